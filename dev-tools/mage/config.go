@@ -153,10 +153,15 @@ func makeConfigTemplate(destination string, mode os.FileMode, confParams ConfigF
 		"BeatLicense":                    BeatLicense,
 		"Reference":                      false,
 		"Docker":                         false,
+		"ExcludeAMQP":                    false,
 		"ExcludeConsole":                 false,
+		"ExcludeFanout":                  false,
 		"ExcludeFileOutput":              false,
+		"ExcludeHTTPOutput":              false,
 		"ExcludeKafka":                   false,
 		"ExcludeLogstash":                false,
+		"ExcludeOTLP":                    false,
+		"ExcludeMQTT":                    false,
 		"ExcludeRedis":                   false,
 		"UseObserverProcessor":           false,
 		"UseDockerMetadataProcessor":     true,
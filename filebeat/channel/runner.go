@@ -39,6 +39,8 @@ type onCreateWrapper func(cfgfile.RunnerFactory, beat.PipelineConnector, *conf.C
 // commonInputConfig defines common input settings
 // for the publisher pipeline.
 type commonInputConfig struct {
+	ID string `config:"id"` // Input ID, identifies the clients of the input.
+
 	// event processing
 	mapstr.EventMetadata `config:",inline"`      // Fields and tags to add to events.
 	Processors           processors.PluginConfig `config:"processors"`
@@ -48,6 +50,10 @@ type commonInputConfig struct {
 		DisableHost bool `config:"disable_host"` // Disable addition of host.name.
 	} `config:"publisher_pipeline"`
 
+	Queue struct {
+		Priority *beat.Priority `config:"priority"` // Memory queue priority class.
+	} `config:"queue"`
+
 	// implicit event fields
 	Type        string `config:"type"`         // input.type
 	ServiceType string `config:"service.type"` // service.type
@@ -79,6 +85,8 @@ func (f *onCreateFactory) Create(pipeline beat.PipelineConnector, cfg *conf.C) (
 //   - *tags*: add additional tags to the events
 //   - *processors*: list of local processors to be added to the processing pipeline
 //   - *keep_null*: keep or remove 'null' from events to be published
+//   - *queue.priority*: priority class of the input's events in the memory queue
+//   - *id*: identifies the clients of the input
 //   - *_module_name* (hidden setting): Add fields describing the module name
 //   - *_ fileset_name* (hidden setting):
 //   - *pipeline*: Configure the ES Ingest Node pipeline name to be used for events from this input
@@ -181,12 +189,18 @@ func newCommonConfigEditor(
 			procs.AddProcessors(*userProcessors)
 		}
 
+		if clientCfg.InputID == "" {
+			clientCfg.InputID = config.ID
+		}
 		clientCfg.Processing.EventMetadata = config.EventMetadata
 		clientCfg.Processing.Meta = meta
 		clientCfg.Processing.Fields = fields
 		clientCfg.Processing.Processor = procs
 		clientCfg.Processing.KeepNull = config.KeepNull
 		clientCfg.Processing.DisableHost = config.PublisherPipeline.DisableHost
+		if config.Queue.Priority != nil {
+			clientCfg.Priority = *config.Queue.Priority
+		}
 
 		return clientCfg, nil
 	}, nil
@@ -159,6 +159,77 @@ func TestProcessorsForConfig(t *testing.T) {
 	}
 }
 
+func TestQueuePriorityForConfig(t *testing.T) {
+	testCases := map[string]struct {
+		configStr string
+		clientCfg beat.ClientConfig
+		expected  beat.Priority
+	}{
+		"default": {
+			expected: beat.PriorityNormal,
+		},
+		"set in input config": {
+			configStr: "queue.priority: high",
+			expected:  beat.PriorityHigh,
+		},
+		"ClientConfig priority is kept if not configured": {
+			clientCfg: beat.ClientConfig{Priority: beat.PriorityLow},
+			expected:  beat.PriorityLow,
+		},
+		"input config overrides ClientConfig": {
+			configStr: "queue.priority: normal",
+			clientCfg: beat.ClientConfig{Priority: beat.PriorityLow},
+			expected:  beat.PriorityNormal,
+		},
+	}
+	for description, test := range testCases {
+		config, err := conf.NewConfigFrom(test.configStr)
+		require.NoError(t, err, description)
+
+		editor, err := newCommonConfigEditor(beat.Info{}, config)
+		require.NoError(t, err, description)
+
+		clientCfg, err := editor(test.clientCfg)
+		require.NoError(t, err, description)
+		assert.Equal(t, test.expected, clientCfg.Priority, description)
+	}
+
+	config, err := conf.NewConfigFrom("queue.priority: urgent")
+	require.NoError(t, err)
+	_, err = newCommonConfigEditor(beat.Info{}, config)
+	assert.Error(t, err, "unknown priorities must be rejected")
+}
+
+func TestInputIDForConfig(t *testing.T) {
+	testCases := map[string]struct {
+		configStr string
+		clientCfg beat.ClientConfig
+		expected  string
+	}{
+		"default": {},
+		"set in input config": {
+			configStr: "id: my-input",
+			expected:  "my-input",
+		},
+		"ClientConfig input ID is kept": {
+			configStr: "id: my-input",
+			clientCfg: beat.ClientConfig{InputID: "my-input-file"},
+			expected:  "my-input-file",
+		},
+	}
+	for description, test := range testCases {
+		config, err := conf.NewConfigFrom(test.configStr)
+		require.NoError(t, err, description)
+
+		editor, err := newCommonConfigEditor(beat.Info{}, config)
+		require.NoError(t, err, description)
+
+		clientCfg, err := editor(test.clientCfg)
+		require.NoError(t, err, description)
+		assert.Equal(t, test.expected, clientCfg.InputID, description)
+	}
+}
+
 func TestProcessorsForConfigIsFlat(t *testing.T) {
 	// This test is regrettable, and exists because of inconsistencies in
 	// processor handling between processors.Processors and processing.group
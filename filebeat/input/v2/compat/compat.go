@@ -155,6 +155,9 @@ func (r *runner) Start() {
 
 		pc := pipetool.WithClientConfigEdit(r.connector,
 			func(orig beat.ClientConfig) (beat.ClientConfig, error) {
+				if orig.InputID == "" {
+					orig.InputID = ctx.ID
+				}
 				orig.ClientListener =
 					v2.NewPipelineClientListener(
 						ctx.MetricsRegistry, orig.ClientListener)
@@ -0,0 +1,285 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	prometheusContentType  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// metricFamily holds the samples of a metric together with its type and
+// help text.
+type metricFamily struct {
+	metricType string
+	help       string
+	samples    []metricSample
+}
+
+// metricSample is a single value of a metric family, with the labels that
+// identify it.
+type metricSample struct {
+	labels string
+	value  string
+}
+
+const (
+	counterType = "counter"
+	gaugeType   = "gauge"
+)
+
+// gaugeComponents are the registry path components that mark an integer
+// metric as a gauge. All other integer metrics are counters.
+//
+// TODO: Replace this with the metric type from where it is defined once the
+// registry has one. See: https://github.com/elastic/beats/issues/5433
+var gaugeComponents = map[string]bool{
+	"active":       true,
+	"clients":      true,
+	"current":      true,
+	"filled":       true,
+	"gc_next":      true,
+	"goroutines":   true,
+	"histogram":    true,
+	"limit":        true,
+	"load":         true,
+	"memory_alloc": true,
+	"memory_sys":   true,
+	"open":         true,
+	"open_files":   true,
+	"pct":          true,
+	"rss":          true,
+	"running":      true,
+	"usage":        true,
+}
+
+// makeMetricsHandler returns a handler that renders the stats registry and
+// the input metrics of the dataset registry in the OpenMetrics text format,
+// or in the Prometheus text format if the client doesn't accept
+// OpenMetrics.
+//
+// Metric names are the dotted registry paths with every character that is
+// not valid in a metric name replaced by '_', e.g. libbeat.pipeline.events.total
+// becomes libbeat_pipeline_events_total. Input metrics are prefixed with
+// input_ and labeled with the ID and type of their input. String values are
+// not exposed.
+//
+// Integer metrics are counters and get a _total suffix, unless their path
+// marks them as a gauge, see isGauge. Float and boolean metrics are gauges.
+// The help text of a metric names its registry path.
+func makeMetricsHandler(stats *monitoring.Registry, dataset *monitoring.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		families := map[string]*metricFamily{}
+		if stats != nil {
+			collectStatsMetrics(families, stats)
+		}
+		if dataset != nil {
+			collectInputMetrics(families, dataset)
+		}
+
+		openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", openMetricsContentType)
+		} else {
+			w.Header().Set("Content-Type", prometheusContentType)
+		}
+		writeMetrics(w, families, openMetrics)
+	}
+}
+
+func collectStatsMetrics(families map[string]*metricFamily, registry *monitoring.Registry) {
+	snapshot := monitoring.CollectFlatSnapshot(registry, monitoring.Full, false)
+	for name, value := range snapshot.Ints {
+		addSample(families, name, intType(name), "", strconv.FormatInt(value, 10))
+	}
+	for name, value := range snapshot.Floats {
+		addSample(families, name, gaugeType, "", formatFloat(value))
+	}
+	for name, value := range snapshot.Bools {
+		addSample(families, name, gaugeType, "", formatBool(value))
+	}
+}
+
+// collectInputMetrics adds the metrics of all registries that have the id
+// and input fields used by the /inputs endpoint.
+func collectInputMetrics(families map[string]*metricFamily, registry *monitoring.Registry) {
+	snapshot := monitoring.CollectStructSnapshot(registry, monitoring.Full, false)
+	for _, value := range snapshot {
+		metrics, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		id, _ := metrics["id"].(string)
+		input, _ := metrics["input"].(string)
+		if id == "" || input == "" {
+			continue
+		}
+		labels := `id="` + escapeLabelValue(id) + `",input="` + escapeLabelValue(input) + `"`
+		for key, value := range metrics {
+			if key == "id" || key == "input" {
+				continue
+			}
+			addInputSample(families, "input."+key, labels, value)
+		}
+	}
+}
+
+func addInputSample(families map[string]*metricFamily, name, labels string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, value := range v {
+			addInputSample(families, name+"."+key, labels, value)
+		}
+	case int64:
+		addSample(families, name, intType(name), labels, strconv.FormatInt(v, 10))
+	case float64:
+		addSample(families, name, gaugeType, labels, formatFloat(v))
+	case bool:
+		addSample(families, name, gaugeType, labels, formatBool(v))
+	}
+}
+
+// addSample adds a sample to the family of the metric at the registry path
+// name. Counter names get a _total suffix.
+func addSample(families map[string]*metricFamily, path, metricType, labels, value string) {
+	name := metricName(path)
+	if metricType == counterType && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	family, ok := families[name]
+	if !ok {
+		family = &metricFamily{metricType: metricType, help: path}
+		families[name] = family
+	}
+	family.samples = append(family.samples, metricSample{labels: labels, value: value})
+}
+
+// intType returns the type of the integer metric at the registry path name.
+func intType(path string) string {
+	if isGauge(path) {
+		return gaugeType
+	}
+	return counterType
+}
+
+// isGauge returns true if the integer metric at the registry path name is
+// a gauge. Metrics are gauges if a component of their path is in
+// gaugeComponents or starts with max_, or if their name ends in _gauge.
+func isGauge(path string) bool {
+	if strings.HasSuffix(path, "_gauge") {
+		return true
+	}
+	for _, component := range strings.Split(path, ".") {
+		if gaugeComponents[component] || strings.HasPrefix(component, "max_") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMetrics(w http.ResponseWriter, families map[string]*metricFamily, openMetrics bool) {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := bufio.NewWriter(w)
+	for _, name := range names {
+		family := families[name]
+		samples := family.samples
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+
+		// OpenMetrics names counter families without the _total suffix of
+		// their samples.
+		familyName := name
+		if openMetrics && family.metricType == counterType {
+			familyName = strings.TrimSuffix(name, "_total")
+		}
+		out.WriteString("# HELP " + familyName + " " + escapeHelp(family.help) + "\n")
+		out.WriteString("# TYPE " + familyName + " " + family.metricType + "\n")
+		for _, sample := range samples {
+			out.WriteString(name)
+			if sample.labels != "" {
+				out.WriteString("{" + sample.labels + "}")
+			}
+			out.WriteString(" " + sample.value + "\n")
+		}
+	}
+	if openMetrics {
+		out.WriteString("# EOF\n")
+	}
+	out.Flush()
+}
+
+// metricName converts a registry path to a valid metric name.
+func metricName(path string) string {
+	var b strings.Builder
+	b.Grow(len(path) + 1)
+	for i, r := range path {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	stats := monitoring.NewRegistry()
+	monitoring.NewInt(stats, "libbeat.pipeline.events.total").Set(42)
+	monitoring.NewUint(stats, "libbeat.pipeline.queue.acked").Set(40)
+	monitoring.NewUint(stats, "libbeat.pipeline.queue.filled.events").Set(2)
+	monitoring.NewFloat(stats, "system.load.1").Set(0.5)
+	monitoring.NewBool(stats, "beat.ok").Set(true)
+	monitoring.NewString(stats, "libbeat.output.type").Set("elasticsearch")
+
+	dataset := monitoring.NewRegistry()
+	for _, input := range []struct{ id, typ string }{
+		{"b", "filestream"},
+		{`my "input"`, "aws-s3"},
+	} {
+		reg := dataset.NewRegistry(input.id)
+		monitoring.NewString(reg, "id").Set(input.id)
+		monitoring.NewString(reg, "input").Set(input.typ)
+		monitoring.NewUint(reg, "events_processed_total").Set(3)
+		monitoring.NewInt(reg, "processing_time.histogram.max").Set(7)
+	}
+	// Registries without an id and input type are not input metrics.
+	monitoring.NewInt(dataset.NewRegistry("other"), "count").Set(1)
+
+	handler := makeMetricsHandler(stats, dataset)
+
+	t.Run("prometheus", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		handler(resp, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, prometheusContentType, resp.Header().Get("Content-Type"))
+		assert.Equal(t, `# HELP beat_ok beat.ok
+# TYPE beat_ok gauge
+beat_ok 1
+# HELP input_events_processed_total input.events_processed_total
+# TYPE input_events_processed_total counter
+input_events_processed_total{id="b",input="filestream"} 3
+input_events_processed_total{id="my \"input\"",input="aws-s3"} 3
+# HELP input_processing_time_histogram_max input.processing_time.histogram.max
+# TYPE input_processing_time_histogram_max gauge
+input_processing_time_histogram_max{id="b",input="filestream"} 7
+input_processing_time_histogram_max{id="my \"input\"",input="aws-s3"} 7
+# HELP libbeat_pipeline_events_total libbeat.pipeline.events.total
+# TYPE libbeat_pipeline_events_total counter
+libbeat_pipeline_events_total 42
+# HELP libbeat_pipeline_queue_acked_total libbeat.pipeline.queue.acked
+# TYPE libbeat_pipeline_queue_acked_total counter
+libbeat_pipeline_queue_acked_total 40
+# HELP libbeat_pipeline_queue_filled_events libbeat.pipeline.queue.filled.events
+# TYPE libbeat_pipeline_queue_filled_events gauge
+libbeat_pipeline_queue_filled_events 2
+# HELP system_load_1 system.load.1
+# TYPE system_load_1 gauge
+system_load_1 0.5
+`, resp.Body.String())
+	})
+
+	t.Run("openmetrics", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+		resp := httptest.NewRecorder()
+		handler(resp, req)
+
+		assert.Equal(t, openMetricsContentType, resp.Header().Get("Content-Type"))
+		body := resp.Body.String()
+		assert.Contains(t, body, "# TYPE libbeat_pipeline_events counter\nlibbeat_pipeline_events_total 42\n",
+			"counter families should be named without the _total suffix")
+		assert.Contains(t, body, "# TYPE libbeat_pipeline_queue_acked counter\nlibbeat_pipeline_queue_acked_total 40\n")
+		assert.Contains(t, body, "# TYPE system_load_1 gauge\n")
+		assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+	})
+}
+
+func TestIsGauge(t *testing.T) {
+	tests := map[string]bool{
+		"libbeat.pipeline.events.total":        false,
+		"libbeat.output.events.acked":          false,
+		"libbeat.pipeline.events.active":       true,
+		"libbeat.pipeline.queue.filled.events": true,
+		"libbeat.pipeline.queue.max_events":    true,
+		"beat.memstats.rss":                    true,
+		"input.processing_time.histogram.p99":  true,
+		"input.queue_size_gauge":               true,
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, isGauge(path), path)
+	}
+}
+
+func TestMetricName(t *testing.T) {
+	tests := map[string]string{
+		"libbeat.pipeline.events.total": "libbeat_pipeline_events_total",
+		"input.route-a.bytes":           "input_route_a_bytes",
+		"1m":                            "_1m",
+		"a:b":                           "a:b",
+	}
+	for path, want := range tests {
+		assert.Equal(t, want, metricName(path), path)
+	}
+}
@@ -18,6 +18,8 @@
 package beat
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -47,8 +49,17 @@ type Client interface {
 type ClientConfig struct {
 	PublishMode PublishMode
 
+	// Priority selects the queue priority class of the client's events.
+	// Queues that don't support priority classes ignore it.
+	Priority Priority
+
 	Processing ProcessingConfig
 
+	// InputID identifies the input instance the client publishes events
+	// for. It is optional, it is used to select tapped events and is passed
+	// to the processors emitting events.
+	InputID string
+
 	// WaitClose sets the maximum duration to wait on ACK, if client still has events
 	// active non-acknowledged events in the publisher pipeline.
 	// WaitClose is only effective if one of ACKCount, ACKEvents and ACKLastEvents
@@ -171,6 +182,53 @@ const (
 	DropIfFull
 )
 
+// Priority enum sets the priority class of a client connection. When the
+// queue is full, producers with a higher priority are admitted first.
+type Priority int8
+
+const (
+	// PriorityLow is for bulk data that can wait while the queue is full.
+	PriorityLow Priority = -1
+
+	// PriorityNormal is the default priority.
+	PriorityNormal Priority = 0
+
+	// PriorityHigh is for events that should not be delayed by other
+	// producers filling up the queue.
+	PriorityHigh Priority = 1
+)
+
+// Priorities lists all priority classes from highest to lowest.
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("priority(%d)", int8(p))
+	}
+}
+
+// Unpack implements config.StringUnpacker.
+func (p *Priority) Unpack(s string) error {
+	switch strings.ToLower(s) {
+	case "low":
+		*p = PriorityLow
+	case "normal", "":
+		*p = PriorityNormal
+	case "high":
+		*p = PriorityHigh
+	default:
+		return fmt.Errorf("invalid priority '%s', must be one of high, normal or low", s)
+	}
+	return nil
+}
+
 type CombinedClientListener struct {
 	A, B ClientListener
 }
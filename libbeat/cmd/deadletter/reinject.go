@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/internal/republish"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
+)
+
+// GenReinjectCmd publishes the events stored in dead letter files through
+// the configured output.
+func GenReinjectCmd(settings instance.Settings) *cobra.Command {
+	var configuredIndex bool
+	var timeout time.Duration
+	command := &cobra.Command{
+		Use:   "reinject FILE...",
+		Short: "Publish the events in dead letter files to the configured output",
+		Long: "Publish the events in the dead letter files written by the Elasticsearch " +
+			"output's dead_letter_file policy to the configured output, e.g. once the " +
+			"mapping conflict that caused them to be rejected has been fixed. Events are " +
+			"sent through an in-memory queue and are not processed again. Only the records " +
+			"that are in a file when the command starts are read. The files are not " +
+			"modified, remove them once all events have been acknowledged.",
+		Args: cobra.MinimumNArgs(1),
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, err := instance.NewInitializedBeat(settings)
+			if err != nil {
+				return fmt.Errorf("error initializing beat: %w", err)
+			}
+			logger := b.Info.Logger.Named("dead-letter-reinject")
+
+			invalid := 0
+			acked, total, err := republish.Publish(b, logger, timeout, func(publish func(beat.Event)) error {
+				for _, path := range args {
+					err := forEachRecord(path, func(line int, record *elasticsearch.DeadLetterRecord, err error) {
+						var event beat.Event
+						if err == nil {
+							event, err = record.BeatEvent()
+						}
+						if err != nil {
+							invalid++
+							fmt.Fprintf(cmd.ErrOrStderr(), "%s:%d: %v\n", path, line, err)
+							return
+						}
+						if !configuredIndex {
+							restoreIndex(&event, record)
+						}
+						publish(event)
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			fmt.Fprintf(cmd.OutOrStdout(), "%d of %d events acknowledged\n", acked, total)
+			if err == nil && invalid > 0 {
+				err = fmt.Errorf("%d invalid records were skipped", invalid)
+			}
+			return err
+		}),
+	}
+	command.Flags().BoolVar(&configuredIndex, "configured-index", false,
+		"Select the index and ingest pipeline with the output settings instead of using the ones the events were rejected from")
+	command.Flags().DurationVar(&timeout, "timeout", 0,
+		"Maximum time to wait for the output to acknowledge all events, 0 waits forever")
+	return command
+}
+
+// forEachRecord decodes the records of a dead letter file and calls fn for
+// each of them, with the error if a line can't be decoded. Lines appended
+// after the file was opened are ignored, the file may still be written to.
+func forEachRecord(path string, fn func(line int, record *elasticsearch.DeadLetterRecord, err error)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(io.LimitReader(f, stat.Size()))
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			var record elasticsearch.DeadLetterRecord
+			decodeErr := json.Unmarshal(data, &record)
+			fn(line, &record, decodeErr)
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// restoreIndex makes the event go to the index and ingest pipeline it was
+// rejected from.
+func restoreIndex(event *beat.Event, record *elasticsearch.DeadLetterRecord) {
+	if record.Index == "" {
+		return
+	}
+	// The alias and the data stream name take precedence over the raw index.
+	_ = event.Meta.Delete(events.FieldMetaAlias)
+	_ = event.Meta.Delete(events.FieldMetaIndex)
+	event.PutValue("@metadata."+events.FieldMetaRawIndex, record.Index)
+	if record.Pipeline != "" {
+		event.PutValue("@metadata."+events.FieldMetaPipeline, record.Pipeline)
+	}
+}
@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deadletter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestForEachRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "elasticsearch-20240101.ndjson")
+	content := `{"@timestamp":"2024-01-01T00:00:00Z","index":"logs","event":{"message":"a"},"error":{"status":400}}
+
+not json
+{"@timestamp":"2024-01-01T00:00:01Z","index":"logs","event":{"message":"b"},"error":{"status":400}}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	var lines []int
+	var invalid []int
+	err := forEachRecord(path, func(line int, record *elasticsearch.DeadLetterRecord, err error) {
+		if err != nil {
+			invalid = append(invalid, line)
+			return
+		}
+		lines = append(lines, line)
+		assert.Equal(t, "logs", record.Index)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 4}, lines)
+	assert.Equal(t, []int{3}, invalid)
+}
+
+func TestRestoreIndex(t *testing.T) {
+	record := &elasticsearch.DeadLetterRecord{
+		Index:    "logs-app-default",
+		Pipeline: "app",
+		Meta:     mapstr.M{"index": "logs", "alias": "logs-alias", "id": "1"},
+		Event:    []byte(`{"message":"a"}`),
+	}
+	event, err := record.BeatEvent()
+	require.NoError(t, err)
+
+	restoreIndex(&event, record)
+	assert.Equal(t, mapstr.M{
+		"id":        "1",
+		"raw_index": "logs-app-default",
+		"pipeline":  "app",
+	}, event.Meta)
+}
@@ -66,6 +66,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 	"github.com/elastic/beats/v7/libbeat/version"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -101,6 +102,10 @@ type Beat struct {
 
 	InputQueueSize int // Size of the producer queue used by most queues.
 
+	// tap is served by the /tap endpoint of the HTTP API, it is nil if the
+	// API is disabled.
+	tap *tap.Hub
+
 	// shouldReexec is a flag to indicate the Beat should restart
 	shouldReexec bool
 }
@@ -483,6 +488,7 @@ func NewBeatReceiver(settings Settings, receiverConfig map[string]interface{}, u
 		Telemetry: tel,
 		Logger:    logger.Named("publisher"),
 		Tracer:    b.Instrumentation.Tracer(),
+		Tap:       b.tap,
 	}
 
 	outputFactory := b.makeOutputFactory(b.Config.Output)
@@ -676,6 +682,10 @@ func (b *Beat) launch(settings Settings, bt beat.Creator) error {
 		if err != nil {
 			return fmt.Errorf("could not start the HTTP server for the API: %w", err)
 		}
+		b.tap = tap.NewHub()
+		if err := b.API.AttachHandler("/tap", tap.Handler(b.tap)); err != nil {
+			return fmt.Errorf("could not attach the tap endpoint: %w", err)
+		}
 		b.API.Start()
 		defer func() {
 			_ = b.API.Stop()
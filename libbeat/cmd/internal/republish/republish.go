@@ -0,0 +1,150 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package republish publishes events that were stored outside of the
+// running pipeline, e.g. in a disk queue directory or a dead letter file,
+// through the configured output of a beat.
+package republish
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Publish loads the configured output of the beat and calls fn with a
+// function that publishes an event to it. Events are sent through an
+// in-memory queue and are not processed again. Once fn returns, Publish
+// waits for the output to acknowledge all published events, or until the
+// timeout expires if it is not 0. The counts of acknowledged and published
+// events are also returned when fn fails.
+func Publish(
+	b *instance.Beat,
+	logger *logp.Logger,
+	timeout time.Duration,
+	fn func(publish func(beat.Event)) error,
+) (acked int, published int, err error) {
+	if !b.Config.Output.IsSet() || !b.Config.Output.Config().Enabled() {
+		return 0, 0, errors.New("no output is configured")
+	}
+
+	out, err := outputs.Load(b.IdxSupporter, b.Info, nil, b.Config.Output.Name(), b.Config.Output.Config())
+	if err != nil {
+		return 0, 0, fmt.Errorf("error initializing output: %w", err)
+	}
+	// Never use a disk queue configured under the output, it could point
+	// to the directory that is being replayed.
+	out.QueueFactory = nil
+	for i := range out.Routes {
+		out.Routes[i].Group.QueueFactory = nil
+	}
+
+	p, err := pipeline.New(
+		b.Info,
+		pipeline.Monitors{Logger: logger},
+		config.Namespace{},
+		out,
+		pipeline.Settings{},
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error initializing publisher: %w", err)
+	}
+	defer p.Close()
+
+	tracker := newTracker()
+	client, err := p.ConnectWith(beat.ClientConfig{
+		PublishMode:   beat.GuaranteedSend,
+		EventListener: acker.RawCounting(tracker.ack),
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("error connecting to publisher: %w", err)
+	}
+	defer client.Close()
+
+	err = fn(func(event beat.Event) {
+		tracker.addPublished()
+		client.Publish(event)
+	})
+	acked, published, waitErr := tracker.wait(timeout)
+	if err != nil {
+		return acked, published, errors.Join(err, waitErr)
+	}
+	return acked, published, waitErr
+}
+
+// tracker counts published and acknowledged events.
+type tracker struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	published int
+	acked     int
+	timedOut  bool
+}
+
+func newTracker() *tracker {
+	t := &tracker{}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *tracker) addPublished() {
+	t.mu.Lock()
+	t.published++
+	t.mu.Unlock()
+}
+
+func (t *tracker) ack(n int) {
+	t.mu.Lock()
+	t.acked += n
+	t.cond.Broadcast()
+	t.mu.Unlock()
+}
+
+// wait blocks until all published events are acknowledged or the
+// timeout expires.
+func (t *tracker) wait(timeout time.Duration) (acked, published int, err error) {
+	if timeout > 0 {
+		// The flag is set and the waiter woken up while holding the lock,
+		// so the wakeup can't be lost between the check and Wait.
+		timer := time.AfterFunc(timeout, func() {
+			t.mu.Lock()
+			t.timedOut = true
+			t.cond.Broadcast()
+			t.mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.acked < t.published {
+		if t.timedOut {
+			return t.acked, t.published, errors.New("timed out waiting for the output")
+		}
+		t.cond.Wait()
+	}
+	return t.acked, t.published, nil
+}
@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package republish
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerWait(t *testing.T) {
+	t.Run("all acked", func(t *testing.T) {
+		tr := newTracker()
+		tr.addPublished()
+		tr.addPublished()
+		go tr.ack(2)
+
+		acked, published, err := tr.wait(0)
+		require.NoError(t, err)
+		assert.Equal(t, 2, acked)
+		assert.Equal(t, 2, published)
+	})
+
+	t.Run("timeout without acks", func(t *testing.T) {
+		tr := newTracker()
+		tr.addPublished()
+
+		done := make(chan struct{})
+		var acked, published int
+		var err error
+		go func() {
+			defer close(done)
+			acked, published, err = tr.wait(10 * time.Millisecond)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("wait didn't return after the timeout")
+		}
+		assert.Error(t, err)
+		assert.Equal(t, 0, acked)
+		assert.Equal(t, 1, published)
+	})
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenDumpCmd writes the events stored in the disk queue to stdout as
+// NDJSON.
+func GenDumpCmd(settings instance.Settings) *cobra.Command {
+	flags := &queueFlags{}
+	var includeAcked bool
+	command := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump the events in the disk queue as NDJSON",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, queueSettings, err := initQueue(settings, flags)
+			if err != nil {
+				return err
+			}
+			encoder := json.New(b.Info.Version, json.Config{})
+			return forEachEvent(queueSettings, flags, includeAcked,
+				func(_ diskqueue.SegmentInfo, frame diskqueue.Frame) error {
+					serialized, err := encoder.Encode(b.Info.Beat, &frame.Event.Content)
+					if err != nil {
+						return fmt.Errorf("error encoding event: %w", err)
+					}
+					out := cmd.OutOrStdout()
+					if _, err := out.Write(serialized); err != nil {
+						return err
+					}
+					_, err = io.WriteString(out, "\n")
+					return err
+				})
+		}),
+	}
+	flags.register(command)
+	command.Flags().BoolVar(&includeAcked, "include-acked", false,
+		"Include events that were already acknowledged by the output")
+	return command
+}
+
+// forEachEvent calls fn for every valid frame of the selected segments,
+// skipping frames before the ACK position unless includeAcked is set.
+// Corrupted segments are reported on stderr and processing continues with
+// the next segment.
+func forEachEvent(
+	settings diskqueue.Settings,
+	flags *queueFlags,
+	includeAcked bool,
+	fn func(diskqueue.SegmentInfo, diskqueue.Frame) error,
+) error {
+	position, _, err := readPosition(settings)
+	if err != nil {
+		return err
+	}
+	segments, err := diskqueue.ListSegments(settings)
+	if segments == nil && err != nil {
+		return err
+	}
+	for _, segment := range segments {
+		if !flags.selected(segment.ID) {
+			continue
+		}
+		if !includeAcked && segment.ID < position.SegmentID {
+			// Fully acknowledged segments are only left behind if the
+			// queue was stopped before it could delete them.
+			continue
+		}
+		result, err := diskqueue.ScanSegment(settings, segment,
+			func(frame diskqueue.Frame) error {
+				if !includeAcked && position.Acked(segment.ID, frame.Index) {
+					return nil
+				}
+				return fn(segment, frame)
+			})
+		if err != nil {
+			return fmt.Errorf("segment %d: %w", segment.ID, err)
+		}
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr,
+				"segment %d is corrupted after frame %d: %v\n",
+				segment.ID, result.Frames, result.Err)
+		}
+	}
+	return nil
+}
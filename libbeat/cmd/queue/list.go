@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenListCmd lists the segments of the disk queue and its ACK position.
+func GenListCmd(settings instance.Settings) *cobra.Command {
+	flags := &queueFlags{}
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "List disk queue segments and the ACK position",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			_, queueSettings, err := initQueue(settings, flags)
+			if err != nil {
+				return err
+			}
+			return listSegments(cmd.OutOrStdout(), queueSettings, flags)
+		}),
+	}
+	flags.register(command)
+	return command
+}
+
+func listSegments(out io.Writer, settings diskqueue.Settings, flags *queueFlags) error {
+	position, hasPosition, err := readPosition(settings)
+	if err != nil {
+		return err
+	}
+	if hasPosition {
+		fmt.Fprintf(out, "ACK position: segment %d, frame %d, byte %d\n",
+			position.SegmentID, position.FrameIndex, position.ByteIndex)
+	} else {
+		fmt.Fprintln(out, "ACK position: no state file")
+	}
+
+	segments, err := diskqueue.ListSegments(settings)
+	if segments == nil && err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tVERSION\tOPTIONS\tFRAMES\tSIZE\tPATH")
+	for _, segment := range segments {
+		if !flags.selected(segment.ID) {
+			continue
+		}
+		options := strings.Join(segment.OptionNames(), ",")
+		if options == "" {
+			options = "-"
+		}
+		frames := fmt.Sprint(segment.FrameCount)
+		if segment.FrameCount == 0 {
+			// The frame count is only written when a segment is closed.
+			frames = "unknown"
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%s\n",
+			segment.ID, segment.Version, options, frames, segment.Size, segment.Path)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	// Segments with unreadable headers are still listed, but the error
+	// is reported.
+	return err
+}
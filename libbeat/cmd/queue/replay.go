@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/internal/republish"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenReplayCmd publishes the events stored in a disk queue directory
+// through the configured output.
+func GenReplayCmd(settings instance.Settings) *cobra.Command {
+	flags := &queueFlags{}
+	var includeAcked bool
+	var timeout time.Duration
+	command := &cobra.Command{
+		Use:   "replay",
+		Short: "Publish the events in a disk queue directory to the configured output",
+		Long: "Publish the events in a disk queue directory to the configured output, " +
+			"e.g. to recover the queue of a decommissioned host. Events are sent through " +
+			"an in-memory queue and are not processed again. The directory is not " +
+			"modified, remove it once all events have been acknowledged. The beat must " +
+			"not be running on the replayed directory.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			b, queueSettings, err := initQueue(settings, flags)
+			if err != nil {
+				return err
+			}
+			acked, total, err := replay(b, queueSettings, flags, includeAcked, timeout)
+			fmt.Fprintf(cmd.OutOrStdout(), "%d of %d events acknowledged\n", acked, total)
+			return err
+		}),
+	}
+	flags.register(command)
+	command.Flags().BoolVar(&includeAcked, "include-acked", false,
+		"Also replay events that were already acknowledged by the output")
+	command.Flags().DurationVar(&timeout, "timeout", 0,
+		"Maximum time to wait for the output to acknowledge all events, 0 waits forever")
+	return command
+}
+
+func replay(
+	b *instance.Beat,
+	settings diskqueue.Settings,
+	flags *queueFlags,
+	includeAcked bool,
+	timeout time.Duration,
+) (int, int, error) {
+	logger := b.Info.Logger.Named("queue-replay")
+	return republish.Publish(b, logger, timeout, func(publish func(beat.Event)) error {
+		return forEachEvent(settings, flags, includeAcked,
+			func(_ diskqueue.SegmentInfo, frame diskqueue.Frame) error {
+				publish(frame.Event.Content)
+				return nil
+			})
+	})
+}
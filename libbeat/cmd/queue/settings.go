@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// queueFlags holds the flags shared by all queue subcommands.
+type queueFlags struct {
+	path     string
+	segments []uint
+}
+
+func (f *queueFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.path, "path", "",
+		"Queue directory, defaults to the configured disk queue path")
+	cmd.Flags().UintSliceVar(&f.segments, "segment", nil,
+		"Only process the given segment IDs (can be repeated)")
+}
+
+// selected reports whether the given segment was selected with --segment.
+func (f *queueFlags) selected(id uint64) bool {
+	if len(f.segments) == 0 {
+		return true
+	}
+	for _, s := range f.segments {
+		if uint64(s) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// initQueue initializes the beat and returns the disk queue settings
+// from its configuration. The disk queue can be configured globally or
+// under the output, if neither is set the defaults are used so a queue
+// directory can still be inspected with --path.
+func initQueue(settings instance.Settings, flags *queueFlags) (*instance.Beat, diskqueue.Settings, error) {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return nil, diskqueue.Settings{}, fmt.Errorf("error initializing beat: %w", err)
+	}
+
+	queueConfig := b.Config.Pipeline.Queue
+	if b.Config.Output.IsSet() && b.Config.Output.Config().HasField("queue") {
+		outputQueue := config.Namespace{}
+		sub, err := b.Config.Output.Config().Child("queue", -1)
+		if err == nil {
+			err = sub.Unpack(&outputQueue)
+		}
+		if err != nil {
+			return nil, diskqueue.Settings{}, fmt.Errorf("error reading output queue config: %w", err)
+		}
+		if outputQueue.IsSet() {
+			queueConfig = outputQueue
+		}
+	}
+
+	queueSettings := diskqueue.DefaultSettings()
+	if queueConfig.Name() == diskqueue.QueueType {
+		queueSettings, err = diskqueue.SettingsForUserConfig(queueConfig.Config())
+		if err != nil {
+			return nil, diskqueue.Settings{}, err
+		}
+	}
+	if flags.path != "" {
+		queueSettings.Path = flags.path
+	}
+	return b, queueSettings, nil
+}
+
+// readPosition returns the ACK position of the queue. A missing state
+// file means nothing has been acknowledged yet.
+func readPosition(settings diskqueue.Settings) (diskqueue.Position, bool, error) {
+	position, err := diskqueue.ReadPosition(settings)
+	if errors.Is(err, os.ErrNotExist) {
+		return diskqueue.Position{}, false, nil
+	}
+	if err != nil {
+		return diskqueue.Position{}, false, fmt.Errorf("error reading queue state file: %w", err)
+	}
+	return position, true, nil
+}
@@ -0,0 +1,119 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+)
+
+// GenVerifyCmd verifies the frame checksums of all disk queue segments
+// and optionally repairs corrupted segments.
+func GenVerifyCmd(settings instance.Settings) *cobra.Command {
+	flags := &queueFlags{}
+	var truncate, quarantine bool
+	command := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify disk queue segments and repair corrupted ones",
+		Long: "Verify the frame checksums of the disk queue segments. With --truncate " +
+			"corrupted segments are cut back to their last valid frame, with --quarantine " +
+			"they are moved to the '" + diskqueue.QuarantineDirectory + "' directory. " +
+			"In both cases the original segment is kept in the quarantine directory. " +
+			"The beat must not be running while segments are repaired.",
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			if truncate && quarantine {
+				return errors.New("--truncate and --quarantine can't be used together")
+			}
+			_, queueSettings, err := initQueue(settings, flags)
+			if err != nil {
+				return err
+			}
+			return verifySegments(cmd.OutOrStdout(), queueSettings, flags, truncate, quarantine)
+		}),
+	}
+	flags.register(command)
+	command.Flags().BoolVar(&truncate, "truncate", false,
+		"Truncate corrupted segments after their last valid frame")
+	command.Flags().BoolVar(&quarantine, "quarantine", false,
+		"Move corrupted segments to the quarantine directory")
+	return command
+}
+
+func verifySegments(
+	out io.Writer,
+	settings diskqueue.Settings,
+	flags *queueFlags,
+	truncate, quarantine bool,
+) error {
+	segments, err := diskqueue.ListSegments(settings)
+	if segments == nil && err != nil {
+		return err
+	}
+
+	corrupted := 0
+	for _, segment := range segments {
+		if !flags.selected(segment.ID) {
+			continue
+		}
+		result, err := diskqueue.ScanSegment(settings, segment, nil)
+		if err == nil && result.Err == nil {
+			fmt.Fprintf(out, "segment %d: ok, %d frames\n", segment.ID, result.Frames)
+			continue
+		}
+		if err != nil {
+			// The segment can't be read at all, e.g. because of a broken
+			// header or a missing encryption key.
+			fmt.Fprintf(out, "segment %d: unreadable: %v\n", segment.ID, err)
+			if !quarantine {
+				corrupted++
+				continue
+			}
+		} else {
+			fmt.Fprintf(out, "segment %d: corrupted after %d valid frames (offset %d): %v\n",
+				segment.ID, result.Frames, result.ValidSize, result.Err)
+		}
+
+		switch {
+		case quarantine:
+			path, err := diskqueue.QuarantineSegment(settings, segment)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "segment %d: moved to %s\n", segment.ID, path)
+		case truncate:
+			result, err := diskqueue.TruncateSegment(settings, segment)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "segment %d: truncated to %d frames\n", segment.ID, result.Frames)
+		default:
+			corrupted++
+		}
+	}
+	if corrupted > 0 {
+		return fmt.Errorf("found %d corrupted segments", corrupted)
+	}
+	return nil
+}
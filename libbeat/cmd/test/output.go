@@ -47,7 +47,11 @@ func GenTestOutputCmd(settings instance.Settings) *cobra.Command {
 				os.Exit(1)
 			}
 
-			for _, client := range output.Clients {
+			clients := output.Clients
+			for _, route := range output.Routes {
+				clients = append(clients, route.Group.Clients...)
+			}
+			for _, client := range clients {
 				tClient, ok := client.(testing.Testable)
 				if !ok {
 					fmt.Printf("%s output doesn't support testing\n", b.Config.Output.Name()) //nolint:forbidigo //output to stderr before exiting
@@ -0,0 +1,335 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package amqp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	amqp091 "github.com/rabbitmq/amqp091-go"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+const defaultConfirmBuffer = 2048
+
+var (
+	errNotConnected  = errors.New("amqp client is not connected")
+	errChannelClosed = errors.New("amqp channel closed while waiting for publisher confirms")
+)
+
+// amqpChannel is the part of an AMQP channel that is used to publish
+// events.
+type amqpChannel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error
+}
+
+// session is an open channel in confirm mode.
+type session struct {
+	conn     io.Closer
+	channel  amqpChannel
+	confirms <-chan amqp091.Confirmation
+	// nextTag is the delivery tag the broker assigns to the next published
+	// message. Tags start at 1 when the channel is put in confirm mode.
+	nextTag uint64
+}
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	url      string
+	// host is the redacted URL of the broker.
+	host    string
+	config  amqp091.Config
+	dial    func(context.Context) (*session, error)
+	session *session
+
+	exchange        string
+	exchangeDeclare exchangeDeclareConfig
+	routingKey      *fmtstr.EventFormatString
+	deliveryMode    uint8
+	contentType     string
+	timeout         time.Duration
+	confirmBuffer   int
+	index           string
+	codec           codec.Codec
+}
+
+// pendingEvent is a published event that has not been confirmed yet.
+type pendingEvent struct {
+	event publisher.Event
+	tag   uint64
+}
+
+func newClient(
+	observer outputs.Observer,
+	url string,
+	config amqpConfig,
+	tlsConfig *tlscommon.TLSConfig,
+	index string,
+	codec codec.Codec,
+	logger *logp.Logger,
+) (*client, error) {
+	uri, err := amqp091.ParseURI(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amqp host '%s': %w", url, err)
+	}
+
+	amqpConfig := amqp091.Config{
+		Vhost:     config.VHost,
+		Heartbeat: config.Heartbeat,
+		Locale:    "en_US",
+		Dial:      amqp091.DefaultDial(config.Timeout),
+	}
+	if config.Username != "" {
+		amqpConfig.SASL = []amqp091.Authentication{
+			&amqp091.PlainAuth{Username: config.Username, Password: config.Password},
+		}
+	}
+	if tlsConfig != nil {
+		if uri.Scheme != "amqps" {
+			return nil, fmt.Errorf("amqp host '%s' must use the amqps scheme when ssl is enabled", url)
+		}
+		amqpConfig.TLSClientConfig = tlsConfig.BuildModuleClientConfig(uri.Host)
+	}
+
+	deliveryMode := amqp091.Transient
+	if config.Persistent {
+		deliveryMode = amqp091.Persistent
+	}
+	confirmBuffer := config.BulkMaxSize
+	if confirmBuffer <= 0 {
+		confirmBuffer = defaultConfirmBuffer
+	}
+
+	c := &client{
+		log:             logger.Named("amqp"),
+		observer:        observer,
+		url:             url,
+		host:            redactURL(url),
+		config:          amqpConfig,
+		exchange:        config.Exchange,
+		exchangeDeclare: config.ExchangeDeclare,
+		routingKey:      config.RoutingKey,
+		deliveryMode:    deliveryMode,
+		contentType:     config.ContentType,
+		timeout:         config.Timeout,
+		confirmBuffer:   confirmBuffer,
+		index:           strings.ToLower(index),
+		codec:           codec,
+	}
+	c.dial = c.dialAMQP
+	return c, nil
+}
+
+// dialAMQP opens a connection and a channel in confirm mode.
+func (c *client) dialAMQP(_ context.Context) (*session, error) {
+	conn, err := amqp091.DialConfig(c.url, c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err == nil && c.exchangeDeclare.Enabled {
+		err = ch.ExchangeDeclare(c.exchange, c.exchangeDeclare.Kind,
+			c.exchangeDeclare.Durable, c.exchangeDeclare.AutoDelete, false, false, nil)
+		if err != nil {
+			err = fmt.Errorf("failed to declare exchange '%s': %w", c.exchange, err)
+		}
+	}
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &session{
+		conn:     conn,
+		channel:  ch,
+		confirms: ch.NotifyPublish(make(chan amqp091.Confirmation, c.confirmBuffer)),
+		nextTag:  1,
+	}, nil
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	c.log.Debug("connect")
+	s, err := c.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to amqp broker: %w", err)
+	}
+	c.session = s
+	return nil
+}
+
+func (c *client) Close() error {
+	c.log.Debug("close connection")
+	if c.session == nil {
+		return nil
+	}
+	err := c.session.conn.Close()
+	c.session = nil
+	if errors.Is(err, amqp091.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *client) String() string {
+	return "amqp(" + c.host + ")"
+}
+
+// redactURL hides the password of the URL, so it does not end up in logs.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// Publish publishes all events of the batch to the exchange and waits for
+// the broker to confirm them. Events that are nacked by the broker, or are
+// not confirmed within the timeout, are retried.
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	s := c.session
+	if s == nil {
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return errNotConnected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var failed []publisher.Event
+	var lastErr error
+	pending := make([]pendingEvent, 0, len(events))
+	dropped := 0
+	for i := range events {
+		event := &events[i]
+		if lastErr != nil {
+			// The channel is unusable after a failed publish, retry the
+			// rest of the batch after reconnecting.
+			failed = append(failed, *event)
+			continue
+		}
+
+		key := ""
+		if c.routingKey != nil {
+			var err error
+			key, err = c.routingKey.Run(&event.Content)
+			if err != nil {
+				c.log.Errorf("Dropping event: failed to select routing key: %+v", err)
+				dropped++
+				continue
+			}
+		}
+
+		serializedEvent, err := c.codec.Encode(c.index, &event.Content)
+		if err != nil {
+			c.log.Errorf("Encoding event failed with error: %+v. Look at the event log file to view the event", err)
+			c.log.Errorw(fmt.Sprintf("Failed event: %v", event.Content), logp.TypeKey, logp.EventType)
+			dropped++
+			continue
+		}
+		body := make([]byte, len(serializedEvent))
+		copy(body, serializedEvent)
+
+		err = s.channel.PublishWithContext(ctx, c.exchange, key, false, false, amqp091.Publishing{
+			ContentType:  c.contentType,
+			DeliveryMode: c.deliveryMode,
+			Timestamp:    event.Content.Timestamp,
+			Body:         body,
+		})
+		if err != nil {
+			lastErr = err
+			c.observer.WriteError(err)
+			failed = append(failed, *event)
+			continue
+		}
+		c.observer.WriteBytes(len(body))
+		pending = append(pending, pendingEvent{event: *event, tag: s.nextTag})
+		s.nextTag++
+	}
+	if dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+
+	begin := time.Now()
+	nacked := 0
+	for i, p := range pending {
+		ack, err := waitConfirm(ctx, s.confirms, p.tag)
+		if err != nil {
+			lastErr = err
+			for _, rest := range pending[i:] {
+				failed = append(failed, rest.event)
+			}
+			break
+		}
+		if !ack {
+			nacked++
+			failed = append(failed, p.event)
+		}
+	}
+	c.observer.ReportLatency(time.Since(begin))
+	c.observer.AckedEvents(len(events) - dropped - len(failed))
+
+	if len(failed) > 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("broker rejected %d events", nacked)
+		}
+		c.observer.RetryableErrors(len(failed))
+		batch.RetryEvents(failed)
+		return lastErr
+	}
+	batch.ACK()
+	return nil
+}
+
+// waitConfirm waits for the publisher confirm of the message with the
+// given delivery tag. Confirms arrive in the order of their delivery tags.
+func waitConfirm(ctx context.Context, confirms <-chan amqp091.Confirmation, tag uint64) (bool, error) {
+	select {
+	case confirm, ok := <-confirms:
+		if !ok {
+			return false, errChannelClosed
+		}
+		if confirm.DeliveryTag != tag {
+			return false, fmt.Errorf("unexpected publisher confirm for delivery tag %d, expected %d",
+				confirm.DeliveryTag, tag)
+		}
+		return confirm.Ack, nil
+	case <-ctx.Done():
+		return false, fmt.Errorf("timeout waiting for publisher confirms: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package amqp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+type amqpConfig struct {
+	Username string `config:"username"`
+	Password string `config:"password"`
+	VHost    string `config:"vhost"`
+
+	Exchange        string                    `config:"exchange"`
+	ExchangeDeclare exchangeDeclareConfig     `config:"exchange_declare"`
+	RoutingKey      *fmtstr.EventFormatString `config:"routing_key"`
+	// Persistent publishes messages with the persistent delivery mode, so
+	// they survive broker restarts in durable queues.
+	Persistent  bool   `config:"persistent"`
+	ContentType string `config:"content_type"`
+
+	Heartbeat time.Duration `config:"heartbeat" validate:"min=0"`
+	// Timeout bounds connecting to the broker and waiting for the
+	// publisher confirms of a batch.
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+
+	TLS   *tlscommon.Config `config:"ssl"`
+	Codec codec.Config      `config:"codec"`
+
+	LoadBalance bool             `config:"loadbalance"`
+	BulkMaxSize int              `config:"bulk_max_size"`
+	MaxRetries  int              `config:"max_retries"`
+	Backoff     backoff          `config:"backoff"`
+	Queue       config.Namespace `config:"queue"`
+}
+
+// exchangeDeclareConfig configures declaring the exchange on connect.
+type exchangeDeclareConfig struct {
+	Enabled    bool   `config:"enabled"`
+	Kind       string `config:"kind"`
+	Durable    bool   `config:"durable"`
+	AutoDelete bool   `config:"auto_delete"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() amqpConfig {
+	return amqpConfig{
+		ExchangeDeclare: exchangeDeclareConfig{
+			Kind:    "topic",
+			Durable: true,
+		},
+		Persistent:  true,
+		ContentType: "application/json",
+		Heartbeat:   10 * time.Second,
+		Timeout:     30 * time.Second,
+		LoadBalance: true,
+		BulkMaxSize: 2048,
+		MaxRetries:  3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+}
+
+func (c *amqpConfig) Validate() error {
+	if c.ExchangeDeclare.Enabled {
+		if c.Exchange == "" {
+			return errors.New("the default exchange can not be declared, set exchange")
+		}
+		switch c.ExchangeDeclare.Kind {
+		case "direct", "fanout", "topic", "headers":
+		default:
+			return fmt.Errorf("unsupported exchange kind '%s'", c.ExchangeDeclare.Kind)
+		}
+	}
+	return nil
+}
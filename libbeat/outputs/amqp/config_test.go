@@ -0,0 +1,71 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package amqp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"defaults": {
+			config: map[string]interface{}{},
+			valid:  true,
+		},
+		"declare exchange": {
+			config: map[string]interface{}{
+				"exchange":         "logs",
+				"exchange_declare": map[string]interface{}{"enabled": true, "kind": "fanout"},
+			},
+			valid: true,
+		},
+		"declare default exchange": {
+			config: map[string]interface{}{
+				"exchange_declare": map[string]interface{}{"enabled": true},
+			},
+		},
+		"unknown exchange kind": {
+			config: map[string]interface{}{
+				"exchange":         "logs",
+				"exchange_declare": map[string]interface{}{"enabled": true, "kind": "x-custom"},
+			},
+		},
+		"invalid routing key": {
+			config: map[string]interface{}{"routing_key": "%{[unterminated"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.config).Unpack(&cfg)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cbor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform/cborl"
+	"github.com/elastic/go-structform/gotype"
+)
+
+func decode(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+	var out map[string]interface{}
+	unfolder, err := gotype.NewUnfolder(&out)
+	require.NoError(t, err)
+	require.NoError(t, cborl.Parse(b, unfolder))
+	return out
+}
+
+func TestCBORCodec(t *testing.T) {
+	cases := map[string]struct {
+		config   Config
+		ts       time.Time
+		in       beat.Event
+		expected map[string]interface{}
+	}{
+		"default": {
+			config: defaultConfig,
+			in: beat.Event{
+				Fields: mapstr.M{"msg": "message", "count": 3, "nested": mapstr.M{"ok": true}},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0001-01-01T00:00:00.000Z",
+				"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				"msg":        "message",
+				"count":      uint8(3),
+				"nested":     map[string]interface{}{"ok": true},
+			},
+		},
+		"metadata": {
+			config: defaultConfig,
+			in: beat.Event{
+				Meta:   mapstr.M{"pipeline": "p1"},
+				Fields: mapstr.M{"msg": "message"},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0001-01-01T00:00:00.000Z",
+				"@metadata": map[string]interface{}{
+					"beat": "test", "type": "_doc", "version": "1.2.3", "pipeline": "p1",
+				},
+				"msg": "message",
+			},
+		},
+		"local time": {
+			config: Config{LocalTime: true},
+			in: beat.Event{
+				Timestamp: time.Time{}.In(time.FixedZone("PST", -8*60*60)),
+				Fields:    mapstr.M{"msg": "message"},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0000-12-31T16:00:00.000-08:00",
+				"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				"msg":        "message",
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3", test.config)
+			actual, err := codec.Encode("test", &test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, decode(t, actual))
+		})
+	}
+}
@@ -22,3 +22,11 @@ import "github.com/elastic/beats/v7/libbeat/beat"
 type Codec interface {
 	Encode(index string, event *beat.Event) ([]byte, error)
 }
+
+// HeaderEncoder is implemented by codecs that require a header line at the
+// start of every file, like the csv codec. Outputs writing to files call
+// Header whenever they start a new file. Header returns nil if no header is
+// required.
+type HeaderEncoder interface {
+	Header() []byte
+}
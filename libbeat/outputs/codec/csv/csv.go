@@ -0,0 +1,167 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package csv provides an output codec that serializes events as CSV
+// records with a fixed list of columns.
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Encoder for serializing a beat.Event to a CSV record.
+type Encoder struct {
+	buf       []byte
+	value     []byte
+	delimiter rune
+	formatter *codec.ValueFormatter
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Fields lists the fields written as columns, in order.
+	Fields    []string `config:"fields" validate:"required"`
+	Delimiter string   `config:"delimiter"`
+	// QuoteAll quotes all values, not only those that require quoting.
+	QuoteAll bool `config:"quote_all"`
+	// Header enables a header row with the field names at the start of
+	// every file.
+	Header    bool `config:"header"`
+	LocalTime bool `config:"local_time"`
+}
+
+var defaultConfig = Config{
+	Delimiter: ",",
+	LocalTime: false,
+}
+
+func init() {
+	codec.RegisterType("csv", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig
+		if cfg == nil {
+			return nil, errors.New("empty csv codec configuration")
+		}
+		if err := cfg.Unpack(&config); err != nil {
+			return nil, err
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// Validate checks that the delimiter is a single character that can be
+// used to separate unquoted values.
+func (c *Config) Validate() error {
+	r, size := utf8.DecodeRuneInString(c.Delimiter)
+	if size == 0 || size != len(c.Delimiter) || r == utf8.RuneError {
+		return fmt.Errorf("csv delimiter must be a single character, got %q", c.Delimiter)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return fmt.Errorf("invalid csv delimiter %q", c.Delimiter)
+	}
+	return nil
+}
+
+// New creates a new CSV Encoder. The config must be valid.
+func New(version string, config Config) *Encoder {
+	delimiter, _ := utf8.DecodeRuneInString(config.Delimiter)
+	return &Encoder{
+		delimiter: delimiter,
+		formatter: codec.NewValueFormatter(config.LocalTime),
+		version:   version,
+		config:    config,
+	}
+}
+
+// Header returns the header row if it is enabled.
+func (e *Encoder) Header() []byte {
+	if !e.config.Header {
+		return nil
+	}
+	var buf []byte
+	for i, field := range e.config.Fields {
+		if i > 0 {
+			buf = utf8.AppendRune(buf, e.delimiter)
+		}
+		buf = e.appendValue(buf, []byte(field))
+	}
+	return buf
+}
+
+// Encode serializes a beat event to a CSV record, without a trailing line
+// break. Missing fields are written as empty values, objects and arrays as
+// JSON.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.buf = e.buf[:0]
+	for i, path := range e.config.Fields {
+		e.value = e.value[:0]
+		if v, found := codec.LookupField(index, e.version, event, path); found {
+			var err error
+			e.value, err = e.formatter.AppendValue(e.value, v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to format field %s: %w", path, err)
+			}
+		}
+
+		if i > 0 {
+			e.buf = utf8.AppendRune(e.buf, e.delimiter)
+		}
+		e.buf = e.appendValue(e.buf, e.value)
+	}
+	return e.buf, nil
+}
+
+// appendValue writes the value as described in RFC 4180. Values that
+// contain the delimiter, quotes or line breaks, or start with a space, are
+// quoted and quotes are doubled.
+func (e *Encoder) appendValue(buf []byte, value []byte) []byte {
+	if !e.config.QuoteAll && !e.needsQuoting(value) {
+		return append(buf, value...)
+	}
+
+	buf = append(buf, '"')
+	for _, b := range value {
+		if b == '"' {
+			buf = append(buf, '"')
+		}
+		buf = append(buf, b)
+	}
+	return append(buf, '"')
+}
+
+func (e *Encoder) needsQuoting(value []byte) bool {
+	if len(value) > 0 && (value[0] == ' ' || value[0] == '\t') {
+		return true
+	}
+	for len(value) > 0 {
+		r, size := utf8.DecodeRune(value)
+		if r == e.delimiter || r == '"' || r == '\r' || r == '\n' {
+			return true
+		}
+		value = value[size:]
+	}
+	return false
+}
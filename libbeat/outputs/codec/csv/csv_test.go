@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package csv
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestCSVCodec(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	event := beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"message": `say "hi", bye`,
+			"count":   3,
+			"host":    mapstr.M{"name": "h1"},
+			"tags":    []string{"a", "b"},
+			"lines":   "a\nb",
+			"padded":  " x",
+		},
+	}
+
+	cases := map[string]struct {
+		config   Config
+		expected string
+	}{
+		"default": {
+			config:   Config{Fields: []string{"@timestamp", "host.name", "count", "missing", "message"}, Delimiter: ","},
+			expected: `2024-05-06T07:08:09.123Z,h1,3,,"say ""hi"", bye"`,
+		},
+		"objects": {
+			config:   Config{Fields: []string{"host", "tags", "@metadata.beat"}, Delimiter: ","},
+			expected: `"{""name"":""h1""}","[""a"",""b""]",test`,
+		},
+		"line breaks and spaces": {
+			config:   Config{Fields: []string{"lines", "padded"}, Delimiter: ","},
+			expected: "\"a\nb\",\" x\"",
+		},
+		"delimiter": {
+			config:   Config{Fields: []string{"host.name", "message"}, Delimiter: ";"},
+			expected: `h1;"say ""hi"", bye"`,
+		},
+		"quote all": {
+			config:   Config{Fields: []string{"host.name", "count"}, Delimiter: ",", QuoteAll: true},
+			expected: `"h1","3"`,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3", test.config)
+			actual, err := codec.Encode("test", &event)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+
+			// The record must be readable by a standard CSV parser.
+			r := csv.NewReader(strings.NewReader(string(actual)))
+			r.Comma = []rune(test.config.Delimiter)[0]
+			record, err := r.Read()
+			require.NoError(t, err)
+			assert.Len(t, record, len(test.config.Fields))
+		})
+	}
+}
+
+func TestCSVHeader(t *testing.T) {
+	enc := New("1.2.3", Config{Fields: []string{"@timestamp", "a,b"}, Delimiter: ","})
+	assert.Nil(t, enc.Header())
+
+	enc = New("1.2.3", Config{Fields: []string{"@timestamp", "a,b"}, Delimiter: ",", Header: true})
+	assert.Equal(t, `@timestamp,"a,b"`, string(enc.Header()))
+}
+
+func TestCSVConfig(t *testing.T) {
+	cases := map[string]struct {
+		config map[string]interface{}
+		err    bool
+	}{
+		"valid":             {config: map[string]interface{}{"fields": []string{"message"}, "delimiter": "\t"}},
+		"missing fields":    {config: map[string]interface{}{"delimiter": ","}, err: true},
+		"long delimiter":    {config: map[string]interface{}{"fields": []string{"message"}, "delimiter": ",,"}, err: true},
+		"quote delimiter":   {config: map[string]interface{}{"fields": []string{"message"}, "delimiter": `"`}, err: true},
+		"newline delimiter": {config: map[string]interface{}{"fields": []string{"message"}, "delimiter": "\n"}, err: true},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			var cfg codec.Config
+			require.NoError(t, config.MustNewConfigFrom(map[string]interface{}{
+				"csv": test.config,
+			}).Unpack(&cfg))
+
+			_, err := codec.CreateEncoder(beat.Info{}, cfg)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -15,7 +15,7 @@
 // specific language governing permissions and limitations
 // under the License.
 
-package json
+package codec
 
 import (
 	"time"
@@ -25,25 +25,27 @@ import (
 )
 
 // Event describes the event structure for events
-// (in-)directly send to logstash
-type event struct {
+// (in-)directly send to logstash. Codecs based on go-structform fold it to
+// add the `@timestamp` and `@metadata` fields to the encoded event.
+type Event struct {
 	Timestamp time.Time `struct:"@timestamp"`
-	Meta      meta      `struct:"@metadata"`
+	Meta      Meta      `struct:"@metadata"`
 	Fields    mapstr.M  `struct:",inline"`
 }
 
 // Meta defines common event metadata to be stored in '@metadata'
-type meta struct {
+type Meta struct {
 	Beat    string                 `struct:"beat"`
 	Type    string                 `struct:"type"`
 	Version string                 `struct:"version"`
 	Fields  map[string]interface{} `struct:",inline"`
 }
 
-func makeEvent(index, version string, in *beat.Event) event {
-	return event{
+// MakeEvent wraps a beat event for encoding.
+func MakeEvent(index, version string, in *beat.Event) Event {
+	return Event{
 		Timestamp: in.Timestamp,
-		Meta: meta{
+		Meta: Meta{
 			Beat:    index,
 			Version: version,
 			Type:    "_doc",
@@ -0,0 +1,215 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/dtfmt"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// This file contains helpers for codecs that write events as a flat list
+// of fields, like logfmt and csv.
+
+const (
+	timestampField = "@timestamp"
+	metadataField  = "@metadata"
+)
+
+// Field is a field of a flattened event.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// LookupField returns the value of the field at the given dotted path. The
+// `@timestamp` and `@metadata` fields are available with the same content
+// the json codec writes for them.
+func LookupField(index, version string, event *beat.Event, path string) (interface{}, bool) {
+	switch {
+	case path == timestampField:
+		return event.Timestamp, true
+	case path == metadataField:
+		return makeMetadata(index, version, event), true
+	case strings.HasPrefix(path, metadataField+"."):
+		v, err := makeMetadata(index, version, event).GetValue(path[len(metadataField)+1:])
+		return v, err == nil
+	}
+
+	v, err := event.Fields.GetValue(path)
+	return v, err == nil
+}
+
+func makeMetadata(index, version string, event *beat.Event) mapstr.M {
+	meta := mapstr.M{"beat": index, "type": "_doc", "version": version}
+	for k, v := range event.Meta {
+		meta[k] = v
+	}
+	return meta
+}
+
+// FlattenFields appends the fields of the given paths to out. Objects are
+// flattened to one field per leaf value, using the dotted path as key and
+// sorted by key. Paths that are not found are skipped. If no paths are
+// given, the `@timestamp` and all event fields are appended.
+func FlattenFields(
+	out []Field, index, version string, event *beat.Event, paths []string,
+) []Field {
+	if len(paths) == 0 {
+		out = append(out, Field{Key: timestampField, Value: event.Timestamp})
+		return appendFlattened(out, "", event.Fields)
+	}
+
+	for _, path := range paths {
+		v, found := LookupField(index, version, event, path)
+		if !found {
+			continue
+		}
+		if m, ok := toMap(v); ok {
+			out = appendFlattened(out, path, m)
+		} else {
+			out = append(out, Field{Key: path, Value: v})
+		}
+	}
+	return out
+}
+
+func appendFlattened(out []Field, prefix string, m mapstr.M) []Field {
+	flat := m.Flatten()
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if prefix != "" {
+			out = append(out, Field{Key: prefix + "." + k, Value: flat[k]})
+		} else {
+			out = append(out, Field{Key: k, Value: flat[k]})
+		}
+	}
+	return out
+}
+
+func toMap(v interface{}) (mapstr.M, bool) {
+	switch m := v.(type) {
+	case mapstr.M:
+		return m, true
+	case map[string]interface{}:
+		return mapstr.M(m), true
+	}
+	return nil, false
+}
+
+// ValueFormatter formats field values as plain text. Timestamps are
+// formatted the same way the json codec formats them, nil values as empty
+// strings, and arrays and objects as JSON.
+type ValueFormatter struct {
+	timestamp *dtfmt.Formatter
+	localTime bool
+}
+
+// NewValueFormatter creates a new ValueFormatter. If localTime is set
+// timestamps are formatted in the local time zone instead of UTC.
+func NewValueFormatter(localTime bool) *ValueFormatter {
+	formatter, err := dtfmt.NewFormatter(common.TimestampFormat(localTime))
+	if err != nil {
+		panic(err)
+	}
+	return &ValueFormatter{timestamp: formatter, localTime: localTime}
+}
+
+// AppendValue appends the text representation of v to buf.
+func (f *ValueFormatter) AppendValue(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return buf, nil
+	case string:
+		return append(buf, v...), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case uint:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(buf, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case float32:
+		return appendFloat(buf, float64(v), 32)
+	case float64:
+		return appendFloat(buf, v, 64)
+	case time.Time:
+		return f.appendTime(buf, v)
+	case common.Time:
+		return f.appendTime(buf, time.Time(v))
+	case *time.Time:
+		if v == nil {
+			return buf, nil
+		}
+		return f.appendTime(buf, *v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, b...), nil
+}
+
+func (f *ValueFormatter) appendTime(buf []byte, t time.Time) ([]byte, error) {
+	if !f.localTime {
+		t = t.UTC()
+	}
+	return f.timestamp.AppendTo(buf, t)
+}
+
+// appendFloat formats floats the same way encoding/json does.
+func appendFloat(buf []byte, f float64, bits int) ([]byte, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return buf, errors.New("unsupported float value " + strconv.FormatFloat(f, 'g', -1, bits))
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	return strconv.AppendFloat(buf, f, format, -1, bits), nil
+}
@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package logfmt provides an output codec that serializes events as logfmt
+// lines of space separated key=value pairs.
+package logfmt
+
+import (
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Encoder for serializing a beat.Event to logfmt.
+type Encoder struct {
+	buf       []byte
+	value     []byte
+	fields    []codec.Field
+	formatter *codec.ValueFormatter
+
+	version string
+	config  Config
+}
+
+// Config is used to pass encoding parameters to New.
+type Config struct {
+	// Fields lists the fields to write in order. Objects are flattened to
+	// dotted keys. If empty, the `@timestamp` and all event fields are
+	// written.
+	Fields    []string `config:"fields"`
+	LocalTime bool     `config:"local_time"`
+}
+
+var defaultConfig = Config{
+	LocalTime: false,
+}
+
+func init() {
+	codec.RegisterType("logfmt", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return New(info.Version, config), nil
+	})
+}
+
+// New creates a new logfmt Encoder.
+func New(version string, config Config) *Encoder {
+	return &Encoder{
+		formatter: codec.NewValueFormatter(config.LocalTime),
+		version:   version,
+		config:    config,
+	}
+}
+
+// Encode serializes a beat event to a logfmt line. Fields that are not
+// found in the event are skipped.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	e.fields = codec.FlattenFields(e.fields[:0], index, e.version, event, e.config.Fields)
+
+	e.buf = e.buf[:0]
+	for i, field := range e.fields {
+		var err error
+		e.value, err = e.formatter.AppendValue(e.value[:0], field.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			e.buf = append(e.buf, ' ')
+		}
+		e.buf = appendKey(e.buf, field.Key)
+		e.buf = append(e.buf, '=')
+		e.buf = appendValue(e.buf, e.value)
+	}
+	return e.buf, nil
+}
+
+// appendKey writes the key, replacing characters that are not allowed in
+// logfmt keys with underscores.
+func appendKey(buf []byte, key string) []byte {
+	for _, r := range key {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			buf = append(buf, '_')
+		} else {
+			buf = utf8.AppendRune(buf, r)
+		}
+	}
+	return buf
+}
+
+// appendValue writes the value, quoting it if it contains spaces, equal
+// signs, quotes or control characters. Empty values are written as `key=`.
+func appendValue(buf []byte, value []byte) []byte {
+	if !needsQuoting(value) {
+		return append(buf, value...)
+	}
+
+	buf = append(buf, '"')
+	for len(value) > 0 {
+		r, size := utf8.DecodeRune(value)
+		switch {
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < ' ' || r == 0x7f:
+			buf = append(buf, '\\', 'u', '0', '0', hex[r>>4], hex[r&0xf])
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, `\ufffd`...)
+		default:
+			buf = append(buf, value[:size]...)
+		}
+		value = value[size:]
+	}
+	return append(buf, '"')
+}
+
+const hex = "0123456789abcdef"
+
+func needsQuoting(value []byte) bool {
+	for _, b := range value {
+		if b <= ' ' || b == '=' || b == '"' || b == 0x7f {
+			return true
+		}
+	}
+	return !utf8.Valid(value)
+}
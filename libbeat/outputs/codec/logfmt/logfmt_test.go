@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package logfmt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestLogfmtCodec(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123000000, time.UTC)
+	cases := map[string]struct {
+		config   Config
+		in       beat.Event
+		expected string
+	}{
+		"all fields": {
+			config: defaultConfig,
+			in: beat.Event{
+				Timestamp: ts,
+				Fields: mapstr.M{
+					"message": "hello world",
+					"count":   3,
+					"host":    mapstr.M{"name": "h1", "os": map[string]interface{}{"family": "linux"}},
+				},
+			},
+			expected: `@timestamp=2024-05-06T07:08:09.123Z count=3 host.name=h1 host.os.family=linux message="hello world"`,
+		},
+		"field list": {
+			config: Config{Fields: []string{"message", "missing", "@metadata.beat", "host", "tags"}},
+			in: beat.Event{
+				Timestamp: ts,
+				Fields: mapstr.M{
+					"message": "ok",
+					"host":    mapstr.M{"name": "h1", "ip": "10.0.0.1"},
+					"tags":    []string{"a", "b"},
+				},
+			},
+			expected: `message=ok @metadata.beat=test host.ip=10.0.0.1 host.name=h1 tags="[\"a\",\"b\"]"`,
+		},
+		"escaping": {
+			config: Config{Fields: []string{"empty", "eq", "quote", "lines", "ctrl", "key with space", "utf8"}},
+			in: beat.Event{
+				Fields: mapstr.M{
+					"empty":          "",
+					"eq":             "a=b",
+					"quote":          `say "hi" \o/`,
+					"lines":          "a\nb\r\tc",
+					"ctrl":           "\x01",
+					"key with space": nil,
+					"utf8":           "grüße",
+				},
+			},
+			expected: `empty= eq="a=b" quote="say \"hi\" \\o/" lines="a\nb\r\tc" ctrl="\u0001" key_with_space= utf8=grüße`,
+		},
+		"local time": {
+			config: Config{Fields: []string{"@timestamp"}, LocalTime: true},
+			in: beat.Event{
+				Timestamp: ts.In(time.FixedZone("PST", -8*60*60)),
+			},
+			expected: `@timestamp=2024-05-05T23:08:09.123-08:00`,
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3", test.config)
+			actual, err := codec.Encode("test", &test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, string(actual))
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ugorji "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func decode(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+	handle := &ugorji.MsgpackHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	var out map[string]interface{}
+	require.NoError(t, ugorji.NewDecoderBytes(b, handle).Decode(&out))
+	return out
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	cases := map[string]struct {
+		config   Config
+		in       beat.Event
+		expected map[string]interface{}
+	}{
+		"default": {
+			config: defaultConfig,
+			in: beat.Event{
+				Fields: mapstr.M{
+					"msg":    "message",
+					"count":  3,
+					"nested": mapstr.M{"ok": true, "none": nil},
+					"list":   []interface{}{1, -2, 1.5, "x"},
+				},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0001-01-01T00:00:00.000Z",
+				"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				"msg":        "message",
+				"count":      int64(3),
+				"nested":     map[string]interface{}{"ok": true, "none": nil},
+				"list":       []interface{}{int64(1), int64(-2), 1.5, "x"},
+			},
+		},
+		"metadata": {
+			config: defaultConfig,
+			in: beat.Event{
+				Meta:   mapstr.M{"pipeline": "p1"},
+				Fields: mapstr.M{"msg": "message"},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0001-01-01T00:00:00.000Z",
+				"@metadata": map[string]interface{}{
+					"beat": "test", "type": "_doc", "version": "1.2.3", "pipeline": "p1",
+				},
+				"msg": "message",
+			},
+		},
+		"local time": {
+			config: Config{LocalTime: true},
+			in: beat.Event{
+				Timestamp: time.Time{}.In(time.FixedZone("PST", -8*60*60)),
+				Fields:    mapstr.M{"msg": "message"},
+			},
+			expected: map[string]interface{}{
+				"@timestamp": "0000-12-31T16:00:00.000-08:00",
+				"@metadata":  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				"msg":        "message",
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3", test.config)
+			actual, err := codec.Encode("test", &test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, decode(t, actual))
+		})
+	}
+}
+
+func TestMsgpackSizes(t *testing.T) {
+	fields := mapstr.M{}
+	list := make([]interface{}, 70000)
+	for i := range list {
+		list[i] = i - 35000
+	}
+	fields["list"] = list
+	fields["long"] = strings.Repeat("a", 70000)
+	fields["medium"] = strings.Repeat("b", 300)
+	for i := 0; i < 20; i++ {
+		fields[strings.Repeat("k", i+1)] = int64(1) << (3 * i)
+	}
+
+	codec := New("1.2.3", defaultConfig)
+	actual, err := codec.Encode("test", &beat.Event{Fields: fields})
+	require.NoError(t, err)
+
+	decoded := decode(t, actual)
+	assert.Len(t, decoded, len(fields)+2)
+	assert.Equal(t, fields["long"], decoded["long"])
+	assert.Equal(t, fields["medium"], decoded["medium"])
+	decodedList := decoded["list"].([]interface{})
+	require.Len(t, decodedList, len(list))
+	assert.EqualValues(t, -35000, decodedList[0])
+	assert.EqualValues(t, 34999, decodedList[len(list)-1])
+	for i := 0; i < 20; i++ {
+		assert.EqualValues(t, int64(1)<<(3*i), decoded[strings.Repeat("k", i+1)])
+	}
+}
+
+func TestMsgpackConfig(t *testing.T) {
+	var cfg codec.Config
+	require.NoError(t, config.MustNewConfigFrom(map[string]interface{}{
+		"msgpack.local_time": true,
+	}).Unpack(&cfg))
+
+	enc, err := codec.CreateEncoder(beat.Info{Version: "1.2.3"}, cfg)
+	require.NoError(t, err)
+	assert.True(t, enc.(*Encoder).config.LocalTime)
+}
@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/elastic/go-structform"
+)
+
+// MessagePack format codes, see
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+const (
+	codeNil     = 0xc0
+	codeFalse   = 0xc2
+	codeTrue    = 0xc3
+	codeFloat32 = 0xca
+	codeFloat64 = 0xcb
+	codeUint8   = 0xcc
+	codeUint16  = 0xcd
+	codeUint32  = 0xce
+	codeUint64  = 0xcf
+	codeInt8    = 0xd0
+	codeInt16   = 0xd1
+	codeInt32   = 0xd2
+	codeInt64   = 0xd3
+	codeStr8    = 0xd9
+	codeStr16   = 0xda
+	codeStr32   = 0xdb
+	codeArray16 = 0xdc
+	codeArray32 = 0xdd
+	codeMap16   = 0xde
+	codeMap32   = 0xdf
+
+	fixStr   = 0xa0
+	fixArray = 0x90
+	fixMap   = 0x80
+
+	// headerReserve is the space reserved for the header of a map or array
+	// until the number of its elements is known.
+	headerReserve = 5
+)
+
+var errUnbalanced = errors.New("msgpack: unbalanced object or array")
+
+// container is an open map or array.
+type container struct {
+	isMap bool
+	// pos is the position of the reserved header in the buffer.
+	pos int
+	// count is the number of keys or elements written so far.
+	count uint32
+}
+
+// visitor writes MessagePack. go-structform does not always report the
+// exact length of objects, as the keys of inlined maps are not counted, so
+// lengths are ignored and the header of a map or array is written once all
+// of its elements have been visited.
+type visitor struct {
+	buf   []byte
+	stack []container
+}
+
+var _ structform.Visitor = (*visitor)(nil)
+
+func (v *visitor) reset() {
+	v.buf = v.buf[:0]
+	v.stack = v.stack[:0]
+}
+
+// onValue counts a new element of the current array.
+func (v *visitor) onValue() {
+	if n := len(v.stack); n > 0 && !v.stack[n-1].isMap {
+		v.stack[n-1].count++
+	}
+}
+
+func (v *visitor) open(isMap bool) {
+	v.onValue()
+	v.stack = append(v.stack, container{isMap: isMap, pos: len(v.buf)})
+	v.buf = append(v.buf, make([]byte, headerReserve)...)
+}
+
+func (v *visitor) close(isMap bool) error {
+	n := len(v.stack)
+	if n == 0 || v.stack[n-1].isMap != isMap {
+		return errUnbalanced
+	}
+	c := v.stack[n-1]
+	v.stack = v.stack[:n-1]
+
+	var header []byte
+	switch {
+	case c.count < 16 && isMap:
+		header = []byte{fixMap | byte(c.count)}
+	case c.count < 16:
+		header = []byte{fixArray | byte(c.count)}
+	case c.count <= math.MaxUint16:
+		code := byte(codeArray16)
+		if isMap {
+			code = codeMap16
+		}
+		header = binary.BigEndian.AppendUint16([]byte{code}, uint16(c.count))
+	default:
+		code := byte(codeArray32)
+		if isMap {
+			code = codeMap32
+		}
+		header = binary.BigEndian.AppendUint32([]byte{code}, c.count)
+	}
+
+	// Move the contents to the end of the actual header.
+	start := c.pos + len(header)
+	copy(v.buf[c.pos:], header)
+	copy(v.buf[start:], v.buf[c.pos+headerReserve:])
+	v.buf = v.buf[:len(v.buf)-(headerReserve-len(header))]
+	return nil
+}
+
+func (v *visitor) OnObjectStart(_ int, _ structform.BaseType) error {
+	v.open(true)
+	return nil
+}
+
+func (v *visitor) OnObjectFinished() error {
+	return v.close(true)
+}
+
+func (v *visitor) OnKey(s string) error {
+	n := len(v.stack)
+	if n == 0 || !v.stack[n-1].isMap {
+		return errUnbalanced
+	}
+	v.stack[n-1].count++
+	v.writeString(s)
+	return nil
+}
+
+func (v *visitor) OnArrayStart(_ int, _ structform.BaseType) error {
+	v.open(false)
+	return nil
+}
+
+func (v *visitor) OnArrayFinished() error {
+	return v.close(false)
+}
+
+func (v *visitor) OnNil() error {
+	v.onValue()
+	v.buf = append(v.buf, codeNil)
+	return nil
+}
+
+func (v *visitor) OnBool(b bool) error {
+	v.onValue()
+	if b {
+		v.buf = append(v.buf, codeTrue)
+	} else {
+		v.buf = append(v.buf, codeFalse)
+	}
+	return nil
+}
+
+func (v *visitor) OnString(s string) error {
+	v.onValue()
+	v.writeString(s)
+	return nil
+}
+
+func (v *visitor) writeString(s string) {
+	l := len(s)
+	switch {
+	case l < 32:
+		v.buf = append(v.buf, fixStr|byte(l))
+	case l <= math.MaxUint8:
+		v.buf = append(v.buf, codeStr8, byte(l))
+	case l <= math.MaxUint16:
+		v.buf = binary.BigEndian.AppendUint16(append(v.buf, codeStr16), uint16(l))
+	default:
+		v.buf = binary.BigEndian.AppendUint32(append(v.buf, codeStr32), uint32(l))
+	}
+	v.buf = append(v.buf, s...)
+}
+
+func (v *visitor) OnInt8(i int8) error   { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt16(i int16) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt32(i int32) error { return v.OnInt64(int64(i)) }
+func (v *visitor) OnInt(i int) error     { return v.OnInt64(int64(i)) }
+
+// OnInt64 writes the integer in its smallest representation.
+func (v *visitor) OnInt64(i int64) error {
+	if i >= 0 {
+		return v.OnUint64(uint64(i))
+	}
+	v.onValue()
+	switch {
+	case i >= -32:
+		// negative fixint
+		v.buf = append(v.buf, byte(i))
+	case i >= math.MinInt8:
+		v.buf = append(v.buf, codeInt8, byte(i))
+	case i >= math.MinInt16:
+		v.buf = binary.BigEndian.AppendUint16(append(v.buf, codeInt16), uint16(i))
+	case i >= math.MinInt32:
+		v.buf = binary.BigEndian.AppendUint32(append(v.buf, codeInt32), uint32(i))
+	default:
+		v.buf = binary.BigEndian.AppendUint64(append(v.buf, codeInt64), uint64(i))
+	}
+	return nil
+}
+
+func (v *visitor) OnByte(b byte) error     { return v.OnUint64(uint64(b)) }
+func (v *visitor) OnUint8(u uint8) error   { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint16(u uint16) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint32(u uint32) error { return v.OnUint64(uint64(u)) }
+func (v *visitor) OnUint(u uint) error     { return v.OnUint64(uint64(u)) }
+
+// OnUint64 writes the integer in its smallest representation.
+func (v *visitor) OnUint64(u uint64) error {
+	v.onValue()
+	switch {
+	case u <= 0x7f:
+		// positive fixint
+		v.buf = append(v.buf, byte(u))
+	case u <= math.MaxUint8:
+		v.buf = append(v.buf, codeUint8, byte(u))
+	case u <= math.MaxUint16:
+		v.buf = binary.BigEndian.AppendUint16(append(v.buf, codeUint16), uint16(u))
+	case u <= math.MaxUint32:
+		v.buf = binary.BigEndian.AppendUint32(append(v.buf, codeUint32), uint32(u))
+	default:
+		v.buf = binary.BigEndian.AppendUint64(append(v.buf, codeUint64), u)
+	}
+	return nil
+}
+
+func (v *visitor) OnFloat32(f float32) error {
+	v.onValue()
+	v.buf = binary.BigEndian.AppendUint32(append(v.buf, codeFloat32), math.Float32bits(f))
+	return nil
+}
+
+func (v *visitor) OnFloat64(f float64) error {
+	v.onValue()
+	v.buf = binary.BigEndian.AppendUint64(append(v.buf, codeFloat64), math.Float64bits(f))
+	return nil
+}
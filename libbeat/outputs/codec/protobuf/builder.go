@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/elastic/go-structform"
+)
+
+var errUnbalanced = errors.New("protobuf: unbalanced object or array")
+
+// frame is an open object or array. Exactly one of object and list is set.
+type frame struct {
+	object *structpb.Struct
+	list   *structpb.ListValue
+	key    string
+}
+
+// valueBuilder is a structform.Visitor that builds a google.protobuf.Value.
+// Protobuf has a single number type, so all numbers are converted to
+// float64.
+type valueBuilder struct {
+	stack []frame
+	value *structpb.Value
+}
+
+var _ structform.Visitor = (*valueBuilder)(nil)
+
+func (b *valueBuilder) reset() {
+	b.stack = b.stack[:0]
+	b.value = nil
+}
+
+func (b *valueBuilder) add(v *structpb.Value) error {
+	n := len(b.stack)
+	if n == 0 {
+		b.value = v
+		return nil
+	}
+	top := &b.stack[n-1]
+	if top.object != nil {
+		top.object.Fields[top.key] = v
+	} else {
+		top.list.Values = append(top.list.Values, v)
+	}
+	return nil
+}
+
+func (b *valueBuilder) OnObjectStart(l int, _ structform.BaseType) error {
+	if l < 0 {
+		l = 0
+	}
+	b.stack = append(b.stack, frame{
+		object: &structpb.Struct{Fields: make(map[string]*structpb.Value, l)},
+	})
+	return nil
+}
+
+func (b *valueBuilder) OnObjectFinished() error {
+	n := len(b.stack)
+	if n == 0 || b.stack[n-1].object == nil {
+		return errUnbalanced
+	}
+	object := b.stack[n-1].object
+	b.stack = b.stack[:n-1]
+	return b.add(structpb.NewStructValue(object))
+}
+
+func (b *valueBuilder) OnKey(s string) error {
+	n := len(b.stack)
+	if n == 0 || b.stack[n-1].object == nil {
+		return errUnbalanced
+	}
+	b.stack[n-1].key = s
+	return nil
+}
+
+func (b *valueBuilder) OnArrayStart(l int, _ structform.BaseType) error {
+	if l < 0 {
+		l = 0
+	}
+	b.stack = append(b.stack, frame{
+		list: &structpb.ListValue{Values: make([]*structpb.Value, 0, l)},
+	})
+	return nil
+}
+
+func (b *valueBuilder) OnArrayFinished() error {
+	n := len(b.stack)
+	if n == 0 || b.stack[n-1].list == nil {
+		return errUnbalanced
+	}
+	list := b.stack[n-1].list
+	b.stack = b.stack[:n-1]
+	return b.add(structpb.NewListValue(list))
+}
+
+func (b *valueBuilder) OnNil() error            { return b.add(structpb.NewNullValue()) }
+func (b *valueBuilder) OnBool(v bool) error     { return b.add(structpb.NewBoolValue(v)) }
+func (b *valueBuilder) OnString(s string) error { return b.add(structpb.NewStringValue(s)) }
+
+func (b *valueBuilder) OnInt8(i int8) error   { return b.OnFloat64(float64(i)) }
+func (b *valueBuilder) OnInt16(i int16) error { return b.OnFloat64(float64(i)) }
+func (b *valueBuilder) OnInt32(i int32) error { return b.OnFloat64(float64(i)) }
+func (b *valueBuilder) OnInt64(i int64) error { return b.OnFloat64(float64(i)) }
+func (b *valueBuilder) OnInt(i int) error     { return b.OnFloat64(float64(i)) }
+
+func (b *valueBuilder) OnByte(u byte) error     { return b.OnFloat64(float64(u)) }
+func (b *valueBuilder) OnUint8(u uint8) error   { return b.OnFloat64(float64(u)) }
+func (b *valueBuilder) OnUint16(u uint16) error { return b.OnFloat64(float64(u)) }
+func (b *valueBuilder) OnUint32(u uint32) error { return b.OnFloat64(float64(u)) }
+func (b *valueBuilder) OnUint64(u uint64) error { return b.OnFloat64(float64(u)) }
+func (b *valueBuilder) OnUint(u uint) error     { return b.OnFloat64(float64(u)) }
+
+func (b *valueBuilder) OnFloat32(f float32) error { return b.OnFloat64(float64(f)) }
+func (b *valueBuilder) OnFloat64(f float64) error { return b.add(structpb.NewNumberValue(f)) }
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package protobuf provides an output codec that serializes events to
+// Protocol Buffers using the generic Event message described in event.proto.
+package protobuf
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// Field numbers of the Event message.
+const (
+	fieldTimestamp protowire.Number = 1
+	fieldMetadata  protowire.Number = 2
+	fieldFields    protowire.Number = 3
+)
+
+// Encoder for serializing a beat.Event to Protocol Buffers.
+type Encoder struct {
+	buf     []byte
+	builder valueBuilder
+	folder  *gotype.Iterator
+
+	version string
+}
+
+func init() {
+	codec.RegisterType("protobuf", func(info beat.Info, _ *config.C) (codec.Codec, error) {
+		return New(info.Version), nil
+	})
+}
+
+// New creates a new Protobuf Encoder.
+func New(version string) *Encoder {
+	e := &Encoder{version: version}
+	e.reset()
+	return e
+}
+
+func (e *Encoder) reset() {
+	var err error
+
+	// Timestamps nested in the event fields are encoded as strings, the
+	// same way the json codec encodes them.
+	e.folder, err = gotype.NewIterator(&e.builder,
+		gotype.Folders(
+			codec.MakeUTCOrLocalTimestampEncoder(false),
+			codec.MakeBCTimestampEncoder(),
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Encode serializes a beat event to an Event message. The `@timestamp` is
+// stored in the timestamp field, the `@metadata` in the metadata field.
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	in := codec.MakeEvent(index, e.version, event)
+
+	e.buf = e.buf[:0]
+	if err := e.appendTimestamp(in.Timestamp); err != nil {
+		return nil, err
+	}
+	if err := e.appendStruct(fieldMetadata, in.Meta); err != nil {
+		return nil, fmt.Errorf("failed to encode event metadata: %w", err)
+	}
+	if err := e.appendStruct(fieldFields, in.Fields); err != nil {
+		return nil, fmt.Errorf("failed to encode event fields: %w", err)
+	}
+	return e.buf, nil
+}
+
+func (e *Encoder) appendTimestamp(ts time.Time) error {
+	msg, err := proto.Marshal(timestamppb.New(ts))
+	if err != nil {
+		return err
+	}
+	e.buf = protowire.AppendTag(e.buf, fieldTimestamp, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, msg)
+	return nil
+}
+
+func (e *Encoder) appendStruct(num protowire.Number, v interface{}) error {
+	e.builder.reset()
+	if err := e.folder.Fold(v); err != nil {
+		e.reset()
+		return err
+	}
+
+	var s *structpb.Struct
+	switch kind := e.builder.value.GetKind().(type) {
+	case *structpb.Value_StructValue:
+		s = kind.StructValue
+	case nil, *structpb.Value_NullValue:
+		s = &structpb.Struct{}
+	default:
+		return fmt.Errorf("expected an object, got %T", kind)
+	}
+
+	msg, err := proto.Marshal(s)
+	if err != nil {
+		return err
+	}
+	e.buf = protowire.AppendTag(e.buf, num, protowire.BytesType)
+	e.buf = protowire.AppendBytes(e.buf, msg)
+	return nil
+}
@@ -0,0 +1,134 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package protobuf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type decodedEvent struct {
+	timestamp time.Time
+	metadata  map[string]interface{}
+	fields    map[string]interface{}
+}
+
+func decode(t *testing.T, b []byte) decodedEvent {
+	t.Helper()
+	var out decodedEvent
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		b = b[n:]
+		msg, n := protowire.ConsumeBytes(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+
+		switch num {
+		case fieldTimestamp:
+			var ts timestamppb.Timestamp
+			require.NoError(t, proto.Unmarshal(msg, &ts))
+			out.timestamp = ts.AsTime()
+		case fieldMetadata:
+			var s structpb.Struct
+			require.NoError(t, proto.Unmarshal(msg, &s))
+			out.metadata = s.AsMap()
+		case fieldFields:
+			var s structpb.Struct
+			require.NoError(t, proto.Unmarshal(msg, &s))
+			out.fields = s.AsMap()
+		default:
+			t.Fatalf("unexpected field %d", num)
+		}
+	}
+	return out
+}
+
+func TestProtobufCodec(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	cases := map[string]struct {
+		in       beat.Event
+		expected decodedEvent
+	}{
+		"default": {
+			in: beat.Event{
+				Timestamp: ts,
+				Fields: mapstr.M{
+					"msg":     "message",
+					"count":   3,
+					"nested":  mapstr.M{"ok": true, "none": nil},
+					"list":    []string{"a", "b"},
+					"created": ts,
+				},
+			},
+			expected: decodedEvent{
+				timestamp: ts,
+				metadata:  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				fields: map[string]interface{}{
+					"msg":     "message",
+					"count":   float64(3),
+					"nested":  map[string]interface{}{"ok": true, "none": nil},
+					"list":    []interface{}{"a", "b"},
+					"created": "2024-05-06T07:08:09.123Z",
+				},
+			},
+		},
+		"metadata": {
+			in: beat.Event{
+				Timestamp: ts,
+				Meta:      mapstr.M{"pipeline": "p1"},
+				Fields:    mapstr.M{"msg": "message"},
+			},
+			expected: decodedEvent{
+				timestamp: ts,
+				metadata: map[string]interface{}{
+					"beat": "test", "type": "_doc", "version": "1.2.3", "pipeline": "p1",
+				},
+				fields: map[string]interface{}{"msg": "message"},
+			},
+		},
+		"no fields": {
+			in: beat.Event{Timestamp: ts},
+			expected: decodedEvent{
+				timestamp: ts,
+				metadata:  map[string]interface{}{"beat": "test", "type": "_doc", "version": "1.2.3"},
+				fields:    map[string]interface{}{},
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			codec := New("1.2.3")
+			actual, err := codec.Encode("test", &test.in)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, decode(t, actual))
+		})
+	}
+}
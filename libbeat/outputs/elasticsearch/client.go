@@ -19,6 +19,7 @@ package elasticsearch
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -59,10 +60,15 @@ type Client struct {
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
 
+	// If deadLetterFile is set, events with bulk-ingest errors are written
+	// to it. Events that can't be written are retried.
+	deadLetterFile *deadLetterFile
+
 	log                    *logp.Logger
 	pLogIndex              *periodic.Doer
 	pLogIndexTryDeadLetter *periodic.Doer
 	pLogDeadLetter         *periodic.Doer
+	pLogDeadLetterFile     *periodic.Doer
 }
 
 // clientSettings contains the settings for a client.
@@ -79,6 +85,10 @@ type clientSettings struct {
 	// If deadLetterIndex is set, events with bulk-ingest errors will be
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
+
+	// If deadLetterFile is set, events with bulk-ingest errors are written
+	// to it instead.
+	deadLetterFile *deadLetterFile
 }
 
 type bulkResultStats struct {
@@ -86,7 +96,7 @@ type bulkResultStats struct {
 	duplicates   int // number of events failed with `create` due to ID already being indexed
 	fails        int // number of events with retryable failures.
 	nonIndexable int // number of events with permanent failures.
-	deadLetter   int // number of failed events ingested to the dead letter index.
+	deadLetter   int // number of failed events ingested to the dead letter index or file.
 	tooMany      int // number of events receiving HTTP 429 Too Many Requests
 }
 
@@ -183,20 +193,29 @@ func NewClient(
 			count, d)
 	})
 
+	pLogDeadLetterFile := periodic.NewDoer(10*time.Second, func(count uint64, d time.Duration) {
+		log.Warnf(
+			"Failed to index %d events in last %s: wrote them to the dead letter file. Look at the event log to view the event and cause.",
+			count, d)
+	})
+
 	pLogDeadLetter.Start()
 	pLogIndex.Start()
 	pLogIndexTryDeadLetter.Start()
+	pLogDeadLetterFile.Start()
 	client := &Client{
 		conn:             *conn,
 		indexSelector:    s.indexSelector,
 		pipelineSelector: pipeline,
 		observer:         observer,
 		deadLetterIndex:  s.deadLetterIndex,
+		deadLetterFile:   s.deadLetterFile,
 
 		log:                    log,
 		pLogDeadLetter:         pLogDeadLetter,
 		pLogIndex:              pLogIndex,
 		pLogIndexTryDeadLetter: pLogIndexTryDeadLetter,
+		pLogDeadLetterFile:     pLogDeadLetterFile,
 	}
 
 	return client, nil
@@ -235,6 +254,7 @@ func (client *Client) Clone() *Client {
 			indexSelector:    client.indexSelector,
 			pipelineSelector: client.pipelineSelector,
 			deadLetterIndex:  client.deadLetterIndex,
+			deadLetterFile:   client.deadLetterFile,
 		},
 		nil, // XXX: do not pass connection callback?
 		client.log,
@@ -317,6 +337,10 @@ func (client *Client) handleBulkResultError(
 			// Report that we split a batch
 			client.observer.BatchSplit()
 			client.observer.RetryableErrors(len(bulkResult.events))
+		} else if client.deadLetterFile != nil {
+			// The batch can't be split, write its events to the dead letter
+			// file instead of dropping them.
+			client.writeBatchToDeadLetterFile(batch, bulkResult.events)
 		} else {
 			// If the batch could not be split, there is no option left but
 			// to drop it and log the error state.
@@ -451,6 +475,9 @@ func (client *Client) bulkCollectPublishFails(bulkResult bulkResult) ([]publishe
 	count := len(events)
 	eventsToRetry := events[:0]
 	stats := bulkResultStats{}
+	// deadLetterFileEvents are the events written to the dead letter file,
+	// which is synced once for the whole response.
+	var deadLetterFileEvents []publisher.Event
 	for i := 0; i < count; i++ {
 		itemStatus, itemMessage, err := bulkReadItemStatus(client.log, reader)
 		if err != nil {
@@ -460,11 +487,17 @@ func (client *Client) bulkCollectPublishFails(bulkResult bulkResult) ([]publishe
 			break
 		}
 
+		deadLetter := stats.deadLetter
 		if client.applyItemStatus(events[i], itemStatus, itemMessage, &stats) {
 			eventsToRetry = append(eventsToRetry, events[i])
 			client.log.Debugf("Bulk item insert failed (i=%v, status=%v): %s", i, itemStatus, itemMessage)
+		} else if itemStatus >= 300 && stats.deadLetter > deadLetter {
+			deadLetterFileEvents = append(deadLetterFileEvents, events[i])
 		}
 	}
+	if len(deadLetterFileEvents) > 0 {
+		eventsToRetry = append(eventsToRetry, client.syncDeadLetterFile(deadLetterFileEvents, &stats)...)
+	}
 
 	return eventsToRetry, stats
 }
@@ -513,6 +546,9 @@ func (client *Client) applyItemStatus(
 			stats.nonIndexable++
 			return false
 		}
+		if client.deadLetterFile != nil {
+			return client.writeToDeadLetterFile(encodedEvent, itemStatus, itemMessage, stats)
+		}
 		if client.deadLetterIndex == "" {
 			// Fatal error and no dead letter index, drop.
 			client.pLogIndex.Add()
@@ -534,6 +570,64 @@ func (client *Client) applyItemStatus(
 	return true
 }
 
+// writeToDeadLetterFile writes an event that Elasticsearch rejected to the
+// dead letter file. Returns true if the event must be retried because it
+// couldn't be written.
+func (client *Client) writeToDeadLetterFile(
+	encodedEvent *encodedEvent,
+	itemStatus int,
+	itemMessage []byte,
+	stats *bulkResultStats,
+) bool {
+	if err := client.deadLetterFile.write(encodedEvent, itemStatus, itemMessage); err != nil {
+		client.log.Errorf("Failed to write event to the dead letter file, retrying it: %v", err)
+		stats.fails++
+		return true
+	}
+	client.pLogDeadLetterFile.Add()
+	client.log.Warnw(fmt.Sprintf("Cannot index event '%s' (status=%v): %s, wrote it to the dead letter file", encodedEvent, itemStatus, itemMessage), logp.TypeKey, logp.EventType)
+	stats.deadLetter++
+	return false
+}
+
+// syncDeadLetterFile syncs the events written to the dead letter file.
+// Returns the events to retry, all of them if the file can't be synced.
+func (client *Client) syncDeadLetterFile(events []publisher.Event, stats *bulkResultStats) []publisher.Event {
+	if err := client.deadLetterFile.sync(); err != nil {
+		client.log.Errorf("Failed to sync the dead letter file, retrying %d events: %v", len(events), err)
+		stats.deadLetter -= len(events)
+		stats.fails += len(events)
+		return events
+	}
+	return nil
+}
+
+// writeBatchToDeadLetterFile writes the events of a batch that is too large
+// for Elasticsearch to the dead letter file, retrying the events that
+// couldn't be written.
+func (client *Client) writeBatchToDeadLetterFile(batch publisher.Batch, events []publisher.Event) {
+	itemMessage, _ := json.Marshal("the bulk payload is too large for the server")
+	var eventsToRetry, written []publisher.Event
+	stats := bulkResultStats{}
+	for _, event := range events {
+		encodedEvent := event.EncodedEvent.(*encodedEvent) //nolint:errcheck //safe to ignore type check
+		if client.writeToDeadLetterFile(encodedEvent, http.StatusRequestEntityTooLarge, itemMessage, &stats) {
+			eventsToRetry = append(eventsToRetry, event)
+		} else {
+			written = append(written, event)
+		}
+	}
+	if len(written) > 0 {
+		eventsToRetry = append(eventsToRetry, client.syncDeadLetterFile(written, &stats)...)
+	}
+	stats.reportToObserver(client.observer)
+	if len(eventsToRetry) > 0 {
+		batch.RetryEvents(eventsToRetry)
+	} else {
+		batch.ACK()
+	}
+}
+
 func (client *Client) Connect(ctx context.Context) error {
 	return client.conn.Connect(ctx)
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
 )
 
 func TestValidDropPolicyConfig(t *testing.T) {
@@ -58,6 +59,59 @@ non_indexable_policy.dead_letter_index:
 	assert.Equal(t, "my-dead-letter-index", index, "index should match config")
 }
 
+func TestDeadLetterFilePolicyConfig(t *testing.T) {
+	c := conf.MustNewConfigFrom(map[string]interface{}{
+		"non_indexable_policy.dead_letter_file.path": t.TempDir(),
+	})
+	elasticsearchOutputConfig, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input")
+	}
+	index, err := deadLetterIndexForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+	if err != nil {
+		t.Fatalf("Can't read non-indexable policy: %v", err.Error())
+	}
+	assert.Equal(t, "", index, "dead letter index should be empty string")
+
+	logger := logptest.NewTestingLogger(t, "")
+	deadLetterFile, err := deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy, logger)
+	if err != nil {
+		t.Fatalf("Can't read non-indexable policy: %v", err.Error())
+	}
+	assert.NotNil(t, deadLetterFile, "dead letter file should be set")
+}
+
+func TestInvalidDeadLetterFilePolicyConfig(t *testing.T) {
+	tests := map[string]string{
+		"rotate_every_kb zero": `
+non_indexable_policy.dead_letter_file:
+    rotate_every_kb: 0
+`,
+		"number_of_files too small": `
+non_indexable_policy.dead_letter_file:
+    number_of_files: 1
+`,
+		"number_of_files too large": `
+non_indexable_policy.dead_letter_file:
+    number_of_files: 1025
+`,
+	}
+
+	logger := logptest.NewTestingLogger(t, "")
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := conf.MustNewConfigFrom(test)
+			elasticsearchOutputConfig, err := readConfig(c)
+			if err != nil {
+				t.Fatalf("Can't create test configuration from valid input")
+			}
+
+			_, err = deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy, logger)
+			assert.Error(t, err, "Invalid dead letter file config should produce an error")
+		})
+	}
+}
+
 func TestInvalidNonIndexablePolicyConfig(t *testing.T) {
 	tests := map[string]string{
 		"non_indexable_policy with invalid policy": `
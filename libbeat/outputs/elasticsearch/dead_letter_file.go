@@ -0,0 +1,352 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/jsontransform"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const dead_letter_file = "dead_letter_file"
+
+// DeadLetterRecord is a line of a dead letter file. It holds an event that
+// Elasticsearch rejected together with the error of its bulk response item.
+type DeadLetterRecord struct {
+	// Timestamp is the time the event was rejected.
+	Timestamp time.Time `json:"@timestamp"`
+	Index     string    `json:"index"`
+	Pipeline  string    `json:"pipeline,omitempty"`
+	Meta      mapstr.M  `json:"@metadata,omitempty"`
+	// Event is the document as it was sent to Elasticsearch.
+	Event json.RawMessage `json:"event"`
+	Error DeadLetterError `json:"error"`
+}
+
+// DeadLetterError describes why Elasticsearch rejected an event.
+type DeadLetterError struct {
+	Status int `json:"status"`
+	// Item is the error object of the bulk response item, or a JSON string
+	// if the error didn't come from a bulk response item.
+	Item json.RawMessage `json:"item,omitempty"`
+}
+
+// BeatEvent restores the event of the record, including its metadata.
+func (r *DeadLetterRecord) BeatEvent() (beat.Event, error) {
+	var fields mapstr.M
+	decoder := json.NewDecoder(bytes.NewReader(r.Event))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return beat.Event{}, fmt.Errorf("invalid event: %w", err)
+	}
+	if fields == nil {
+		return beat.Event{}, errors.New("missing event")
+	}
+	jsontransform.TransformNumbers(fields)
+
+	event := beat.Event{Timestamp: r.Timestamp, Fields: fields}
+	if r.Meta != nil {
+		event.Meta = r.Meta.Clone()
+	}
+	if ts, ok := fields["@timestamp"].(string); ok {
+		timestamp, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return beat.Event{}, fmt.Errorf("invalid @timestamp: %w", err)
+		}
+		event.Timestamp = timestamp
+		delete(fields, "@timestamp")
+	}
+	return event, nil
+}
+
+type deadLetterFileConfig struct {
+	Path              string `config:"path"`
+	Filename          string `config:"filename"`
+	RotateEveryKb     uint   `config:"rotate_every_kb" validate:"min=1"`
+	NumberOfFiles     uint   `config:"number_of_files" validate:"min=2,max=1024"`
+	DeleteOldestFiles bool   `config:"delete_oldest_files"`
+	Permissions       uint32 `config:"permissions"`
+}
+
+func defaultDeadLetterFileConfig() deadLetterFileConfig {
+	return deadLetterFileConfig{
+		Filename:      "elasticsearch",
+		RotateEveryKb: 10 * 1024,
+		NumberOfFiles: 1024,
+		Permissions:   0600,
+	}
+}
+
+// errDeadLetterFileFull is returned when number_of_files is reached and the
+// oldest files can't be deleted.
+var errDeadLetterFileFull = errors.New("the dead letter file reached number_of_files")
+
+// deadLetterFile writes rejected events to rotating NDJSON files. Every
+// record is synced to disk before the event is acknowledged.
+type deadLetterFile struct {
+	log  *logp.Logger
+	path string
+
+	mutex   sync.Mutex
+	config  deadLetterFileConfig
+	rotator *file.Rotator
+	size    uint // size of the active file.
+	rotated uint // number of rotated files.
+}
+
+// deadLetterFiles holds the dead letter files by path, so all clients of
+// an output, and the outputs created on reload, share the same writer.
+var deadLetterFiles = struct {
+	mutex sync.Mutex
+	files map[string]*deadLetterFile
+}{files: map[string]*deadLetterFile{}}
+
+// deadLetterFilesDeleted counts the dead letter files that were deleted
+// because number_of_files was exceeded and delete_oldest_files is set.
+var deadLetterFilesDeleted = monitoring.NewUint(nil, "libbeat.dead_letter_file.deleted_files")
+
+func deadLetterFileForConfig(cfg *config.C, log *logp.Logger) (*deadLetterFile, error) {
+	fileConfig := defaultDeadLetterFileConfig()
+	if cfg != nil {
+		if err := cfg.Unpack(&fileConfig); err != nil {
+			return nil, err
+		}
+	}
+	dir := fileConfig.Path
+	if dir == "" {
+		dir = paths.Resolve(paths.Data, "dead_letter")
+	}
+	path := filepath.Join(dir, fileConfig.Filename)
+
+	deadLetterFiles.mutex.Lock()
+	defer deadLetterFiles.mutex.Unlock()
+	if f, ok := deadLetterFiles.files[path]; ok {
+		if err := f.setConfig(fileConfig); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	f := &deadLetterFile{
+		log:  log.Named("dead_letter_file"),
+		path: path,
+	}
+	if err := f.setConfig(fileConfig); err != nil {
+		return nil, err
+	}
+	deadLetterFiles.files[path] = f
+	log.Infof("Writing events rejected by Elasticsearch to the dead letter file %v", path)
+	return f, nil
+}
+
+// setConfig replaces the rotator if the settings changed. The outputs that
+// still use the file write to the new rotator as well.
+func (f *deadLetterFile) setConfig(fileConfig deadLetterFileConfig) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.rotator != nil && f.config == fileConfig {
+		return nil
+	}
+
+	// The files are rotated and purged by the dead letter file, so that it
+	// knows when number_of_files is reached and every deleted file is
+	// reported. The limits only keep the rotator from doing it itself.
+	rotator, err := file.NewFileRotator(
+		f.path,
+		file.MaxSizeBytes(math.MaxUint),
+		file.MaxBackups(file.MaxBackupsLimit),
+		file.RotateOnStartup(false),
+		file.Permissions(os.FileMode(fileConfig.Permissions)),
+		file.WithLogger(f.log.With(logp.Namespace("rotator"))),
+	)
+	if err != nil {
+		return err
+	}
+	if f.rotator != nil {
+		f.log.Infof("Dead letter file settings changed, reopening %v", f.path)
+		if err := f.rotator.Close(); err != nil {
+			f.log.Warnf("Failed to close dead letter file: %v", err)
+		}
+	}
+	f.config = fileConfig
+	f.rotator = rotator
+
+	// The rotator appends to the newest file.
+	f.size, f.rotated = 0, 0
+	if files := f.files(); len(files) > 0 {
+		if info, err := os.Stat(files[len(files)-1]); err == nil {
+			f.size = uint(info.Size())
+		}
+		f.rotated = uint(len(files) - 1)
+	}
+	return nil
+}
+
+func deadLetterFileForPolicy(configNamespace *config.Namespace, log *logp.Logger) (*deadLetterFile, error) {
+	if configNamespace == nil || configNamespace.Name() != dead_letter_file {
+		return nil, nil
+	}
+	return deadLetterFileForConfig(configNamespace.Config(), log)
+}
+
+// write appends a record for the event to the file. The record must be
+// synced with sync before the event is acknowledged.
+func (f *deadLetterFile) write(event *encodedEvent, status int, itemError []byte) error {
+	record := DeadLetterRecord{
+		Timestamp: time.Now().UTC(),
+		Index:     event.index,
+		Pipeline:  event.pipeline,
+		Meta:      event.meta,
+		Event:     event.encoding,
+		Error:     DeadLetterError{Status: status},
+	}
+	if json.Valid(itemError) {
+		record.Error.Item = itemError
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter record: %w", err)
+	}
+	line = append(line, '\n')
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.size > 0 && f.size+uint(len(line)) > f.config.RotateEveryKb*1024 {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.rotator.Write(line)
+	f.size += uint(n)
+	return err
+}
+
+// sync commits the written records to disk.
+func (f *deadLetterFile) sync() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.rotator.Sync()
+}
+
+// rotate starts a new file. When number_of_files is reached, the oldest
+// files are deleted if delete_oldest_files is set, otherwise
+// errDeadLetterFileFull is returned so that the events are retried.
+func (f *deadLetterFile) rotate() error {
+	if f.rotated >= f.config.NumberOfFiles && !f.config.DeleteOldestFiles {
+		// Files may have been deleted once their events were reinjected.
+		f.rotated = uint(max(len(f.files())-1, 0))
+		if f.rotated >= f.config.NumberOfFiles {
+			return errDeadLetterFileFull
+		}
+	}
+	// The records of the active file are synced before it is closed.
+	if err := f.rotator.Sync(); err != nil {
+		return err
+	}
+	if err := f.rotator.Rotate(); err != nil {
+		return err
+	}
+	f.size = 0
+	f.rotated++
+	if f.config.DeleteOldestFiles {
+		f.purge()
+	}
+	return nil
+}
+
+// purge deletes the oldest rotated files that exceed number_of_files. It is
+// called after a rotation, before the new file is created. The events in
+// deleted files are lost, so every deleted file is logged and counted.
+func (f *deadLetterFile) purge() {
+	rotated := f.files()
+	f.rotated = uint(len(rotated))
+	if f.rotated <= f.config.NumberOfFiles {
+		return
+	}
+	for _, path := range rotated[:f.rotated-f.config.NumberOfFiles] {
+		if err := os.Remove(path); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				f.log.Errorf("Failed to delete dead letter file %v: %v", path, err)
+			}
+			continue
+		}
+		f.rotated--
+		deadLetterFilesDeleted.Inc()
+		f.log.Warnf("Deleted dead letter file %v with the events it holds, "+
+			"as the number of files exceeds number_of_files (%d)", path, f.config.NumberOfFiles)
+	}
+}
+
+// deadLetterFileName matches the names of the files written by the
+// rotator after the filename, -{date}[-{index}].ndjson, and captures the
+// date and index.
+var deadLetterFileName = regexp.MustCompile(`^-(\d{8})(?:-(\d+))?\.ndjson$`)
+
+// files returns the dead letter files, oldest first, in the same order the
+// rotator uses.
+func (f *deadLetterFile) files() []string {
+	paths, err := filepath.Glob(f.path + "-*.ndjson")
+	if err != nil {
+		f.log.Errorf("Failed to list dead letter files: %v", err)
+		return nil
+	}
+
+	type order struct {
+		date  string
+		index int
+	}
+	files := make([]string, 0, len(paths))
+	orders := make(map[string]order, len(paths))
+	for _, path := range paths {
+		match := deadLetterFileName.FindStringSubmatch(path[len(f.path):])
+		if match == nil {
+			continue
+		}
+		o := order{date: match[1]}
+		if match[2] != "" {
+			o.index, _ = strconv.Atoi(match[2])
+		}
+		files = append(files, path)
+		orders[path] = o
+	}
+	sort.Slice(files, func(i, j int) bool {
+		a, b := orders[files[i]], orders[files[j]]
+		if a.date != b.date {
+			return a.date < b.date
+		}
+		return a.index < b.index
+	})
+	return files
+}
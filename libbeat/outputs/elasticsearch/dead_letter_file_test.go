@@ -0,0 +1,278 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestCollectPublishFailDeadLetterFile(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	dir := t.TempDir()
+	deadLetterFile, err := deadLetterFileForConfig(config.MustNewConfigFrom(mapstr.M{
+		"path": dir,
+	}), logger)
+	require.NoError(t, err)
+	client, err := NewClient(
+		clientSettings{
+			observer:       outputs.NewNilObserver(),
+			deadLetterFile: deadLetterFile,
+		},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	response := []byte(`
+{
+	"items": [
+		{"create": {"status": 200}},
+		{
+			"create": {
+				"error" : {"type": "mapper_parsing_exception", "reason": "failed to parse field [bar]"},
+				"status" : 400
+			}
+		},
+		{"create": {"status": 200}}
+	]
+}`)
+
+	timestamp := time.Date(2024, 5, 1, 10, 20, 30, 123000000, time.UTC)
+	event1 := encodeEvent(client, publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": 1}}})
+	event2 := encodeEvent(client, publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": 2}}})
+	eventFail := encodeEvent(client, publisher.Event{Content: beat.Event{
+		Timestamp: timestamp,
+		Meta:      mapstr.M{"_id": "abc"},
+		Fields:    mapstr.M{"bar": "bar1", "count": int64(1) << 60},
+	}})
+	events := []publisher.Event{event1, eventFail, event2}
+
+	res, stats := client.bulkCollectPublishFails(bulkResult{
+		events:   events,
+		status:   200,
+		response: response,
+	})
+	assert.Equal(t, bulkResultStats{acked: 2, deadLetter: 1}, stats)
+	assert.Empty(t, res, "events written to the dead letter file should not be retried")
+
+	records := readDeadLetterRecords(t, dir)
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, 400, record.Error.Status)
+	assert.JSONEq(t,
+		`{"type": "mapper_parsing_exception", "reason": "failed to parse field [bar]"}`,
+		string(record.Error.Item))
+	assert.Equal(t, mapstr.M{"_id": "abc"}, record.Meta)
+
+	event, err := record.BeatEvent()
+	require.NoError(t, err)
+	assert.True(t, timestamp.Equal(event.Timestamp), "the event timestamp should be restored")
+	assert.Equal(t, mapstr.M{"bar": "bar1", "count": int64(1) << 60}, event.Fields)
+	assert.Equal(t, mapstr.M{"_id": "abc"}, event.Meta)
+}
+
+func TestCollectPublishFailDeadLetterFileRetriesOnWriteError(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	// The dead letter directory can't be created below a regular file.
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, nil, 0600))
+	deadLetterFile, err := deadLetterFileForConfig(config.MustNewConfigFrom(mapstr.M{
+		"path": filepath.Join(parent, "dead_letter"),
+	}), logger)
+	require.NoError(t, err)
+	client, err := NewClient(
+		clientSettings{
+			observer:       outputs.NewNilObserver(),
+			deadLetterFile: deadLetterFile,
+		},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+
+	response := []byte(`{"items": [{"create": {"status": 400, "error": "rejected"}}]}`)
+	eventFail := encodeEvent(client, publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": "bar1"}}})
+
+	res, stats := client.bulkCollectPublishFails(bulkResult{
+		events:   []publisher.Event{eventFail},
+		status:   200,
+		response: response,
+	})
+	assert.Equal(t, bulkResultStats{fails: 1}, stats)
+	assert.Equal(t, []publisher.Event{eventFail}, res, "the event should be retried")
+}
+
+func TestDeadLetterFileIsShared(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	cfg := config.MustNewConfigFrom(mapstr.M{"path": t.TempDir()})
+	first, err := deadLetterFileForConfig(cfg, logger)
+	require.NoError(t, err)
+	second, err := deadLetterFileForConfig(cfg, logger)
+	require.NoError(t, err)
+	assert.Same(t, first, second, "outputs writing to the same path should share the writer")
+
+	// Changed settings replace the rotator of the shared writer.
+	rotator := first.rotator
+	require.NoError(t, cfg.SetInt("rotate_every_kb", -1, 1))
+	third, err := deadLetterFileForConfig(cfg, logger)
+	require.NoError(t, err)
+	assert.Same(t, first, third)
+	assert.NotSame(t, rotator, third.rotator, "the rotator should be replaced")
+	assert.Equal(t, uint(1), third.config.RotateEveryKb)
+}
+
+func TestDeadLetterFileReportsDeletedFiles(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	dir := t.TempDir()
+	f, err := deadLetterFileForConfig(config.MustNewConfigFrom(mapstr.M{
+		"path":            dir,
+		"rotate_every_kb":     1,
+		"number_of_files":     2,
+		"delete_oldest_files": true,
+	}), logger)
+	require.NoError(t, err)
+	// Files of other writers in the same directory are never deleted.
+	other := filepath.Join(dir, "elasticsearch-other-20240501.ndjson")
+	require.NoError(t, os.WriteFile(other, nil, 0600))
+
+	deleted := deadLetterFilesDeleted.Get()
+	event := &encodedEvent{
+		index:    "logs",
+		encoding: []byte(`{"message": "` + strings.Repeat("a", 600) + `"}`),
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, f.write(event, 400, nil))
+	}
+	require.NoError(t, f.sync())
+
+	files := f.files()
+	assert.Len(t, files, 3, "number_of_files rotated files and the active file should be kept")
+	assert.FileExists(t, other)
+	assert.Greater(t, deadLetterFilesDeleted.Get(), deleted, "deleted files should be counted")
+}
+
+func TestDeadLetterFileFull(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	dir := t.TempDir()
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"path":            dir,
+		"rotate_every_kb": 1,
+		"number_of_files": 2,
+	})
+	f, err := deadLetterFileForConfig(cfg, logger)
+	require.NoError(t, err)
+
+	deleted := deadLetterFilesDeleted.Get()
+	event := &encodedEvent{
+		index:    "logs",
+		encoding: []byte(`{"message": "` + strings.Repeat("a", 600) + `"}`),
+	}
+	// Each file holds one record.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, f.write(event, 400, nil))
+	}
+	require.NoError(t, f.sync())
+
+	// No file is deleted by default, events are rejected instead.
+	assert.ErrorIs(t, f.write(event, 400, nil), errDeadLetterFileFull)
+	files := f.files()
+	assert.Len(t, files, 3)
+	assert.Equal(t, deleted, deadLetterFilesDeleted.Get())
+
+	// Files deleted once their events are reinjected make room for new ones.
+	require.NoError(t, os.Remove(files[0]))
+	assert.NoError(t, f.write(event, 400, nil))
+
+	// The number of files is restored when the file is reopened.
+	require.NoError(t, cfg.SetInt("rotate_every_kb", -1, 2))
+	_, err = deadLetterFileForConfig(cfg, logger)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), f.rotated)
+}
+
+func TestDeadLetterRecordBeatEvent(t *testing.T) {
+	tests := map[string]struct {
+		record string
+		fields mapstr.M
+		err    bool
+	}{
+		"event": {
+			record: `{"event": {"message": "hello", "size": 12, "ratio": 0.5}}`,
+			fields: mapstr.M{"message": "hello", "size": int64(12), "ratio": 0.5},
+		},
+		"missing event": {
+			record: `{"index": "logs"}`,
+			err:    true,
+		},
+		"invalid timestamp": {
+			record: `{"event": {"@timestamp": "yesterday"}}`,
+			err:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var record DeadLetterRecord
+			require.NoError(t, json.Unmarshal([]byte(test.record), &record))
+			event, err := record.BeatEvent()
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.fields, event.Fields)
+		})
+	}
+}
+
+func readDeadLetterRecords(t *testing.T, dir string) []DeadLetterRecord {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "elasticsearch*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []DeadLetterRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record DeadLetterRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	require.NoError(t, scanner.Err())
+	return records
+}
@@ -71,6 +71,11 @@ func makeES(
 		log.Errorf("error in non_indexable_policy: %v", err)
 		return outputs.Fail(err)
 	}
+	deadLetterFile, err := deadLetterFileForPolicy(esConfig.NonIndexablePolicy, log)
+	if err != nil {
+		log.Errorf("error in non_indexable_policy: %v", err)
+		return outputs.Fail(err)
+	}
 
 	hosts, err := outputs.ReadHostList(cfg)
 	if err != nil {
@@ -120,6 +125,7 @@ func makeES(
 			pipelineSelector: pipelineSelector,
 			observer:         observer,
 			deadLetterIndex:  deadLetterIndex,
+			deadLetterFile:   deadLetterFile,
 		}, &connectCallbackRegistry, log)
 		if err != nil {
 			return outputs.Fail(err)
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// routeNamePattern restricts route names to characters that are safe in
+// metric names and file paths.
+var routeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type fanoutConfig struct {
+	Routes []*config.C `config:"routes" validate:"required"`
+}
+
+type routeConfig struct {
+	Name string             `config:"name" validate:"required"`
+	When *conditions.Config `config:"when"`
+
+	// The output type and its settings, which are read from the only other
+	// field of the route.
+	outputType string
+	output     *config.C
+}
+
+func (c *routeConfig) Validate() error {
+	if !routeNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid route name '%v', only letters, digits, '_' and '-' are allowed", c.Name)
+	}
+	return nil
+}
+
+func readRouteConfig(cfg *config.C) (routeConfig, error) {
+	rc := routeConfig{}
+	if err := cfg.Unpack(&rc); err != nil {
+		return rc, err
+	}
+
+	for _, field := range cfg.GetFields() {
+		if field == "name" || field == "when" {
+			continue
+		}
+		if rc.outputType != "" {
+			return rc, fmt.Errorf("route '%v' configures more than one output: '%v' and '%v'",
+				rc.Name, rc.outputType, field)
+		}
+		rc.outputType = field
+	}
+	if rc.outputType == "" {
+		return rc, fmt.Errorf("route '%v' configures no output", rc.Name)
+	}
+	if rc.outputType == "fanout" {
+		return rc, errors.New("fanout outputs can not be nested")
+	}
+
+	var err error
+	rc.output, err = cfg.Child(rc.outputType, -1)
+	if err != nil {
+		return rc, fmt.Errorf("route '%v': %w", rc.Name, err)
+	}
+	return rc, nil
+}
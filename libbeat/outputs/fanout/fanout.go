@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package fanout provides an output that sends events to several outputs,
+// each of which only receives the events matching its condition.
+package fanout
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func init() {
+	outputs.RegisterType("fanout", makeFanout)
+}
+
+// makeFanout loads the output of every route. The publisher pipeline
+// creates a queue per route and ACKs an event once all routes it matched
+// have ACKed it.
+func makeFanout(
+	im outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	fc := fanoutConfig{}
+	if err := cfg.Unpack(&fc); err != nil {
+		return outputs.Fail(err)
+	}
+
+	log := beat.Logger.Named("fanout")
+	names := map[string]bool{}
+	routes := make([]outputs.Route, 0, len(fc.Routes))
+	for _, routeCfg := range fc.Routes {
+		rc, err := readRouteConfig(routeCfg)
+		if err != nil {
+			closeRoutes(routes)
+			return outputs.Fail(err)
+		}
+		if names[rc.Name] {
+			closeRoutes(routes)
+			return outputs.Fail(fmt.Errorf("duplicate route name '%v'", rc.Name))
+		}
+		names[rc.Name] = true
+
+		if !rc.output.Enabled() {
+			log.Infof("Output of route '%v' is disabled", rc.Name)
+			continue
+		}
+		route, err := makeRoute(im, beat, observer, rc)
+		if err != nil {
+			closeRoutes(routes)
+			return outputs.Fail(fmt.Errorf("route '%v': %w", rc.Name, err))
+		}
+		routes = append(routes, route)
+		log.Infof("Initialized route '%v' with %v output", rc.Name, rc.outputType)
+	}
+	if len(routes) == 0 {
+		return outputs.Fail(errors.New("no enabled routes configured"))
+	}
+
+	return outputs.Group{Routes: routes}, nil
+}
+
+func makeRoute(
+	im outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	rc routeConfig,
+) (outputs.Route, error) {
+	var condition conditions.Condition
+	if rc.When != nil {
+		var err error
+		condition, err = conditions.NewCondition(rc.When)
+		if err != nil {
+			return outputs.Route{}, fmt.Errorf("invalid condition: %w", err)
+		}
+	}
+
+	group, err := outputs.Load(im, beat, observer, rc.outputType, rc.output)
+	if err != nil {
+		return outputs.Route{}, err
+	}
+	if len(group.Clients) == 0 {
+		return outputs.Route{}, fmt.Errorf("%v output has no clients", rc.outputType)
+	}
+
+	return outputs.Route{
+		Name:      rc.Name,
+		Condition: condition,
+		Group:     group,
+	}, nil
+}
+
+func closeRoutes(routes []outputs.Route) {
+	for _, route := range routes {
+		for _, client := range route.Group.Clients {
+			client.Close()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fanout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/discard"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMakeFanout(t *testing.T) {
+	group := makeTestFanout(t, map[string]interface{}{
+		"routes": []interface{}{
+			map[string]interface{}{
+				"name":    "nginx",
+				"when":    map[string]interface{}{"equals": map[string]interface{}{"event.module": "nginx"}},
+				"discard": map[string]interface{}{},
+			},
+			map[string]interface{}{
+				"name":    "archive",
+				"discard": map[string]interface{}{},
+			},
+			map[string]interface{}{
+				"name":    "disabled",
+				"discard": map[string]interface{}{"enabled": false},
+			},
+		},
+	})
+
+	assert.Empty(t, group.Clients)
+	require.Len(t, group.Routes, 2, "the disabled route should be skipped")
+
+	nginx := group.Routes[0]
+	assert.Equal(t, "nginx", nginx.Name)
+	assert.Len(t, nginx.Group.Clients, 1)
+	require.NotNil(t, nginx.Condition)
+	assert.True(t, nginx.Condition.Check(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"module": "nginx"}}}))
+	assert.False(t, nginx.Condition.Check(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"module": "system"}}}))
+
+	archive := group.Routes[1]
+	assert.Equal(t, "archive", archive.Name)
+	assert.Len(t, archive.Group.Clients, 1)
+	assert.Nil(t, archive.Condition, "a route without condition should match all events")
+}
+
+func TestMakeFanoutErrors(t *testing.T) {
+	tests := map[string][]interface{}{
+		"no routes": nil,
+		"missing name": {
+			map[string]interface{}{"discard": map[string]interface{}{}},
+		},
+		"invalid name": {
+			map[string]interface{}{"name": "a/b", "discard": map[string]interface{}{}},
+		},
+		"duplicate name": {
+			map[string]interface{}{"name": "a", "discard": map[string]interface{}{}},
+			map[string]interface{}{"name": "a", "discard": map[string]interface{}{}},
+		},
+		"no output": {
+			map[string]interface{}{"name": "a"},
+		},
+		"two outputs": {
+			map[string]interface{}{
+				"name":    "a",
+				"discard": map[string]interface{}{},
+				"console": map[string]interface{}{},
+			},
+		},
+		"unknown output": {
+			map[string]interface{}{"name": "a", "unknown": map[string]interface{}{}},
+		},
+		"nested fanout": {
+			map[string]interface{}{"name": "a", "fanout": map[string]interface{}{}},
+		},
+		"invalid condition": {
+			map[string]interface{}{
+				"name":    "a",
+				"when":    map[string]interface{}{"unknown": map[string]interface{}{}},
+				"discard": map[string]interface{}{},
+			},
+		},
+		"all disabled": {
+			map[string]interface{}{"name": "a", "discard": map[string]interface{}{"enabled": false}},
+		},
+	}
+
+	for name, routes := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(map[string]interface{}{"routes": routes})
+			beatInfo := beat.Info{Logger: logptest.NewTestingLogger(t, "")}
+			_, err := makeFanout(nil, beatInfo, outputs.NewNilObserver(), cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func makeTestFanout(t *testing.T, settings map[string]interface{}) outputs.Group {
+	t.Helper()
+	beatInfo := beat.Info{Logger: logptest.NewTestingLogger(t, "")}
+	group, err := makeFanout(nil, beatInfo, outputs.NewNilObserver(), config.MustNewConfigFrom(settings))
+	require.NoError(t, err)
+	return group
+}
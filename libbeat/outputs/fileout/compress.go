@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// compressorQueueSize is the number of rotated files that can wait for
+// compression before rotating blocks.
+const compressorQueueSize = 64
+
+// Compression selects how rotated files are compressed.
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// Unpack implements config.StringUnpacker.
+func (c *Compression) Unpack(s string) error {
+	switch strings.ToLower(s) {
+	case "", "none":
+		*c = CompressionNone
+	case "gzip":
+		*c = CompressionGzip
+	case "zstd":
+		*c = CompressionZstd
+	default:
+		return fmt.Errorf("unknown compression %q, must be one of none, gzip or zstd", s)
+	}
+	return nil
+}
+
+// suffix returns the file name suffix of compressed files.
+func (c Compression) suffix() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (c Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("no writer for compression %v", c)
+	}
+}
+
+// compressor compresses rotated files in the background. The compressed
+// file replaces the original once it is complete, it keeps the
+// modification time of the original so the order of rotated files is
+// preserved.
+type compressor struct {
+	log         *logp.Logger
+	compression Compression
+
+	jobs chan string
+	wg   sync.WaitGroup
+}
+
+func newCompressor(log *logp.Logger, compression Compression) *compressor {
+	c := &compressor{
+		log:         log,
+		compression: compression,
+		jobs:        make(chan string, compressorQueueSize),
+	}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for path := range c.jobs {
+			if err := c.compressFile(path); err != nil {
+				c.log.Errorf("Failed to compress rotated file %v: %v", path, err)
+			}
+		}
+	}()
+	return c
+}
+
+// Compress queues a file for compression. It must not be called after
+// Close.
+func (c *compressor) Compress(path string) {
+	c.jobs <- path
+}
+
+// Close waits for all queued files to be compressed.
+func (c *compressor) Close() {
+	close(c.jobs)
+	c.wg.Wait()
+}
+
+func (c *compressor) compressFile(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Purged before it was compressed.
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	target := path + c.compression.suffix()
+	tmp := target + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, stat.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	w, err := c.compression.newWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp, stat.ModTime(), stat.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, target); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
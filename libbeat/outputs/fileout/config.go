@@ -18,8 +18,12 @@
 package fileout
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/elastic/beats/v7/libbeat/common/dtfmt"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -29,7 +33,11 @@ type fileOutConfig struct {
 	Path            *PathFormatString `config:"path"`
 	Filename        string            `config:"filename"`
 	RotateEveryKb   uint              `config:"rotate_every_kb" validate:"min=1"`
+	RotateEvery     time.Duration     `config:"rotate_every"`
 	NumberOfFiles   uint              `config:"number_of_files"`
+	TimestampFormat string            `config:"timestamp_format"`
+	Compression     Compression       `config:"compression"`
+	MaxOpenFiles    int               `config:"max_open_files" validate:"min=1"`
 	Codec           codec.Config      `config:"codec"`
 	Permissions     uint32            `config:"permissions"`
 	RotateOnStartup bool              `config:"rotate_on_startup"`
@@ -41,6 +49,8 @@ func defaultConfig() fileOutConfig {
 		Path:            &PathFormatString{},
 		NumberOfFiles:   7,
 		RotateEveryKb:   10 * 1024,
+		TimestampFormat: defaultTimestampFormat,
+		MaxOpenFiles:    64,
 		Permissions:     0600,
 		RotateOnStartup: true,
 	}
@@ -64,5 +74,18 @@ func (c *fileOutConfig) Validate() error {
 			file.MaxBackupsLimit)
 	}
 
+	if c.RotateEvery != 0 && c.RotateEvery < time.Second {
+		return errors.New("rotate_every must be at least 1s")
+	}
+
+	timestamp, err := dtfmt.Format(time.Now(), c.TimestampFormat)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp_format '%s': %w", c.TimestampFormat, err)
+	}
+	if timestamp == "" || strings.ContainsAny(timestamp, `/\`) {
+		return fmt.Errorf("timestamp_format '%s' must not be empty or contain path separators",
+			c.TimestampFormat)
+	}
+
 	return nil
 }
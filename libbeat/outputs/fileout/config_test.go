@@ -40,6 +40,8 @@ func TestConfig(t *testing.T) {
 					Path:            &PathFormatString{},
 					NumberOfFiles:   7,
 					RotateEveryKb:   10 * 1024,
+					TimestampFormat: "yyyyMMdd",
+					MaxOpenFiles:    64,
 					Permissions:     0600,
 					RotateOnStartup: true,
 				}
@@ -91,6 +93,38 @@ func TestConfig(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		"time based rotation and compression": {
+			config: config.MustNewConfigFrom(mapstr.M{
+				"path":             "/tmp/packetbeat",
+				"rotate_every":     "1h",
+				"timestamp_format": "yyyy-MM-dd-HH",
+				"compression":      "zstd",
+			}),
+			assertion: func(t *testing.T, actual *fileOutConfig, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, time.Hour, actual.RotateEvery)
+				assert.Equal(t, "yyyy-MM-dd-HH", actual.TimestampFormat)
+				assert.Equal(t, CompressionZstd, actual.Compression)
+			},
+		},
+		"invalid rotate_every": {
+			config: config.MustNewConfigFrom(mapstr.M{"rotate_every": "500ms"}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.Error(t, err)
+			},
+		},
+		"timestamp_format with path separator": {
+			config: config.MustNewConfigFrom(mapstr.M{"timestamp_format": "yyyy/MM/dd"}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.Error(t, err)
+			},
+		},
+		"invalid compression": {
+			config: config.MustNewConfigFrom(mapstr.M{"compression": "lz4"}),
+			assertion: func(t *testing.T, _ *fileOutConfig, err error) {
+				assert.Error(t, err)
+			},
+		},
 	} {
 		t.Run(name, func(t *testing.T) {
 			isWindowsPath = test.useWindowsPath
@@ -19,9 +19,12 @@ package fileout
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -29,7 +32,6 @@ import (
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	c "github.com/elastic/elastic-agent-libs/config"
-	"github.com/elastic/elastic-agent-libs/file"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
 
@@ -42,8 +44,29 @@ type fileOutput struct {
 	filePath string
 	beat     beat.Info
 	observer outputs.Observer
-	rotator  *file.Rotator
 	codec    codec.Codec
+
+	// path is set if the path depends on the event, then a rotator is
+	// created for every directory. Only the rotators of open files are
+	// kept, a rotator is removed once its file is closed.
+	path         *PathFormatString
+	filename     string
+	settings     rotatorSettings
+	maxOpenFiles int
+	compressor   *compressor
+
+	mutex    sync.Mutex
+	rotator  *rotator
+	rotators map[string]*route
+	// lastUse counts writes to order routes by their last use.
+	lastUse uint64
+}
+
+// route is the rotator for one directory of a dynamic path.
+type route struct {
+	dir     string
+	rotator *rotator
+	lastUse uint64
 }
 
 // makeFileout instantiates a new file output instance.
@@ -71,47 +94,89 @@ func makeFileout(
 }
 
 func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
-	var path string
-	configPath, runErr := c.Path.Run(time.Now().UTC())
-	if runErr != nil {
-		return runErr
-	}
-	if c.Filename != "" {
-		path = filepath.Join(configPath, c.Filename)
-	} else {
-		path = filepath.Join(configPath, out.beat.Beat)
+	out.filename = c.Filename
+	if out.filename == "" {
+		out.filename = out.beat.Beat
 	}
 
-	out.filePath = path
-
 	var err error
-	out.rotator, err = file.NewFileRotator(
-		path,
-		file.MaxSizeBytes(c.RotateEveryKb*1024),
-		file.MaxBackups(c.NumberOfFiles),
-		file.Permissions(os.FileMode(c.Permissions)),
-		file.RotateOnStartup(c.RotateOnStartup),
-		file.WithLogger(beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
-	)
+	out.codec, err = codec.CreateEncoder(beat, c.Codec)
 	if err != nil {
 		return err
 	}
 
-	out.codec, err = codec.CreateEncoder(beat, c.Codec)
-	if err != nil {
-		return err
+	var header []byte
+	if enc, ok := out.codec.(codec.HeaderEncoder); ok {
+		if header = enc.Header(); header != nil {
+			header = append(header, '\n')
+		}
+	}
+
+	out.settings = rotatorSettings{
+		MaxSizeBytes:    c.RotateEveryKb * 1024,
+		MaxBackups:      c.NumberOfFiles,
+		Permissions:     os.FileMode(c.Permissions),
+		RotateOnStartup: c.RotateOnStartup,
+		StartTime:       time.Now(),
+		Interval:        c.RotateEvery,
+		TimestampFormat: c.TimestampFormat,
+		Header:          header,
+	}
+	out.maxOpenFiles = c.MaxOpenFiles
+
+	if c.Compression != CompressionNone {
+		out.compressor = newCompressor(out.log.Named("compressor"), c.Compression)
+	}
+
+	if c.Path.IsDynamic() {
+		out.path = c.Path
+		out.filePath = filepath.Join(c.Path.String(), out.filename)
+		out.rotators = map[string]*route{}
+	} else {
+		configPath, runErr := c.Path.Run(time.Now().UTC())
+		if runErr != nil {
+			return runErr
+		}
+		out.filePath = filepath.Join(configPath, out.filename)
+		out.rotator, err = out.newRotator(out.filePath)
+		if err != nil {
+			return err
+		}
 	}
 
 	out.log.Infof("Initialized file output. "+
-		"path=%v max_size_bytes=%v max_backups=%v permissions=%v",
-		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions))
+		"path=%v max_size_bytes=%v max_backups=%v permissions=%v rotate_every=%v compression=%v",
+		out.filePath, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions),
+		c.RotateEvery, c.Compression)
 
 	return nil
 }
 
+func (out *fileOutput) newRotator(path string) (*rotator, error) {
+	return newRotator(
+		out.beat.Logger.Named("rotator").With(logp.Namespace("rotator")),
+		path,
+		out.settings,
+		out.compressor,
+	)
+}
+
 // Implement Outputer
 func (out *fileOutput) Close() error {
-	return out.rotator.Close()
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	var errs []error
+	if out.rotator != nil {
+		errs = append(errs, out.rotator.Close())
+	}
+	for _, route := range out.rotators {
+		errs = append(errs, route.rotator.Close())
+	}
+	if out.compressor != nil {
+		out.compressor.Close()
+	}
+	return errors.Join(errs...)
 }
 
 func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
@@ -141,7 +206,7 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 		}
 
 		begin := time.Now()
-		if _, err = out.rotator.Write(append(serializedEvent, '\n')); err != nil {
+		if err = out.write(&event.Content, append(serializedEvent, '\n')); err != nil {
 			st.WriteError(err)
 
 			if event.Guaranteed() {
@@ -166,6 +231,78 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
+func (out *fileOutput) write(event *beat.Event, data []byte) error {
+	out.mutex.Lock()
+	defer out.mutex.Unlock()
+
+	r := out.rotator
+	if out.path != nil {
+		var err error
+		if r, err = out.route(event); err != nil {
+			return err
+		}
+	}
+	_, err := r.Write(data)
+	return err
+}
+
+// route returns the rotator for the event's directory. If more than
+// max_open_files files are open, the least recently used one is closed and
+// its rotator removed. A new rotator appends to the file again once the
+// directory receives events.
+func (out *fileOutput) route(event *beat.Event) (*rotator, error) {
+	dir, err := out.path.RunEvent(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate path: %w", err)
+	}
+	for _, elem := range strings.FieldsFunc(dir, isPathSeparator) {
+		if elem == ".." {
+			return nil, fmt.Errorf("path '%s' must not contain '..'", dir)
+		}
+	}
+
+	out.lastUse++
+	rt, ok := out.rotators[dir]
+	if !ok {
+		r, err := out.newRotator(filepath.Join(dir, out.filename))
+		if err != nil {
+			return nil, err
+		}
+		rt = &route{dir: dir, rotator: r}
+		out.closeIdle()
+		out.rotators[dir] = rt
+	}
+	rt.lastUse = out.lastUse
+	return rt.rotator, nil
+}
+
+// closeIdle closes and removes the least recently used routes until a new
+// one can be added without exceeding max_open_files. Routes whose file
+// could not be opened are removed as well.
+func (out *fileOutput) closeIdle() {
+	for dir, rt := range out.rotators {
+		if !rt.rotator.IsOpen() {
+			delete(out.rotators, dir)
+		}
+	}
+	for len(out.rotators) >= out.maxOpenFiles {
+		var oldest *route
+		for _, rt := range out.rotators {
+			if oldest == nil || rt.lastUse < oldest.lastUse {
+				oldest = rt
+			}
+		}
+		if err := oldest.rotator.Close(); err != nil {
+			out.log.Warnf("Failed to close idle file: %+v", err)
+		}
+		delete(out.rotators, oldest.dir)
+	}
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/' || r == os.PathSeparator
+}
+
 func (out *fileOutput) String() string {
 	return "file(" + out.filePath + ")"
 }
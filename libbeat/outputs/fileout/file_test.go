@@ -18,3 +18,115 @@
 //go:build !integration
 
 package fileout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/csv"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/format"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFileOutputWritesCSVHeader(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"path":            dir,
+		"filename":        "out",
+		"rotate_every_kb": 1,
+		"codec.csv": mapstr.M{
+			"fields": []string{"message", "count"},
+			"header": true,
+		},
+	})
+
+	group, err := makeFileout(nil,
+		beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")},
+		outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	client := group.Clients[0]
+
+	// Every event takes up 500 bytes, so each file holds two of them.
+	var events []beat.Event
+	for i := 0; i < 5; i++ {
+		events = append(events, beat.Event{Fields: mapstr.M{
+			"message": string(make([]byte, 490)),
+			"count":   i,
+		}})
+	}
+	require.NoError(t, client.Publish(context.Background(), outest.NewBatch(events...)))
+	require.NoError(t, client.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "out-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Regexp(t, `^message,count\n(\x00+,\d\n){1,2}$`, string(content))
+	}
+}
+
+func TestFileOutputRoutesByPath(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"path":           filepath.Join(dir, "%{[data_stream.dataset]}"),
+		"filename":       "out",
+		"max_open_files": 1,
+		"codec.format":   mapstr.M{"string": "%{[message]}"},
+	})
+
+	group, err := makeFileout(nil,
+		beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")},
+		outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	client := group.Clients[0]
+	assert.Equal(t, "file("+filepath.Join(dir, "%{[data_stream.dataset]}", "out")+")", client.String())
+
+	event := func(dataset, message string) beat.Event {
+		fields := mapstr.M{"message": message}
+		if dataset != "" {
+			fields["data_stream"] = mapstr.M{"dataset": dataset}
+		}
+		return beat.Event{Fields: fields}
+	}
+	batch := outest.NewBatch(
+		event("nginx.access", "a1"),
+		event("system.auth", "s1"),
+		event("nginx.access", "a2"),
+		event("", "no dataset"),
+		event("..", "escape"),
+		event("system.auth", "s2"),
+	)
+	require.NoError(t, client.Publish(context.Background(), batch))
+	// Only the route of the open file is kept.
+	assert.Len(t, client.(*fileOutput).rotators, 1)
+	require.NoError(t, client.Close())
+
+	read := func(dataset string) string {
+		files, err := filepath.Glob(filepath.Join(dir, dataset, "out-*.ndjson"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		content, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		return string(content)
+	}
+	// max_open_files closes files between the events, they are appended to
+	// instead of being rotated.
+	assert.Equal(t, "a1\na2\n", read("nginx.access"))
+	assert.Equal(t, "s1\ns2\n", read("system.auth"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "events with invalid paths must be dropped")
+}
@@ -36,9 +36,30 @@ var isWindowsPath = os.PathSeparator == '\\'
 // which would be interpreted as an escape character. This formatter double escapes
 // the path separator so it is properly interpreted by the fmtstr processor
 type PathFormatString struct {
+	raw string
 	efs *fmtstr.EventFormatString
 }
 
+// IsDynamic returns true if the path references event fields and must be
+// evaluated for every event.
+func (fs *PathFormatString) IsDynamic() bool {
+	return fs.efs != nil && fs.efs.NumFields() > 0
+}
+
+// RunEvent executes the format string for an event. Timestamps are taken
+// from the event's @timestamp.
+func (fs *PathFormatString) RunEvent(event *beat.Event) (string, error) {
+	if fs.efs == nil {
+		return "", fmt.Errorf("path format string is nil; check if `path` option is configured correctly")
+	}
+	return fs.efs.Run(event)
+}
+
+// String returns the path as configured.
+func (fs *PathFormatString) String() string {
+	return fs.raw
+}
+
 // Run executes the format string returning a new expanded string or an error
 // if execution or event field expansion fails.
 func (fs *PathFormatString) Run(timestamp time.Time) (string, error) {
@@ -61,6 +82,7 @@ func (fs *PathFormatString) Unpack(v interface{}) error {
 		return nil
 	}
 
+	fs.raw = path
 	if isWindowsPath {
 		path = strings.ReplaceAll(path, "\\", "\\\\")
 	}
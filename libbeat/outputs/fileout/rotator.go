@@ -0,0 +1,514 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/dtfmt"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// defaultTimestampFormat is the format of the timestamp in file names. The
+// default names are the same that elastic-agent-libs/file.Rotator uses:
+// {filename}-{timestamp}[-{index}].ndjson.
+const defaultTimestampFormat = "yyyyMMdd"
+
+// rotatorSettings configures a rotator.
+type rotatorSettings struct {
+	MaxSizeBytes    uint
+	MaxBackups      uint
+	Permissions     os.FileMode
+	RotateOnStartup bool
+
+	// StartTime is the time the output started. On startup only files
+	// that were last modified before it are rotated, so a rotator that is
+	// created again for the same file doesn't rotate it. Defaults to the
+	// time the rotator is created.
+	StartTime time.Time
+
+	// Interval rotates the file when the current interval ends, intervals
+	// are aligned to midnight local time. Zero disables time based rotation.
+	Interval time.Duration
+
+	// TimestampFormat is the dtfmt pattern of the timestamp in file names.
+	TimestampFormat string
+
+	// Header is written at the start of every new file, if set.
+	Header []byte
+}
+
+// rotator writes to a file that is rotated when it reaches the maximum
+// size or the rotation interval ends, keeping at most MaxBackups rotated
+// files. Unlike file.Rotator it knows when a new file is started, which is
+// required to write headers. Write and Close are safe for concurrent use.
+type rotator struct {
+	log        *logp.Logger
+	settings   rotatorSettings
+	timestamp  *dtfmt.Formatter
+	compressor *compressor
+	now        func() time.Time
+
+	prefix    string
+	extension string
+	// names matches the names of the files written by the rotator.
+	names *regexp.Regexp
+
+	mutex   sync.Mutex
+	started bool
+	active  string
+	file    *os.File
+	size    uint
+	// created is the time the active file was started, used for time based
+	// rotation.
+	created time.Time
+}
+
+// newRotator creates a rotator for files starting with filename. If
+// compressor is not nil, rotated files are compressed with it.
+func newRotator(
+	log *logp.Logger, filename string, settings rotatorSettings, compressor *compressor,
+) (*rotator, error) {
+	if settings.MaxSizeBytes == 0 {
+		return nil, errors.New("file rotator max file size must be greater than 0")
+	}
+	if uint(len(settings.Header)) >= settings.MaxSizeBytes {
+		return nil, errors.New("file header must be smaller than the max file size")
+	}
+	if settings.Permissions > os.ModePerm {
+		return nil, fmt.Errorf("file rotator permissions mask of %o is invalid", settings.Permissions)
+	}
+	if settings.Interval != 0 && settings.Interval < time.Second {
+		return nil, errors.New("the minimum time interval for file rotation is 1 second")
+	}
+	if settings.TimestampFormat == "" {
+		settings.TimestampFormat = defaultTimestampFormat
+	}
+	timestamp, err := dtfmt.NewFormatter(settings.TimestampFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp format '%s': %w", settings.TimestampFormat, err)
+	}
+	if settings.StartTime.IsZero() {
+		settings.StartTime = time.Now()
+	}
+
+	r := &rotator{
+		log:        log,
+		settings:   settings,
+		timestamp:  timestamp,
+		compressor: compressor,
+		now:        time.Now,
+		prefix:     filename + "-",
+		extension:  ".ndjson",
+	}
+	if r.names, err = r.namePattern(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// namePattern returns the pattern of the names of the files written by the
+// rotator: {prefix}{timestamp}[-{index}]{extension}, optionally followed by
+// the compression suffix. The timestamp pattern is derived from a formatted
+// timestamp, runs of digits and letters match any number of digits or
+// letters, other characters must be equal.
+func (r *rotator) namePattern() (*regexp.Regexp, error) {
+	sample, err := r.timestamp.Format(time.Date(2006, time.January, 2, 15, 4, 5, 0, time.Local))
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp format '%s': %w", r.settings.TimestampFormat, err)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^" + regexp.QuoteMeta(r.prefix))
+	for i := 0; i < len(sample); {
+		j := i + 1
+		switch c := sample[i]; {
+		case isDigit(c):
+			for j < len(sample) && isDigit(sample[j]) {
+				j++
+			}
+			pattern.WriteString(`\d+`)
+		case isLetter(c):
+			for j < len(sample) && isLetter(sample[j]) {
+				j++
+			}
+			pattern.WriteString(`[a-zA-Z]+`)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(sample[i:j]))
+		}
+		i = j
+	}
+	pattern.WriteString(`(-\d+)?` + regexp.QuoteMeta(r.extension))
+	if r.compressor != nil {
+		pattern.WriteString("(" + regexp.QuoteMeta(r.compressor.compression.suffix()) + ")?")
+	}
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// Write writes data to the active file, rotating it first if the data would
+// exceed the max size or the rotation interval has ended.
+func (r *rotator) Write(data []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	size := uint(len(data))
+	if size+uint(len(r.settings.Header)) > r.settings.MaxSizeBytes {
+		return 0, fmt.Errorf("data size (%d bytes) is greater than "+
+			"the max file size (%d bytes)", size, r.settings.MaxSizeBytes)
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, fmt.Errorf("failed to open file for writing: %w", err)
+		}
+	}
+	if r.size+size > r.settings.MaxSizeBytes || r.intervalEnded() {
+		if err := r.rotate(); err != nil {
+			return 0, fmt.Errorf("error rotating files: %w", err)
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += uint(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write to file: %w", err)
+	}
+	return n, nil
+}
+
+// Close closes the active file. A following Write appends to it again.
+func (r *rotator) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.closeFile()
+}
+
+// IsOpen returns true if the active file is open.
+func (r *rotator) IsOpen() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.file != nil
+}
+
+func (r *rotator) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	if err != nil {
+		return fmt.Errorf("failed to close active file: %w", err)
+	}
+	return nil
+}
+
+func (r *rotator) intervalEnded() bool {
+	interval := r.settings.Interval
+	if interval == 0 {
+		return false
+	}
+	return intervalStart(r.created, interval) != intervalStart(r.now(), interval)
+}
+
+// intervalStart returns the start of the interval containing t, intervals
+// are aligned to midnight local time.
+func intervalStart(t time.Time, interval time.Duration) time.Time {
+	// Truncate works on absolute time, so shift the local wall clock to UTC.
+	local := time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return local.Truncate(interval)
+}
+
+// open opens the active file. On the first call the most recent existing
+// file is used, it is rotated if rotate_on_startup is set or it is a
+// symlink. A symlink is always rotated to avoid writing to its target,
+// which could be a sensitive file not owned by us. Rotated files that
+// were not compressed yet are queued for compression.
+func (r *rotator) open() error {
+	if r.started && r.active != "" {
+		return r.appendTo(r.active)
+	}
+
+	files, err := r.files()
+	if err != nil {
+		return err
+	}
+	var active *rotatedFile
+	for i := range files {
+		if !files[i].compressed {
+			active = &files[i]
+		}
+	}
+	if active == nil {
+		r.started = true
+		return r.create()
+	}
+
+	if r.compressor != nil {
+		for _, f := range files {
+			if !f.compressed && f.path != active.path {
+				r.compressor.Compress(f.path)
+			}
+		}
+	}
+
+	stat, err := os.Lstat(active.path)
+	if err != nil {
+		return err
+	}
+	// Compare to the full second, file systems may store modification
+	// times with a lower precision.
+	rotate := !r.started && r.settings.RotateOnStartup &&
+		stat.ModTime().Before(r.settings.StartTime.Truncate(time.Second))
+	r.started = true
+	if rotate || stat.Mode()&fs.ModeSymlink != 0 {
+		r.active = active.path
+		return r.rotate()
+	}
+	return r.appendTo(active.path)
+}
+
+func (r *rotator) appendTo(path string) error {
+	stat, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r.create()
+	}
+	if err != nil {
+		return err
+	}
+	if stat.Mode()&fs.ModeSymlink != 0 {
+		r.active = path
+		return r.rotate()
+	}
+
+	r.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, r.settings.Permissions)
+	if err != nil {
+		return fmt.Errorf("failed to append to existing file: %w", err)
+	}
+	r.active = path
+	r.size = uint(stat.Size())
+	r.created = stat.ModTime()
+	if r.size == 0 {
+		return r.writeHeader()
+	}
+	return nil
+}
+
+// rotate closes the active file, starts a new one and removes the oldest
+// files that exceed MaxBackups.
+func (r *rotator) rotate() error {
+	if err := r.closeFile(); err != nil {
+		return err
+	}
+	r.log.Debugw("Rotating file", "filename", r.active)
+
+	rotated := r.active
+	if err := r.create(); err != nil {
+		return err
+	}
+	if rotated != "" && r.compressor != nil {
+		r.compressor.Compress(rotated)
+	}
+	return r.purge()
+}
+
+func (r *rotator) create() error {
+	path, err := r.nextName()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), r.dirMode()); err != nil {
+		return fmt.Errorf("failed to make directories for new file: %w", err)
+	}
+
+	r.file, err = os.OpenFile(path, os.O_EXCL|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, r.settings.Permissions)
+	if err != nil {
+		return fmt.Errorf("failed to open new file '%s': %w", path, err)
+	}
+	r.active = path
+	r.size = 0
+	r.created = r.now()
+	return r.writeHeader()
+}
+
+func (r *rotator) writeHeader() error {
+	if len(r.settings.Header) == 0 {
+		return nil
+	}
+	n, err := r.file.Write(r.settings.Header)
+	r.size += uint(n)
+	if err != nil {
+		return fmt.Errorf("failed to write file header: %w", err)
+	}
+	return nil
+}
+
+func (r *rotator) purge() error {
+	files, err := r.files()
+	if err != nil {
+		return err
+	}
+
+	rotated := make([]rotatedFile, 0, len(files))
+	for _, f := range files {
+		if f.path != r.active {
+			rotated = append(rotated, f)
+		}
+	}
+	if uint(len(rotated)) <= r.settings.MaxBackups {
+		return nil
+	}
+	for _, f := range rotated[:uint(len(rotated))-r.settings.MaxBackups] {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %v during rotation: %w", f.path, err)
+		}
+	}
+	return nil
+}
+
+func (r *rotator) dirMode() os.FileMode {
+	mode := os.FileMode(0700)
+	if r.settings.Permissions&0070 > 0 {
+		mode |= 0050
+	}
+	if r.settings.Permissions&0007 > 0 {
+		mode |= 0005
+	}
+	return mode
+}
+
+// rotatedFile is a file written by the rotator.
+type rotatedFile struct {
+	path       string
+	modTime    time.Time
+	compressed bool
+}
+
+// files returns all files written by the rotator, compressed or not,
+// oldest first. Files whose names don't match the rotator's naming scheme
+// are ignored, they could belong to another output writing to the same
+// directory. Files are ordered by modification time, as the timestamp
+// format is not necessarily sortable, and by name for equal times.
+func (r *rotator) files() ([]rotatedFile, error) {
+	patterns := []string{r.prefix + "*" + r.extension}
+	if r.compressor != nil {
+		patterns = append(patterns, patterns[0]+r.compressor.compression.suffix())
+	}
+
+	var files []rotatedFile
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list existing files: %w", err)
+		}
+		for _, path := range paths {
+			if !r.names.MatchString(path) {
+				continue
+			}
+			stat, err := os.Lstat(path)
+			if err != nil {
+				continue
+			}
+			files = append(files, rotatedFile{
+				path:       path,
+				modTime:    stat.ModTime(),
+				compressed: !strings.HasSuffix(path, r.extension),
+			})
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if !a.modTime.Equal(b.modTime) {
+			return a.modTime.Before(b.modTime)
+		}
+		// {name}-9 precedes {name}-10
+		if len(a.path) != len(b.path) {
+			return len(a.path) < len(b.path)
+		}
+		return a.path < b.path
+	})
+	return files, nil
+}
+
+// nextName returns the name of the next file. If files with the current
+// timestamp exist, an index is appended that is one larger than the
+// largest existing one.
+func (r *rotator) nextName() (string, error) {
+	timestamp, err := r.timestamp.Format(r.now())
+	if err != nil {
+		return "", err
+	}
+	base := r.prefix + timestamp
+
+	index := -1
+	if r.exists(base + r.extension) {
+		index = 0
+	}
+	paths, err := filepath.Glob(base + "-*" + r.extension + "*")
+	if err != nil {
+		return "", fmt.Errorf("failed to list existing files: %w", err)
+	}
+	for _, path := range paths {
+		rest := path[len(base)+1:]
+		end := strings.Index(rest, r.extension)
+		if end < 0 {
+			continue
+		}
+		if i, err := strconv.Atoi(rest[:end]); err == nil && i > index {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return base + r.extension, nil
+	}
+	return base + "-" + strconv.Itoa(index+1) + r.extension, nil
+}
+
+// exists returns true if the file or its compressed version exists.
+func (r *rotator) exists(path string) bool {
+	if _, err := os.Lstat(path); err == nil {
+		return true
+	}
+	if r.compressor != nil {
+		if _, err := os.Lstat(path + r.compressor.compression.suffix()); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,412 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+var testNow = time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+// writeFiles creates the files in the given order, with increasing
+// modification times.
+func writeFiles(t *testing.T, dir string, files ...[2]string) {
+	t.Helper()
+	for i, f := range files {
+		path := filepath.Join(dir, f[0])
+		require.NoError(t, os.WriteFile(path, []byte(f[1]), 0600))
+		mtime := testNow.Add(time.Duration(i-len(files)) * time.Minute)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+}
+
+func newTestRotator(t *testing.T, dir string, settings rotatorSettings, c *compressor) *rotator {
+	t.Helper()
+	r, err := newRotator(logptest.NewTestingLogger(t, ""), filepath.Join(dir, "out"), settings, c)
+	require.NoError(t, err)
+	r.now = func() time.Time { return testNow }
+	return r
+}
+
+func TestRotatorRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes: 10,
+		MaxBackups:   2,
+		Permissions:  0600,
+		Header:       []byte("h\n"),
+	}, nil)
+
+	for _, line := range []string{"aaaa\n", "bbb\n", "cccc\n", "ddddddd\n", "e\n"} {
+		_, err := r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	// Every line but the first starts a new file as the header counts
+	// towards the size. The oldest files are purged, every remaining file
+	// starts with the header.
+	assert.Equal(t, map[string]string{
+		"out-20240506-2.ndjson": "h\ncccc\n",
+		"out-20240506-3.ndjson": "h\nddddddd\n",
+		"out-20240506-4.ndjson": "h\ne\n",
+	}, readDir(t, dir))
+
+	_, err := r.Write([]byte("too long line\n"))
+	assert.Error(t, err)
+}
+
+func TestRotatorStartup(t *testing.T) {
+	tests := map[string]struct {
+		rotateOnStartup bool
+		existing        [][2]string
+		expected        map[string]string
+	}{
+		"rotate on startup": {
+			rotateOnStartup: true,
+			existing:        [][2]string{{"out-20240505.ndjson", "h\nold\n"}},
+			expected: map[string]string{
+				"out-20240505.ndjson": "h\nold\n",
+				"out-20240506.ndjson": "h\nnew\n",
+			},
+		},
+		"append": {
+			existing: [][2]string{
+				{"out-20240505.ndjson", "h\nolder\n"},
+				{"out-20240505-1.ndjson", "h\nold\n"},
+			},
+			expected: map[string]string{
+				"out-20240505.ndjson":   "h\nolder\n",
+				"out-20240505-1.ndjson": "h\nold\nnew\n",
+			},
+		},
+		"append to empty file": {
+			existing: [][2]string{{"out-20240505.ndjson", ""}},
+			expected: map[string]string{"out-20240505.ndjson": "h\nnew\n"},
+		},
+		"no existing files": {
+			expected: map[string]string{"out-20240506.ndjson": "h\nnew\n"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.existing...)
+
+			r := newTestRotator(t, dir, rotatorSettings{
+				MaxSizeBytes:    1024,
+				MaxBackups:      7,
+				Permissions:     0600,
+				RotateOnStartup: test.rotateOnStartup,
+				Header:          []byte("h\n"),
+			}, nil)
+			_, err := r.Write([]byte("new\n"))
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+
+			assert.Equal(t, test.expected, readDir(t, dir))
+		})
+	}
+}
+
+func TestRotatorReopen(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, [2]string{"out-20240505.ndjson", "old\n"})
+	r := newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes:    1024,
+		MaxBackups:      7,
+		Permissions:     0600,
+		RotateOnStartup: true,
+	}, nil)
+
+	// Closing the file does not count as a startup, so the file is not
+	// rotated again.
+	for _, line := range []string{"a\n", "b\n"} {
+		_, err := r.Write([]byte(line))
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		assert.False(t, r.IsOpen())
+	}
+
+	assert.Equal(t, map[string]string{
+		"out-20240505.ndjson": "old\n",
+		"out-20240506.ndjson": "a\nb\n",
+	}, readDir(t, dir))
+
+	// A new rotator doesn't rotate files that were modified after the
+	// output started.
+	r = newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes:    1024,
+		MaxBackups:      7,
+		Permissions:     0600,
+		RotateOnStartup: true,
+		StartTime:       time.Now().Add(-time.Hour),
+	}, nil)
+	_, err := r.Write([]byte("c\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "a\nb\nc\n", readDir(t, dir)["out-20240506.ndjson"])
+}
+
+func TestRotatorIgnoresOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		[2]string{"out-foo-20240501.ndjson", "other output\n"},
+		[2]string{"out-20240502.ndjson", "oldest\n"},
+		[2]string{"out-20240503-x.ndjson", "other output\n"},
+		[2]string{"out-20240504-1.ndjson", "old\n"},
+		[2]string{"out-20240505.ndjson.txt", "other output\n"},
+	)
+
+	r := newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes:    1024,
+		MaxBackups:      1,
+		Permissions:     0600,
+		RotateOnStartup: true,
+	}, nil)
+	_, err := r.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, map[string]string{
+		"out-foo-20240501.ndjson": "other output\n",
+		"out-20240503-x.ndjson":   "other output\n",
+		"out-20240504-1.ndjson":   "old\n",
+		"out-20240505.ndjson.txt": "other output\n",
+		"out-20240506.ndjson":     "new\n",
+	}, readDir(t, dir))
+}
+
+func TestRotatorNamePattern(t *testing.T) {
+	tests := map[string]struct {
+		format  string
+		matches []string
+		other   []string
+	}{
+		"default": {
+			format:  "",
+			matches: []string{"out-20240506.ndjson", "out-20240506-12.ndjson"},
+			other:   []string{"out-2024-05-06.ndjson", "out-20240506-a.ndjson", "out-foo-20240506.ndjson"},
+		},
+		"with separators and text": {
+			format:  "yyyy-MM-dd'T'HH.mm.ss-MMM",
+			matches: []string{"out-2024-05-06T07.08.09-May.ndjson", "out-2024-05-06T07.08.09-May-3.ndjson"},
+			other:   []string{"out-2024-05-06.ndjson", "out-20240506T070809-May.ndjson"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			r := newTestRotator(t, dir, rotatorSettings{MaxSizeBytes: 1024, TimestampFormat: test.format}, nil)
+			for _, name := range test.matches {
+				assert.True(t, r.names.MatchString(filepath.Join(dir, name)), name)
+			}
+			for _, name := range test.other {
+				assert.False(t, r.names.MatchString(filepath.Join(dir, name)), name)
+			}
+		})
+	}
+}
+
+func TestRotatorFileOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir,
+		[2]string{"out-20231231.ndjson", ""},
+		[2]string{"out-20240506.ndjson", ""},
+		[2]string{"out-20240506-2.ndjson", ""},
+		[2]string{"out-20240506-10.ndjson", ""},
+	)
+	// Files with the same modification time are ordered by their index.
+	mtime := testNow.Add(-time.Minute)
+	for _, name := range []string{"out-20240506-2.ndjson", "out-20240506-10.ndjson"} {
+		require.NoError(t, os.Chtimes(filepath.Join(dir, name), mtime, mtime))
+	}
+
+	r := newTestRotator(t, dir, rotatorSettings{MaxSizeBytes: 1024}, nil)
+	files, err := r.files()
+	require.NoError(t, err)
+
+	var actual []string
+	for _, f := range files {
+		actual = append(actual, filepath.Base(f.path))
+	}
+	assert.Equal(t, []string{
+		"out-20231231.ndjson",
+		"out-20240506.ndjson",
+		"out-20240506-2.ndjson",
+		"out-20240506-10.ndjson",
+	}, actual)
+
+	next, err := r.nextName()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "out-20240506-11.ndjson"), next)
+}
+
+func TestRotatorRotatesByInterval(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes:    1024,
+		MaxBackups:      7,
+		Permissions:     0600,
+		Interval:        time.Hour,
+		TimestampFormat: "yyyy-MM-dd-HH",
+	}, nil)
+
+	now := testNow
+	r.now = func() time.Time { return now }
+	for _, step := range []time.Duration{0, 30 * time.Minute, 30 * time.Minute, 5 * time.Hour} {
+		now = now.Add(step)
+		_, err := r.Write([]byte(now.Format("15:04") + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, map[string]string{
+		"out-2024-05-06-07.ndjson": "07:08\n07:38\n",
+		"out-2024-05-06-08.ndjson": "08:08\n",
+		"out-2024-05-06-13.ndjson": "13:08\n",
+	}, readDir(t, dir))
+}
+
+func TestRotatorAppendRotatesByInterval(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, [2]string{"out-20240505.ndjson", "yesterday\n"})
+	r := newTestRotator(t, dir, rotatorSettings{
+		MaxSizeBytes: 1024,
+		MaxBackups:   7,
+		Permissions:  0600,
+		Interval:     24 * time.Hour,
+	}, nil)
+	// The existing file was last written in the current interval, but more
+	// than a day ago.
+	mtime := testNow.Add(-24 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "out-20240505.ndjson"), mtime, mtime))
+
+	_, err := r.Write([]byte("today\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	assert.Equal(t, map[string]string{
+		"out-20240505.ndjson": "yesterday\n",
+		"out-20240506.ndjson": "today\n",
+	}, readDir(t, dir))
+}
+
+func TestIntervalStart(t *testing.T) {
+	loc := time.FixedZone("UTC+5:30", 5*60*60+30*60)
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, loc)
+	start := intervalStart(ts, 24*time.Hour)
+	assert.Equal(t, time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), start)
+	start = intervalStart(ts, time.Hour)
+	assert.Equal(t, time.Date(2024, 5, 6, 7, 0, 0, 0, time.UTC), start)
+}
+
+func TestRotatorCompression(t *testing.T) {
+	decompress := map[Compression]func(t *testing.T, data []byte) string{
+		CompressionGzip: func(t *testing.T, data []byte) string {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			out, err := io.ReadAll(r)
+			require.NoError(t, err)
+			return string(out)
+		},
+		CompressionZstd: func(t *testing.T, data []byte) string {
+			r, err := zstd.NewReader(bytes.NewReader(data))
+			require.NoError(t, err)
+			defer r.Close()
+			out, err := io.ReadAll(r)
+			require.NoError(t, err)
+			return string(out)
+		},
+	}
+
+	for compression, decompress := range decompress {
+		t.Run(compression.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			suffix := compression.suffix()
+			// A file that was rotated but not compressed before a restart.
+			writeFiles(t, dir,
+				[2]string{"out-20240505.ndjson", "left over\n"},
+				[2]string{"out-20240505-1.ndjson", "active\n"},
+			)
+
+			c := newCompressor(logptest.NewTestingLogger(t, ""), compression)
+			r := newTestRotator(t, dir, rotatorSettings{
+				MaxSizeBytes:    10,
+				MaxBackups:      3,
+				Permissions:     0600,
+				RotateOnStartup: true,
+			}, c)
+
+			for _, line := range []string{"first\n", "second\n", "third\n"} {
+				_, err := r.Write([]byte(line))
+				require.NoError(t, err)
+			}
+			require.NoError(t, r.Close())
+			c.Close()
+
+			files := readDir(t, dir)
+			require.Len(t, files, 4)
+			assert.Equal(t, "third\n", files["out-20240506-2.ndjson"])
+			for name, content := range map[string]string{
+				"out-20240505-1.ndjson": "active\n",
+				"out-20240506.ndjson":   "first\n",
+				"out-20240506-1.ndjson": "second\n",
+			} {
+				require.Contains(t, files, name+suffix)
+				assert.Equal(t, content, decompress(t, []byte(files[name+suffix])))
+			}
+
+			// Compressed files keep their order.
+			r = newTestRotator(t, dir, rotatorSettings{MaxSizeBytes: 10}, newCompressor(logptest.NewTestingLogger(t, ""), compression))
+			ordered, err := r.files()
+			require.NoError(t, err)
+			require.Len(t, ordered, 4)
+			assert.Equal(t, "out-20240505-1.ndjson"+suffix, filepath.Base(ordered[0].path))
+			assert.Equal(t, "out-20240506-2.ndjson", filepath.Base(ordered[3].path))
+			r.compressor.Close()
+		})
+	}
+}
@@ -0,0 +1,314 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/version"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/useragent"
+)
+
+// maxErrorBodySize limits how much of an error response is logged.
+const maxErrorBodySize = 1024
+
+type clientSettings struct {
+	URL      string
+	Beat     beat.Info
+	Config   httpConfig
+	Codec    codec.Codec
+	Observer outputs.Observer
+}
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	url      string
+	index    string
+	codec    codec.Codec
+
+	method           string
+	headers          map[string]string
+	format           string
+	compressionLevel int
+	retryable        map[int]bool
+
+	username    string
+	password    string
+	bearerToken string
+	oauth2      *oauth2Config
+
+	transport httpcommon.HTTPTransportSettings
+	userAgent string
+
+	http *http.Client
+}
+
+func newClient(s clientSettings) (*client, error) {
+	codes := s.Config.RetryableStatusCodes
+	if codes == nil {
+		codes = defaultRetryableStatusCodes
+	}
+	retryable := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		retryable[code] = true
+	}
+
+	logger := s.Beat.Logger
+	if logger == nil {
+		logger = logp.NewLogger("")
+	}
+
+	return &client{
+		log:              logger.Named("http"),
+		observer:         s.Observer,
+		url:              s.URL,
+		index:            strings.ToLower(s.Beat.Beat),
+		codec:            s.Codec,
+		method:           strings.ToUpper(s.Config.Method),
+		headers:          s.Config.Headers,
+		format:           s.Config.Format,
+		compressionLevel: s.Config.CompressionLevel,
+		retryable:        retryable,
+		username:         s.Config.Username,
+		password:         s.Config.Password,
+		bearerToken:      s.Config.BearerToken,
+		oauth2:           s.Config.OAuth2,
+		transport:        s.Config.Transport,
+		userAgent:        useragent.UserAgent(s.Beat.Beat, version.GetDefaultVersion(), version.Commit(), version.BuildTime().String()),
+	}, nil
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
+
+func (c *client) Connect(_ context.Context) error {
+	httpClient, err := c.transport.Client(
+		httpcommon.WithLogger(c.log),
+		httpcommon.WithIOStats(c.observer),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: c.transport.IdleConnTimeout},
+		httpcommon.WithHeaderRoundTripper(map[string]string{"User-Agent": c.userAgent}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if c.oauth2 != nil {
+		creds := clientcredentials.Config{
+			ClientID:       c.oauth2.ClientID,
+			ClientSecret:   c.oauth2.ClientSecret,
+			TokenURL:       c.oauth2.TokenURL,
+			Scopes:         c.oauth2.Scopes,
+			EndpointParams: c.oauth2.EndpointParams,
+		}
+		// The token source keeps using its context for token refreshes, so
+		// it must not be the short lived connect context.
+		tokenCtx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+		tokens := creds.TokenSource(tokenCtx)
+		if _, err := tokens.Token(); err != nil {
+			return fmt.Errorf("failed to fetch oauth2 token: %w", err)
+		}
+		httpClient = oauth2.NewClient(tokenCtx, tokens)
+	}
+
+	c.http = httpClient
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	body, okEvents := c.encodeEvents(events)
+	if dropped := len(events) - len(okEvents); dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+	if len(okEvents) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	begin := time.Now()
+	status, respBody, err := c.send(ctx, body)
+	if err != nil {
+		c.observer.RetryableErrors(len(okEvents))
+		c.retry(batch, events, okEvents)
+		return err
+	}
+	c.observer.ReportLatency(time.Since(begin))
+
+	switch {
+	case status >= 200 && status < 300:
+		c.observer.AckedEvents(len(okEvents))
+		batch.ACK()
+		return nil
+
+	case status == http.StatusRequestEntityTooLarge:
+		if batch.SplitRetry() {
+			c.observer.BatchSplit()
+			c.observer.RetryableErrors(len(okEvents))
+		} else {
+			c.log.Errorf("Dropping event: request of %d bytes is too large (status=%d)", len(body), status)
+			batch.Drop()
+			c.observer.PermanentErrors(len(okEvents))
+		}
+		return nil
+
+	case c.retryable[status]:
+		c.observer.RetryableErrors(len(okEvents))
+		if status == http.StatusTooManyRequests {
+			c.observer.ErrTooMany(len(okEvents))
+		}
+		c.retry(batch, events, okEvents)
+		return fmt.Errorf("http request failed with status %d: %s", status, respBody)
+
+	default:
+		c.log.Errorf("Dropping %d events: http request failed with status %d: %s",
+			len(okEvents), status, respBody)
+		batch.Drop()
+		c.observer.PermanentErrors(len(okEvents))
+		return nil
+	}
+}
+
+// retry returns the events that were encoded to the pipeline. Events that
+// failed to encode are dropped.
+func (c *client) retry(batch publisher.Batch, events, okEvents []publisher.Event) {
+	if len(okEvents) == len(events) {
+		batch.Retry()
+	} else {
+		batch.RetryEvents(okEvents)
+	}
+}
+
+// encodeEvents encodes the events into a request body in the configured
+// format. It returns the body and the events that were encoded successfully.
+func (c *client) encodeEvents(events []publisher.Event) ([]byte, []publisher.Event) {
+	var buf bytes.Buffer
+	okEvents := events[:0:0]
+
+	if c.format == formatJSONArray {
+		buf.WriteByte('[')
+	}
+	for i := range events {
+		serialized, err := c.codec.Encode(c.index, &events[i].Content)
+		if err != nil {
+			c.log.Errorf("Encoding event failed with error: %+v. Look at the event log file to view the event", err)
+			c.log.Errorw(fmt.Sprintf("Failed event: %v", events[i].Content), logp.TypeKey, logp.EventType)
+			continue
+		}
+		if c.format == formatJSONArray && len(okEvents) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(serialized)
+		if c.format == formatNDJSON {
+			buf.WriteByte('\n')
+		}
+		okEvents = append(okEvents, events[i])
+	}
+	if c.format == formatJSONArray {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), okEvents
+}
+
+// send executes the request and returns the response status and, for
+// unsuccessful responses, the beginning of the response body.
+func (c *client) send(ctx context.Context, body []byte) (int, string, error) {
+	if c.http == nil {
+		return 0, "", errors.New("http client is not connected")
+	}
+
+	contentEncoding := ""
+	if c.compressionLevel > 0 {
+		var buf bytes.Buffer
+		w, err := gzip.NewWriterLevel(&buf, c.compressionLevel)
+		if err != nil {
+			return 0, "", err
+		}
+		if _, err := w.Write(body); err != nil {
+			return 0, "", err
+		}
+		if err := w.Close(); err != nil {
+			return 0, "", err
+		}
+		body = buf.Bytes()
+		contentEncoding = "gzip"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, c.method, c.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.format == formatNDJSON {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+	switch {
+	case c.username != "" || c.password != "":
+		req.SetBasicAuth(c.username, c.password)
+	case c.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	var respBody []byte
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ = io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	}
+	// Drain the rest of the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, string(respBody), nil
+}
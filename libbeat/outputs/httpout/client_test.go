@@ -0,0 +1,304 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	codecjson "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestClient(t *testing.T, url string, settings map[string]interface{}) *client {
+	t.Helper()
+	cfg := defaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	c, err := newClient(clientSettings{
+		URL:      url,
+		Beat:     beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")},
+		Config:   cfg,
+		Codec:    codecjson.New("1.2.3", codecjson.Config{}),
+		Observer: outputs.NewNilObserver(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testBatch(messages ...string) *outest.Batch {
+	events := make([]beat.Event, len(messages))
+	for i, msg := range messages {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": msg},
+		}
+	}
+	return outest.NewBatch(events...)
+}
+
+func batchSignals(batch *outest.Batch) []outest.BatchSignalTag {
+	var tags []outest.BatchSignalTag
+	for _, sig := range batch.Signals {
+		tags = append(tags, sig.Tag)
+	}
+	return tags
+}
+
+type request struct {
+	header http.Header
+	body   string
+}
+
+func newRecordingServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	t.Helper()
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		requests <- request{header: r.Header.Clone(), body: string(data)}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func messages(t *testing.T, lines []string) []string {
+	t.Helper()
+	var result []string
+	for _, line := range lines {
+		var event struct {
+			Message string `json:"message"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		result = append(result, event.Message)
+	}
+	return result
+}
+
+func TestPublishNDJSON(t *testing.T) {
+	server, requests := newRecordingServer(t, http.StatusOK)
+	c := newTestClient(t, server.URL, map[string]interface{}{
+		"headers": map[string]interface{}{"X-Test": "value"},
+	})
+
+	batch := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+
+	req := <-requests
+	assert.Equal(t, "application/x-ndjson", req.header.Get("Content-Type"))
+	assert.Equal(t, "value", req.header.Get("X-Test"))
+	assert.Contains(t, req.header.Get("User-Agent"), "Elastic-testbeat")
+	assert.True(t, strings.HasSuffix(req.body, "\n"))
+	lines := strings.Split(strings.TrimSuffix(req.body, "\n"), "\n")
+	assert.Equal(t, []string{"a", "b"}, messages(t, lines))
+}
+
+func TestPublishJSONArrayGzip(t *testing.T) {
+	server, requests := newRecordingServer(t, http.StatusAccepted)
+	c := newTestClient(t, server.URL, map[string]interface{}{
+		"format":            "json_array",
+		"compression_level": 5,
+	})
+
+	batch := testBatch("a", "b", "c")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+
+	req := <-requests
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+	assert.Equal(t, "gzip", req.header.Get("Content-Encoding"))
+	var raw []json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(req.body), &raw))
+	lines := make([]string, len(raw))
+	for i, r := range raw {
+		lines[i] = string(r)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, messages(t, lines))
+}
+
+func TestPublishAuthentication(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		server, requests := newRecordingServer(t, http.StatusOK)
+		c := newTestClient(t, server.URL, map[string]interface{}{
+			"username": "beat", "password": "secret",
+		})
+		require.NoError(t, c.Publish(context.Background(), testBatch("a")))
+		req := <-requests
+		assert.Equal(t, "Basic YmVhdDpzZWNyZXQ=", req.header.Get("Authorization"))
+	})
+
+	t.Run("bearer", func(t *testing.T) {
+		server, requests := newRecordingServer(t, http.StatusOK)
+		c := newTestClient(t, server.URL, map[string]interface{}{
+			"bearer_token": "token",
+		})
+		require.NoError(t, c.Publish(context.Background(), testBatch("a")))
+		req := <-requests
+		assert.Equal(t, "Bearer token", req.header.Get("Authorization"))
+	})
+
+	t.Run("oauth2", func(t *testing.T) {
+		var tokenRequests atomic.Int32
+		tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenRequests.Add(1)
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":3600}`))
+		}))
+		defer tokenServer.Close()
+
+		server, requests := newRecordingServer(t, http.StatusOK)
+		c := newTestClient(t, server.URL, map[string]interface{}{
+			"oauth2": map[string]interface{}{
+				"client.id":     "id",
+				"client.secret": "secret",
+				"token_url":     tokenServer.URL,
+			},
+		})
+		require.NoError(t, c.Publish(context.Background(), testBatch("a")))
+		require.NoError(t, c.Publish(context.Background(), testBatch("b")))
+		assert.Equal(t, "Bearer oauth-token", (<-requests).header.Get("Authorization"))
+		assert.Equal(t, "Bearer oauth-token", (<-requests).header.Get("Authorization"))
+		assert.Equal(t, int32(1), tokenRequests.Load(), "the token must be cached")
+	})
+}
+
+func TestPublishStatusHandling(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		settings map[string]interface{}
+		events   []string
+		signals  []outest.BatchSignalTag
+		err      bool
+	}{
+		"server error is retried": {
+			status:  http.StatusServiceUnavailable,
+			events:  []string{"a"},
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+			err:     true,
+		},
+		"too many requests is retried": {
+			status:  http.StatusTooManyRequests,
+			events:  []string{"a"},
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+			err:     true,
+		},
+		"client error is dropped": {
+			status:  http.StatusBadRequest,
+			events:  []string{"a"},
+			signals: []outest.BatchSignalTag{outest.BatchDrop},
+		},
+		"configured status is retried": {
+			status:   http.StatusBadRequest,
+			settings: map[string]interface{}{"retryable_status_codes": []int{400}},
+			events:   []string{"a"},
+			signals:  []outest.BatchSignalTag{outest.BatchRetry},
+			err:      true,
+		},
+		"unlisted server error is dropped": {
+			status:   http.StatusServiceUnavailable,
+			settings: map[string]interface{}{"retryable_status_codes": []int{429}},
+			events:   []string{"a"},
+			signals:  []outest.BatchSignalTag{outest.BatchDrop},
+		},
+		"large batch is split": {
+			status:  http.StatusRequestEntityTooLarge,
+			events:  []string{"a", "b"},
+			signals: []outest.BatchSignalTag{outest.BatchSplitRetry},
+		},
+		"large event is dropped": {
+			status:  http.StatusRequestEntityTooLarge,
+			events:  []string{"a"},
+			signals: []outest.BatchSignalTag{outest.BatchSplitRetry, outest.BatchDrop},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, _ := newRecordingServer(t, test.status)
+			settings := test.settings
+			if settings == nil {
+				settings = map[string]interface{}{}
+			}
+			c := newTestClient(t, server.URL, settings)
+
+			batch := testBatch(test.events...)
+			err := c.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, batchSignals(batch))
+		})
+	}
+}
+
+func TestPublishConnectionError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	c := newTestClient(t, url, map[string]interface{}{})
+	batch := testBatch("a")
+	assert.Error(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchRetry}, batchSignals(batch))
+}
+
+func TestMakeHTTP(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"hosts":      []string{"localhost:8080", "https://example.com/ingest"},
+		"path":       "/events",
+		"parameters": map[string]interface{}{"source": "beats"},
+	})
+	group, err := makeHTTP(nil, beat.Info{Beat: "testbeat", Logger: logptest.NewTestingLogger(t, "")},
+		outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	require.Len(t, group.Clients, 2)
+	assert.Equal(t, "backoff(http(http://localhost:8080/events?source=beats))", group.Clients[0].String())
+	assert.Equal(t, "backoff(http(https://example.com/ingest?source=beats))", group.Clients[1].String())
+}
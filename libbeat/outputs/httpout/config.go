@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	// formatNDJSON sends one encoded event per line.
+	formatNDJSON = "ndjson"
+	// formatJSONArray sends the encoded events as elements of a JSON array.
+	formatJSONArray = "json_array"
+)
+
+// binaryCodecs lists the codecs whose output can't be framed by newlines or
+// placed in a JSON array.
+var binaryCodecs = map[string]bool{
+	"cbor":     true,
+	"msgpack":  true,
+	"protobuf": true,
+}
+
+type httpConfig struct {
+	Path             string            `config:"path"`
+	Method           string            `config:"method"`
+	Params           map[string]string `config:"parameters"`
+	Headers          map[string]string `config:"headers"`
+	Format           string            `config:"format"`
+	Codec            codec.Config      `config:"codec"`
+	CompressionLevel int               `config:"compression_level" validate:"min=0, max=9"`
+
+	Username    string        `config:"username"`
+	Password    string        `config:"password"`
+	BearerToken string        `config:"bearer_token"`
+	OAuth2      *oauth2Config `config:"oauth2"`
+
+	// RetryableStatusCodes lists the HTTP status codes after which a batch
+	// is retried. Other non-2xx responses drop the batch. If unset,
+	// defaultRetryableStatusCodes is used. It is not part of the default
+	// config, as unpacking a list merges it with the default list.
+	RetryableStatusCodes []int `config:"retryable_status_codes"`
+
+	LoadBalance bool             `config:"loadbalance"`
+	BulkMaxSize int              `config:"bulk_max_size"`
+	MaxRetries  int              `config:"max_retries"`
+	Backoff     backoff          `config:"backoff"`
+	Queue       config.Namespace `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// oauth2Config configures the OAuth2 client credentials flow.
+type oauth2Config struct {
+	ClientID       string              `config:"client.id"`
+	ClientSecret   string              `config:"client.secret"`
+	TokenURL       string              `config:"token_url"`
+	Scopes         []string            `config:"scopes"`
+	EndpointParams map[string][]string `config:"endpoint_params"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+const (
+	defaultBulkSize = 1600
+)
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+func defaultConfig() httpConfig {
+	return httpConfig{
+		Method:           http.MethodPost,
+		Format:           formatNDJSON,
+		CompressionLevel: 0,
+		LoadBalance:      true,
+		BulkMaxSize:      defaultBulkSize,
+		MaxRetries:       3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+		Transport: httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *httpConfig) Validate() error {
+	switch strings.ToUpper(c.Method) {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("unsupported http method '%s', must be POST or PUT", c.Method)
+	}
+
+	switch c.Format {
+	case formatNDJSON, formatJSONArray:
+	default:
+		return fmt.Errorf("unsupported format '%s', must be %s or %s",
+			c.Format, formatNDJSON, formatJSONArray)
+	}
+
+	codecName := c.Codec.Namespace.Name()
+	if binaryCodecs[codecName] {
+		return fmt.Errorf("the %s codec is not supported, events must be separated by newlines or in a JSON array", codecName)
+	}
+	if c.Format == formatJSONArray && codecName != "" && codecName != "json" {
+		return fmt.Errorf("format %s requires the json codec, got %s", formatJSONArray, codecName)
+	}
+
+	auth := 0
+	if c.Username != "" || c.Password != "" {
+		auth++
+	}
+	if c.BearerToken != "" {
+		auth++
+	}
+	if c.OAuth2 != nil {
+		auth++
+	}
+	if auth > 1 {
+		return errors.New("only one of username/password, bearer_token or oauth2 can be set")
+	}
+
+	for _, code := range c.RetryableStatusCodes {
+		if code < 100 || code > 599 {
+			return fmt.Errorf("invalid retryable status code %d", code)
+		}
+		if code >= 200 && code < 300 {
+			return fmt.Errorf("retryable status code %d is a success status", code)
+		}
+	}
+	return nil
+}
+
+func (c *oauth2Config) Validate() error {
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return errors.New("oauth2 requires client.id and client.secret")
+	}
+	if c.TokenURL == "" {
+		return errors.New("oauth2 requires token_url")
+	}
+	if _, err := url.Parse(c.TokenURL); err != nil {
+		return fmt.Errorf("invalid oauth2 token_url: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"defaults": {
+			config: map[string]interface{}{},
+			valid:  true,
+		},
+		"put": {
+			config: map[string]interface{}{"method": "put"},
+			valid:  true,
+		},
+		"unsupported method": {
+			config: map[string]interface{}{"method": "GET"},
+		},
+		"json array": {
+			config: map[string]interface{}{"format": "json_array"},
+			valid:  true,
+		},
+		"json array with json codec": {
+			config: map[string]interface{}{"format": "json_array", "codec.json.pretty": true},
+			valid:  true,
+		},
+		"json array with format codec": {
+			config: map[string]interface{}{"format": "json_array", "codec.format.string": "%{[message]}"},
+		},
+		"ndjson with logfmt codec": {
+			config: map[string]interface{}{"codec.logfmt": map[string]interface{}{}},
+			valid:  true,
+		},
+		"binary codec": {
+			config: map[string]interface{}{"codec.msgpack": map[string]interface{}{}},
+		},
+		"unknown format": {
+			config: map[string]interface{}{"format": "xml"},
+		},
+		"compression level out of range": {
+			config: map[string]interface{}{"compression_level": 10},
+		},
+		"basic auth and bearer token": {
+			config: map[string]interface{}{"username": "u", "bearer_token": "t"},
+		},
+		"oauth2": {
+			config: map[string]interface{}{"oauth2": map[string]interface{}{
+				"client.id":     "id",
+				"client.secret": "secret",
+				"token_url":     "https://localhost/token",
+			}},
+			valid: true,
+		},
+		"oauth2 without token url": {
+			config: map[string]interface{}{"oauth2": map[string]interface{}{
+				"client.id":     "id",
+				"client.secret": "secret",
+			}},
+		},
+		"success status is not retryable": {
+			config: map[string]interface{}{"retryable_status_codes": []int{200}},
+		},
+		"invalid status code": {
+			config: map[string]interface{}{"retryable_status_codes": []int{999}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.config).Unpack(&cfg)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -27,12 +27,15 @@ import (
 	"time"
 
 	"github.com/eapache/go-resiliency/breaker"
+	"github.com/rcrowley/go-metrics"
 
 	"github.com/elastic/sarama"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/kafka/schemaregistry"
 	"github.com/elastic/beats/v7/libbeat/outputs/outil"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -54,6 +57,14 @@ type client struct {
 
 	producer sarama.AsyncProducer
 
+	// serializer replaces the codec if a schema registry is configured.
+	serializer *schemaregistry.Serializer
+
+	// transactionsCommitted and transactionsAborted are only set for
+	// transactional producers.
+	transactionsCommitted metrics.Counter
+	transactionsAborted   metrics.Counter
+
 	recordHeaders []sarama.RecordHeader
 
 	wg sync.WaitGroup
@@ -66,9 +77,21 @@ type msgRef struct {
 	failed []publisher.Event
 	batch  publisher.Batch
 
+	// finished is set for batches published in a transaction. It is closed
+	// once all messages are done instead of signaling the batch, which is
+	// left to the transaction. delivered collects the events that have
+	// to be retried if the transaction is aborted.
+	finished  chan struct{}
+	delivered []publisher.Event
+
 	err error
 }
 
+const (
+	transactionsCommittedMetric = "kafka.transactions.committed"
+	transactionsAbortedMetric   = "kafka.transactions.aborted"
+)
+
 var (
 	errNoTopicsSelected = errors.New("no topic could be selected")
 
@@ -95,6 +118,7 @@ func newKafkaClient(
 	topic outil.Selector,
 	headers []header,
 	writer codec.Codec,
+	serializer *schemaregistry.Serializer,
 	cfg *sarama.Config,
 	logger *logp.Logger,
 ) (*client, error) {
@@ -108,6 +132,8 @@ func newKafkaClient(
 		codec:    writer,
 		config:   *cfg,
 		done:     make(chan struct{}),
+
+		serializer: serializer,
 	}
 
 	if len(headers) != 0 {
@@ -126,6 +152,11 @@ func newKafkaClient(
 		c.recordHeaders = recordHeaders
 	}
 
+	if cfg.Producer.Transaction.ID != "" {
+		c.transactionsCommitted = metrics.GetOrRegisterCounter(transactionsCommittedMetric, cfg.MetricRegistry)
+		c.transactionsAborted = metrics.GetOrRegisterCounter(transactionsAbortedMetric, cfg.MetricRegistry)
+	}
+
 	return c, nil
 }
 
@@ -135,6 +166,13 @@ func (c *client) Connect(_ context.Context) error {
 
 	c.log.Debugf("connect: %v", c.hosts)
 
+	// a transactional producer is replaced after a fatal transaction error.
+	if c.producer != nil {
+		c.producer.AsyncClose()
+		c.wg.Wait()
+		c.producer = nil
+	}
+
 	// try to connect
 	producer, err := sarama.NewAsyncProducer(c.hosts, &c.config)
 	if err != nil {
@@ -169,21 +207,104 @@ func (c *client) Close() error {
 }
 
 func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	if c.producer.IsTransactional() {
+		return c.publishTransaction(batch)
+	}
+
 	events := batch.Events()
 	c.observer.NewBatch(len(events))
+	c.send(c.newMsgRef(batch), events)
+	return nil
+}
 
-	ref := &msgRef{
+// publishTransaction publishes the batch in its own transaction. It blocks
+// until the transaction is committed or aborted, the events are only ACKed
+// once the transaction is committed.
+func (c *client) publishTransaction(batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+	if len(events) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	if err := c.producer.BeginTxn(); err != nil {
+		batch.Retry()
+		c.observer.RetryableErrors(len(events))
+		return fmt.Errorf("failed to begin kafka transaction: %w", err)
+	}
+
+	ref := c.newMsgRef(batch)
+	ref.finished = make(chan struct{})
+	c.send(ref, events)
+	<-ref.finished
+
+	err := ref.err
+	if err == nil && len(ref.failed) > 0 {
+		// only the circuit breaker fails messages without setting an error.
+		err = breaker.ErrBreakerOpen
+	}
+	if err == nil {
+		err = c.producer.CommitTxn()
+		if err == nil {
+			c.transactionsCommitted.Inc(1)
+			batch.ACK()
+			c.observer.AckedEvents(len(ref.delivered))
+			return nil
+		}
+	}
+
+	// The delivered events are discarded with the transaction, all events
+	// that were not dropped are retried.
+	retry := append(ref.failed, ref.delivered...)
+	batch.RetryEvents(retry)
+	c.observer.RetryableErrors(len(retry))
+
+	if abortErr := c.producer.AbortTxn(); abortErr != nil {
+		// The producer can't be used anymore, returning the error makes
+		// the output reconnect with a new producer.
+		return fmt.Errorf("failed to abort kafka transaction after %v: %w", err, abortErr)
+	}
+	c.transactionsAborted.Inc(1)
+	c.log.Errorf("Kafka transaction aborted: %v", err)
+	return nil
+}
+
+func (c *client) newMsgRef(batch publisher.Batch) *msgRef {
+	events := batch.Events()
+	return &msgRef{
 		client: c,
 		count:  int32(len(events)), //nolint:gosec //keep old behavior
 		total:  len(events),
 		failed: nil,
 		batch:  batch,
 	}
+}
+
+func (c *client) send(ref *msgRef, events []publisher.Event) {
+	// Schema registry errors usually affect all events of a batch, so they
+	// are logged once per batch.
+	var retried, rejected int
+	var retryErr, rejectErr error
 
 	ch := c.producer.Input()
 	for i := range events {
 		d := &events[i]
 		msg, err := c.getEventMessage(d)
+		if errors.Is(err, schemaregistry.ErrRegistry) {
+			// the event is retried once the registry is available again.
+			retried++
+			retryErr = err
+			ref.fail(&message{data: *d}, err)
+			continue
+		}
+		if errors.Is(err, schemaregistry.ErrRegistryRejected) {
+			rejected++
+			rejectErr = err
+			ref.done()
+			c.observer.PermanentErrors(1)
+			continue
+		}
 		if err != nil {
 			c.log.Errorf("Dropping event: %+v", err)
 			ref.done()
@@ -196,7 +317,12 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 		ch <- &msg.msg
 	}
 
-	return nil
+	if retried > 0 {
+		c.log.Errorf("Retrying %d events: %+v", retried, retryErr)
+	}
+	if rejected > 0 {
+		c.log.Errorf("Dropping %d events: %+v", rejected, rejectErr)
+	}
 }
 
 func (c *client) String() string {
@@ -241,7 +367,7 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 		}
 	}
 
-	serializedEvent, err := c.codec.Encode(c.index, event)
+	msg.value, err = c.encodeValue(msg.topic, event)
 	if err != nil {
 		if c.log.IsDebug() {
 			c.log.Debug("failed event logged to event log file")
@@ -250,10 +376,6 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 		return nil, err
 	}
 
-	buf := make([]byte, len(serializedEvent))
-	copy(buf, serializedEvent)
-	msg.value = buf
-
 	// message timestamps have been added to kafka with version 0.10.0.0
 	if c.config.Version.IsAtLeast(sarama.V0_10_0_0) {
 		msg.ts = event.Timestamp
@@ -268,6 +390,22 @@ func (c *client) getEventMessage(data *publisher.Event) (*message, error) {
 	return msg, nil
 }
 
+// encodeValue encodes the event as message value for the topic.
+func (c *client) encodeValue(topic string, event *beat.Event) ([]byte, error) {
+	if c.serializer != nil {
+		return c.serializer.Serialize(topic, event)
+	}
+
+	serializedEvent, err := c.codec.Encode(c.index, event)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, len(serializedEvent))
+	copy(buf, serializedEvent)
+	return buf, nil
+}
+
 func (c *client) successWorker(ch <-chan *sarama.ProducerMessage) {
 	defer c.wg.Done()
 	defer c.log.Debug("Stop kafka ack worker")
@@ -278,7 +416,7 @@ func (c *client) successWorker(ch <-chan *sarama.ProducerMessage) {
 			c.log.Debug("Failed to assert libMsg.Metadata to *message")
 			return
 		}
-		msg.ref.done()
+		msg.ref.succeed(msg)
 	}
 }
 
@@ -380,6 +518,13 @@ func (r *msgRef) done() {
 	r.dec()
 }
 
+func (r *msgRef) succeed(msg *message) {
+	if r.finished != nil {
+		r.delivered = append(r.delivered, msg.data)
+	}
+	r.dec()
+}
+
 func (r *msgRef) fail(msg *message, err error) {
 	switch {
 	case errors.Is(err, sarama.ErrInvalidMessage):
@@ -419,6 +564,11 @@ func (r *msgRef) dec() {
 	}
 
 	r.client.log.Debug("finished kafka batch")
+	if r.finished != nil {
+		close(r.finished)
+		return
+	}
+
 	stats := r.client.observer
 
 	err := r.err
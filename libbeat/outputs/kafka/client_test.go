@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/kafka/schemaregistry"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/sarama"
+)
+
+// txnProducer is a transactional sarama.AsyncProducer that fails messages
+// with the configured errors in order, all other messages succeed.
+type txnProducer struct {
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+
+	mu        sync.Mutex
+	results   []error
+	status    sarama.ProducerTxnStatusFlag
+	commitErr error
+}
+
+func newTxnProducer(results ...error) *txnProducer {
+	p := &txnProducer{
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+		results:   results,
+		status:    sarama.ProducerTxnFlagReady,
+	}
+	go p.run()
+	return p
+}
+
+func (p *txnProducer) run() {
+	defer close(p.errors)
+	defer close(p.successes)
+	for msg := range p.input {
+		p.mu.Lock()
+		var err error
+		if len(p.results) > 0 {
+			err, p.results = p.results[0], p.results[1:]
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			p.errors <- &sarama.ProducerError{Msg: msg, Err: err}
+		} else {
+			p.successes <- msg
+		}
+	}
+}
+
+func (p *txnProducer) AsyncClose()                               { close(p.input) }
+func (p *txnProducer) Close() error                              { p.AsyncClose(); return nil }
+func (p *txnProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *txnProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *txnProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+func (p *txnProducer) IsTransactional() bool                     { return true }
+
+func (p *txnProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *txnProducer) BeginTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = sarama.ProducerTxnFlagInTransaction
+	return nil
+}
+
+func (p *txnProducer) CommitTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.commitErr != nil {
+		p.status = sarama.ProducerTxnFlagInError | sarama.ProducerTxnFlagAbortableError
+		return p.commitErr
+	}
+	p.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *txnProducer) AbortTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *txnProducer) AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata, string) error {
+	return nil
+}
+
+func (p *txnProducer) AddMessageToTxn(*sarama.ConsumerMessage, string, *string) error {
+	return nil
+}
+
+func newTransactionalTestClient(t *testing.T, producer *txnProducer) *client {
+	t.Helper()
+	cfg := sarama.NewConfig()
+	cfg.Version = sarama.V2_1_0_0
+	cfg.Producer.Transaction.ID = "test"
+
+	c, err := newKafkaClient(
+		outputs.NewNilObserver(),
+		[]string{"localhost:9092"},
+		"testbeat",
+		nil,
+		outil.MakeSelector(outil.ConstSelectorExpr("test", outil.SelectorKeepCase)),
+		nil,
+		json.New("1.2.3", json.Config{}),
+		nil,
+		cfg,
+		logptest.NewTestingLogger(t, ""),
+	)
+	require.NoError(t, err)
+
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	t.Cleanup(func() { require.NoError(t, c.Close()) })
+	return c
+}
+
+func testBatch(n int) *outest.Batch {
+	events := make([]beat.Event, n)
+	for i := range events {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": randString(10)},
+		}
+	}
+	return outest.NewBatch(events...)
+}
+
+func TestPublishTransactionCommit(t *testing.T) {
+	producer := newTxnProducer()
+	c := newTransactionalTestClient(t, producer)
+
+	batch := testBatch(2)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, int64(1), c.transactionsCommitted.Count())
+	assert.Equal(t, int64(0), c.transactionsAborted.Count())
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+}
+
+func TestPublishTransactionAbort(t *testing.T) {
+	producer := newTxnProducer(nil, sarama.ErrNotLeaderForPartition, sarama.ErrMessageSizeTooLarge)
+	c := newTransactionalTestClient(t, producer)
+
+	batch := testBatch(3)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	// The delivered event is discarded with the transaction and retried
+	// together with the failed one, the too large event is dropped.
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 2)
+	assert.Equal(t, int64(0), c.transactionsCommitted.Count())
+	assert.Equal(t, int64(1), c.transactionsAborted.Count())
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+}
+
+func TestPublishTransactionCommitFailure(t *testing.T) {
+	producer := newTxnProducer()
+	producer.commitErr = sarama.ErrOutOfOrderSequenceNumber
+	c := newTransactionalTestClient(t, producer)
+
+	batch := testBatch(2)
+	require.NoError(t, c.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 2)
+	assert.Equal(t, int64(1), c.transactionsAborted.Count())
+	assert.Equal(t, sarama.ProducerTxnFlagReady, producer.TxnStatus())
+}
+
+func TestPublishSchemaRegistryErrors(t *testing.T) {
+	tests := map[string]struct {
+		status   int
+		expected outest.BatchSignalTag
+	}{
+		"incompatible schema is dropped": {
+			status:   http.StatusConflict,
+			expected: outest.BatchACK,
+		},
+		"unavailable registry is retried": {
+			status:   http.StatusServiceUnavailable,
+			expected: outest.BatchRetryEvents,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer registry.Close()
+
+			cfg := schemaregistry.DefaultConfig()
+			cfg.URL = registry.URL
+			cfg.Fields = []schemaregistry.Field{{Name: "message"}}
+			serializer, err := schemaregistry.New(cfg, logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			c := newTransactionalTestClient(t, newTxnProducer())
+			c.serializer = serializer
+
+			batch := testBatch(3)
+			require.NoError(t, c.Publish(context.Background(), batch))
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.expected, batch.Signals[0].Tag)
+		})
+	}
+}
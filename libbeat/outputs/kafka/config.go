@@ -31,6 +31,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/transport/kerberos"
 	"github.com/elastic/beats/v7/libbeat/management"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/kafka/schemaregistry"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/monitoring"
@@ -60,6 +61,8 @@ type kafkaConfig struct {
 	KeepAlive          time.Duration             `config:"keep_alive"          validate:"min=0"`
 	MaxMessageBytes    *int                      `config:"max_message_bytes"   validate:"min=1"`
 	RequiredACKs       *int                      `config:"required_acks"       validate:"min=-1"`
+	Idempotent         bool                      `config:"idempotent"`
+	Transactional      transactionalConfig       `config:"transactional"`
 	BrokerTimeout      time.Duration             `config:"broker_timeout"      validate:"min=1"`
 	Compression        string                    `config:"compression"`
 	CompressionLevel   int                       `config:"compression_level"`
@@ -74,6 +77,7 @@ type kafkaConfig struct {
 	Username           string                    `config:"username"`
 	Password           string                    `config:"password"`
 	Codec              codec.Config              `config:"codec"`
+	SchemaRegistry     *config.C                 `config:"schema_registry"`
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
 	Queue              config.Namespace          `config:"queue"`
@@ -84,6 +88,11 @@ type kafkaConfig struct {
 	Topics []any  `config:"topics"`
 }
 
+type transactionalConfig struct {
+	ID      string        `config:"id"`
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+}
+
 type metaConfig struct {
 	Retry       metaRetryConfig `config:"retry"`
 	RefreshFreq time.Duration   `config:"refresh_frequency" validate:"min=0"`
@@ -132,6 +141,7 @@ func defaultConfig() kafkaConfig {
 		KeepAlive:        0,
 		MaxMessageBytes:  nil, // use library default
 		RequiredACKs:     nil, // use library default
+		Idempotent:       false,
 		BrokerTimeout:    10 * time.Second,
 		Compression:      "gzip",
 		CompressionLevel: 4,
@@ -142,6 +152,10 @@ func defaultConfig() kafkaConfig {
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
+		Transactional: transactionalConfig{
+			ID:      "",
+			Timeout: 1 * time.Minute,
+		},
 		ClientID:       "beats",
 		ChanBufferSize: 256,
 		Username:       "",
@@ -157,6 +171,14 @@ func readConfig(cfg *config.C) (*kafkaConfig, error) {
 	return &c, nil
 }
 
+func readSchemaRegistryConfig(cfg *config.C) (schemaregistry.Config, error) {
+	c := schemaregistry.DefaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return c, fmt.Errorf("invalid schema_registry settings: %w", err)
+	}
+	return c, nil
+}
+
 func (c *kafkaConfig) Validate() error {
 	if len(c.Hosts) == 0 {
 		return errors.New("no hosts configured")
@@ -181,6 +203,28 @@ func (c *kafkaConfig) Validate() error {
 		}
 	}
 
+	if c.Idempotent {
+		if c.RequiredACKs != nil && *c.RequiredACKs != int(sarama.WaitForAll) {
+			return errors.New("idempotent requires required_acks to be -1")
+		}
+		if version, ok := c.Version.Get(); ok && !version.IsAtLeast(sarama.V0_11_0_0) {
+			return errors.New("idempotent requires version 0.11.0 or newer")
+		}
+	}
+
+	if c.Transactional.ID != "" && !c.Idempotent {
+		return errors.New("transactional.id requires idempotent to be enabled")
+	}
+
+	if c.SchemaRegistry != nil {
+		if c.Codec.Namespace.IsSet() {
+			return errors.New("'codec' and 'schema_registry' can't be used together")
+		}
+		if _, err := readSchemaRegistryConfig(c.SchemaRegistry); err != nil {
+			return err
+		}
+	}
+
 	if c.Topic == "" && len(c.Topics) == 0 {
 		return errors.New("either 'topic' or 'topics' must be defined")
 	}
@@ -269,6 +313,19 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 		k.Producer.RequiredAcks = sarama.RequiredAcks(*config.RequiredACKs)
 	}
 
+	// the idempotent producer needs the acknowledgement of all in-sync
+	// replicas and, in sarama, a single in-flight request per broker to
+	// keep the message order on retries.
+	if config.Idempotent {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+	if config.Transactional.ID != "" {
+		k.Producer.Transaction.ID = config.Transactional.ID
+		k.Producer.Transaction.Timeout = config.Transactional.Timeout
+	}
+
 	compressionMode, ok := compressionModes[strings.ToLower(config.Compression)]
 	if !ok {
 		return nil, fmt.Errorf("Unknown compression mode: '%v'", config.Compression)
@@ -313,6 +370,7 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 		adapter.Rename("outgoing-byte-rate", "write.bytes"),
 		adapter.Rename("request-latency-in-ms", "write.latency"),
 		adapter.Rename("requests-in-flight", "kafka.requests-in-flight"),
+		adapter.Whitelist(transactionsCommittedMetric, transactionsAbortedMetric),
 		adapter.GoMetricsNilify,
 	)
 
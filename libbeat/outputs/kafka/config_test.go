@@ -29,6 +29,7 @@ import (
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
 	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/sarama"
 )
 
 func TestConfigAcceptValid(t *testing.T) {
@@ -43,6 +44,19 @@ func TestConfigAcceptValid(t *testing.T) {
 			"version":     "1.0.0",
 			"topic":       "foo",
 		},
+		"idempotent with transactions": mapstr.M{
+			"idempotent":       true,
+			"transactional.id": "beats",
+			"topic":            "foo",
+		},
+		"schema_registry": mapstr.M{
+			"topic": "foo",
+			"schema_registry": mapstr.M{
+				"url":    "http://localhost:8081",
+				"format": "protobuf",
+				"fields": []mapstr.M{{"name": "message"}},
+			},
+		},
 	}
 
 	for name, test := range tests {
@@ -76,6 +90,32 @@ func TestConfigInvalid(t *testing.T) {
 		},
 		// The default config does not set `topic` nor `topics`.
 		"No topics or topic provided": mapstr.M{},
+		"idempotent without required_acks -1": mapstr.M{
+			"idempotent":    true,
+			"required_acks": 1,
+			"topic":         "foo",
+		},
+		"idempotent with 0.10": mapstr.M{
+			"idempotent": true,
+			"version":    "0.10.2",
+			"topic":      "foo",
+		},
+		"transactional without idempotent": mapstr.M{
+			"transactional.id": "beats",
+			"topic":            "foo",
+		},
+		"schema_registry with codec": mapstr.M{
+			"topic":      "foo",
+			"codec.json": mapstr.M{"pretty": true},
+			"schema_registry": mapstr.M{
+				"url":    "http://localhost:8081",
+				"fields": []mapstr.M{{"name": "message"}},
+			},
+		},
+		"schema_registry without fields": mapstr.M{
+			"topic":               "foo",
+			"schema_registry.url": "http://localhost:8081",
+		},
 	}
 
 	for name, test := range tests {
@@ -93,6 +133,37 @@ func TestConfigInvalid(t *testing.T) {
 	}
 }
 
+func TestConfigIdempotent(t *testing.T) {
+	c := config.MustNewConfigFrom(mapstr.M{
+		"hosts":                 []string{"localhost"},
+		"topic":                 "foo",
+		"idempotent":            true,
+		"transactional.id":      "beats",
+		"transactional.timeout": "30s",
+	})
+	cfg, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can not create test configuration: %v", err)
+	}
+	k, err := newSaramaConfig(logptest.NewTestingLogger(t, ""), cfg)
+	if err != nil {
+		t.Fatalf("Failure creating sarama config: %v", err)
+	}
+
+	if !k.Producer.Idempotent {
+		t.Error("expected the idempotent producer to be enabled")
+	}
+	if k.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("expected required acks to be WaitForAll, got %v", k.Producer.RequiredAcks)
+	}
+	if k.Net.MaxOpenRequests != 1 {
+		t.Errorf("expected a single open request, got %v", k.Net.MaxOpenRequests)
+	}
+	if k.Producer.Transaction.ID != "beats" || k.Producer.Transaction.Timeout != 30*time.Second {
+		t.Errorf("unexpected transaction settings: %+v", k.Producer.Transaction)
+	}
+}
+
 func TestConfigUnderElasticAgent(t *testing.T) {
 	oldUnderAgent := management.UnderAgent()
 	t.Cleanup(func() {
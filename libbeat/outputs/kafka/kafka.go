@@ -23,6 +23,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/kafka/schemaregistry"
 	"github.com/elastic/beats/v7/libbeat/outputs/outil"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -73,7 +74,19 @@ func makeKafka(
 		return outputs.Fail(err)
 	}
 
-	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, kConfig.Key, topic, kConfig.Headers, codec, libCfg, beat.Logger)
+	var serializer *schemaregistry.Serializer
+	if kConfig.SchemaRegistry != nil {
+		registryConfig, err := readSchemaRegistryConfig(kConfig.SchemaRegistry)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+		serializer, err = schemaregistry.New(registryConfig, log)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+	}
+
+	client, err := newKafkaClient(observer, hosts, beat.IndexPrefix, kConfig.Key, topic, kConfig.Headers, codec, serializer, libCfg, beat.Logger)
 	if err != nil {
 		return outputs.Fail(err)
 	}
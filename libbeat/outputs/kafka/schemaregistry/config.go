@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// Schema formats.
+const (
+	FormatAvro     = "avro"
+	FormatProtobuf = "protobuf"
+)
+
+// Subject name strategies, named after the Confluent serializer strategies.
+const (
+	StrategyTopicName       = "topic_name"
+	StrategyRecordName      = "record_name"
+	StrategyTopicRecordName = "topic_record_name"
+)
+
+// Config configures the schema registry encoding of the Kafka message
+// values.
+type Config struct {
+	URL             string  `config:"url"`
+	Format          string  `config:"format"`
+	SubjectStrategy string  `config:"subject_strategy"`
+	Name            string  `config:"name"`
+	AutoRegister    bool    `config:"auto_register"`
+	Fields          []Field `config:"fields"`
+
+	Username string `config:"username"`
+	Password string `config:"password"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+// Field maps an event field to a field of the schema.
+type Field struct {
+	// Name of the schema field.
+	Name string `config:"name"`
+	// Field is the event field, it defaults to Name.
+	Field string `config:"field"`
+	// Type is one of the fieldType values, it defaults to string.
+	Type string `config:"type"`
+	// Required fields are not nullable, events missing them are dropped.
+	Required bool `config:"required"`
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fullNamePattern matches an Avro full name or a Protobuf message name
+// with its package.
+var fullNamePattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*\.)*[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DefaultConfig returns the default schema registry settings.
+func DefaultConfig() Config {
+	return Config{
+		Format:          FormatAvro,
+		SubjectStrategy: StrategyTopicName,
+		Name:            "co.elastic.beats.Event",
+		AutoRegister:    true,
+		Transport:       httpcommon.DefaultHTTPTransportSettings(),
+	}
+}
+
+func (c *Config) Validate() error {
+	if c.URL == "" {
+		return errors.New("url is required")
+	}
+	if _, err := url.Parse(c.URL); err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	switch c.Format {
+	case FormatAvro, FormatProtobuf:
+	default:
+		return fmt.Errorf("unsupported format '%s', must be %s or %s", c.Format, FormatAvro, FormatProtobuf)
+	}
+
+	switch c.SubjectStrategy {
+	case StrategyTopicName, StrategyRecordName, StrategyTopicRecordName:
+	default:
+		return fmt.Errorf("unsupported subject_strategy '%s'", c.SubjectStrategy)
+	}
+
+	if !fullNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid name '%s'", c.Name)
+	}
+
+	if c.Username != "" && c.Password == "" {
+		return errors.New("password must be set when username is configured")
+	}
+
+	if len(c.Fields) == 0 {
+		return errors.New("at least one field must be configured")
+	}
+	names := make(map[string]struct{}, len(c.Fields))
+	for _, f := range c.Fields {
+		if !namePattern.MatchString(f.Name) {
+			return fmt.Errorf("invalid field name '%s'", f.Name)
+		}
+		if _, ok := names[f.Name]; ok {
+			return fmt.Errorf("duplicate field name '%s'", f.Name)
+		}
+		names[f.Name] = struct{}{}
+		if f.Type != "" {
+			if _, ok := fieldTypes[f.Type]; !ok {
+				return fmt.Errorf("unsupported type '%s' of field '%s'", f.Type, f.Name)
+			}
+		}
+	}
+
+	return nil
+}
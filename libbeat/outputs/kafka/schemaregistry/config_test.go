@@ -0,0 +1,129 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfigValidate(t *testing.T) {
+	fields := []map[string]interface{}{{"name": "message"}}
+	tests := map[string]struct {
+		settings map[string]interface{}
+		err      string
+	}{
+		"valid": {
+			settings: map[string]interface{}{"url": "http://localhost:8081", "fields": fields},
+		},
+		"missing url": {
+			settings: map[string]interface{}{"fields": fields},
+			err:      "url is required",
+		},
+		"no fields": {
+			settings: map[string]interface{}{"url": "http://localhost:8081"},
+			err:      "at least one field",
+		},
+		"unknown format": {
+			settings: map[string]interface{}{"url": "http://localhost:8081", "format": "thrift", "fields": fields},
+			err:      "unsupported format",
+		},
+		"invalid name": {
+			settings: map[string]interface{}{"url": "http://localhost:8081", "name": "co.elastic-beats", "fields": fields},
+			err:      "invalid name",
+		},
+		"invalid field name": {
+			settings: map[string]interface{}{
+				"url":    "http://localhost:8081",
+				"fields": []map[string]interface{}{{"name": "event.code"}},
+			},
+			err: "invalid field name",
+		},
+		"duplicate field": {
+			settings: map[string]interface{}{
+				"url":    "http://localhost:8081",
+				"fields": []map[string]interface{}{{"name": "message"}, {"name": "message"}},
+			},
+			err: "duplicate field name",
+		},
+		"unknown type": {
+			settings: map[string]interface{}{
+				"url":    "http://localhost:8081",
+				"fields": []map[string]interface{}{{"name": "message", "type": "decimal"}},
+			},
+			err: "unsupported type",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			err := config.MustNewConfigFrom(test.settings).Unpack(&cfg)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	ts := time.UnixMilli(1700000000123).UTC()
+	tests := []struct {
+		value    interface{}
+		typ      fieldType
+		expected interface{}
+		err      bool
+	}{
+		{value: "a", typ: typeString, expected: "a"},
+		{value: 12, typ: typeString, expected: "12"},
+		{value: mapstr.M{"a": 1}, typ: typeString, err: true},
+		{value: uint16(12), typ: typeLong, expected: int64(12)},
+		{value: float64(12), typ: typeLong, expected: int64(12)},
+		{value: 1.5, typ: typeLong, err: true},
+		{value: uint64(math.MaxUint64), typ: typeLong, err: true},
+		{value: "12", typ: typeLong, expected: int64(12)},
+		{value: 12, typ: typeDouble, expected: float64(12)},
+		{value: float32(1.5), typ: typeDouble, expected: 1.5},
+		{value: "true", typ: typeBoolean, expected: true},
+		{value: 1, typ: typeBoolean, err: true},
+		{value: ts, typ: typeTimestamp, expected: int64(1700000000123)},
+		{value: common.Time(ts), typ: typeTimestamp, expected: int64(1700000000123)},
+		{value: "2023-11-14T22:13:20.123Z", typ: typeTimestamp, expected: int64(1700000000123)},
+		{value: []string{"a", "b"}, typ: typeJSON, expected: `["a","b"]`},
+	}
+
+	for _, test := range tests {
+		v, err := convert(test.value, test.typ)
+		if test.err {
+			assert.Error(t, err, "%v", test.value)
+			continue
+		}
+		if assert.NoError(t, err, "%v", test.value) {
+			assert.Equal(t, test.expected, v)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// errorTTL is the time a failed lookup of a subject is cached, so that a
+// registry outage doesn't cause a request for every event.
+const errorTTL = 5 * time.Second
+
+// registry looks up or registers the schema for each subject in a
+// Confluent-compatible schema registry and caches the schema IDs.
+type registry struct {
+	url        string
+	username   string
+	password   string
+	register   bool
+	schema     string
+	schemaType string
+	client     *http.Client
+
+	// requests makes sure that only one request per subject is in flight.
+	requests singleflight.Group
+
+	mu     sync.Mutex
+	ids    map[string]int
+	errors map[string]cachedError
+	now    func() time.Time
+}
+
+type cachedError struct {
+	err error
+	at  time.Time
+}
+
+type schemaRequest struct {
+	Schema string `json:"schema"`
+	// SchemaType is omitted for Avro, the default of the registry.
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type schemaResponse struct {
+	ID int `json:"id"`
+}
+
+type errorResponse struct {
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+// statusError is returned if the registry responds with an unsuccessful
+// status.
+type statusError struct {
+	subject string
+	status  int
+	resp    errorResponse
+}
+
+func (e *statusError) Error() string {
+	if e.resp.Message != "" {
+		return fmt.Sprintf("subject '%s': %s (status %d, error code %d)", e.subject, e.resp.Message, e.status, e.resp.Code)
+	}
+	return fmt.Sprintf("subject '%s': unexpected status %d", e.subject, e.status)
+}
+
+// isPermanent returns true if the registry rejected the schema of the
+// events, because it is incompatible with the subject or invalid. Such
+// events can't be encoded. Other client errors, like invalid credentials
+// or a subject that doesn't exist yet, are retried as they are expected to
+// be fixed in the registry.
+func isPermanent(err error) bool {
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.status {
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// schemaID returns the ID of the schema in the subject.
+func (r *registry) schemaID(subject string) (int, error) {
+	r.mu.Lock()
+	if id, ok := r.ids[subject]; ok {
+		r.mu.Unlock()
+		return id, nil
+	}
+	if cached, ok := r.errors[subject]; ok && r.now().Sub(cached.at) < errorTTL {
+		r.mu.Unlock()
+		return 0, cached.err
+	}
+	r.mu.Unlock()
+
+	// The lock is not held during the request, so events of other subjects
+	// are not blocked by a slow registry.
+	v, err, _ := r.requests.Do(subject, func() (interface{}, error) {
+		id, err := r.request(subject)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err != nil {
+			r.errors[subject] = cachedError{err: err, at: r.now()}
+			return 0, err
+		}
+		delete(r.errors, subject)
+		r.ids[subject] = id
+		return id, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	id, _ := v.(int)
+	return id, nil
+}
+
+// request registers the schema in the subject, or looks it up if schemas
+// are not registered automatically.
+func (r *registry) request(subject string) (int, error) {
+	path := "/subjects/" + url.PathEscape(subject)
+	if r.register {
+		path += "/versions"
+	}
+
+	schemaType := r.schemaType
+	if schemaType == "AVRO" {
+		schemaType = ""
+	}
+	body, err := json.Marshal(schemaRequest{Schema: r.schema, SchemaType: schemaType})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(r.url, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType+", application/json")
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &statusError{subject: subject, status: resp.StatusCode}
+		_ = json.Unmarshal(data, &statusErr.resp)
+		return 0, statusErr
+	}
+
+	var schemaResp schemaResponse
+	if err := json.Unmarshal(data, &schemaResp); err != nil {
+		return 0, fmt.Errorf("subject '%s': failed to decode response: %w", subject, err)
+	}
+	return schemaResp.ID, nil
+}
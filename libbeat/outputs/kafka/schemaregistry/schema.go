@@ -0,0 +1,333 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+)
+
+// fieldType is the type of a schema field. Values of the event field are
+// converted to the type before they are encoded.
+type fieldType int
+
+const (
+	typeString fieldType = iota
+	typeLong
+	typeDouble
+	typeBoolean
+	// typeTimestamp is a long holding the milliseconds since the epoch.
+	typeTimestamp
+	// typeJSON is a string holding the JSON encoded value, it can be used
+	// for objects and arrays.
+	typeJSON
+)
+
+var fieldTypes = map[string]fieldType{
+	"string":    typeString,
+	"long":      typeLong,
+	"double":    typeDouble,
+	"boolean":   typeBoolean,
+	"timestamp": typeTimestamp,
+	"json":      typeJSON,
+}
+
+// schemaField is a configured Field with its defaults applied.
+type schemaField struct {
+	name     string
+	field    string
+	typ      fieldType
+	required bool
+}
+
+func makeSchemaFields(fields []Field) []schemaField {
+	result := make([]schemaField, len(fields))
+	for i, f := range fields {
+		result[i] = schemaField{
+			name:     f.Name,
+			field:    f.Field,
+			typ:      fieldTypes[f.Type],
+			required: f.Required,
+		}
+		if result[i].field == "" {
+			result[i].field = f.Name
+		}
+	}
+	return result
+}
+
+// convert converts an event value to the string, int64, float64 or bool
+// representation of the field type.
+func convert(v interface{}, typ fieldType) (interface{}, error) {
+	switch typ {
+	case typeString:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return fmt.Sprint(v), nil
+		}
+	case typeLong:
+		switch v := v.(type) {
+		case int:
+			return int64(v), nil
+		case int8:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case uint:
+			return uintToLong(uint64(v))
+		case uint8:
+			return int64(v), nil
+		case uint16:
+			return int64(v), nil
+		case uint32:
+			return int64(v), nil
+		case uint64:
+			return uintToLong(v)
+		case float32:
+			return floatToLong(float64(v))
+		case float64:
+			return floatToLong(v)
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case typeDouble:
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case string:
+			return strconv.ParseFloat(v, 64)
+		}
+		if l, err := convert(v, typeLong); err == nil {
+			return float64(l.(int64)), nil
+		}
+	case typeBoolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case typeTimestamp:
+		switch v := v.(type) {
+		case time.Time:
+			return v.UnixMilli(), nil
+		case common.Time:
+			return time.Time(v).UnixMilli(), nil
+		case string:
+			ts, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return nil, err
+			}
+			return ts.UnixMilli(), nil
+		}
+	case typeJSON:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	return nil, fmt.Errorf("can't convert %T", v)
+}
+
+func uintToLong(u uint64) (interface{}, error) {
+	if u > math.MaxInt64 {
+		return nil, errors.New("value overflows long")
+	}
+	return int64(u), nil
+}
+
+func floatToLong(f float64) (interface{}, error) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return nil, fmt.Errorf("%v is not a long", f)
+	}
+	return int64(f), nil
+}
+
+// schemaFormat generates the schema of the fields and encodes the values
+// according to it.
+type schemaFormat interface {
+	// schemaType is the schemaType of the registry API.
+	schemaType() string
+	schema(name string, fields []schemaField) (string, error)
+	// appendValues encodes the converted values of the fields, nil values
+	// are missing.
+	appendValues(buf []byte, fields []schemaField, values []interface{}) []byte
+}
+
+// splitName splits a full name into its namespace and name.
+func splitName(fullName string) (string, string) {
+	if i := strings.LastIndexByte(fullName, '.'); i >= 0 {
+		return fullName[:i], fullName[i+1:]
+	}
+	return "", fullName
+}
+
+// avroFormat encodes the fields as an Avro record. Optional fields are
+// unions of null and the field type with a null default.
+type avroFormat struct{}
+
+type avroRecord struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name    string           `json:"name"`
+	Type    interface{}      `json:"type"`
+	Default *json.RawMessage `json:"default,omitempty"`
+}
+
+func (avroFormat) schemaType() string { return "AVRO" }
+
+func (avroFormat) schema(fullName string, fields []schemaField) (string, error) {
+	namespace, name := splitName(fullName)
+	record := avroRecord{Type: "record", Name: name, Namespace: namespace}
+	null := json.RawMessage("null")
+	for _, f := range fields {
+		var typ interface{}
+		switch f.typ {
+		case typeString, typeJSON:
+			typ = "string"
+		case typeLong:
+			typ = "long"
+		case typeDouble:
+			typ = "double"
+		case typeBoolean:
+			typ = "boolean"
+		case typeTimestamp:
+			typ = map[string]string{"type": "long", "logicalType": "timestamp-millis"}
+		}
+		field := avroField{Name: f.name, Type: typ}
+		if !f.required {
+			field.Type = []interface{}{"null", typ}
+			field.Default = &null
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	data, err := json.Marshal(record)
+	return string(data), err
+}
+
+func (avroFormat) appendValues(buf []byte, fields []schemaField, values []interface{}) []byte {
+	for i, f := range fields {
+		v := values[i]
+		if !f.required {
+			// index of the union branch
+			if v == nil {
+				buf = binary.AppendVarint(buf, 0)
+				continue
+			}
+			buf = binary.AppendVarint(buf, 1)
+		}
+		switch v := v.(type) {
+		case string:
+			buf = binary.AppendVarint(buf, int64(len(v)))
+			buf = append(buf, v...)
+		case int64:
+			buf = binary.AppendVarint(buf, v)
+		case float64:
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		case bool:
+			if v {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+		}
+	}
+	return buf
+}
+
+// protobufFormat encodes the fields as a proto3 message, the field numbers
+// follow the order of the fields. Optional fields are only written if they
+// are set.
+type protobufFormat struct{}
+
+func (protobufFormat) schemaType() string { return "PROTOBUF" }
+
+func (protobufFormat) schema(fullName string, fields []schemaField) (string, error) {
+	pkg, name := splitName(fullName)
+	var sb strings.Builder
+	sb.WriteString("syntax = \"proto3\";\n\n")
+	if pkg != "" {
+		fmt.Fprintf(&sb, "package %s;\n\n", pkg)
+	}
+	fmt.Fprintf(&sb, "message %s {\n", name)
+	for i, f := range fields {
+		var typ string
+		switch f.typ {
+		case typeString, typeJSON:
+			typ = "string"
+		case typeLong, typeTimestamp:
+			typ = "int64"
+		case typeDouble:
+			typ = "double"
+		case typeBoolean:
+			typ = "bool"
+		}
+		label := "optional "
+		if f.required {
+			label = ""
+		}
+		fmt.Fprintf(&sb, "  %s%s %s = %d;\n", label, typ, f.name, i+1)
+	}
+	sb.WriteString("}\n")
+	return sb.String(), nil
+}
+
+func (protobufFormat) appendValues(buf []byte, fields []schemaField, values []interface{}) []byte {
+	for i := range fields {
+		num := protowire.Number(i + 1)
+		switch v := values[i].(type) {
+		case string:
+			buf = protowire.AppendTag(buf, num, protowire.BytesType)
+			buf = protowire.AppendString(buf, v)
+		case int64:
+			buf = protowire.AppendTag(buf, num, protowire.VarintType)
+			buf = protowire.AppendVarint(buf, uint64(v))
+		case float64:
+			buf = protowire.AppendTag(buf, num, protowire.Fixed64Type)
+			buf = protowire.AppendFixed64(buf, math.Float64bits(v))
+		case bool:
+			buf = protowire.AppendTag(buf, num, protowire.VarintType)
+			buf = protowire.AppendVarint(buf, protowire.EncodeBool(v))
+		}
+	}
+	return buf
+}
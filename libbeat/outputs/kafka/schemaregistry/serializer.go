@@ -0,0 +1,149 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package schemaregistry encodes events with a schema stored in a
+// Confluent-compatible schema registry. The schema is derived from a
+// mapping of event fields to schema fields, and the encoded values are
+// prefixed with the schema ID in the Confluent wire format.
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+// ErrRegistry wraps the errors of registry requests that can be retried,
+// like network errors, timeouts, server errors, authentication errors and
+// unknown subjects.
+var ErrRegistry = errors.New("schema registry request failed")
+
+// ErrRegistryRejected wraps the errors of registry requests that the
+// registry rejected because the schema of the events is incompatible or
+// invalid. Retrying the events fails again until the registry or the
+// configuration is changed.
+var ErrRegistryRejected = errors.New("schema registry rejected the request")
+
+// magicByte starts every value in the Confluent wire format, followed by
+// the 4 byte schema ID.
+const magicByte = 0
+
+// Serializer encodes events in the Confluent wire format.
+type Serializer struct {
+	name     string
+	strategy string
+	format   schemaFormat
+	fields   []schemaField
+	registry *registry
+}
+
+// New creates a Serializer for the configuration.
+func New(cfg Config, log *logp.Logger) (*Serializer, error) {
+	var format schemaFormat = avroFormat{}
+	if cfg.Format == FormatProtobuf {
+		format = protobufFormat{}
+	}
+
+	fields := makeSchemaFields(cfg.Fields)
+	schema, err := format.schema(cfg.Name, fields)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate schema: %w", err)
+	}
+
+	client, err := cfg.Transport.Client(
+		httpcommon.WithLogger(log),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: cfg.Transport.IdleConnTimeout},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Serializer{
+		name:     cfg.Name,
+		strategy: cfg.SubjectStrategy,
+		format:   format,
+		fields:   fields,
+		registry: &registry{
+			url:        cfg.URL,
+			username:   cfg.Username,
+			password:   cfg.Password,
+			register:   cfg.AutoRegister,
+			schema:     schema,
+			schemaType: format.schemaType(),
+			client:     client,
+			ids:        map[string]int{},
+			errors:     map[string]cachedError{},
+			now:        time.Now,
+		},
+	}, nil
+}
+
+// Serialize encodes the event published to topic. Errors of the registry
+// requests wrap ErrRegistry or ErrRegistryRejected, all other errors are
+// caused by the event.
+func (s *Serializer) Serialize(topic string, event *beat.Event) ([]byte, error) {
+	values := make([]interface{}, len(s.fields))
+	for i, f := range s.fields {
+		v, err := event.GetValue(f.field)
+		if err != nil && !errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil, fmt.Errorf("failed to read field '%s': %w", f.field, err)
+		}
+		if v == nil {
+			if f.required {
+				return nil, fmt.Errorf("required field '%s' is missing", f.field)
+			}
+			continue
+		}
+		if values[i], err = convert(v, f.typ); err != nil {
+			return nil, fmt.Errorf("failed to convert field '%s': %w", f.field, err)
+		}
+	}
+
+	id, err := s.registry.schemaID(s.subject(topic))
+	if err != nil {
+		if isPermanent(err) {
+			return nil, fmt.Errorf("%w: %w", ErrRegistryRejected, err)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrRegistry, err)
+	}
+
+	buf := make([]byte, 5, 64)
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:], uint32(id)) //nolint:gosec // schema IDs are positive 32 bit integers
+	if _, ok := s.format.(protobufFormat); ok {
+		// The message indexes of the first message in the schema.
+		buf = append(buf, 0)
+	}
+	return s.format.appendValues(buf, s.fields, values), nil
+}
+
+func (s *Serializer) subject(topic string) string {
+	switch s.strategy {
+	case StrategyRecordName:
+		return s.name
+	case StrategyTopicRecordName:
+		return topic + "-" + s.name
+	default:
+		return topic + "-value"
+	}
+}
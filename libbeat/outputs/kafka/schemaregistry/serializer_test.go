@@ -0,0 +1,307 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// stubRegistry is a schema registry storing the schemas in memory.
+type stubRegistry struct {
+	*httptest.Server
+
+	requests atomic.Int32
+	status   atomic.Int32
+	subjects map[string]schemaRequest
+	paths    []string
+}
+
+func newStubRegistry(t *testing.T) *stubRegistry {
+	t.Helper()
+	r := &stubRegistry{subjects: map[string]schemaRequest{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.requests.Add(1)
+		r.paths = append(r.paths, req.URL.Path)
+		assert.Equal(t, contentType, req.Header.Get("Content-Type"))
+
+		if status := r.status.Load(); status != 0 {
+			w.WriteHeader(int(status))
+			_, _ = w.Write([]byte(`{"error_code":50001,"message":"unavailable"}`))
+			return
+		}
+
+		var body schemaRequest
+		data, _ := io.ReadAll(req.Body)
+		assert.NoError(t, json.Unmarshal(data, &body))
+
+		switch req.URL.Path {
+		case "/subjects/logs-value/versions", "/subjects/co.elastic.beats.Event/versions":
+			r.subjects[req.URL.Path] = body
+			_, _ = w.Write([]byte(`{"id":42}`))
+		case "/subjects/registered-value":
+			_, _ = w.Write([]byte(`{"subject":"registered-value","id":7,"version":1,"schema":"{}"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func newTestSerializer(t *testing.T, settings map[string]interface{}) *Serializer {
+	t.Helper()
+	cfg := DefaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+	s, err := New(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return s
+}
+
+func testEvent() *beat.Event {
+	return &beat.Event{
+		Timestamp: time.UnixMilli(1700000000123),
+		Fields: mapstr.M{
+			"message": "hello",
+			"event":   mapstr.M{"code": 4624},
+		},
+	}
+}
+
+func TestSerializeAvro(t *testing.T) {
+	registry := newStubRegistry(t)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url": registry.URL,
+		"fields": []map[string]interface{}{
+			{"name": "timestamp", "field": "@timestamp", "type": "timestamp", "required": true},
+			{"name": "message"},
+			{"name": "code", "field": "event.code", "type": "long"},
+			{"name": "user"},
+		},
+	})
+
+	value, err := s.Serialize("logs", testEvent())
+	require.NoError(t, err)
+
+	expected := []byte{magicByte, 0, 0, 0, 42}
+	expected = binary.AppendVarint(expected, 1700000000123)
+	expected = append(expected, 2, 10)
+	expected = append(expected, "hello"...)
+	expected = append(expected, 2)
+	expected = binary.AppendVarint(expected, 4624)
+	expected = append(expected, 0)
+	assert.Equal(t, expected, value)
+
+	registered := registry.subjects["/subjects/logs-value/versions"]
+	assert.Empty(t, registered.SchemaType)
+	assert.JSONEq(t, `{
+		"type": "record",
+		"name": "Event",
+		"namespace": "co.elastic.beats",
+		"fields": [
+			{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+			{"name": "message", "type": ["null", "string"], "default": null},
+			{"name": "code", "type": ["null", "long"], "default": null},
+			{"name": "user", "type": ["null", "string"], "default": null}
+		]
+	}`, registered.Schema)
+
+	// The schema ID is cached.
+	_, err = s.Serialize("logs", testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), registry.requests.Load())
+}
+
+func TestSerializeProtobuf(t *testing.T) {
+	registry := newStubRegistry(t)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url":              registry.URL,
+		"format":           "protobuf",
+		"subject_strategy": "record_name",
+		"fields": []map[string]interface{}{
+			{"name": "message", "required": true},
+			{"name": "user"},
+			{"name": "event", "type": "json"},
+		},
+	})
+
+	value, err := s.Serialize("logs", testEvent())
+	require.NoError(t, err)
+	require.Equal(t, []byte{magicByte, 0, 0, 0, 42, 0}, value[:6])
+
+	var fields []string
+	data := value[6:]
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		require.GreaterOrEqual(t, n, 0)
+		require.Equal(t, protowire.BytesType, typ)
+		data = data[n:]
+		v, n := protowire.ConsumeString(data)
+		require.GreaterOrEqual(t, n, 0)
+		data = data[n:]
+		fields = append(fields, strconv.Itoa(int(num))+"="+v)
+	}
+	assert.Equal(t, []string{"1=hello", `3={"code":4624}`}, fields)
+
+	registered := registry.subjects["/subjects/co.elastic.beats.Event/versions"]
+	assert.Equal(t, "PROTOBUF", registered.SchemaType)
+	assert.Equal(t, `syntax = "proto3";
+
+package co.elastic.beats;
+
+message Event {
+  string message = 1;
+  optional string user = 2;
+  optional string event = 3;
+}
+`, registered.Schema)
+}
+
+func TestSerializeLookup(t *testing.T) {
+	registry := newStubRegistry(t)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url":           registry.URL,
+		"auto_register": false,
+		"fields":        []map[string]interface{}{{"name": "message"}},
+	})
+
+	value, err := s.Serialize("registered", testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, []byte{magicByte, 0, 0, 0, 7}, value[:5])
+
+	_, err = s.Serialize("unknown", testEvent())
+	assert.ErrorIs(t, err, ErrRegistry, "unknown subjects should be retried")
+	assert.NotErrorIs(t, err, ErrRegistryRejected)
+	assert.ErrorContains(t, err, "Subject not found.")
+	assert.Equal(t, []string{"/subjects/registered-value", "/subjects/unknown-value"}, registry.paths)
+}
+
+func TestSerializeRegistryUnavailable(t *testing.T) {
+	registry := newStubRegistry(t)
+	registry.status.Store(http.StatusServiceUnavailable)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url":    registry.URL,
+		"fields": []map[string]interface{}{{"name": "message"}},
+	})
+	now := time.Now()
+	s.registry.now = func() time.Time { return now }
+
+	_, err := s.Serialize("logs", testEvent())
+	assert.ErrorIs(t, err, ErrRegistry)
+
+	// The error is cached for a while.
+	registry.status.Store(0)
+	_, err = s.Serialize("logs", testEvent())
+	assert.ErrorIs(t, err, ErrRegistry)
+	assert.Equal(t, int32(1), registry.requests.Load())
+
+	now = now.Add(errorTTL)
+	_, err = s.Serialize("logs", testEvent())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), registry.requests.Load())
+}
+
+func TestSerializeRegistryErrors(t *testing.T) {
+	tests := map[int]error{
+		http.StatusUnauthorized:        ErrRegistry,
+		http.StatusForbidden:           ErrRegistry,
+		http.StatusNotFound:            ErrRegistry,
+		http.StatusConflict:            ErrRegistryRejected,
+		http.StatusUnprocessableEntity: ErrRegistryRejected,
+		http.StatusRequestTimeout:      ErrRegistry,
+		http.StatusTooManyRequests:     ErrRegistry,
+		http.StatusInternalServerError: ErrRegistry,
+		http.StatusBadGateway:          ErrRegistry,
+	}
+
+	for status, expected := range tests {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			registry := newStubRegistry(t)
+			registry.status.Store(int32(status))
+			s := newTestSerializer(t, map[string]interface{}{
+				"url":    registry.URL,
+				"fields": []map[string]interface{}{{"name": "message"}},
+			})
+
+			_, err := s.Serialize("logs", testEvent())
+			assert.ErrorIs(t, err, expected)
+		})
+	}
+}
+
+func TestSerializeConcurrentRequests(t *testing.T) {
+	registry := newStubRegistry(t)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url":    registry.URL,
+		"fields": []map[string]interface{}{{"name": "message"}},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Serialize("logs", testEvent())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	id, err := s.registry.schemaID("logs-value")
+	require.NoError(t, err)
+	assert.Equal(t, 42, id)
+}
+
+func TestSerializeInvalidEvent(t *testing.T) {
+	registry := newStubRegistry(t)
+	s := newTestSerializer(t, map[string]interface{}{
+		"url": registry.URL,
+		"fields": []map[string]interface{}{
+			{"name": "user", "required": true},
+			{"name": "message", "type": "long"},
+		},
+	})
+
+	_, err := s.Serialize("logs", testEvent())
+	assert.ErrorContains(t, err, "required field 'user' is missing")
+	assert.NotErrorIs(t, err, ErrRegistry)
+	assert.NotErrorIs(t, err, ErrRegistryRejected)
+
+	event := testEvent()
+	event.Fields["user"] = "alice"
+	_, err = s.Serialize("logs", event)
+	assert.ErrorContains(t, err, "failed to convert field 'message'")
+	assert.Zero(t, registry.requests.Load())
+}
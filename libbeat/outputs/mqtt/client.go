@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	libmqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// disconnectQuiesce is the time in milliseconds given to in-flight work
+// when the connection is closed.
+const disconnectQuiesce = 250
+
+var errNotConnected = errors.New("mqtt client is not connected")
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+
+	options       *libmqtt.ClientOptions
+	newMQTTClient func(*libmqtt.ClientOptions) libmqtt.Client
+	mqtt          libmqtt.Client
+
+	topic    *fmtstr.EventFormatString
+	qos      byte
+	retained bool
+	timeout  time.Duration
+	index    string
+	codec    codec.Codec
+}
+
+// pendingEvent is an event whose publication has not been confirmed yet.
+type pendingEvent struct {
+	event publisher.Event
+	token libmqtt.Token
+}
+
+func newClient(
+	observer outputs.Observer,
+	options *libmqtt.ClientOptions,
+	newMQTTClient func(*libmqtt.ClientOptions) libmqtt.Client,
+	config mqttConfig,
+	index string,
+	codec codec.Codec,
+	logger *logp.Logger,
+) *client {
+	return &client{
+		log:           logger.Named("mqtt"),
+		observer:      observer,
+		options:       options,
+		newMQTTClient: newMQTTClient,
+		topic:         config.Topic,
+		qos:           byte(config.QoS),
+		retained:      config.Retained,
+		timeout:       config.Timeout,
+		index:         strings.ToLower(index),
+		codec:         codec,
+	}
+}
+
+func (c *client) Connect(ctx context.Context) error {
+	c.log.Debug("connect")
+	mqtt := c.newMQTTClient(c.options)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err := waitToken(ctx, mqtt.Connect()); err != nil {
+		return fmt.Errorf("failed to connect to mqtt broker: %w", err)
+	}
+	c.mqtt = mqtt
+	return nil
+}
+
+func (c *client) Close() error {
+	c.log.Debug("close connection")
+	if c.mqtt != nil {
+		c.mqtt.Disconnect(disconnectQuiesce)
+		c.mqtt = nil
+	}
+	return nil
+}
+
+func (c *client) String() string {
+	return "mqtt(" + strings.Join(c.brokers(), ",") + ")"
+}
+
+func (c *client) brokers() []string {
+	brokers := make([]string, len(c.options.Servers))
+	for i, server := range c.options.Servers {
+		brokers[i] = server.String()
+	}
+	return brokers
+}
+
+// Publish sends all events of the batch and waits until the broker has
+// confirmed them. At QoS 0 an event is confirmed once it has been written
+// to the connection, at QoS 1 and 2 once the broker acknowledged it.
+// Events that are not confirmed within the timeout are retried.
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	if c.mqtt == nil {
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return errNotConnected
+	}
+
+	pending := make([]pendingEvent, 0, len(events))
+	dropped := 0
+	for i := range events {
+		event := &events[i]
+		topic, err := c.topic.Run(&event.Content)
+		if err != nil {
+			c.log.Errorf("Dropping event: failed to select topic: %+v", err)
+			dropped++
+			continue
+		}
+
+		serializedEvent, err := c.codec.Encode(c.index, &event.Content)
+		if err != nil {
+			c.log.Errorf("Encoding event failed with error: %+v. Look at the event log file to view the event", err)
+			c.log.Errorw(fmt.Sprintf("Failed event: %v", event.Content), logp.TypeKey, logp.EventType)
+			dropped++
+			continue
+		}
+
+		// The codec reuses its buffer, the client keeps the payload until
+		// the message has been acknowledged.
+		payload := make([]byte, len(serializedEvent))
+		copy(payload, serializedEvent)
+		c.observer.WriteBytes(len(payload))
+
+		pending = append(pending, pendingEvent{
+			event: *event,
+			token: c.mqtt.Publish(topic, c.qos, c.retained, payload),
+		})
+	}
+	if dropped > 0 {
+		c.observer.PermanentErrors(dropped)
+	}
+
+	begin := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var failed []publisher.Event
+	var lastErr error
+	for _, p := range pending {
+		if err := waitToken(ctx, p.token); err != nil {
+			failed = append(failed, p.event)
+			lastErr = err
+		}
+	}
+	c.observer.ReportLatency(time.Since(begin))
+	c.observer.AckedEvents(len(pending) - len(failed))
+
+	if len(failed) > 0 {
+		c.observer.RetryableErrors(len(failed))
+		c.observer.WriteError(lastErr)
+		batch.RetryEvents(failed)
+		return fmt.Errorf("failed to publish %d events: %w", len(failed), lastErr)
+	}
+	batch.ACK()
+	return nil
+}
+
+// waitToken waits until the token completes or the context is done.
+func waitToken(ctx context.Context, token libmqtt.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
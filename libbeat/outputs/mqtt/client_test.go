@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	libmqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	codecjson "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type mockToken struct {
+	done chan struct{}
+	err  error
+}
+
+var _ libmqtt.Token = new(mockToken)
+
+func newMockToken() *mockToken {
+	return &mockToken{done: make(chan struct{})}
+}
+
+func completedToken(err error) *mockToken {
+	t := newMockToken()
+	t.complete(err)
+	return t
+}
+
+func (t *mockToken) complete(err error) {
+	t.err = err
+	close(t.done)
+}
+
+func (t *mockToken) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *mockToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+func (t *mockToken) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *mockToken) Error() error {
+	return t.err
+}
+
+type publishedMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+type mockClient struct {
+	libmqtt.Client
+
+	mu           sync.Mutex
+	connectErr   error
+	disconnected bool
+	published    []publishedMessage
+	// publishToken returns the token for the n-th published message.
+	publishToken func(n int) libmqtt.Token
+}
+
+func (m *mockClient) Connect() libmqtt.Token {
+	return completedToken(m.connectErr)
+}
+
+func (m *mockClient) Disconnect(uint) {
+	m.disconnected = true
+}
+
+func (m *mockClient) Publish(topic string, qos byte, retained bool, payload interface{}) libmqtt.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.published)
+	m.published = append(m.published, publishedMessage{topic, qos, retained, payload.([]byte)})
+	if m.publishToken != nil {
+		return m.publishToken(n)
+	}
+	return completedToken(nil)
+}
+
+func newTestClient(t *testing.T, mock *mockClient, settings map[string]interface{}) *client {
+	t.Helper()
+	cfg := defaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	options, err := createClientOptions(cfg, beat.Info{Beat: "testbeat"})
+	require.NoError(t, err)
+	c := newClient(outputs.NewNilObserver(), options,
+		func(*libmqtt.ClientOptions) libmqtt.Client { return mock },
+		cfg, "testbeat", codecjson.New("1.2.3", codecjson.Config{}),
+		logptest.NewTestingLogger(t, ""))
+	require.NoError(t, c.Connect(context.Background()))
+	return c
+}
+
+func testBatch(sensors ...string) *outest.Batch {
+	events := make([]beat.Event, len(sensors))
+	for i, sensor := range sensors {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"sensor": sensor},
+		}
+	}
+	return outest.NewBatch(events...)
+}
+
+func batchSignals(batch *outest.Batch) []outest.BatchSignalTag {
+	var tags []outest.BatchSignalTag
+	for _, sig := range batch.Signals {
+		tags = append(tags, sig.Tag)
+	}
+	return tags
+}
+
+func TestPublishTopicAndFlags(t *testing.T) {
+	mock := &mockClient{}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts":    []string{"tcp://localhost:1883"},
+		"topic":    "sensors/%{[sensor]}",
+		"qos":      2,
+		"retained": true,
+	})
+
+	batch := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+
+	require.Len(t, mock.published, 2)
+	assert.Equal(t, "sensors/a", mock.published[0].topic)
+	assert.Equal(t, "sensors/b", mock.published[1].topic)
+	for _, msg := range mock.published {
+		assert.Equal(t, byte(2), msg.qos)
+		assert.True(t, msg.retained)
+	}
+	assert.Contains(t, string(mock.published[0].payload), `"sensor":"a"`)
+}
+
+func TestPublishWaitsForAcknowledgement(t *testing.T) {
+	tokens := []*mockToken{newMockToken(), newMockToken()}
+	mock := &mockClient{publishToken: func(n int) libmqtt.Token { return tokens[n] }}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts": []string{"tcp://localhost:1883"},
+		"topic": "sensors",
+	})
+
+	batch := testBatch("a", "b")
+	done := make(chan error)
+	go func() { done <- c.Publish(context.Background(), batch) }()
+
+	tokens[0].complete(nil)
+	select {
+	case <-done:
+		t.Fatal("batch must not be acknowledged before all messages are confirmed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	tokens[1].complete(nil)
+	require.NoError(t, <-done)
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+}
+
+func TestPublishRetriesFailedEvents(t *testing.T) {
+	mock := &mockClient{publishToken: func(n int) libmqtt.Token {
+		if n == 1 {
+			return completedToken(errors.New("connection lost"))
+		}
+		return completedToken(nil)
+	}}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts": []string{"tcp://localhost:1883"},
+		"topic": "sensors",
+	})
+
+	batch := testBatch("a", "b", "c")
+	assert.Error(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 1)
+	assert.Equal(t, "b", batch.Signals[0].Events[0].Content.Fields["sensor"])
+}
+
+func TestPublishTimeout(t *testing.T) {
+	mock := &mockClient{publishToken: func(int) libmqtt.Token { return newMockToken() }}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts": []string{"tcp://localhost:1883"},
+		"topic": "sensors",
+	})
+	c.timeout = 10 * time.Millisecond
+
+	batch := testBatch("a")
+	assert.ErrorIs(t, c.Publish(context.Background(), batch), context.DeadlineExceeded)
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchRetryEvents}, batchSignals(batch))
+}
+
+func TestPublishDropsEventsWithoutTopic(t *testing.T) {
+	mock := &mockClient{}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts": []string{"tcp://localhost:1883"},
+		"topic": "sensors/%{[missing]}",
+	})
+
+	batch := testBatch("a")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Empty(t, mock.published)
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+}
+
+func TestConnectAndClose(t *testing.T) {
+	mock := &mockClient{}
+	c := newTestClient(t, mock, map[string]interface{}{
+		"hosts": []string{"tcp://localhost:1883"},
+		"topic": "sensors",
+	})
+	assert.Equal(t, "mqtt(tcp://localhost:1883)", c.String())
+	require.NoError(t, c.Close())
+	assert.True(t, mock.disconnected)
+
+	batch := testBatch("a")
+	assert.Error(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchRetry}, batchSignals(batch))
+
+	mock.connectErr = errors.New("not authorized")
+	assert.Error(t, c.Connect(context.Background()))
+}
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+type mqttConfig struct {
+	Hosts []string                  `config:"hosts" validate:"required,min=1"`
+	Topic *fmtstr.EventFormatString `config:"topic" validate:"required"`
+	QoS   int                       `config:"qos" validate:"min=0,max=2"`
+	// Retained sets the retained flag on every published message.
+	Retained bool `config:"retained"`
+
+	ClientID     string        `config:"client_id"`
+	Username     string        `config:"username"`
+	Password     string        `config:"password"`
+	CleanSession bool          `config:"clean_session"`
+	KeepAlive    time.Duration `config:"keep_alive" validate:"min=0"`
+	// Timeout bounds connecting to the broker and waiting for the
+	// acknowledgements of a batch.
+	Timeout time.Duration `config:"timeout" validate:"min=1"`
+
+	TLS   *tlscommon.Config `config:"ssl"`
+	Codec codec.Config      `config:"codec"`
+
+	BulkMaxSize int              `config:"bulk_max_size"`
+	MaxRetries  int              `config:"max_retries"`
+	Backoff     backoff          `config:"backoff"`
+	Queue       config.Namespace `config:"queue"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+func defaultConfig() mqttConfig {
+	return mqttConfig{
+		QoS:          1,
+		CleanSession: true,
+		KeepAlive:    30 * time.Second,
+		Timeout:      30 * time.Second,
+		BulkMaxSize:  1024,
+		MaxRetries:   3,
+		Backoff: backoff{
+			Init: 1 * time.Second,
+			Max:  60 * time.Second,
+		},
+	}
+}
+
+func (c *mqttConfig) Validate() error {
+	// MQTT 3.1.1 brokers are only required to accept client IDs of up to
+	// 23 characters.
+	if len(c.ClientID) > 23 {
+		return errors.New("client_id must not be longer than 23 characters")
+	}
+	return nil
+}
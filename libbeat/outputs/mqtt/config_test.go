@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		valid  bool
+	}{
+		"minimal": {
+			config: map[string]interface{}{"hosts": []string{"tcp://localhost:1883"}, "topic": "events"},
+			valid:  true,
+		},
+		"missing topic": {
+			config: map[string]interface{}{"hosts": []string{"tcp://localhost:1883"}},
+		},
+		"missing hosts": {
+			config: map[string]interface{}{"topic": "events"},
+		},
+		"invalid qos": {
+			config: map[string]interface{}{"hosts": []string{"tcp://localhost:1883"}, "topic": "events", "qos": 3},
+		},
+		"client id too long": {
+			config: map[string]interface{}{
+				"hosts":     []string{"tcp://localhost:1883"},
+				"topic":     "events",
+				"client_id": "a-client-id-that-is-too-long",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.config).Unpack(&cfg)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package mqtt
+
+import (
+	libmqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+)
+
+func init() {
+	outputs.RegisterType("mqtt", makeMQTT)
+}
+
+func makeMQTT(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	options, err := createClientOptions(config, beat)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	enc, err := codec.CreateEncoder(beat, config.Codec)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	client := newClient(observer, options, libmqtt.NewClient, config, beat.Beat, enc, beat.Logger)
+
+	// All brokers are handled by a single connection, as brokers drop
+	// existing sessions when another one with the same client ID connects.
+	clients := []outputs.NetworkClient{
+		outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max),
+	}
+	return outputs.SuccessNet(config.Queue, false, config.BulkMaxSize, config.MaxRetries, nil, clients)
+}
+
+func createClientOptions(config mqttConfig, beat beat.Info) (*libmqtt.ClientOptions, error) {
+	clientID := config.ClientID
+	if clientID == "" {
+		clientID = beat.Beat
+	}
+
+	options := libmqtt.NewClientOptions().
+		SetClientID(clientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetCleanSession(config.CleanSession).
+		SetKeepAlive(config.KeepAlive).
+		SetConnectTimeout(config.Timeout).
+		SetWriteTimeout(config.Timeout).
+		// Reconnects are driven by the output pipeline, so events of a
+		// failed batch are retried with backoff.
+		SetAutoReconnect(false).
+		SetConnectRetry(false)
+
+	for _, host := range config.Hosts {
+		options.AddBroker(host)
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := tlscommon.LoadTLSConfig(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		options.SetTLSConfig(tlsConfig.BuildModuleClientConfig(""))
+	}
+	return options, nil
+}
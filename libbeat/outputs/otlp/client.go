@@ -0,0 +1,329 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/version"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/transport/tlscommon"
+	"github.com/elastic/elastic-agent-libs/useragent"
+)
+
+// maxErrorBodySize limits how much of an error response is logged.
+const maxErrorBodySize = 1024
+
+type clientSettings struct {
+	Endpoint string
+	Beat     beat.Info
+	Config   otlpConfig
+	Observer outputs.Observer
+}
+
+type client struct {
+	log      *logp.Logger
+	observer outputs.Observer
+	beat     beat.Info
+	endpoint string
+
+	protocol  string
+	headers   map[string]string
+	gzip      bool
+	transport httpcommon.HTTPTransportSettings
+	userAgent string
+
+	http *http.Client
+	conn *grpc.ClientConn
+	grpc plogotlp.GRPCClient
+}
+
+// exportError is returned by the exporters if the collector failed the
+// request.
+type exportError struct {
+	err error
+	// retryable is set if the request can be retried.
+	retryable bool
+	// throttled is set if the collector asked to slow down.
+	throttled bool
+	// tooLarge is set if the request is too large, splitting the batch may
+	// help.
+	tooLarge bool
+}
+
+func (e *exportError) Error() string { return e.err.Error() }
+func (e *exportError) Unwrap() error { return e.err }
+
+func newClient(s clientSettings) (*client, error) {
+	logger := s.Beat.Logger
+	if logger == nil {
+		logger = logp.NewLogger("")
+	}
+
+	return &client{
+		log:       logger.Named("otlp"),
+		observer:  s.Observer,
+		beat:      s.Beat,
+		endpoint:  s.Endpoint,
+		protocol:  s.Config.Protocol,
+		headers:   s.Config.Headers,
+		gzip:      s.Config.Compression == compressionGzip,
+		transport: s.Config.Transport,
+		userAgent: useragent.UserAgent(s.Beat.Beat, version.GetDefaultVersion(), version.Commit(), version.BuildTime().String()),
+	}, nil
+}
+
+func (c *client) String() string {
+	return "otlp(" + c.protocol + "://" + c.endpoint + ")"
+}
+
+func (c *client) Connect(_ context.Context) error {
+	if c.protocol == protocolHTTP {
+		httpClient, err := c.transport.Client(
+			httpcommon.WithLogger(c.log),
+			httpcommon.WithIOStats(c.observer),
+			httpcommon.WithKeepaliveSettings{IdleConnTimeout: c.transport.IdleConnTimeout},
+			httpcommon.WithHeaderRoundTripper(map[string]string{"User-Agent": c.userAgent}),
+		)
+		if err != nil {
+			return err
+		}
+		c.http = httpClient
+		return nil
+	}
+
+	creds := insecure.NewCredentials()
+	if c.transport.TLS.IsEnabled() {
+		tlsConfig, err := tlscommon.LoadTLSConfig(c.transport.TLS)
+		if err != nil {
+			return err
+		}
+		host, _, err := net.SplitHostPort(c.endpoint)
+		if err != nil {
+			return err
+		}
+		creds = credentials.NewTLS(tlsConfig.BuildModuleClientConfig(host))
+	}
+	conn, err := grpc.NewClient(c.endpoint,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUserAgent(c.userAgent),
+	)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.grpc = plogotlp.NewGRPCClient(conn)
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		c.grpc = nil
+		return err
+	}
+	return nil
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+	if len(events) == 0 {
+		batch.ACK()
+		return nil
+	}
+
+	request := plogotlp.NewExportRequestFromLogs(makeLogs(c.beat, events))
+	begin := time.Now()
+	var response plogotlp.ExportResponse
+	var err error
+	if c.protocol == protocolHTTP {
+		response, err = c.exportHTTP(ctx, request)
+	} else {
+		response, err = c.exportGRPC(ctx, request)
+	}
+
+	var exportErr *exportError
+	switch {
+	case err == nil:
+		c.observer.ReportLatency(time.Since(begin))
+
+	case errors.As(err, &exportErr) && exportErr.tooLarge:
+		if batch.SplitRetry() {
+			c.observer.BatchSplit()
+			c.observer.RetryableErrors(len(events))
+		} else {
+			c.log.Errorf("Dropping %d events: %v", len(events), err)
+			batch.Drop()
+			c.observer.PermanentErrors(len(events))
+		}
+		return nil
+
+	case errors.As(err, &exportErr) && !exportErr.retryable:
+		c.log.Errorf("Dropping %d events: %v", len(events), err)
+		batch.Drop()
+		c.observer.PermanentErrors(len(events))
+		return nil
+
+	default:
+		c.observer.RetryableErrors(len(events))
+		if exportErr != nil && exportErr.throttled {
+			c.observer.ErrTooMany(len(events))
+		}
+		batch.Retry()
+		return err
+	}
+
+	// The collector may reject some of the records, it doesn't say which
+	// ones, so they can't be retried.
+	rejected := int(response.PartialSuccess().RejectedLogRecords())
+	if rejected > len(events) {
+		rejected = len(events)
+	}
+	if rejected > 0 {
+		c.log.Warnf("The collector rejected %d of %d log records: %s",
+			rejected, len(events), response.PartialSuccess().ErrorMessage())
+		c.observer.PermanentErrors(rejected)
+	}
+	c.observer.AckedEvents(len(events) - rejected)
+	batch.ACK()
+	return nil
+}
+
+func (c *client) exportGRPC(ctx context.Context, request plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if c.grpc == nil {
+		return plogotlp.ExportResponse{}, errors.New("grpc client is not connected")
+	}
+	if c.transport.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.transport.Timeout)
+		defer cancel()
+	}
+	if len(c.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(c.headers))
+	}
+	var opts []grpc.CallOption
+	if c.gzip {
+		opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+	}
+
+	response, err := c.grpc.Export(ctx, request, opts...)
+	if err == nil {
+		return response, nil
+	}
+	st := status.Convert(err)
+	exportErr := &exportError{err: fmt.Errorf("export failed with status %s: %s", st.Code(), st.Message())}
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss:
+		exportErr.retryable = true
+	case codes.ResourceExhausted:
+		exportErr.retryable = true
+		exportErr.throttled = true
+	}
+	return plogotlp.ExportResponse{}, exportErr
+}
+
+func (c *client) exportHTTP(ctx context.Context, request plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	if c.http == nil {
+		return plogotlp.ExportResponse{}, errors.New("http client is not connected")
+	}
+	body, err := request.MarshalProto()
+	if err != nil {
+		return plogotlp.ExportResponse{}, &exportError{err: fmt.Errorf("failed to encode request: %w", err)}
+	}
+	if c.gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return plogotlp.ExportResponse{}, err
+		}
+		if err := w.Close(); err != nil {
+			return plogotlp.ExportResponse{}, err
+		}
+		body = buf.Bytes()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return plogotlp.ExportResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if c.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return plogotlp.ExportResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		response := plogotlp.NewExportResponse()
+		respBody, err := io.ReadAll(resp.Body)
+		if err == nil && len(respBody) > 0 && resp.Header.Get("Content-Type") == "application/x-protobuf" {
+			// A response that can't be decoded is still a success.
+			_ = response.UnmarshalProto(respBody)
+		}
+		return response, nil
+	}
+
+	// The body of failed responses is a google.rpc.Status message, it is
+	// only drained.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	exportErr := &exportError{err: fmt.Errorf("export failed with status %d", resp.StatusCode)}
+	switch resp.StatusCode {
+	case http.StatusRequestEntityTooLarge:
+		exportErr.tooLarge = true
+	case http.StatusTooManyRequests:
+		exportErr.retryable = true
+		exportErr.throttled = true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		exportErr.retryable = true
+	}
+	return plogotlp.ExportResponse{}, exportErr
+}
@@ -0,0 +1,285 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestClient(t *testing.T, endpoint string, settings map[string]interface{}) *client {
+	t.Helper()
+	cfg := defaultConfig()
+	require.NoError(t, config.MustNewConfigFrom(settings).Unpack(&cfg))
+
+	c, err := newClient(clientSettings{
+		Endpoint: endpoint,
+		Beat:     beat.Info{Beat: "testbeat", Version: "1.2.3", Logger: logptest.NewTestingLogger(t, "")},
+		Config:   cfg,
+		Observer: outputs.NewNilObserver(),
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testBatch(messages ...string) *outest.Batch {
+	events := make([]beat.Event, len(messages))
+	for i, msg := range messages {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": msg},
+		}
+	}
+	return outest.NewBatch(events...)
+}
+
+func batchSignals(batch *outest.Batch) []outest.BatchSignalTag {
+	var tags []outest.BatchSignalTag
+	for _, sig := range batch.Signals {
+		tags = append(tags, sig.Tag)
+	}
+	return tags
+}
+
+func bodies(logs plog.Logs) []string {
+	var result []string
+	records := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	for i := 0; i < records.Len(); i++ {
+		result = append(result, records.At(i).Body().Str())
+	}
+	return result
+}
+
+type httpRequest struct {
+	header http.Header
+	logs   plog.Logs
+}
+
+func newHTTPServer(t *testing.T, handler func(w http.ResponseWriter)) (*httptest.Server, chan httpRequest) {
+	t.Helper()
+	requests := make(chan httpRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		request := plogotlp.NewExportRequest()
+		assert.NoError(t, request.UnmarshalProto(data))
+		requests <- httpRequest{header: r.Header.Clone(), logs: request.Logs()}
+		handler(w)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestPublishHTTP(t *testing.T) {
+	server, requests := newHTTPServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusOK)
+	})
+	c := newTestClient(t, server.URL+"/v1/logs", map[string]interface{}{
+		"protocol": "http",
+		"headers":  map[string]interface{}{"X-Tenant": "a"},
+	})
+
+	batch := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+
+	req := <-requests
+	assert.Equal(t, "application/x-protobuf", req.header.Get("Content-Type"))
+	assert.Equal(t, "gzip", req.header.Get("Content-Encoding"))
+	assert.Equal(t, "a", req.header.Get("X-Tenant"))
+	assert.Equal(t, []string{"a", "b"}, bodies(req.logs))
+}
+
+func TestPublishHTTPStatus(t *testing.T) {
+	tests := map[string]struct {
+		status  int
+		err     bool
+		signals []outest.BatchSignalTag
+	}{
+		"retryable": {
+			status:  http.StatusServiceUnavailable,
+			err:     true,
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+		},
+		"throttled": {
+			status:  http.StatusTooManyRequests,
+			err:     true,
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+		},
+		"permanent": {
+			status:  http.StatusBadRequest,
+			signals: []outest.BatchSignalTag{outest.BatchDrop},
+		},
+		"too large": {
+			status:  http.StatusRequestEntityTooLarge,
+			signals: []outest.BatchSignalTag{outest.BatchSplitRetry},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, _ := newHTTPServer(t, func(w http.ResponseWriter) {
+				w.WriteHeader(test.status)
+			})
+			c := newTestClient(t, server.URL, map[string]interface{}{"protocol": "http"})
+
+			batch := testBatch("a", "b")
+			err := c.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, batchSignals(batch))
+		})
+	}
+}
+
+func TestPublishHTTPPartialSuccess(t *testing.T) {
+	server, _ := newHTTPServer(t, func(w http.ResponseWriter) {
+		response := plogotlp.NewExportResponse()
+		response.PartialSuccess().SetRejectedLogRecords(1)
+		response.PartialSuccess().SetErrorMessage("invalid record")
+		data, _ := response.MarshalProto()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		_, _ = w.Write(data)
+	})
+	c := newTestClient(t, server.URL, map[string]interface{}{
+		"protocol":    "http",
+		"compression": "none",
+	})
+
+	batch := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+}
+
+type grpcServer struct {
+	plogotlp.UnimplementedGRPCServer
+	requests chan plog.Logs
+	headers  chan metadata.MD
+	err      error
+}
+
+func (s *grpcServer) Export(ctx context.Context, request plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.headers <- md
+	s.requests <- request.Logs()
+	return plogotlp.NewExportResponse(), s.err
+}
+
+func newGRPCServer(t *testing.T, err error) (string, *grpcServer) {
+	t.Helper()
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, listenErr)
+
+	srv := &grpcServer{
+		requests: make(chan plog.Logs, 10),
+		headers:  make(chan metadata.MD, 10),
+		err:      err,
+	}
+	server := grpc.NewServer()
+	plogotlp.RegisterGRPCServer(server, srv)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return listener.Addr().String(), srv
+}
+
+func TestPublishGRPC(t *testing.T) {
+	addr, srv := newGRPCServer(t, nil)
+	c := newTestClient(t, addr, map[string]interface{}{
+		"headers": map[string]interface{}{"X-Tenant": "a"},
+	})
+
+	batch := testBatch("a", "b")
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, []outest.BatchSignalTag{outest.BatchACK}, batchSignals(batch))
+	assert.Equal(t, []string{"a", "b"}, bodies(<-srv.requests))
+	assert.Equal(t, []string{"a"}, (<-srv.headers).Get("x-tenant"))
+}
+
+func TestPublishGRPCStatus(t *testing.T) {
+	tests := map[string]struct {
+		code    codes.Code
+		err     bool
+		signals []outest.BatchSignalTag
+	}{
+		"retryable": {
+			code:    codes.Unavailable,
+			err:     true,
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+		},
+		"throttled": {
+			code:    codes.ResourceExhausted,
+			err:     true,
+			signals: []outest.BatchSignalTag{outest.BatchRetry},
+		},
+		"permanent": {
+			code:    codes.InvalidArgument,
+			signals: []outest.BatchSignalTag{outest.BatchDrop},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			addr, _ := newGRPCServer(t, status.Error(test.code, "failed"))
+			c := newTestClient(t, addr, nil)
+
+			batch := testBatch("a")
+			err := c.Publish(context.Background(), batch)
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.signals, batchSignals(batch))
+		})
+	}
+}
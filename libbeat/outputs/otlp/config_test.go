@@ -0,0 +1,98 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		settings map[string]interface{}
+		err      string
+	}{
+		"defaults": {},
+		"http with path": {
+			settings: map[string]interface{}{"protocol": "http", "path": "/otlp/v1/logs"},
+		},
+		"unknown protocol": {
+			settings: map[string]interface{}{"protocol": "thrift"},
+			err:      "unsupported protocol",
+		},
+		"path with grpc": {
+			settings: map[string]interface{}{"path": "/v1/logs"},
+			err:      "path can only be set",
+		},
+		"unknown compression": {
+			settings: map[string]interface{}{"compression": "zstd"},
+			err:      "unsupported compression",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.settings).Unpack(&cfg)
+			if test.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.err)
+			}
+		})
+	}
+}
+
+func TestMakeEndpoint(t *testing.T) {
+	tests := []struct {
+		settings map[string]interface{}
+		host     string
+		endpoint string
+	}{
+		{host: "collector", endpoint: "collector:4317"},
+		{host: "collector:9000", endpoint: "collector:9000"},
+		{host: "https://collector", endpoint: "collector:4317"},
+		{
+			settings: map[string]interface{}{"protocol": "http"},
+			host:     "collector",
+			endpoint: "http://collector:4318/v1/logs",
+		},
+		{
+			settings: map[string]interface{}{"protocol": "http", "path": "/otlp/v1/logs"},
+			host:     "https://collector:443",
+			endpoint: "https://collector:443/otlp/v1/logs",
+		},
+		{
+			settings: map[string]interface{}{"protocol": "http", "ssl.enabled": true},
+			host:     "collector",
+			endpoint: "https://collector:4318/v1/logs",
+		},
+	}
+
+	for _, test := range tests {
+		cfg := defaultConfig()
+		require.NoError(t, config.MustNewConfigFrom(test.settings).Unpack(&cfg))
+		endpoint, err := makeEndpoint(cfg, test.host)
+		require.NoError(t, err)
+		assert.Equal(t, test.endpoint, endpoint, test.host)
+	}
+}
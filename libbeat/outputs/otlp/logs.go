@@ -0,0 +1,100 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/otelbeat/otelmap"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// makeLogs converts events to OTLP log records. The records share a
+// resource that describes the beat. The message field of an event becomes
+// the body of its record, log.level sets the severity and all other fields
+// are converted to attributes, keeping nested objects as maps.
+func makeLogs(info beat.Info, events []publisher.Event) plog.Logs {
+	logs := plog.NewLogs()
+	resourceLogs := logs.ResourceLogs().AppendEmpty()
+	resource := resourceLogs.Resource().Attributes()
+	resource.PutStr("service.name", info.Beat)
+	resource.PutStr("service.version", info.Version)
+	resource.PutStr("service.instance.id", info.ID.String())
+	if info.Hostname != "" {
+		resource.PutStr("host.name", info.Hostname)
+	}
+
+	scopeLogs := resourceLogs.ScopeLogs().AppendEmpty()
+	scopeLogs.Scope().SetName(info.Beat)
+	scopeLogs.Scope().SetVersion(info.Version)
+
+	observed := pcommon.NewTimestampFromTime(time.Now())
+	records := scopeLogs.LogRecords()
+	records.EnsureCapacity(len(events))
+	for i := range events {
+		setLogRecord(records.AppendEmpty(), &events[i].Content, observed)
+	}
+	return logs
+}
+
+func setLogRecord(record plog.LogRecord, event *beat.Event, observed pcommon.Timestamp) {
+	record.SetTimestamp(pcommon.NewTimestampFromTime(event.Timestamp))
+	record.SetObservedTimestamp(observed)
+
+	fields := make(mapstr.M, len(event.Fields))
+	for k, v := range event.Fields {
+		fields[k] = v
+	}
+	if message, ok := fields["message"].(string); ok {
+		record.Body().SetStr(message)
+		delete(fields, "message")
+	}
+	if level, err := event.Fields.GetValue("log.level"); err == nil {
+		if level, ok := level.(string); ok {
+			record.SetSeverityText(level)
+			record.SetSeverityNumber(severityNumber(level))
+		}
+	}
+	otelmap.FromMapstr(fields).MoveTo(record.Attributes())
+}
+
+// severityNumber maps common log level names to OTLP severity numbers.
+func severityNumber(level string) plog.SeverityNumber {
+	switch strings.ToLower(level) {
+	case "trace":
+		return plog.SeverityNumberTrace
+	case "debug":
+		return plog.SeverityNumberDebug
+	case "info", "informational", "notice":
+		return plog.SeverityNumberInfo
+	case "warn", "warning":
+		return plog.SeverityNumberWarn
+	case "error", "err":
+		return plog.SeverityNumberError
+	case "fatal", "critical", "crit", "alert", "emerg", "emergency":
+		return plog.SeverityNumberFatal
+	default:
+		return plog.SeverityNumberUnspecified
+	}
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/plog"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMakeLogs(t *testing.T) {
+	info := beat.Info{
+		Beat:     "filebeat",
+		Version:  "9.1.0",
+		Hostname: "host-a",
+		ID:       uuid.Must(uuid.FromString("8b2e5c2e-9d4e-4f8e-a2d1-6f3e5b1c2a10")),
+	}
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []publisher.Event{
+		{Content: beat.Event{
+			Timestamp: ts,
+			Fields: mapstr.M{
+				"message": "hello",
+				"log":     mapstr.M{"level": "WARN", "file": mapstr.M{"path": "/var/log/a.log"}},
+				"tags":    []string{"a", "b"},
+			},
+		}},
+		{Content: beat.Event{
+			Timestamp: ts,
+			Fields:    mapstr.M{"count": 3},
+		}},
+	}
+
+	logs := makeLogs(info, events)
+	require.Equal(t, 1, logs.ResourceLogs().Len())
+	resource := logs.ResourceLogs().At(0).Resource().Attributes().AsRaw()
+	assert.Equal(t, map[string]any{
+		"service.name":        "filebeat",
+		"service.version":     "9.1.0",
+		"service.instance.id": "8b2e5c2e-9d4e-4f8e-a2d1-6f3e5b1c2a10",
+		"host.name":           "host-a",
+	}, resource)
+
+	records := logs.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords()
+	require.Equal(t, 2, records.Len())
+
+	record := records.At(0)
+	assert.Equal(t, ts, record.Timestamp().AsTime())
+	assert.NotZero(t, record.ObservedTimestamp())
+	assert.Equal(t, "hello", record.Body().Str())
+	assert.Equal(t, "WARN", record.SeverityText())
+	assert.Equal(t, plog.SeverityNumberWarn, record.SeverityNumber())
+	assert.Equal(t, map[string]any{
+		"log":  map[string]any{"level": "WARN", "file": map[string]any{"path": "/var/log/a.log"}},
+		"tags": []any{"a", "b"},
+	}, record.Attributes().AsRaw())
+
+	record = records.At(1)
+	assert.Equal(t, plog.SeverityNumberUnspecified, record.SeverityNumber())
+	assert.Equal(t, map[string]any{"count": int64(3)}, record.Attributes().AsRaw())
+
+	// The events are not modified.
+	assert.Equal(t, "hello", events[0].Content.Fields["message"])
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"net/url"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func init() {
+	outputs.RegisterType("otlp", makeOTLP)
+}
+
+func makeOTLP(
+	_ outputs.IndexManager,
+	beat beat.Info,
+	observer outputs.Observer,
+	cfg *config.C,
+) (outputs.Group, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return outputs.Fail(err)
+	}
+
+	hosts, err := outputs.ReadHostList(cfg)
+	if err != nil {
+		return outputs.Fail(err)
+	}
+
+	clients := make([]outputs.NetworkClient, len(hosts))
+	for i, host := range hosts {
+		endpoint, err := makeEndpoint(config, host)
+		if err != nil {
+			return outputs.Fail(err)
+		}
+
+		client, err := newClient(clientSettings{
+			Endpoint: endpoint,
+			Beat:     beat,
+			Config:   config,
+			Observer: observer,
+		})
+		if err != nil {
+			return outputs.Fail(err)
+		}
+		clients[i] = outputs.WithBackoff(client, config.Backoff.Init, config.Backoff.Max)
+	}
+
+	return outputs.SuccessNet(config.Queue, config.LoadBalance, config.BulkMaxSize, config.MaxRetries, nil, clients)
+}
+
+// makeEndpoint returns the URL of the logs endpoint of host for OTLP/HTTP,
+// or the host:port target for OTLP/gRPC.
+func makeEndpoint(config otlpConfig, host string) (string, error) {
+	if config.Protocol == protocolHTTP {
+		scheme := "http"
+		if config.Transport.TLS.IsEnabled() {
+			scheme = "https"
+		}
+		path := config.Path
+		if path == "" {
+			path = defaultHTTPPath
+		}
+		return common.MakeURL(scheme, path, host, defaultHTTPPort)
+	}
+
+	// gRPC targets have no scheme or path, only the default port is added.
+	hostURL, err := common.MakeURL("http", "", host, defaultGRPCPort)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := url.Parse(hostURL)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Host, nil
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/config"
 )
@@ -75,6 +76,23 @@ type Group struct {
 	//   and clear Content anyway. Metadata about the error should be saved in
 	//   EncodedEvent and reported when Publish is called.
 	EncoderFactory queue.EncoderFactory
+
+	// If Routes is set the group has no clients of its own. The pipeline
+	// creates a separate queue and set of output workers for each route and
+	// publishes every event to all routes whose condition matches it.
+	Routes []Route
+}
+
+// Route is an output group that only receives the events matching its
+// condition.
+type Route struct {
+	Name string
+
+	// Condition selects the events sent to the route. A nil condition
+	// matches all events.
+	Condition conditions.Condition
+
+	Group Group
 }
 
 // RegisterType registers a new output type.
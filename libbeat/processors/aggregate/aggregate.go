@@ -0,0 +1,483 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	processorName = "aggregate"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+func init() {
+	// We cannot use this as a JS plugin as it includes a Close method.
+	processors.RegisterPlugin(processorName, New)
+}
+
+var _ processors.Emitter = (*processor)(nil)
+
+// aggregators are the aggregations shared by the processors of the clients
+// of an input, keyed by input ID, position in the processors of the
+// clients and configuration.
+var aggregators = struct {
+	sync.Mutex
+	m map[string]*aggregator
+}{m: map[string]*aggregator{}}
+
+type metrics struct {
+	Summaries *monitoring.Int
+	Overflow  *monitoring.Int
+}
+
+// processor is the aggregate processor of a client. Inputs like filestream
+// connect a client per file, the processors of the clients of an input
+// share their aggregator so that a single summary per group is published
+// in each window.
+type processor struct {
+	config
+	clock clockwork.Clock
+
+	// mu protects the aggregator.
+	mu     sync.Mutex
+	agg    *aggregator
+	closed bool
+}
+
+// aggregator aggregates the events of the processors sharing it and
+// publishes the summaries at the end of each window.
+type aggregator struct {
+	config
+	key     string
+	log     *logp.Logger
+	clock   clockwork.Clock
+	metrics metrics
+
+	// refs is the number of processors using the aggregator, it is
+	// protected by the aggregators lock.
+	refs int
+
+	// mu protects the current window.
+	mu     sync.Mutex
+	start  time.Time
+	groups map[string]*group
+
+	// emitMu protects the emitters, it is held while publishing the
+	// summaries so that a processor is not closed while they are published
+	// with its emitter.
+	emitMu   sync.Mutex
+	emitters []emitter
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// emitter is the function publishing events with the client of a processor.
+type emitter struct {
+	p    *processor
+	emit func(beat.Event)
+}
+
+// group is the aggregation of the events with the same dimensions in a
+// window.
+type group struct {
+	dimensions mapstr.M
+	count      int64
+	fields     map[string]*stats
+}
+
+// stats are the statistics of a numeric field.
+type stats struct {
+	count    int64
+	sum      float64
+	min, max float64
+	digest   *tdigest
+}
+
+// New constructs a new aggregate processor. The resulting processor
+// implements `Close()` to publish the summaries of the last window.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+	return newProcessor(c, clockwork.NewRealClock()), nil
+}
+
+func newProcessor(c config, clock clockwork.Clock) *processor {
+	return &processor{config: c, clock: clock}
+}
+
+// SetEmitter sets the function publishing the summaries. The processors
+// at the same position in the clients of the same input share their
+// aggregator, the summaries are published with the client of any of them.
+func (p *processor) SetEmitter(inputID string, index int, emit func(beat.Event)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.agg == nil {
+		p.agg = acquire(p.config, p.clock, inputID, index)
+	}
+	p.agg.emitMu.Lock()
+	p.agg.emitters = append(p.agg.emitters, emitter{p: p, emit: emit})
+	p.agg.emitMu.Unlock()
+}
+
+// aggregator returns the aggregator of the processor, it is nil once the
+// processor is closed. Processors without an emitter don't share their
+// aggregator.
+func (p *processor) aggregator() *aggregator {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.agg == nil && !p.closed {
+		p.agg = acquire(p.config, p.clock, "", 0)
+	}
+	return p.agg
+}
+
+// Run adds the event to the aggregation of its group in the current window.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	a := p.aggregator()
+	if a == nil {
+		return event, nil
+	}
+	if !a.add(event) {
+		// The event is kept so that it is not lost.
+		return event, nil
+	}
+	if p.DropEvents {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Close releases the aggregator of the processor. The summaries of the
+// current window are published early when it is the last processor using
+// it.
+func (p *processor) Close() error {
+	p.mu.Lock()
+	a := p.agg
+	p.agg, p.closed = nil, true
+	p.mu.Unlock()
+
+	if a != nil {
+		a.release(p)
+	}
+	return nil
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("%v=[window=%v, group_by=[%v], fields=[%v]]",
+		processorName, p.Window, strings.Join(p.GroupBy, ", "), strings.Join(p.Fields, ", "))
+}
+
+// acquire returns the aggregator shared by the processors at position index
+// in the clients of the input, or a new aggregator if inputID is empty.
+// Identical processors at different positions get their own aggregator.
+func acquire(c config, clock clockwork.Clock, inputID string, index int) *aggregator {
+	if inputID == "" {
+		a := newAggregator(c, clock, "")
+		a.refs = 1
+		return a
+	}
+
+	aggregators.Lock()
+	defer aggregators.Unlock()
+	key := inputID + "/" + strconv.Itoa(index) + "/" + fmt.Sprintf("%+v", c)
+	a, ok := aggregators.m[key]
+	if !ok {
+		a = newAggregator(c, clock, key)
+		aggregators.m[key] = a
+	}
+	a.refs++
+	return a
+}
+
+// release removes the emitter of p from the aggregator, and closes it if
+// p was the last processor using it.
+func (a *aggregator) release(p *processor) {
+	aggregators.Lock()
+	a.refs--
+	last := a.refs == 0
+	if last && a.key != "" {
+		delete(aggregators.m, a.key)
+	}
+	aggregators.Unlock()
+
+	if last {
+		// The emitter of p publishes the summaries of the current window.
+		a.close()
+	}
+
+	a.emitMu.Lock()
+	defer a.emitMu.Unlock()
+	for i, e := range a.emitters {
+		if e.p == p {
+			a.emitters = append(a.emitters[:i], a.emitters[i+1:]...)
+			break
+		}
+	}
+}
+
+func newAggregator(c config, clock clockwork.Clock, key string) *aggregator {
+	var (
+		id  = int(instanceID.Add(1))
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+	a := &aggregator{
+		config: c,
+		key:    key,
+		log:    logp.NewLogger(logName).With("instance_id", id),
+		clock:  clock,
+		metrics: metrics{
+			Summaries: monitoring.NewInt(reg, "summaries"),
+			Overflow:  monitoring.NewInt(reg, "overflow"),
+		},
+		start:  clock.Now().Truncate(c.Window),
+		groups: map[string]*group{},
+		done:   make(chan struct{}),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// add adds the event to the aggregation of its group, it returns false if
+// the group can't be created because of max_groups.
+func (a *aggregator) add(event *beat.Event) bool {
+	key, dimensions := a.dimensions(event)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	g, ok := a.groups[key]
+	if !ok {
+		if len(a.groups) >= a.MaxGroups {
+			a.metrics.Overflow.Inc()
+			return false
+		}
+		g = &group{dimensions: dimensions, fields: map[string]*stats{}}
+		a.groups[key] = g
+	}
+	g.count++
+	for _, field := range a.Fields {
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		x, ok := toFloat(v)
+		if !ok || math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		s, ok := g.fields[field]
+		if !ok {
+			s = &stats{min: x, max: x}
+			if len(a.Percentiles) > 0 {
+				s.digest = newTDigest(a.Compression)
+			}
+			g.fields[field] = s
+		}
+		s.add(x)
+	}
+	return true
+}
+
+// dimensions returns the key of the group of the event and the values of
+// its dimensions.
+func (a *aggregator) dimensions(event *beat.Event) (string, mapstr.M) {
+	var (
+		b          strings.Builder
+		dimensions = mapstr.M{}
+	)
+	for _, field := range a.GroupBy {
+		v, err := event.GetValue(field)
+		if err != nil {
+			b.WriteByte(0)
+			continue
+		}
+		dimensions[field] = v
+		b.WriteByte(1)
+		fmt.Fprint(&b, v)
+	}
+	return b.String(), dimensions
+}
+
+func (s *stats) add(x float64) {
+	s.count++
+	s.sum += x
+	s.min = math.Min(s.min, x)
+	s.max = math.Max(s.max, x)
+	if s.digest != nil {
+		s.digest.add(x)
+	}
+}
+
+// run publishes the summaries at the end of each window until the
+// aggregator is closed.
+func (a *aggregator) run() {
+	defer a.wg.Done()
+	for {
+		a.mu.Lock()
+		end := a.start.Add(a.Window)
+		a.mu.Unlock()
+
+		select {
+		case <-a.done:
+			return
+		case <-a.clock.After(end.Sub(a.clock.Now())):
+			a.flush(end)
+		}
+	}
+}
+
+// flush starts a new window and publishes the summaries of the previous
+// one, which ends at end.
+func (a *aggregator) flush(end time.Time) {
+	a.mu.Lock()
+	start, groups := a.start, a.groups
+	a.start = a.clock.Now().Truncate(a.Window)
+	a.groups = map[string]*group{}
+	a.mu.Unlock()
+
+	if len(groups) == 0 {
+		return
+	}
+
+	// Summaries are published outside of the window lock, as the pipeline
+	// can block or run the processor while publishing them.
+	a.emitMu.Lock()
+	defer a.emitMu.Unlock()
+	if len(a.emitters) == 0 {
+		a.log.Warnf("Dropping %d summaries, the %v processor can only publish them when used in the processors of an input or module.", len(groups), processorName)
+		return
+	}
+	emit := a.emitters[len(a.emitters)-1].emit
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		emit(a.summary(groups[k], start, end))
+		a.metrics.Summaries.Inc()
+	}
+}
+
+// summary returns the event summarizing a group.
+func (a *aggregator) summary(g *group, start, end time.Time) beat.Event {
+	event := beat.Event{Timestamp: start, Fields: mapstr.M{}}
+	for field, v := range g.dimensions {
+		_, _ = event.PutValue(field, v)
+	}
+
+	target := mapstr.M{
+		"count": g.count,
+		"window": mapstr.M{
+			"start": start,
+			"end":   end,
+		},
+	}
+	for field, s := range g.fields {
+		summary := mapstr.M{
+			"count": s.count,
+			"sum":   s.sum,
+			"min":   s.min,
+			"max":   s.max,
+			"avg":   s.sum / float64(s.count),
+		}
+		if s.digest != nil {
+			percentiles := mapstr.M{}
+			for _, q := range a.Percentiles {
+				percentiles[percentileKey(q)] = s.digest.quantile(q / 100)
+			}
+			summary["percentiles"] = percentiles
+		}
+		_, _ = target.Put(field, summary)
+	}
+	_, _ = event.PutValue(a.TargetField, target)
+	return event
+}
+
+// close publishes the summaries of the current window, which ends early.
+func (a *aggregator) close() {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.wg.Wait()
+		a.flush(a.clock.Now())
+	})
+}
+
+// percentileKey returns the field name of a percentile, like p50 or p99_9.
+func percentileKey(q float64) string {
+	return "p" + strings.ReplaceAll(strconv.FormatFloat(q, 'f', -1, 64), ".", "_")
+}
+
+// toFloat converts numbers and numeric strings to a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,229 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+var start = time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+func newTestProcessor(t *testing.T, config mapstr.M) (*processor, clockwork.FakeClock, chan beat.Event) {
+	t.Helper()
+	c := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(config).Unpack(&c))
+
+	clock := clockwork.NewFakeClockAt(start.Add(10 * time.Second))
+	p := newProcessor(c, clock)
+	t.Cleanup(func() { p.Close() })
+
+	emitted := make(chan beat.Event, 10)
+	p.SetEmitter("", 0, func(e beat.Event) { emitted <- e })
+	return p, clock, emitted
+}
+
+func run(t *testing.T, p *processor, fields mapstr.M) *beat.Event {
+	t.Helper()
+	event, err := p.Run(&beat.Event{Fields: fields})
+	require.NoError(t, err)
+	return event
+}
+
+func TestAggregate(t *testing.T) {
+	p, clock, emitted := newTestProcessor(t, mapstr.M{
+		"group_by":    []string{"url.path", "http.response.status_code"},
+		"fields":      []string{"http.response.body.bytes", "event.duration"},
+		"percentiles": []float64{50, 99.9},
+	})
+
+	for _, bytes := range []interface{}{100, int64(300), "200", "not a number"} {
+		event := run(t, p, mapstr.M{
+			"url":  mapstr.M{"path": "/a"},
+			"http": mapstr.M{"response": mapstr.M{"status_code": 200, "body": mapstr.M{"bytes": bytes}}},
+		})
+		assert.NotNil(t, event)
+	}
+	run(t, p, mapstr.M{"url": mapstr.M{"path": "/b"}, "event": mapstr.M{"duration": 5}})
+
+	clock.BlockUntil(1)
+	clock.Advance(50 * time.Second)
+
+	end := start.Add(time.Minute)
+	window := mapstr.M{"start": start, "end": end}
+	assert.Equal(t, beat.Event{
+		Timestamp: start,
+		Fields: mapstr.M{
+			"url":  mapstr.M{"path": "/a"},
+			"http": mapstr.M{"response": mapstr.M{"status_code": 200}},
+			"aggregate": mapstr.M{
+				"count":  int64(4),
+				"window": window,
+				"http": mapstr.M{"response": mapstr.M{"body": mapstr.M{"bytes": mapstr.M{
+					"count": int64(3), "sum": 600.0, "min": 100.0, "max": 300.0, "avg": 200.0,
+					"percentiles": mapstr.M{"p50": 200.0, "p99_9": 300.0},
+				}}}},
+			},
+		},
+	}, <-emitted)
+	assert.Equal(t, beat.Event{
+		Timestamp: start,
+		Fields: mapstr.M{
+			"url": mapstr.M{"path": "/b"},
+			"aggregate": mapstr.M{
+				"count":  int64(1),
+				"window": window,
+				"event": mapstr.M{"duration": mapstr.M{
+					"count": int64(1), "sum": 5.0, "min": 5.0, "max": 5.0, "avg": 5.0,
+					"percentiles": mapstr.M{"p50": 5.0, "p99_9": 5.0},
+				}},
+			},
+		},
+	}, <-emitted)
+
+	// Empty windows don't produce summaries, Close publishes the current
+	// window early.
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	clock.BlockUntil(1)
+	run(t, p, mapstr.M{"url": mapstr.M{"path": "/a"}})
+	clock.Advance(15 * time.Second)
+	metrics := p.agg.metrics
+	require.NoError(t, p.Close())
+	summary := <-emitted
+	assert.Equal(t, end.Add(time.Minute), summary.Timestamp)
+	assert.Equal(t, mapstr.M{"start": end.Add(time.Minute), "end": end.Add(75 * time.Second)}, summary.Fields["aggregate"].(mapstr.M)["window"])
+	assert.Empty(t, emitted)
+	assert.Equal(t, int64(3), metrics.Summaries.Get())
+}
+
+func TestAggregateSharedByInput(t *testing.T) {
+	c := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(mapstr.M{"group_by": []string{"host.name"}}).Unpack(&c))
+	clock := clockwork.NewFakeClockAt(start.Add(10 * time.Second))
+
+	type emittedEvent struct {
+		client string
+		count  interface{}
+	}
+	emitted := make(chan emittedEvent, 10)
+	// newClient returns the processor at position index of a client of an
+	// input, like the client of a harvester of a filestream input.
+	newClient := func(inputID string, index int, name string) *processor {
+		p := newProcessor(c, clock)
+		t.Cleanup(func() { p.Close() })
+		p.SetEmitter(inputID, index, func(e beat.Event) {
+			count, _ := e.GetValue("aggregate.count")
+			emitted <- emittedEvent{client: name, count: count}
+		})
+		return p
+	}
+	host := mapstr.M{"host": mapstr.M{"name": "a"}}
+
+	a1, a2 := newClient("input-a", 0, "a1"), newClient("input-a", 0, "a2")
+	// An identical processor later in the processors of the input has its
+	// own aggregation.
+	a1Next := newClient("input-a", 1, "a1-next")
+	other := newClient("input-b", 0, "b")
+	run(t, a1, host)
+	run(t, a1, host)
+	run(t, a2, host)
+	run(t, a1Next, host)
+	run(t, other, host)
+
+	// Closing a client doesn't end the window of the input early.
+	require.NoError(t, a1.Close())
+	assert.Empty(t, emitted)
+
+	// The inputs publish a summary each, with the clients still open.
+	clock.BlockUntil(3)
+	clock.Advance(50 * time.Second)
+	got := []emittedEvent{<-emitted, <-emitted, <-emitted}
+	assert.ElementsMatch(t, []emittedEvent{{"a2", int64(3)}, {"a1-next", int64(1)}, {"b", int64(1)}}, got)
+
+	// The window ends early when the last client of the input is closed.
+	clock.BlockUntil(3)
+	run(t, a2, host)
+	require.NoError(t, a2.Close())
+	assert.Equal(t, emittedEvent{"a2", int64(1)}, <-emitted)
+
+	require.NoError(t, a1Next.Close())
+	require.NoError(t, other.Close())
+	assert.Empty(t, emitted)
+	assert.Empty(t, aggregators.m)
+}
+
+func TestAggregateDropEvents(t *testing.T) {
+	p, _, emitted := newTestProcessor(t, mapstr.M{"drop_events": true, "max_groups": 1, "group_by": []string{"host.name"}})
+
+	assert.Nil(t, run(t, p, mapstr.M{"host": mapstr.M{"name": "a"}}))
+	assert.Nil(t, run(t, p, mapstr.M{"host": mapstr.M{"name": "a"}}))
+
+	// Events of groups above the limit are not aggregated nor dropped.
+	assert.NotNil(t, run(t, p, mapstr.M{"host": mapstr.M{"name": "b"}}))
+	assert.Equal(t, int64(1), p.agg.metrics.Overflow.Get())
+
+	require.NoError(t, p.Close())
+	summary := <-emitted
+	assert.Equal(t, "a", summary.Fields["host"].(mapstr.M)["name"])
+	count, err := summary.GetValue("aggregate.count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestConfig(t *testing.T) {
+	tests := map[string]struct {
+		config mapstr.M
+		err    string
+	}{
+		"invalid window": {
+			config: mapstr.M{"window": "0s"},
+			err:    "zero value accessing 'window'",
+		},
+		"invalid percentile": {
+			config: mapstr.M{"fields": []string{"x"}, "percentiles": []float64{100}},
+			err:    "percentile 100 must be in the range (0, 100)",
+		},
+		"percentiles without fields": {
+			config: mapstr.M{"percentiles": []float64{50}},
+			err:    "percentiles require fields",
+		},
+		"empty target field": {
+			config: mapstr.M{"target_field": ""},
+			err:    "target_field must not be empty",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(test.config))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{}))
+	require.NoError(t, err)
+	assert.NoError(t, p.(*processor).Close())
+}
@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type config struct {
+	// Window is the duration of the tumbling windows over which events
+	// are aggregated.
+	Window time.Duration `config:"window" validate:"positive,nonzero"`
+
+	// GroupBy is the list of dimension fields, a summary is emitted for
+	// each combination of their values.
+	GroupBy []string `config:"group_by"`
+
+	// Fields is the list of numeric fields summarized.
+	Fields []string `config:"fields"`
+
+	// Percentiles is the list of percentiles of the fields to estimate.
+	Percentiles []float64 `config:"percentiles"`
+
+	// Compression trades the accuracy of the percentiles for memory.
+	Compression float64 `config:"compression" validate:"min=10"`
+
+	// TargetField is the field holding the statistics in summaries.
+	TargetField string `config:"target_field"`
+
+	// DropEvents drops the aggregated events, only summaries are kept.
+	DropEvents bool `config:"drop_events"`
+
+	// MaxGroups is the maximum number of groups in a window. Events of
+	// new groups are not aggregated once it is reached.
+	MaxGroups int `config:"max_groups" validate:"positive,nonzero"`
+}
+
+func defaultConfig() config {
+	return config{
+		Window:      time.Minute,
+		Compression: 100,
+		TargetField: "aggregate",
+		MaxGroups:   10000,
+	}
+}
+
+func (cfg *config) Validate() error {
+	if cfg.TargetField == "" {
+		return errors.New("target_field must not be empty")
+	}
+	for _, p := range cfg.Percentiles {
+		if p <= 0 || p >= 100 {
+			return fmt.Errorf("percentile %v must be in the range (0, 100)", p)
+		}
+	}
+	if len(cfg.Percentiles) > 0 && len(cfg.Fields) == 0 {
+		return errors.New("percentiles require fields")
+	}
+	return nil
+}
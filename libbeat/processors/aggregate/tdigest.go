@@ -0,0 +1,126 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math"
+	"sort"
+)
+
+// tdigest is a merging t-digest, a compact summary of a distribution
+// estimating its quantiles with a better accuracy at the extremes.
+// See https://arxiv.org/abs/1902.04023.
+type tdigest struct {
+	compression float64
+	centroids   []centroid // centroids are merged and sorted by mean.
+	buffer      []centroid // buffer holds values not merged yet.
+	count       float64
+	min, max    float64
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+func newTDigest(compression float64) *tdigest {
+	return &tdigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// add adds a value to the digest.
+func (d *tdigest) add(x float64) {
+	d.buffer = append(d.buffer, centroid{mean: x, weight: 1})
+	d.count++
+	d.min = math.Min(d.min, x)
+	d.max = math.Max(d.max, x)
+	if len(d.buffer) >= int(5*d.compression) {
+		d.merge()
+	}
+}
+
+// merge merges the buffered values into the centroids. Neighbouring
+// centroids are merged as long as their combined size stays within the
+// bound given by the k1 scale function.
+func (d *tdigest) merge() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	d.buffer = d.buffer[:0]
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+
+	merged := make([]centroid, 0, len(all))
+	merged = append(merged, all[0])
+	var before float64 // weight of the centroids before the last merged one.
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		q0 := before / d.count
+		q1 := (before + last.weight + c.weight) / d.count
+		if d.k(q1)-d.k(q0) <= 1 {
+			last.weight += c.weight
+			last.mean += (c.mean - last.mean) * c.weight / last.weight
+			continue
+		}
+		before += last.weight
+		merged = append(merged, c)
+	}
+	d.centroids = merged
+}
+
+// k is the k1 scale function, mapping quantiles to the index of the
+// centroid they belong to.
+func (d *tdigest) k(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*math.Min(q, 1)-1)
+}
+
+// quantile returns an estimate of the value at quantile q, in the range
+// [0, 1]. It returns NaN if the digest is empty.
+func (d *tdigest) quantile(q float64) float64 {
+	d.merge()
+	switch {
+	case len(d.centroids) == 0:
+		return math.NaN()
+	case q <= 0:
+		return d.min
+	case q >= 1:
+		return d.max
+	}
+
+	// Values are interpolated between the centers of the centroids, the
+	// minimum and maximum bound the first and last half centroids.
+	index := q * d.count
+	first := d.centroids[0]
+	if index < first.weight/2 {
+		return d.min + (first.mean-d.min)*index/(first.weight/2)
+	}
+	center := first.weight / 2
+	for i := 0; i < len(d.centroids)-1; i++ {
+		c, next := d.centroids[i], d.centroids[i+1]
+		step := (c.weight + next.weight) / 2
+		if index < center+step {
+			return c.mean + (next.mean-c.mean)*(index-center)/step
+		}
+		center += step
+	}
+	last := d.centroids[len(d.centroids)-1]
+	return last.mean + (d.max-last.mean)*(index-center)/(last.weight/2)
+}
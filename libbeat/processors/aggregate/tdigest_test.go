@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package aggregate
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTDigest(t *testing.T) {
+	d := newTDigest(100)
+	assert.True(t, math.IsNaN(d.quantile(0.5)))
+
+	d.add(42)
+	assert.Equal(t, 42.0, d.quantile(0.01))
+	assert.Equal(t, 42.0, d.quantile(0.99))
+
+	// Small digests are exact.
+	d = newTDigest(100)
+	for i := 1; i <= 100; i++ {
+		d.add(float64(i))
+	}
+	assert.Equal(t, 50.5, d.quantile(0.5))
+	assert.Equal(t, 1.0, d.quantile(0))
+	assert.Equal(t, 100.0, d.quantile(1))
+
+	const n = 100000
+	d = newTDigest(100)
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, i := range r.Perm(n) {
+		d.add(float64(i))
+	}
+	assert.Less(t, len(d.centroids), 200)
+	for _, q := range []float64{0.001, 0.01, 0.25, 0.5, 0.75, 0.99, 0.999} {
+		assert.InDelta(t, q*n, d.quantile(q), 0.005*n, "quantile %v", q)
+	}
+	// The accuracy is better at the extremes.
+	assert.InDelta(t, 0.999*n, d.quantile(0.999), 0.0005*n)
+}
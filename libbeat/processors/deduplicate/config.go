@@ -0,0 +1,103 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type config struct {
+	// Field is the field holding the key used to detect duplicates.
+	Field string `config:"field"`
+
+	// Fields is the list of fields hashed into a fingerprint used
+	// to detect duplicates. It is an alternative to Field.
+	Fields []string `config:"fields"`
+
+	// TTL is the time a key is remembered after it was first seen.
+	TTL time.Duration `config:"ttl" validate:"positive,nonzero"`
+
+	// Mode selects whether duplicates are dropped or only tagged.
+	Mode string `config:"mode"`
+
+	// Tag is the tag added to duplicates in mark mode.
+	Tag string `config:"tag"`
+
+	// IgnoreMissing passes events without a key through unchanged.
+	IgnoreMissing bool `config:"ignore_missing"`
+
+	Store storeConfig `config:"backend"`
+}
+
+const (
+	modeDrop = "drop"
+	modeMark = "mark"
+)
+
+func (cfg *config) Validate() error {
+	switch {
+	case cfg.Field != "" && len(cfg.Fields) != 0:
+		return errors.New("must specify only one of field or fields")
+	case cfg.Field == "" && len(cfg.Fields) == 0:
+		return errors.New("must specify one of field or fields")
+	}
+	switch cfg.Mode {
+	case modeDrop:
+	case modeMark:
+		if cfg.Tag == "" {
+			return errors.New("tag is required in mark mode")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q, must be one of %q or %q", cfg.Mode, modeDrop, modeMark)
+	}
+	return nil
+}
+
+func defaultConfig() config {
+	return config{
+		TTL:           10 * time.Minute,
+		Mode:          modeDrop,
+		Tag:           "duplicate",
+		IgnoreMissing: true,
+		Store: storeConfig{
+			Capacity: 100000,
+		},
+	}
+}
+
+type storeConfig struct {
+	Memory *idConfig `config:"memory"`
+	File   *idConfig `config:"file"`
+
+	// Capacity is the maximum number of keys that are remembered.
+	// The oldest keys are forgotten first when it is reached.
+	Capacity int `config:"capacity" validate:"positive,nonzero"`
+}
+
+type idConfig struct {
+	ID string `config:"id" validate:"required"`
+}
+
+func (cfg *storeConfig) Validate() error {
+	if cfg.Memory != nil && cfg.File != nil {
+		return errors.New("must specify only one of backend.memory.id or backend.file.id")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConfig(t *testing.T) {
+	cases := map[string]struct {
+		config mapstr.M
+		err    string
+	}{
+		"field": {
+			config: mapstr.M{"field": "event.id"},
+		},
+		"fields in mark mode": {
+			config: mapstr.M{"fields": []string{"message", "host.name"}, "mode": "mark"},
+		},
+		"file backend": {
+			config: mapstr.M{"field": "event.id", "backend.file.id": "dedup"},
+		},
+		"no key": {
+			config: mapstr.M{},
+			err:    "must specify one of field or fields",
+		},
+		"field and fields": {
+			config: mapstr.M{"field": "event.id", "fields": []string{"message"}},
+			err:    "must specify only one of field or fields",
+		},
+		"invalid mode": {
+			config: mapstr.M{"field": "event.id", "mode": "delete"},
+			err:    `invalid mode "delete"`,
+		},
+		"mark without tag": {
+			config: mapstr.M{"field": "event.id", "mode": "mark", "tag": ""},
+			err:    "tag is required in mark mode",
+		},
+		"zero ttl": {
+			config: mapstr.M{"field": "event.id", "ttl": "0s"},
+			err:    "zero value accessing 'ttl'",
+		},
+		"two backends": {
+			config: mapstr.M{"field": "event.id", "backend.memory.id": "a", "backend.file.id": "b"},
+			err:    "must specify only one of backend.memory.id or backend.file.id",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := defaultConfig()
+			err := conf.MustNewConfigFrom(tc.config).Unpack(&c)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	name    = "deduplicate"
+	logName = "processor." + name
+)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(name, New)
+}
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+type metrics struct {
+	Hits   *monitoring.Int
+	Misses *monitoring.Int
+}
+
+// deduplicate is a processor that drops or tags events with a key
+// that was already seen within the configured TTL.
+type deduplicate struct {
+	config config
+	fields []string
+	set    *seenSet
+	cancel context.CancelFunc
+	now    func() time.Time
+
+	log     *logp.Logger
+	metrics metrics
+}
+
+// New constructs a new deduplicate processor. The resulting processor
+// implements `Close()` to release the seen-set resources.
+func New(cfg *conf.C) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %s configuration: %w", name, err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id  = int(instanceID.Add(1))
+		log = logp.NewLogger(logName).With("instance_id", id)
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+
+	set, cancel, err := seenSets.get(config.Store, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the store for %s: %w", name, err)
+	}
+
+	p := &deduplicate{
+		config: config,
+		// The fields are sorted to compute the same fingerprint
+		// regardless of their configured order.
+		fields: common.MakeStringSet(config.Fields...).ToSlice(),
+		set:    set,
+		cancel: cancel,
+		now:    time.Now,
+		log:    log,
+		metrics: metrics{
+			Hits:   monitoring.NewInt(reg, "hits"),
+			Misses: monitoring.NewInt(reg, "misses"),
+		},
+	}
+	return p, nil
+}
+
+// Run drops or tags the event if its key was already seen.
+func (p *deduplicate) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.key(event)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, fmt.Errorf("could not get deduplication key: %w", err)
+	}
+
+	if !p.set.seen(key, p.now(), p.config.TTL) {
+		p.metrics.Misses.Inc()
+		return event, nil
+	}
+
+	p.metrics.Hits.Inc()
+	if p.config.Mode == modeMark {
+		if err := mapstr.AddTags(event.Fields, []string{p.config.Tag}); err != nil {
+			return event, fmt.Errorf("could not tag duplicate event: %w", err)
+		}
+		return event, nil
+	}
+	p.log.Debugw("dropped duplicate event", "key", key)
+	return nil, nil
+}
+
+// key returns the value of the configured field, or the hex-encoded
+// SHA-256 fingerprint of the configured fields.
+func (p *deduplicate) key(event *beat.Event) (string, error) {
+	if p.config.Field != "" {
+		v, err := event.GetValue(p.config.Field)
+		if err != nil {
+			return "", fmt.Errorf("failed to get field %q: %w", p.config.Field, err)
+		}
+		return fmt.Sprint(v), nil
+	}
+
+	h := sha256.New()
+	for _, k := range p.fields {
+		v, err := event.GetValue(k)
+		if err != nil {
+			return "", fmt.Errorf("failed to get field %q: %w", k, err)
+		}
+		if t, ok := v.(time.Time); ok {
+			// Ensure we consistently hash times in UTC.
+			v = t.UTC()
+		}
+		fmt.Fprintf(h, "|%v|%v", k, v)
+	}
+	h.Write([]byte("|"))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Close releases the seen-set.
+func (p *deduplicate) Close() error {
+	p.cancel()
+	return nil
+}
+
+func (p *deduplicate) String() string {
+	key := "field=" + p.config.Field
+	if p.config.Field == "" {
+		key = fmt.Sprintf("fields=%v", p.fields)
+	}
+	return fmt.Sprintf("%s=[%s,ttl=%v,mode=%s]", name, key, p.config.TTL, p.config.Mode)
+}
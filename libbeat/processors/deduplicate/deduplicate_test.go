@@ -0,0 +1,143 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func newTestProcessor(t *testing.T, config mapstr.M, now *time.Time) *deduplicate {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(config))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, p.(*deduplicate).Close()) })
+	d := p.(*deduplicate)
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+func run(t *testing.T, p *deduplicate, fields mapstr.M) *beat.Event {
+	t.Helper()
+	event, err := p.Run(&beat.Event{Fields: fields})
+	require.NoError(t, err)
+	return event
+}
+
+func TestDeduplicateDrop(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newTestProcessor(t, mapstr.M{"field": "event.id", "ttl": "1m"}, &now)
+
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}}))
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "b"}}))
+	assert.Nil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}}))
+
+	// The TTL runs from the first occurrence.
+	now = now.Add(time.Minute)
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}}))
+	assert.Nil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}}))
+
+	assert.Equal(t, int64(2), p.metrics.Hits.Get())
+	assert.Equal(t, int64(3), p.metrics.Misses.Get())
+}
+
+func TestDeduplicateMark(t *testing.T) {
+	now := time.Now()
+	p := newTestProcessor(t, mapstr.M{"field": "event.id", "mode": "mark"}, &now)
+
+	event := run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}})
+	assert.Equal(t, mapstr.M{"event": mapstr.M{"id": "a"}}, event.Fields)
+
+	event = run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}, "tags": []string{"x"}})
+	assert.Equal(t, mapstr.M{"event": mapstr.M{"id": "a"}, "tags": []string{"x", "duplicate"}}, event.Fields)
+}
+
+func TestDeduplicateFingerprint(t *testing.T) {
+	now := time.Now()
+	p := newTestProcessor(t, mapstr.M{"fields": []string{"message", "host.name"}}, &now)
+
+	assert.NotNil(t, run(t, p, mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}}))
+	assert.NotNil(t, run(t, p, mapstr.M{"message": "hello", "host": mapstr.M{"name": "b"}}))
+	assert.Nil(t, run(t, p, mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}, "other": 1}))
+
+	q := newTestProcessor(t, mapstr.M{"fields": []string{"host.name", "message"}}, &now)
+	k1, err := p.key(&beat.Event{Fields: mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}}})
+	require.NoError(t, err)
+	k2, err := q.key(&beat.Event{Fields: mapstr.M{"message": "hello", "host": mapstr.M{"name": "a"}}})
+	require.NoError(t, err)
+	assert.Equal(t, k1, k2, "fingerprint should not depend on the order of fields")
+}
+
+func TestDeduplicateMissing(t *testing.T) {
+	now := time.Now()
+	p := newTestProcessor(t, mapstr.M{"field": "event.id"}, &now)
+	assert.NotNil(t, run(t, p, mapstr.M{"message": "a"}))
+	assert.NotNil(t, run(t, p, mapstr.M{"message": "a"}))
+
+	q := newTestProcessor(t, mapstr.M{"field": "event.id", "ignore_missing": false}, &now)
+	event, err := q.Run(&beat.Event{Fields: mapstr.M{"message": "a"}})
+	assert.ErrorContains(t, err, `failed to get field "event.id"`)
+	assert.NotNil(t, event)
+}
+
+func TestDeduplicateSharedMemory(t *testing.T) {
+	now := time.Now()
+	config := mapstr.M{"field": "event.id", "backend.memory.id": "shared"}
+	p := newTestProcessor(t, config, &now)
+	q := newTestProcessor(t, config, &now)
+	require.Same(t, p.set, q.set)
+
+	assert.NotNil(t, run(t, p, mapstr.M{"event": mapstr.M{"id": "a"}}))
+	assert.Nil(t, run(t, q, mapstr.M{"event": mapstr.M{"id": "a"}}))
+}
+
+func TestDeduplicateFile(t *testing.T) {
+	orig := paths.Paths
+	paths.Paths = &paths.Path{Data: t.TempDir()}
+	t.Cleanup(func() { paths.Paths = orig })
+
+	config := conf.MustNewConfigFrom(mapstr.M{"field": "event.id", "backend.file.id": "persisted"})
+	p, err := New(config)
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b", "a"} {
+		_, err := p.Run(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"id": id}}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, p.(*deduplicate).Close())
+
+	// A new processor loads the keys seen before the restart.
+	p, err = New(config)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, p.(*deduplicate).Close()) })
+	assert.Equal(t, 2, p.(*deduplicate).set.len())
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"id": "b"}}})
+	require.NoError(t, err)
+	assert.Nil(t, event)
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"id": "c"}}})
+	require.NoError(t, err)
+	assert.NotNil(t, event)
+}
@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/statestore"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+var seenSets = seenSetMap{sets: map[string]*seenSet{}}
+
+// seenSetMap is a collection of seen-sets shared by their backend ID.
+type seenSetMap struct {
+	mu   sync.Mutex
+	sets map[string]*seenSet
+}
+
+// get returns the seen-set for the backend configuration. Sets with
+// a memory or file ID are shared between processors and their reference
+// count is increased, without an ID a private in-memory set is returned.
+// The returned context.CancelFunc releases the set.
+func (m *seenSetMap) get(cfg storeConfig, log *logp.Logger) (*seenSet, context.CancelFunc, error) {
+	var key string
+	switch {
+	case cfg.Memory != nil:
+		key = "memory:" + cfg.Memory.ID
+	case cfg.File != nil:
+		key = "file:" + cfg.File.ID
+	default:
+		return newSeenSet(cfg.Capacity), noop, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set, ok := m.sets[key]
+	if !ok {
+		set = newSeenSet(cfg.Capacity)
+		if cfg.File != nil {
+			if err := set.open(cfg.File.ID, log); err != nil {
+				return nil, noop, err
+			}
+		}
+		m.sets[key] = set
+	}
+	set.refs++
+	set.capacity = max(set.capacity, cfg.Capacity)
+
+	return set, func() {
+		m.release(key, set, log)
+	}, nil
+}
+
+// release decreases the reference count of the set, and removes and
+// closes the set when it is no longer referenced.
+func (m *seenSetMap) release(key string, set *seenSet, log *logp.Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set.refs--
+	if set.refs > 0 {
+		return
+	}
+	delete(m.sets, key)
+	if err := set.close(); err != nil {
+		log.Errorw("failed to close deduplicate store", "id", key, "error", err)
+	}
+}
+
+// noop is a no-op context.CancelFunc.
+func noop() {}
+
+// seenSet is a TTL-bounded set of keys, ordered by insertion time.
+// If a statestore is attached, changes are written through to it.
+type seenSet struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // order holds *seenEntry, oldest first.
+	capacity int
+	refs     int
+
+	registry *statestore.Registry
+	store    *statestore.Store
+	log      *logp.Logger
+}
+
+type seenEntry struct {
+	key     string
+	expires time.Time
+}
+
+// seenState is the persisted state of a key.
+type seenState struct {
+	Expires int64 `struct:"expires"` // Expires is in Unix nanoseconds.
+}
+
+func newSeenSet(capacity int) *seenSet {
+	return &seenSet{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+	}
+}
+
+// open attaches a file-backed statestore to the set and loads the
+// keys that have not yet expired.
+func (s *seenSet) open(id string, log *logp.Logger) error {
+	root := paths.Resolve(paths.Data, "deduplicate_processor")
+	err := os.MkdirAll(root, 0o700)
+	if err != nil {
+		return fmt.Errorf("deduplicate processor could not create store directory: %w", err)
+	}
+	name := cleanFilename(id)
+	log.Infow("mapping file-backed deduplicate processor config to file path", "id", id, "path", filepath.Join(root, name))
+	backend, err := memlog.New(log, memlog.Settings{Root: root, FileMode: 0o600})
+	if err != nil {
+		return fmt.Errorf("deduplicate processor could not create registry: %w", err)
+	}
+	registry := statestore.NewRegistry(backend)
+	store, err := registry.Get(name)
+	if err != nil {
+		registry.Close()
+		return fmt.Errorf("deduplicate processor could not open store: %w", err)
+	}
+	s.registry = registry
+	s.store = store
+	s.log = log
+
+	now := time.Now()
+	var (
+		loaded  []*seenEntry
+		expired []string
+	)
+	err = store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
+		var st seenState
+		if err := dec.Decode(&st); err != nil {
+			return false, err
+		}
+		expires := time.Unix(0, st.Expires)
+		if !now.Before(expires) {
+			expired = append(expired, key)
+			return true, nil
+		}
+		loaded = append(loaded, &seenEntry{key: key, expires: expires})
+		return true, nil
+	})
+	if err != nil {
+		s.close()
+		return fmt.Errorf("deduplicate processor could not load store: %w", err)
+	}
+	for _, key := range expired {
+		s.remove(key)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].expires.Before(loaded[j].expires)
+	})
+	for _, e := range loaded {
+		s.entries[e.key] = s.order.PushBack(e)
+	}
+	s.evict(now)
+	return nil
+}
+
+// close closes the backing statestore if there is one.
+func (s *seenSet) close() error {
+	if s.store == nil {
+		return nil
+	}
+	err := s.store.Close()
+	s.registry.Close()
+	return err
+}
+
+// seen reports whether key is in the set and has not expired. If it is
+// not, key is added with the given TTL. The expiry of keys already in
+// the set is not extended.
+func (s *seenSet) seen(key string, now time.Time, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		if now.Before(elem.Value.(*seenEntry).expires) {
+			return true
+		}
+		s.order.Remove(elem)
+		delete(s.entries, key)
+	}
+
+	e := &seenEntry{key: key, expires: now.Add(ttl)}
+	s.entries[key] = s.order.PushBack(e)
+	if s.store != nil {
+		err := s.store.Set(key, seenState{Expires: e.expires.UnixNano()})
+		if err != nil {
+			s.log.Warnw("failed to persist deduplicate key", "error", err)
+		}
+	}
+	s.evict(now)
+	return false
+}
+
+// evict removes expired keys from the front of the set, and the oldest
+// keys while the set is larger than its capacity. Keys inserted with a
+// longer TTL by another processor sharing the set may hold back the
+// removal of expired keys behind them, these are removed on lookup.
+func (s *seenSet) evict(now time.Time) {
+	for front := s.order.Front(); front != nil; front = s.order.Front() {
+		e := front.Value.(*seenEntry)
+		if now.Before(e.expires) && s.order.Len() <= s.capacity {
+			return
+		}
+		s.order.Remove(front)
+		delete(s.entries, e.key)
+		s.remove(e.key)
+	}
+}
+
+// remove removes key from the backing statestore if there is one.
+func (s *seenSet) remove(key string) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Remove(key); err != nil {
+		s.log.Warnw("failed to remove deduplicate key from store", "error", err)
+	}
+}
+
+// len returns the number of keys in the set.
+func (s *seenSet) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// cleanFilename replaces illegal printable characters (and space or dot) in
+// filenames, with underscore.
+func cleanFilename(s string) string {
+	return pathCleaner.Replace(s)
+}
+
+var pathCleaner = strings.NewReplacer(
+	"/", "_",
+	"<", "_",
+	">", "_",
+	":", "_",
+	`"`, "_",
+	`\`, "_",
+	"|", "_",
+	"?", "_",
+	"*", "_",
+	".", "_",
+	" ", "_",
+)
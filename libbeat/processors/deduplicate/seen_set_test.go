@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeenSetCapacity(t *testing.T) {
+	now := time.Now()
+	s := newSeenSet(3)
+	for i := range 5 {
+		assert.False(t, s.seen(strconv.Itoa(i), now, time.Minute))
+	}
+	assert.Equal(t, 3, s.len())
+
+	// The oldest keys were forgotten.
+	assert.False(t, s.seen("0", now, time.Minute))
+	assert.True(t, s.seen("4", now, time.Minute))
+}
+
+func TestSeenSetExpiry(t *testing.T) {
+	now := time.Now()
+	s := newSeenSet(10)
+	assert.False(t, s.seen("a", now, time.Minute))
+	assert.False(t, s.seen("b", now.Add(30*time.Second), time.Minute))
+
+	now = now.Add(time.Minute)
+	assert.False(t, s.seen("c", now, time.Minute))
+	assert.Equal(t, 2, s.len(), "expired key should be evicted")
+	assert.True(t, s.seen("b", now, time.Minute))
+
+	// An expired key behind a longer-lived key is still not reported.
+	s = newSeenSet(10)
+	assert.False(t, s.seen("long", now, time.Hour))
+	assert.False(t, s.seen("short", now, time.Second))
+	assert.False(t, s.seen("short", now.Add(time.Second), time.Second))
+}
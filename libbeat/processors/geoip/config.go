@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// config defines the configuration options for the geoip processor.
+type config struct {
+	Databases      []string      `config:"databases" validate:"required"` // Paths of the MaxMind DB files.
+	Fields         mapstr.M      `config:"fields"`                        // Mapping of source IP fields to target fields.
+	TagOnFailure   []string      `config:"tag_on_failure"`                // Tags to append when a failure occurs.
+	ReloadInterval time.Duration `config:"reload_interval"`               // How often to check the databases for changes, 0 disables reloading.
+	Cache          cacheConfig   `config:"cache"`
+	reverseFlat    map[string]string
+}
+
+type cacheConfig struct {
+	// Size is the maximum number of lookup results kept. When it is
+	// reached, the least recently used result is evicted.
+	Size int `config:"size" validate:"min=1"`
+}
+
+func defaultConfig() config {
+	return config{
+		ReloadInterval: time.Minute,
+		Cache: cacheConfig{
+			Size: 10000,
+		},
+	}
+}
+
+// defaultFields is the mapping used when no fields are configured.
+var defaultFields = map[string]string{
+	"source.ip":      "source",
+	"destination.ip": "destination",
+}
+
+// Validate validates the data contained in the config.
+func (c *config) Validate() error {
+	if c.ReloadInterval < 0 {
+		return fmt.Errorf("reload_interval must be >= 0")
+	}
+
+	// Flatten the mapping of source fields to target fields.
+	c.reverseFlat = map[string]string{}
+	for k, v := range c.Fields.Flatten() {
+		target, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("target field for geoip lookup of %v "+
+				"must be a string but got %T", k, v)
+		}
+		c.reverseFlat[k] = target
+	}
+	if len(c.reverseFlat) == 0 {
+		for k, v := range defaultFields {
+			c.reverseFlat[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const logName = "processor.geoip"
+
+// instanceID is used to assign each instance a unique logger.
+var instanceID atomic.Uint32
+
+func init() {
+	// We cannot use this as a JS plugin as it includes a Close method.
+	processors.RegisterPlugin("geoip", New)
+}
+
+type processor struct {
+	config
+	sources []string // sources are the source fields in a stable order.
+	log     *logp.Logger
+
+	// mu protects the databases and the consistency of the cache with them.
+	mu    sync.RWMutex
+	files []*databaseFile
+	cache *lru.Cache[string, result]
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// databaseFile is a database and the file state it was loaded from.
+type databaseFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	db      *database
+}
+
+// result is the enrichment of an IP address.
+type result struct {
+	geo mapstr.M
+	as  mapstr.M
+}
+
+// New constructs a new geoip processor. The resulting processor implements
+// `Close()` to stop reloading the databases.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the geoip configuration: %w", err)
+	}
+
+	cache, err := lru.New[string, result](c.Cache.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create geoip cache: %w", err)
+	}
+	p := &processor{
+		config: c,
+		log:    logp.NewLogger(logName).With("instance_id", instanceID.Add(1)),
+		cache:  cache,
+		done:   make(chan struct{}),
+	}
+	for source := range c.reverseFlat {
+		p.sources = append(p.sources, source)
+	}
+	sort.Strings(p.sources)
+
+	for _, path := range c.Databases {
+		f, err := loadDatabaseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p.log.Infow("loaded geoip database", "path", path, "database_type", f.db.metadata.databaseType)
+		p.files = append(p.files, f)
+	}
+
+	if c.ReloadInterval > 0 {
+		p.wg.Add(1)
+		go p.watch(c.ReloadInterval)
+	}
+	return p, nil
+}
+
+func loadDatabaseFile(path string) (*databaseFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat geoip database: %w", err)
+	}
+	db, err := openDatabase(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load geoip database %s: %w", path, err)
+	}
+	return &databaseFile{path: path, modTime: info.ModTime(), size: info.Size(), db: db}, nil
+}
+
+// watch reloads the databases that changed on disk every interval.
+func (p *processor) watch(interval time.Duration) {
+	defer p.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			p.reload()
+		}
+	}
+}
+
+// reload replaces the databases whose file modification time or size
+// changed, and clears the cache if any was replaced. A database that
+// fails to load is kept until the next attempt.
+func (p *processor) reload() {
+	// Only the watch goroutine replaces elements of p.files, so
+	// they can be read without holding the lock here.
+	for i, f := range p.files {
+		info, err := os.Stat(f.path)
+		if err != nil {
+			p.log.Warnw("failed to stat geoip database", "path", f.path, "error", err)
+			continue
+		}
+		if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+			continue
+		}
+		nf, err := loadDatabaseFile(f.path)
+		if err != nil {
+			p.log.Warnw("failed to reload geoip database", "path", f.path, "error", err)
+			continue
+		}
+		p.mu.Lock()
+		p.files[i] = nf
+		p.cache.Purge()
+		p.mu.Unlock()
+		p.log.Infow("reloaded geoip database", "path", f.path, "database_type", nf.db.metadata.databaseType)
+	}
+}
+
+// Run enriches the event with the geo and ASN data of the source fields.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	var tagOnce sync.Once
+	for _, source := range p.sources {
+		if err := p.processField(source, p.reverseFlat[source], event); err != nil {
+			p.log.Debugf("geoip processor failed: %v", err)
+			tagOnce.Do(func() { _ = mapstr.AddTags(event.Fields, p.TagOnFailure) })
+		}
+	}
+	return event, nil
+}
+
+func (p *processor) processField(source, target string, event *beat.Event) error {
+	v, err := event.GetValue(source)
+	if err != nil {
+		//nolint:nilerr // an empty source field isn't considered an error for this processor
+		return nil
+	}
+
+	strVal, ok := v.(string)
+	if !ok {
+		return nil
+	}
+
+	r, err := p.lookup(strVal)
+	if err != nil {
+		return fmt.Errorf("geoip lookup of %s value '%s' failed: %w", source, strVal, err)
+	}
+	if len(r.geo) != 0 {
+		if _, err := event.PutValue(target+".geo", r.geo.Clone()); err != nil {
+			return err
+		}
+	}
+	if len(r.as) != 0 {
+		if _, err := event.PutValue(target+".as", r.as.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup returns the enrichment of ip from the cache or the databases.
+func (p *processor) lookup(ip string) (result, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if r, ok := p.cache.Get(ip); ok {
+		return r, nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return result{}, err
+	}
+	var r result
+	for _, f := range p.files {
+		v, err := f.db.lookup(addr)
+		if err != nil {
+			return result{}, fmt.Errorf("database %s: %w", f.path, err)
+		}
+		rec, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		r.geo = merge(r.geo, geoFields(rec))
+		r.as = merge(r.as, asFields(rec))
+	}
+	p.cache.Add(ip, r)
+	return r, nil
+}
+
+// merge adds the fields of src missing from dst.
+func merge(dst, src mapstr.M) mapstr.M {
+	if dst == nil {
+		return src
+	}
+	for k, v := range src {
+		if _, ok := dst[k]; !ok {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
+// geoFields maps a City or Country database record to ECS geo fields.
+func geoFields(rec map[string]interface{}) mapstr.M {
+	geo := mapstr.M{}
+	if continent, ok := rec["continent"].(map[string]interface{}); ok {
+		putString(geo, "continent_code", continent["code"])
+		putString(geo, "continent_name", englishName(continent))
+	}
+	country, _ := rec["country"].(map[string]interface{})
+	if country != nil {
+		putString(geo, "country_iso_code", country["iso_code"])
+		putString(geo, "country_name", englishName(country))
+	}
+	if subdivisions, ok := rec["subdivisions"].([]interface{}); ok && len(subdivisions) != 0 {
+		if region, ok := subdivisions[0].(map[string]interface{}); ok {
+			putString(geo, "region_name", englishName(region))
+			countryCode, _ := country["iso_code"].(string)
+			regionCode, _ := region["iso_code"].(string)
+			if countryCode != "" && regionCode != "" {
+				geo["region_iso_code"] = countryCode + "-" + regionCode
+			}
+		}
+	}
+	if city, ok := rec["city"].(map[string]interface{}); ok {
+		putString(geo, "city_name", englishName(city))
+	}
+	if postal, ok := rec["postal"].(map[string]interface{}); ok {
+		putString(geo, "postal_code", postal["code"])
+	}
+	if location, ok := rec["location"].(map[string]interface{}); ok {
+		lat, latOK := location["latitude"].(float64)
+		lon, lonOK := location["longitude"].(float64)
+		if latOK && lonOK {
+			geo["location"] = mapstr.M{"lat": lat, "lon": lon}
+		}
+		putString(geo, "timezone", location["time_zone"])
+	}
+	return geo
+}
+
+// asFields maps an ASN database record to ECS as fields.
+func asFields(rec map[string]interface{}) mapstr.M {
+	as := mapstr.M{}
+	if n, ok := rec["autonomous_system_number"].(uint64); ok {
+		as["number"] = int64(n)
+	}
+	if org, ok := rec["autonomous_system_organization"].(string); ok && org != "" {
+		as["organization"] = mapstr.M{"name": org}
+	}
+	return as
+}
+
+func englishName(m map[string]interface{}) interface{} {
+	names, _ := m["names"].(map[string]interface{})
+	return names["en"]
+}
+
+func putString(m mapstr.M, key string, v interface{}) {
+	if s, ok := v.(string); ok && s != "" {
+		m[key] = s
+	}
+}
+
+// Close stops reloading the databases.
+func (p *processor) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	p.wg.Wait()
+	return nil
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("geoip=[databases=[%s], fields=%v, tag_on_failure=%v]",
+		strings.Join(p.Databases, ", "), p.reverseFlat, p.TagOnFailure)
+}
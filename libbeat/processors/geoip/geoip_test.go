@@ -0,0 +1,190 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func cityRecord(city string) map[string]interface{} {
+	return map[string]interface{}{
+		"continent": map[string]interface{}{
+			"code":  "EU",
+			"names": map[string]interface{}{"en": "Europe", "de": "Europa"},
+		},
+		"country": map[string]interface{}{
+			"iso_code": "GB",
+			"names":    map[string]interface{}{"en": "United Kingdom"},
+		},
+		"subdivisions": []interface{}{
+			map[string]interface{}{
+				"iso_code": "ENG",
+				"names":    map[string]interface{}{"en": "England"},
+			},
+		},
+		"city":   map[string]interface{}{"names": map[string]interface{}{"en": city}},
+		"postal": map[string]interface{}{"code": "OX1"},
+		"location": map[string]interface{}{
+			"latitude":  51.75,
+			"longitude": -1.25,
+			"time_zone": "Europe/London",
+		},
+	}
+}
+
+func writeDatabase(t *testing.T, path string, w *testDatabase) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, w.bytes(), 0o600))
+}
+
+func TestProcessor(t *testing.T) {
+	dir := t.TempDir()
+	city := newTestDatabase(6, 28, "GeoIP2-City")
+	city.insert("81.2.69.0/24", cityRecord("Oxford"))
+	writeDatabase(t, filepath.Join(dir, "city.mmdb"), city)
+	asn := newTestDatabase(6, 24, "GeoLite2-ASN")
+	asn.insert("81.2.69.0/24", map[string]interface{}{
+		"autonomous_system_number":       uint32(20712),
+		"autonomous_system_organization": "Andrews & Arnold Ltd",
+	})
+	asn.insert("2001:db8::/32", map[string]interface{}{
+		"autonomous_system_number": uint32(64496),
+	})
+	writeDatabase(t, filepath.Join(dir, "asn.mmdb"), asn)
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"databases":      []string{filepath.Join(dir, "city.mmdb"), filepath.Join(dir, "asn.mmdb")},
+		"tag_on_failure": []string{"_geoip_lookup_failure"},
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, p.(*processor).Close()) })
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"source":      mapstr.M{"ip": "81.2.69.142"},
+		"destination": mapstr.M{"ip": "2001:db8::1"},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"source": mapstr.M{
+			"ip": "81.2.69.142",
+			"geo": mapstr.M{
+				"continent_code":   "EU",
+				"continent_name":   "Europe",
+				"country_iso_code": "GB",
+				"country_name":     "United Kingdom",
+				"region_iso_code":  "GB-ENG",
+				"region_name":      "England",
+				"city_name":        "Oxford",
+				"postal_code":      "OX1",
+				"location":         mapstr.M{"lat": 51.75, "lon": -1.25},
+				"timezone":         "Europe/London",
+			},
+			"as": mapstr.M{
+				"number":       int64(20712),
+				"organization": mapstr.M{"name": "Andrews & Arnold Ltd"},
+			},
+		},
+		"destination": mapstr.M{
+			"ip": "2001:db8::1",
+			"as": mapstr.M{"number": int64(64496)},
+		},
+	}, event.Fields)
+	assert.Equal(t, 2, p.(*processor).cache.Len())
+
+	// Cached results are not shared between events.
+	event.Fields.Put("source.geo.city_name", "changed")
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}}})
+	require.NoError(t, err)
+	name, _ := event.GetValue("source.geo.city_name")
+	assert.Equal(t, "Oxford", name)
+
+	// Unknown addresses and missing fields are ignored, invalid addresses are tagged.
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "10.0.0.1"}}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"source": mapstr.M{"ip": "10.0.0.1"}}, event.Fields)
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"destination": mapstr.M{"ip": "not-an-ip"}}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{
+		"destination": mapstr.M{"ip": "not-an-ip"},
+		"tags":        []string{"_geoip_lookup_failure"},
+	}, event.Fields)
+}
+
+func TestProcessorReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	db := newTestDatabase(4, 32, "GeoIP2-City")
+	db.insert("81.2.69.0/24", cityRecord("Oxford"))
+	writeDatabase(t, path, db)
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"databases":       []string{path},
+		"fields":          mapstr.M{"client.ip": "client"},
+		"reload_interval": 0,
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, p.(*processor).Close()) })
+	gp := p.(*processor)
+
+	lookupCity := func() interface{} {
+		t.Helper()
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"client": mapstr.M{"ip": "81.2.69.1"}}})
+		require.NoError(t, err)
+		v, _ := event.GetValue("client.geo.city_name")
+		return v
+	}
+	assert.Equal(t, "Oxford", lookupCity())
+
+	// An invalid file keeps the loaded database.
+	require.NoError(t, os.WriteFile(path, []byte("partial"), 0o600))
+	gp.reload()
+	assert.Equal(t, "Oxford", lookupCity())
+
+	db = newTestDatabase(4, 32, "GeoIP2-City")
+	db.insert("81.2.69.0/24", cityRecord("London"))
+	writeDatabase(t, path, db)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	gp.reload()
+	assert.Equal(t, "London", lookupCity())
+}
+
+func TestConfig(t *testing.T) {
+	_, err := New(conf.MustNewConfigFrom(mapstr.M{}))
+	assert.ErrorContains(t, err, "missing required field accessing 'databases'")
+
+	_, err = New(conf.MustNewConfigFrom(mapstr.M{"databases": []string{"/does/not/exist.mmdb"}}))
+	assert.ErrorContains(t, err, "failed to stat geoip database")
+
+	c := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(mapstr.M{"databases": []string{"x"}}).Unpack(&c))
+	assert.Equal(t, defaultFields, c.reverseFlat)
+
+	c = defaultConfig()
+	err = conf.MustNewConfigFrom(mapstr.M{"databases": []string{"x"}, "fields": mapstr.M{"a": 1}}).Unpack(&c)
+	assert.ErrorContains(t, err, "must be a string")
+}
@@ -0,0 +1,370 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// This file implements a reader for the MaxMind DB file format described
+// at https://maxmind.github.io/MaxMind-DB/.
+
+var (
+	metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+	errInvalidDatabase = errors.New("invalid MaxMind database")
+)
+
+const dataSectionSeparator = 16
+
+// database is a MaxMind DB file loaded in memory.
+type database struct {
+	buf       []byte
+	tree      []byte // tree is the binary search tree section.
+	data      []byte // data is the data section.
+	metadata  metadata
+	ipv4Start uint // ipv4Start is the node of the ::/96 subtree.
+}
+
+type metadata struct {
+	nodeCount    uint
+	recordSize   uint
+	ipVersion    uint
+	databaseType string
+}
+
+// openDatabase reads and validates the database at path.
+func openDatabase(path string) (*database, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newDatabase(buf)
+}
+
+func newDatabase(buf []byte) (*database, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: metadata not found", errInvalidDatabase)
+	}
+	meta := buf[i+len(metadataMarker):]
+	v, _, err := decoder{buf: meta}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode metadata: %w", errInvalidDatabase, err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", errInvalidDatabase)
+	}
+	md := metadata{
+		nodeCount:  toUint(m["node_count"]),
+		recordSize: toUint(m["record_size"]),
+		ipVersion:  toUint(m["ip_version"]),
+	}
+	md.databaseType, _ = m["database_type"].(string)
+	switch md.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", errInvalidDatabase, md.recordSize)
+	}
+	if md.ipVersion != 4 && md.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", errInvalidDatabase, md.ipVersion)
+	}
+
+	treeSize := md.nodeCount * md.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, fmt.Errorf("%w: search tree exceeds file size", errInvalidDatabase)
+	}
+	db := &database{
+		buf:      buf,
+		tree:     buf[:treeSize],
+		data:     buf[treeSize+dataSectionSeparator : i],
+		metadata: md,
+	}
+	if md.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < md.nodeCount; j++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func toUint(v interface{}) uint {
+	switch v := v.(type) {
+	case uint64:
+		return uint(v)
+	case uint32:
+		return uint(v)
+	case uint16:
+		return uint(v)
+	}
+	return 0
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *database) record(node uint, bit byte) uint {
+	switch db.metadata.recordSize {
+	case 24:
+		b := db.tree[node*6+uint(bit)*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+uint(bit)*4:]))
+	}
+}
+
+// lookup returns the record for ip, or nil if ip is not in the database.
+func (db *database) lookup(ip netip.Addr) (interface{}, error) {
+	ip = ip.Unmap()
+	var (
+		addr []byte
+		node uint
+	)
+	switch {
+	case ip.Is4():
+		a := ip.As4()
+		addr = a[:]
+		node = db.ipv4Start
+	case db.metadata.ipVersion == 4:
+		// IPv6 addresses are not in IPv4 databases.
+		return nil, nil
+	default:
+		a := ip.As16()
+		addr = a[:]
+	}
+
+	nodeCount := db.metadata.nodeCount
+	for i := 0; i < len(addr)*8 && node < nodeCount; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		node = db.record(node, bit)
+	}
+	switch {
+	case node == nodeCount:
+		return nil, nil
+	case node < nodeCount:
+		return nil, fmt.Errorf("%w: search tree is deeper than the address", errInvalidDatabase)
+	}
+	offset := node - nodeCount - dataSectionSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, fmt.Errorf("%w: data pointer out of range", errInvalidDatabase)
+	}
+	v, _, err := decoder{buf: db.data}.decode(offset, 0)
+	return v, err
+}
+
+// decoder decodes values of the data section format.
+type decoder struct {
+	buf []byte
+}
+
+// Data section types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth limits the nesting of decoded values.
+const maxDepth = 64
+
+// decode decodes the value at offset and returns it with the offset
+// following it.
+func (d decoder) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: data nesting too deep", errInvalidDatabase)
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		ptr, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr, depth+1)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			var k, v interface{}
+			k, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", errInvalidDatabase)
+			}
+			v, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			var v interface{}
+			v, offset, err = d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buf)) {
+		return nil, 0, fmt.Errorf("%w: value exceeds data section", errInvalidDatabase)
+	}
+	b := d.buf[offset:end]
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return append([]byte(nil), b...), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: invalid double size %d", errInvalidDatabase, size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: invalid float size %d", errInvalidDatabase, size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", errInvalidDatabase, size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: invalid integer size %d", errInvalidDatabase, size)
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), end, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), end, nil
+	default:
+		return nil, 0, fmt.Errorf("%w: unsupported data type %d", errInvalidDatabase, typ)
+	}
+}
+
+// control decodes the control byte at offset, and returns the type and
+// size of the value and the offset of its payload.
+func (d decoder) control(offset uint) (typ, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("%w: offset out of range", errInvalidDatabase)
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = uint(ctrl >> 5)
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, fmt.Errorf("%w: offset out of range", errInvalidDatabase)
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size = uint(ctrl & 0x1f)
+	if typ == typePointer || size < 29 {
+		return typ, size, offset, nil
+	}
+	n := size - 28
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, 0, fmt.Errorf("%w: offset out of range", errInvalidDatabase)
+	}
+	var ext uint
+	for _, c := range d.buf[offset : offset+n] {
+		ext = ext<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + ext
+	case 30:
+		size = 285 + ext
+	default:
+		size = 65821 + ext
+	}
+	return typ, size, offset + n, nil
+}
+
+// pointer decodes a pointer with the size bits of its control byte.
+func (d decoder) pointer(size, offset uint) (ptr, next uint, err error) {
+	n := (size>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, fmt.Errorf("%w: offset out of range", errInvalidDatabase)
+	}
+	b := d.buf[offset : offset+n]
+	for _, c := range b {
+		ptr = ptr<<8 | uint(c)
+	}
+	switch n {
+	case 1:
+		ptr |= (size & 0x7) << 8
+	case 2:
+		ptr = (ptr | (size&0x7)<<16) + 2048
+	case 3:
+		ptr = (ptr | (size&0x7)<<24) + 526336
+	}
+	return ptr, offset + n, nil
+}
@@ -0,0 +1,293 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package geoip
+
+import (
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabase builds MaxMind DB files for tests.
+type testDatabase struct {
+	ipVersion  int
+	recordSize int
+	dbType     string
+	root       *testNode
+	data       []byte
+}
+
+type testNode struct {
+	children [2]interface{} // *testNode, dataRef or nil
+}
+
+type dataRef int
+
+func newTestDatabase(ipVersion, recordSize int, dbType string) *testDatabase {
+	return &testDatabase{ipVersion: ipVersion, recordSize: recordSize, dbType: dbType, root: &testNode{}}
+}
+
+// insert adds the record v for the network prefix.
+func (w *testDatabase) insert(prefix string, v interface{}) {
+	p := netip.MustParsePrefix(prefix)
+	var addr []byte
+	bits := p.Bits()
+	if p.Addr().Is4() && w.ipVersion == 6 {
+		// IPv4 networks are stored in the ::/96 subtree.
+		a := p.Addr().As4()
+		addr = append(make([]byte, 12), a[:]...)
+		bits += 96
+	} else {
+		addr = p.Addr().AsSlice()
+	}
+	ref := dataRef(len(w.data))
+	w.data = encodeTestValue(w.data, v)
+
+	n := w.root
+	for i := 0; i < bits; i++ {
+		bit := (addr[i/8] >> (7 - uint(i%8))) & 1
+		if i == bits-1 {
+			n.children[bit] = ref
+			return
+		}
+		next, ok := n.children[bit].(*testNode)
+		if !ok {
+			next = &testNode{}
+			n.children[bit] = next
+		}
+		n = next
+	}
+}
+
+// bytes serializes the database.
+func (w *testDatabase) bytes() []byte {
+	var nodes []*testNode
+	index := map[*testNode]int{}
+	queue := []*testNode{w.root}
+	for len(queue) != 0 {
+		n := queue[0]
+		queue = queue[1:]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c, ok := c.(*testNode); ok {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	nodeCount := len(nodes)
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint32
+		for i, c := range n.children {
+			switch c := c.(type) {
+			case *testNode:
+				records[i] = uint32(index[c])
+			case dataRef:
+				records[i] = uint32(nodeCount + dataSectionSeparator + int(c))
+			default:
+				records[i] = uint32(nodeCount)
+			}
+		}
+		l, r := records[0], records[1]
+		switch w.recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>20&0xf0|r>>24&0x0f), byte(r>>16), byte(r>>8), byte(r))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, l)
+			tree = binary.BigEndian.AppendUint32(tree, r)
+		}
+	}
+
+	buf := append(tree, make([]byte, dataSectionSeparator)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, metadataMarker...)
+	return encodeTestValue(buf, map[string]interface{}{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(w.recordSize),
+		"ip_version":                  uint16(w.ipVersion),
+		"database_type":               w.dbType,
+	})
+}
+
+func encodeTestValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		b = appendControl(b, typeString, len(v))
+		return append(b, v...)
+	case float64:
+		b = appendControl(b, typeDouble, 8)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v))
+	case uint16:
+		return appendUint(b, typeUint16, uint64(v))
+	case uint32:
+		return appendUint(b, typeUint32, uint64(v))
+	case uint64:
+		return appendUint(b, typeUint64, v)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		return appendControl(b, typeBool, n)
+	case []interface{}:
+		b = appendControl(b, typeArray, len(v))
+		for _, e := range v {
+			b = encodeTestValue(b, e)
+		}
+		return b
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendControl(b, typeMap, len(v))
+		for _, k := range keys {
+			b = encodeTestValue(b, k)
+			b = encodeTestValue(b, v[k])
+		}
+		return b
+	default:
+		panic("unsupported type")
+	}
+}
+
+func appendUint(b []byte, typ int, v uint64) []byte {
+	var payload []byte
+	for ; v != 0; v >>= 8 {
+		payload = append([]byte{byte(v)}, payload...)
+	}
+	b = appendControl(b, typ, len(payload))
+	return append(b, payload...)
+}
+
+func appendControl(b []byte, typ, size int) []byte {
+	ctrl := byte(typ << 5)
+	var ext []byte
+	if typ > 7 {
+		ctrl = 0
+		ext = []byte{byte(typ - 7)}
+	}
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		ext = append(ext, byte(size-29))
+	case size < 65821:
+		ctrl |= 30
+		ext = binary.BigEndian.AppendUint16(ext, uint16(size-285))
+	default:
+		ctrl |= 31
+		n := size - 65821
+		ext = append(ext, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(append(b, ctrl), ext...)
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			w := newTestDatabase(ipVersion, recordSize, "Test")
+			w.insert("81.2.69.0/24", map[string]interface{}{"name": "a"})
+			w.insert("81.2.70.0/23", map[string]interface{}{"name": "b", "n": uint32(70000)})
+			if ipVersion == 6 {
+				w.insert("2a02:cf40::/29", map[string]interface{}{"name": "c", "ok": true})
+			}
+			db, err := newDatabase(w.bytes())
+			require.NoError(t, err)
+			assert.Equal(t, "Test", db.metadata.databaseType)
+
+			lookup := func(ip string) interface{} {
+				t.Helper()
+				v, err := db.lookup(netip.MustParseAddr(ip))
+				require.NoError(t, err)
+				return v
+			}
+			assert.Equal(t, map[string]interface{}{"name": "a"}, lookup("81.2.69.160"))
+			assert.Equal(t, map[string]interface{}{"name": "b", "n": uint64(70000)}, lookup("81.2.71.1"))
+			assert.Equal(t, map[string]interface{}{"name": "b", "n": uint64(70000)}, lookup("::ffff:81.2.70.1"))
+			assert.Nil(t, lookup("81.2.72.1"))
+			assert.Nil(t, lookup("10.0.0.1"))
+			if ipVersion == 6 {
+				assert.Equal(t, map[string]interface{}{"name": "c", "ok": true}, lookup("2a02:cf40:1::1"))
+				assert.Nil(t, lookup("2a03::1"))
+			} else {
+				assert.Nil(t, lookup("2a02:cf40:1::1"))
+			}
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	long := make([]byte, 300)
+	for i := range long {
+		long[i] = 'x'
+	}
+	buf := encodeTestValue(nil, "shared")
+	arrayOffset := len(buf)
+	buf = encodeTestValue(buf, []interface{}{string(long), float64(1.5), uint64(math.MaxUint64)})
+	pointerOffset := len(buf)
+	// A pointer with a 1 byte payload to offset 0.
+	buf = append(buf, typePointer<<5, 0)
+	// A negative int32.
+	int32Offset := len(buf)
+	buf = append(buf, 0x04, typeInt32-7, 0xff, 0xff, 0xff, 0xfe)
+
+	d := decoder{buf: buf}
+	v, next, err := d.decode(uint(arrayOffset), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{string(long), 1.5, uint64(math.MaxUint64)}, v)
+	assert.Equal(t, uint(pointerOffset), next)
+
+	v, next, err = d.decode(uint(pointerOffset), 0)
+	require.NoError(t, err)
+	assert.Equal(t, "shared", v)
+	assert.Equal(t, uint(int32Offset), next)
+
+	v, _, err = d.decode(uint(int32Offset), 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), v)
+
+	// A pointer to itself.
+	_, _, err = decoder{buf: []byte{typePointer << 5, 0}}.decode(0, 0)
+	assert.ErrorIs(t, err, errInvalidDatabase)
+
+	_, _, err = decoder{buf: []byte{typeString<<5 | 10, 'a'}}.decode(0, 0)
+	assert.ErrorIs(t, err, errInvalidDatabase)
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	_, err := newDatabase([]byte("not a database"))
+	assert.ErrorContains(t, err, "metadata not found")
+
+	w := newTestDatabase(6, 20, "Test")
+	_, err = newDatabase(w.bytes())
+	assert.ErrorContains(t, err, "unsupported record size 20")
+}
@@ -0,0 +1,287 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//go:embed patterns
+var bundled embed.FS
+
+var (
+	// referenceRE matches %{SYNTAX}, %{SYNTAX:SEMANTIC} and
+	// %{SYNTAX:SEMANTIC:TYPE} references to named patterns.
+	referenceRE = regexp.MustCompile(`%\{(\w+)(?::([^:{}]+))?(?::(\w+))?\}`)
+
+	// namedGroupRE matches the opening of named capture groups
+	// written directly in a pattern.
+	namedGroupRE = regexp.MustCompile(`\(\?P?<([^>!=]+)>`)
+
+	// definitionRE matches a "NAME pattern" line of a pattern file.
+	definitionRE = regexp.MustCompile(`^(\w+)\s+(.*)$`)
+
+	errNoMatch = errors.New("provided grok patterns do not match the field value")
+)
+
+// library is a set of named patterns.
+type library map[string]string
+
+// loadBundled returns the library of patterns bundled with the processor.
+func loadBundled() (library, error) {
+	lib := library{}
+	err := fs.WalkDir(bundled, "patterns", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := bundled.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return lib.read(f, path)
+	})
+	return lib, err
+}
+
+// loadDir adds the patterns defined in the files of dir to the library.
+func (lib library) loadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read patterns directory: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open patterns file: %w", err)
+		}
+		err = lib.read(f, path)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read adds the patterns of a Logstash-style patterns file to the library.
+// Each line holds a pattern name followed by whitespace and the pattern.
+// Blank lines and lines starting with # are ignored.
+func (lib library) read(r io.Reader, path string) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		m := definitionRE.FindStringSubmatch(line)
+		if m == nil {
+			return fmt.Errorf("invalid pattern definition at %s:%d", path, n)
+		}
+		lib[m[1]] = m[2]
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read patterns file %s: %w", path, err)
+	}
+	return nil
+}
+
+// matcher matches strings against a list of grok patterns.
+type matcher struct {
+	patterns []*compiled
+}
+
+// compiled is a grok pattern compiled to a regular expression.
+type compiled struct {
+	raw      string
+	re       *regexp.Regexp
+	captures []capture // captures is indexed by regexp submatch index.
+}
+
+// capture describes the field a submatch is written to.
+type capture struct {
+	field string
+	typ   string
+}
+
+// compile compiles the patterns using the named patterns of lib.
+func (lib library) compile(patterns []string) (*matcher, error) {
+	g := &matcher{}
+	for _, p := range patterns {
+		c, err := lib.compileOne(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile grok pattern %q: %w", p, err)
+		}
+		g.patterns = append(g.patterns, c)
+	}
+	return g, nil
+}
+
+func (lib library) compileOne(pattern string) (*compiled, error) {
+	e := expander{lib: lib, stack: map[string]bool{}}
+	expr, err := e.expand(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	captures := make([]capture, re.NumSubexp()+1)
+	for i, name := range re.SubexpNames() {
+		if c, ok := e.captures[name]; ok {
+			captures[i] = c
+		}
+	}
+	return &compiled{raw: pattern, re: re, captures: captures}, nil
+}
+
+// expander expands the pattern references of a grok pattern into
+// a regular expression.
+type expander struct {
+	lib      library
+	stack    map[string]bool // stack holds the names being expanded.
+	captures map[string]capture
+	err      error
+}
+
+func (e *expander) expand(pattern string) (string, error) {
+	pattern = namedGroupRE.ReplaceAllStringFunc(pattern, func(s string) string {
+		field := namedGroupRE.FindStringSubmatch(s)[1]
+		return "(?P<" + e.addCapture(field, "") + ">"
+	})
+	expr := referenceRE.ReplaceAllStringFunc(pattern, func(s string) string {
+		if e.err != nil {
+			return ""
+		}
+		m := referenceRE.FindStringSubmatch(s)
+		name, field, typ := m[1], m[2], m[3]
+		def, ok := e.lib[name]
+		if !ok {
+			e.err = fmt.Errorf("pattern %s not defined", name)
+			return ""
+		}
+		if e.stack[name] {
+			e.err = fmt.Errorf("pattern %s is recursive", name)
+			return ""
+		}
+		if typ != "" {
+			if _, ok := converters[typ]; !ok {
+				e.err = fmt.Errorf("unsupported type %s for field %s", typ, field)
+				return ""
+			}
+		}
+
+		e.stack[name] = true
+		sub, err := e.expand(def)
+		delete(e.stack, name)
+		if err != nil {
+			e.err = err
+			return ""
+		}
+		if field == "" {
+			return "(?:" + sub + ")"
+		}
+		return "(?P<" + e.addCapture(field, typ) + ">" + sub + ")"
+	})
+	return expr, e.err
+}
+
+// addCapture registers a capture for field and returns its group name.
+// Group names are generated since field names may contain characters
+// that are invalid in regexp group names.
+func (e *expander) addCapture(field, typ string) string {
+	if e.captures == nil {
+		e.captures = map[string]capture{}
+	}
+	name := "_" + strconv.Itoa(len(e.captures))
+	e.captures[name] = capture{field: fieldName(field), typ: typ}
+	return name
+}
+
+// fieldName converts Logstash [a][b] field references to a.b.
+func fieldName(field string) string {
+	if !strings.HasPrefix(field, "[") || !strings.HasSuffix(field, "]") {
+		return field
+	}
+	return strings.Join(strings.Split(field[1:len(field)-1], "]["), ".")
+}
+
+// match returns the fields captured by the first pattern matching s,
+// and the index of that pattern. Unmatched captures are omitted.
+func (g *matcher) match(s string) (map[string]interface{}, int, error) {
+	for i, p := range g.patterns {
+		loc := p.re.FindStringSubmatchIndex(s)
+		if loc == nil {
+			continue
+		}
+		fields := map[string]interface{}{}
+		for j, c := range p.captures {
+			if c.field == "" || loc[2*j] < 0 {
+				continue
+			}
+			v, err := convert(c.typ, s[loc[2*j]:loc[2*j+1]])
+			if err != nil {
+				return nil, i, fmt.Errorf("failed to convert field %s to %s: %w", c.field, c.typ, err)
+			}
+			fields[c.field] = v
+		}
+		return fields, i, nil
+	}
+	return nil, -1, errNoMatch
+}
+
+// converters are the type conversions supported in %{SYNTAX:SEMANTIC:TYPE}.
+// Like in Logstash, int is a 64-bit integer and float a 64-bit float.
+var converters = map[string]func(string) (interface{}, error){
+	"int":     parseInt,
+	"long":    parseInt,
+	"float":   parseFloat,
+	"double":  parseFloat,
+	"boolean": func(s string) (interface{}, error) { return strconv.ParseBool(s) },
+	"string":  func(s string) (interface{}, error) { return s, nil },
+}
+
+func parseInt(s string) (interface{}, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func parseFloat(s string) (interface{}, error) {
+	return strconv.ParseFloat(s, 64)
+}
+
+func convert(typ, s string) (interface{}, error) {
+	if typ == "" {
+		return s, nil
+	}
+	return converters[typ](s)
+}
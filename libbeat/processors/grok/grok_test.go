@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundledPatternsCompile(t *testing.T) {
+	lib, err := loadBundled()
+	require.NoError(t, err)
+	require.Contains(t, lib, "IPORHOST")
+	require.Contains(t, lib, "HTTPD_COMBINEDLOG")
+	require.Contains(t, lib, "SYSLOG5424LINE")
+
+	for name := range lib {
+		_, err := lib.compile([]string{"%{" + name + "}"})
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	lib, err := loadBundled()
+	require.NoError(t, err)
+
+	cases := map[string]struct {
+		pattern string
+		input   string
+		want    map[string]interface{}
+	}{
+		"ipv4": {
+			pattern: `^%{IP:ip}$`,
+			input:   "192.168.1.254",
+			want:    map[string]interface{}{"ip": "192.168.1.254"},
+		},
+		"ipv6": {
+			pattern: `^%{IP:ip}$`,
+			input:   "2001:db8::8a2e:370:7334",
+			want:    map[string]interface{}{"ip": "2001:db8::8a2e:370:7334"},
+		},
+		"typed": {
+			pattern: `%{NUMBER:n:int} %{NUMBER:f:float} %{WORD:b:boolean} %{NUMBER:s}`,
+			input:   "42 1.5 true 7",
+			want:    map[string]interface{}{"n": int64(42), "f": 1.5, "b": true, "s": "7"},
+		},
+		"nested fields": {
+			pattern: `%{WORD:[http][request][method]} %{URIPATHPARAM:url.original}`,
+			input:   "GET /index.html?q=1",
+			want: map[string]interface{}{
+				"http.request.method": "GET",
+				"url.original":        "/index.html?q=1",
+			},
+		},
+		"named group": {
+			pattern: `user=(?<user.name>\w+)`,
+			input:   "user=alice",
+			want:    map[string]interface{}{"user.name": "alice"},
+		},
+		"httpd combined": {
+			pattern: `%{HTTPD_COMBINEDLOG}`,
+			input:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`,
+			want: map[string]interface{}{
+				"source.address":            "127.0.0.1",
+				"user.name":                 "frank",
+				"timestamp":                 "10/Oct/2000:13:55:36 -0700",
+				"http.request.method":       "GET",
+				"url.original":              "/apache_pb.gif",
+				"http.version":              "1.0",
+				"http.response.status_code": int64(200),
+				"http.response.body.bytes":  int64(2326),
+				"http.request.referrer":     "http://www.example.com/start.html",
+				"user_agent.original":       "Mozilla/4.08",
+			},
+		},
+		"syslog": {
+			pattern: `%{SYSLOGLINE}`,
+			input:   "Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+			want: map[string]interface{}{
+				"timestamp":     "Oct 11 22:14:15",
+				"host.hostname": "mymachine",
+				"process.name":  "su",
+				"process.pid":   int64(123),
+				"message":       "'su root' failed",
+			},
+		},
+		"syslog5424": {
+			pattern: `%{SYSLOG5424LINE}`,
+			input:   "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed",
+			want: map[string]interface{}{
+				"log.syslog.priority":   int64(34),
+				"system.syslog.version": "1",
+				"timestamp":             "2003-10-11T22:14:15.003Z",
+				"host.hostname":         "mymachine.example.com",
+				"process.name":          "su",
+				"event.code":            "ID47",
+				"message":               "'su root' failed",
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m, err := lib.compile([]string{tc.pattern})
+			require.NoError(t, err)
+			got, _, err := m.match(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	lib, err := loadBundled()
+	require.NoError(t, err)
+	m, err := lib.compile([]string{`^%{INT:n:int}$`, `^%{WORD:w}$`, `^%{GREEDYDATA:any}$`})
+	require.NoError(t, err)
+
+	got, i, err := m.match("hello")
+	require.NoError(t, err)
+	assert.Equal(t, 1, i)
+	assert.Equal(t, map[string]interface{}{"w": "hello"}, got)
+
+	m, err = lib.compile([]string{`^%{INT:n:int}$`})
+	require.NoError(t, err)
+	_, _, err = m.match("hello")
+	assert.ErrorIs(t, err, errNoMatch)
+}
+
+func TestCompileErrors(t *testing.T) {
+	lib := library{
+		"A":   "%{B}",
+		"B":   "%{A}",
+		"BAD": "(?<![0-9])x",
+	}
+	cases := map[string]string{
+		"%{MISSING}":    "pattern MISSING not defined",
+		"%{A}":          "pattern A is recursive",
+		"%{BAD}":        "error parsing regexp",
+		"%{BAD:x:date}": "unsupported type date for field x",
+	}
+	for pattern, want := range cases {
+		_, err := lib.compile([]string{pattern})
+		assert.ErrorContains(t, err, want, pattern)
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "custom"), []byte("# comment\n\nMYID [A-Z]{3}-\\d+\n"), 0o600)
+	require.NoError(t, err)
+
+	lib := library{}
+	require.NoError(t, lib.loadDir(dir))
+	assert.Equal(t, library{"MYID": `[A-Z]{3}-\d+`}, lib)
+
+	err = os.WriteFile(filepath.Join(dir, "invalid"), []byte("not-a-name x\n"), 0o600)
+	require.NoError(t, err)
+	assert.ErrorContains(t, lib.loadDir(dir), "invalid pattern definition at "+filepath.Join(dir, "invalid")+":1")
+}
@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	cases := map[string]struct {
+		config  mapstr.M
+		fields  mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"root fields": {
+			config: mapstr.M{"patterns": []string{`%{IP:source.ip} %{WORD:http.request.method} %{NUMBER:http.response.body.bytes:long}`}},
+			fields: mapstr.M{"message": "10.0.0.1 GET 512"},
+			want: mapstr.M{
+				"message": "10.0.0.1 GET 512",
+				"source":  mapstr.M{"ip": "10.0.0.1"},
+				"http": mapstr.M{
+					"request":  mapstr.M{"method": "GET"},
+					"response": mapstr.M{"body": mapstr.M{"bytes": int64(512)}},
+				},
+			},
+		},
+		"target prefix and custom definitions": {
+			config: mapstr.M{
+				"field":               "event.original",
+				"target_prefix":       "parsed",
+				"patterns":            []string{`^%{TICKET:ticket} %{GREEDYDATA:rest}$`, `^%{GREEDYDATA:other}$`},
+				"pattern_definitions": mapstr.M{"TICKET": `[A-Z]+-%{INT}`},
+			},
+			fields: mapstr.M{"event": mapstr.M{"original": "ABC-123 fixed"}},
+			want: mapstr.M{
+				"event":  mapstr.M{"original": "ABC-123 fixed"},
+				"parsed": mapstr.M{"ticket": "ABC-123", "rest": "fixed"},
+			},
+		},
+		"no match": {
+			config:  mapstr.M{"patterns": []string{`^%{INT:n}$`}},
+			fields:  mapstr.M{"message": "abc"},
+			want:    mapstr.M{"message": "abc", "log": mapstr.M{"flags": []string{flagParsingError}}},
+			wantErr: errNoMatch.Error(),
+		},
+		"no match ignored": {
+			config: mapstr.M{"patterns": []string{`^%{INT:n}$`}, "ignore_failure": true},
+			fields: mapstr.M{"message": "abc"},
+			want:   mapstr.M{"message": "abc", "log": mapstr.M{"flags": []string{flagParsingError}}},
+		},
+		"missing field": {
+			config:  mapstr.M{"patterns": []string{`%{INT:n}`}},
+			fields:  mapstr.M{"other": "1"},
+			want:    mapstr.M{"other": "1"},
+			wantErr: "key not found",
+		},
+		"missing field ignored": {
+			config: mapstr.M{"patterns": []string{`%{INT:n}`}, "ignore_missing": true},
+			fields: mapstr.M{"other": "1"},
+			want:   mapstr.M{"other": "1"},
+		},
+		"existing key": {
+			config:  mapstr.M{"patterns": []string{`%{WORD:message}`}},
+			fields:  mapstr.M{"message": "hello world"},
+			want:    mapstr.M{"message": "hello world"},
+			wantErr: "cannot override existing key with `message`",
+		},
+		"overwrite keys": {
+			config: mapstr.M{"patterns": []string{`%{WORD:level} %{GREEDYDATA:message}`}, "overwrite_keys": true},
+			fields: mapstr.M{"message": "INFO hello world"},
+			want:   mapstr.M{"message": "hello world", "level": "INFO"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewProcessor(conf.MustNewConfigFrom(tc.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: tc.fields})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, event.Fields)
+		})
+	}
+}
+
+func TestProcessorInvalidPattern(t *testing.T) {
+	_, err := NewProcessor(conf.MustNewConfigFrom(mapstr.M{"patterns": []string{`%{NOPE:x}`}}))
+	assert.ErrorContains(t, err, "pattern NOPE not defined")
+
+	_, err = NewProcessor(conf.MustNewConfigFrom(mapstr.M{"field": "message"}))
+	assert.ErrorContains(t, err, "missing required field accessing 'patterns'")
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type config struct {
+	Field         string   `config:"field"`
+	TargetField   string   `config:"target_field"`
+	FieldSplit    string   `config:"field_split" validate:"required"`
+	ValueSplit    string   `config:"value_split" validate:"required"`
+	IncludeKeys   []string `config:"include_keys"`
+	ExcludeKeys   []string `config:"exclude_keys"`
+	Prefix        string   `config:"prefix"`
+	TrimKey       string   `config:"trim_key"`
+	TrimValue     string   `config:"trim_value"`
+	DuplicateKeys dupMode  `config:"duplicate_keys"`
+	IgnoreMissing bool     `config:"ignore_missing"`
+	OverwriteKeys bool     `config:"overwrite_keys"`
+}
+
+var defaultConfig = config{
+	Field:      "message",
+	FieldSplit: " ",
+	ValueSplit: "=",
+}
+
+func (c *config) Validate() error {
+	if err := validateSplit(c.FieldSplit); err != nil {
+		return fmt.Errorf("invalid field_split: %w", err)
+	}
+	if err := validateSplit(c.ValueSplit); err != nil {
+		return fmt.Errorf("invalid value_split: %w", err)
+	}
+	return nil
+}
+
+func validateSplit(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	if re.MatchString("") {
+		return fmt.Errorf("%q matches an empty string", expr)
+	}
+	return nil
+}
+
+// dupMode is the handling of keys found more than once in a field.
+type dupMode byte
+
+const (
+	dupModeArray dupMode = iota
+	dupModeFirst
+	dupModeLast
+)
+
+// Unpack the duplicate keys mode from a string.
+func (m *dupMode) Unpack(v string) error {
+	switch strings.ToLower(v) {
+	case "", "array":
+		*m = dupModeArray
+	case "first":
+		*m = dupModeFirst
+	case "last":
+		*m = dupModeLast
+	default:
+		return fmt.Errorf("unsupported value %s. Must be one of [array, first, last]", v)
+	}
+	return nil
+}
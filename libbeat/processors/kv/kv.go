@@ -0,0 +1,97 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type processor struct {
+	config config
+	parser *parser
+}
+
+func init() {
+	processors.RegisterPlugin("kv", NewProcessor)
+	jsprocessor.RegisterPlugin("KV", NewProcessor)
+}
+
+// NewProcessor constructs a new kv processor.
+func NewProcessor(c *cfg.C) (beat.Processor, error) {
+	config := defaultConfig
+	err := c.Unpack(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &processor{config: config, parser: newParser(config)}, nil
+}
+
+// Run splits the configured field into key-value pairs and adds them
+// to the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	pairs, keys := p.parser.parse(s)
+	if len(keys) == 0 {
+		return event, nil
+	}
+
+	prefix := p.config.Prefix
+	if p.config.TargetField != "" {
+		prefix = p.config.TargetField + "." + prefix
+	}
+	backup := event.Clone()
+	for _, k := range keys {
+		key := prefix + k
+		if _, err := event.GetValue(key); errors.Is(err, mapstr.ErrKeyNotFound) || p.config.OverwriteKeys {
+			_, _ = event.PutValue(key, pairs[k])
+		} else {
+			// When the target key exists but is a string instead of a map.
+			if err != nil {
+				return backup, fmt.Errorf("cannot override existing key with `%s`: %w", key, err)
+			}
+			return backup, fmt.Errorf("cannot override existing key with `%s`", key)
+		}
+	}
+	return event, nil
+}
+
+func (p *processor) String() string {
+	return "kv=[field=" + p.config.Field +
+		",target_field=" + p.config.TargetField +
+		",field_split=" + p.config.FieldSplit +
+		",value_split=" + p.config.ValueSplit + "]"
+}
@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestProcessor(t *testing.T) {
+	cases := map[string]struct {
+		config  mapstr.M
+		fields  mapstr.M
+		want    mapstr.M
+		wantErr string
+	}{
+		"target field and prefix": {
+			config: mapstr.M{"target_field": "fw", "prefix": "arg_"},
+			fields: mapstr.M{"message": `act=deny src=10.0.0.1 reason="policy 7"`},
+			want: mapstr.M{
+				"message": `act=deny src=10.0.0.1 reason="policy 7"`,
+				"fw":      mapstr.M{"arg_act": "deny", "arg_src": "10.0.0.1", "arg_reason": "policy 7"},
+			},
+		},
+		"root": {
+			config: mapstr.M{"field": "event.original"},
+			fields: mapstr.M{"event": mapstr.M{"original": "source.ip=10.0.0.1 action=allow"}},
+			want: mapstr.M{
+				"event":  mapstr.M{"original": "source.ip=10.0.0.1 action=allow"},
+				"source": mapstr.M{"ip": "10.0.0.1"},
+				"action": "allow",
+			},
+		},
+		"existing key": {
+			config:  mapstr.M{},
+			fields:  mapstr.M{"message": "a=1 message=x"},
+			want:    mapstr.M{"message": "a=1 message=x"},
+			wantErr: "cannot override existing key with `message`",
+		},
+		"overwrite keys": {
+			config: mapstr.M{"overwrite_keys": true},
+			fields: mapstr.M{"message": "a=1 message=x"},
+			want:   mapstr.M{"message": "x", "a": "1"},
+		},
+		"missing field": {
+			config:  mapstr.M{},
+			fields:  mapstr.M{"other": "a=1"},
+			want:    mapstr.M{"other": "a=1"},
+			wantErr: "key not found",
+		},
+		"missing field ignored": {
+			config: mapstr.M{"ignore_missing": true},
+			fields: mapstr.M{"other": "a=1"},
+			want:   mapstr.M{"other": "a=1"},
+		},
+		"not a string": {
+			config:  mapstr.M{},
+			fields:  mapstr.M{"message": 1},
+			want:    mapstr.M{"message": 1},
+			wantErr: "field is not a string",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewProcessor(conf.MustNewConfigFrom(tc.config))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: tc.fields})
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.want, event.Fields)
+		})
+	}
+}
+
+func TestConfig(t *testing.T) {
+	cases := map[string]struct {
+		config mapstr.M
+		err    string
+	}{
+		"invalid regexp": {
+			config: mapstr.M{"field_split": "("},
+			err:    "invalid field_split",
+		},
+		"empty match": {
+			config: mapstr.M{"value_split": "=*"},
+			err:    `invalid value_split: "=*" matches an empty string`,
+		},
+		"invalid duplicate mode": {
+			config: mapstr.M{"duplicate_keys": "merge"},
+			err:    "unsupported value merge",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewProcessor(conf.MustNewConfigFrom(tc.config))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
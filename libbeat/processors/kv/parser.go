@@ -0,0 +1,147 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"regexp"
+	"strings"
+)
+
+// parser splits strings into key-value pairs.
+type parser struct {
+	fieldSplit *regexp.Regexp
+	valueSplit *regexp.Regexp
+	include    map[string]bool
+	exclude    map[string]bool
+	trimKey    string
+	trimValue  string
+	duplicates dupMode
+}
+
+func newParser(c config) *parser {
+	p := &parser{
+		fieldSplit: regexp.MustCompile(c.FieldSplit),
+		valueSplit: regexp.MustCompile(c.ValueSplit),
+		trimKey:    c.TrimKey,
+		trimValue:  c.TrimValue,
+		duplicates: c.DuplicateKeys,
+	}
+	if len(c.IncludeKeys) != 0 {
+		p.include = toSet(c.IncludeKeys)
+	}
+	if len(c.ExcludeKeys) != 0 {
+		p.exclude = toSet(c.ExcludeKeys)
+	}
+	return p
+}
+
+func toSet(keys []string) map[string]bool {
+	m := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		m[k] = true
+	}
+	return m
+}
+
+// parse returns the key-value pairs of s. Values of keys found more than
+// once are collected in a []string, or the first or last value is kept,
+// depending on the duplicate keys mode. keys holds the keys in the order
+// they were first found.
+func (p *parser) parse(s string) (pairs map[string]interface{}, keys []string) {
+	pairs = map[string]interface{}{}
+	p.scan(s, func(key, value string) {
+		key = strings.Trim(key, p.trimKey)
+		value = strings.Trim(value, p.trimValue)
+		if key == "" || (p.include != nil && !p.include[key]) || p.exclude[key] {
+			return
+		}
+		prev, ok := pairs[key]
+		if !ok {
+			pairs[key] = value
+			keys = append(keys, key)
+			return
+		}
+		switch p.duplicates {
+		case dupModeFirst:
+		case dupModeLast:
+			pairs[key] = value
+		default:
+			if prev, ok := prev.([]string); ok {
+				pairs[key] = append(prev, value)
+				return
+			}
+			pairs[key] = []string{prev.(string), value}
+		}
+	})
+	return pairs, keys
+}
+
+// scan calls fn for each key-value pair of s. Tokens without a value
+// split are skipped. Values enclosed in double or single quotes may
+// contain separators and backslash-escaped quotes, the enclosing quotes
+// are removed.
+func (p *parser) scan(s string, fn func(key, value string)) {
+	for pos := 0; pos < len(s); {
+		vs := p.valueSplit.FindStringIndex(s[pos:])
+		if vs == nil {
+			return
+		}
+		keyStart, keyEnd := pos, pos+vs[0]
+		for _, fs := range p.fieldSplit.FindAllStringIndex(s[keyStart:keyEnd], -1) {
+			// Skip the tokens before the key that have no value.
+			keyStart = pos + fs[1]
+		}
+		var value string
+		value, pos = p.value(s, pos+vs[1])
+		fn(s[keyStart:keyEnd], value)
+	}
+}
+
+// value returns the value starting at start, and the position after
+// the value and the field split that follows it.
+func (p *parser) value(s string, start int) (string, int) {
+	if start < len(s) && (s[start] == '"' || s[start] == '\'') {
+		quote := s[start]
+		for i := start + 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case quote:
+				next := i + 1
+				if fs := p.fieldSplit.FindStringIndex(s[next:]); fs != nil && fs[0] == 0 {
+					next += fs[1]
+				}
+				return unescape(s[start+1:i], quote), next
+			}
+		}
+		// An unterminated quote is part of an unquoted value.
+	}
+	fs := p.fieldSplit.FindStringIndex(s[start:])
+	if fs == nil {
+		return s[start:], len(s)
+	}
+	return s[start : start+fs[0]], start + fs[1]
+}
+
+// unescape removes the backslash before escaped quotes and backslashes.
+func unescape(s string, quote byte) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\`+string(quote), string(quote), `\\`, `\`).Replace(s)
+}
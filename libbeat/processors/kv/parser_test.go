@@ -0,0 +1,109 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]struct {
+		config    config
+		input     string
+		want      map[string]interface{}
+		wantOrder []string
+	}{
+		"simple": {
+			input:     "a=1 b=2 c=3",
+			want:      map[string]interface{}{"a": "1", "b": "2", "c": "3"},
+			wantOrder: []string{"a", "b", "c"},
+		},
+		"quoted values": {
+			input:     `msg="hello world" path='C:\\temp' q="say \"hi\"" empty="" end=x`,
+			want:      map[string]interface{}{"msg": "hello world", "path": `C:\temp`, "q": `say "hi"`, "empty": "", "end": "x"},
+			wantOrder: []string{"msg", "path", "q", "empty", "end"},
+		},
+		"unterminated quote": {
+			input:     `a="b c=d`,
+			want:      map[string]interface{}{"a": `"b`, "c": "d"},
+			wantOrder: []string{"a", "c"},
+		},
+		"tokens without value": {
+			input:     "Jan 1 host fw: src=10.0.0.1 dst=10.0.0.2 junk",
+			want:      map[string]interface{}{"src": "10.0.0.1", "dst": "10.0.0.2"},
+			wantOrder: []string{"src", "dst"},
+		},
+		"empty value and key": {
+			input:     "a= =b c=1",
+			want:      map[string]interface{}{"a": "", "c": "1"},
+			wantOrder: []string{"a", "c"},
+		},
+		"regex splits": {
+			config:    config{FieldSplit: `\s*[,;]\s*`, ValueSplit: `\s*:\s*`},
+			input:     "a : 1, b:2 ;c: three",
+			want:      map[string]interface{}{"a": "1", "b": "2", "c": "three"},
+			wantOrder: []string{"a", "b", "c"},
+		},
+		"trim": {
+			config:    config{FieldSplit: "&", ValueSplit: "=", TrimKey: " <", TrimValue: " >"},
+			input:     " <a = 1> & b=2 ",
+			want:      map[string]interface{}{"a": "1", "b": "2"},
+			wantOrder: []string{"a", "b"},
+		},
+		"include and exclude": {
+			config:    config{IncludeKeys: []string{"a", "b"}, ExcludeKeys: []string{"b"}},
+			input:     "a=1 b=2 c=3",
+			want:      map[string]interface{}{"a": "1"},
+			wantOrder: []string{"a"},
+		},
+		"duplicates as array": {
+			input:     "a=1 b=2 a=3 a=4",
+			want:      map[string]interface{}{"a": []string{"1", "3", "4"}, "b": "2"},
+			wantOrder: []string{"a", "b"},
+		},
+		"duplicates first": {
+			config:    config{DuplicateKeys: dupModeFirst},
+			input:     "a=1 a=2",
+			want:      map[string]interface{}{"a": "1"},
+			wantOrder: []string{"a"},
+		},
+		"duplicates last": {
+			config:    config{DuplicateKeys: dupModeLast},
+			input:     "a=1 a=2",
+			want:      map[string]interface{}{"a": "2"},
+			wantOrder: []string{"a"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := tc.config
+			if c.FieldSplit == "" {
+				c.FieldSplit = defaultConfig.FieldSplit
+			}
+			if c.ValueSplit == "" {
+				c.ValueSplit = defaultConfig.ValueSplit
+			}
+			got, order := newParser(c).parse(tc.input)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantOrder, order)
+		})
+	}
+}
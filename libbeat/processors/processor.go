@@ -53,6 +53,50 @@ func Close(p beat.Processor) error {
 	return nil
 }
 
+// Emitter defines the interface for processors that publish new events
+// outside of Run, for example summaries of the events seen during a time
+// window.
+// SetEmitter is called by the publisher pipeline before the first event is
+// processed, with the ID of the input of the client, empty when unknown,
+// and the index of the emitter among the emitters of the client's
+// processors. Inputs like filestream connect a client per file with the
+// same processors, emitters can use the input ID and index to share their
+// state with the emitter at the same position in the other clients of the
+// input.
+// Emitted events skip the processors of the client the processor belongs
+// to, and go through the global processors only. Emitters must also
+// implement Closer, publish their pending events in Close and stop emitting
+// once it returns.
+type Emitter interface {
+	beat.Processor
+	Closer
+	SetEmitter(inputID string, index int, emit func(beat.Event))
+}
+
+// Emitters returns the processors in p, including the ones nested in lists
+// and conditionals, that implement the Emitter interface.
+func Emitters(p beat.Processor) []Emitter {
+	switch p := p.(type) {
+	case nil:
+		return nil
+	case Emitter:
+		return []Emitter{p}
+	case *SafeProcessor:
+		return Emitters(p.Processor)
+	case *WhenProcessor:
+		return Emitters(p.p)
+	case *IfThenElseProcessor:
+		return append(Emitters(p.then), Emitters(p.els)...)
+	}
+	var emitters []Emitter
+	if list, ok := p.(interface{ All() []beat.Processor }); ok {
+		for _, sub := range list.All() {
+			emitters = append(emitters, Emitters(sub)...)
+		}
+	}
+	return emitters
+}
+
 // NewList creates a new empty processor list.
 // Additional processors can be added to the List field.
 func NewList(log *logp.Logger) *Processors {
@@ -30,6 +30,7 @@ import (
 	_ "github.com/elastic/beats/v7/libbeat/processors/actions"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_cloud_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_process_metadata"
+	_ "github.com/elastic/beats/v7/libbeat/processors/aggregate"
 	_ "github.com/elastic/beats/v7/libbeat/processors/convert"
 	_ "github.com/elastic/beats/v7/libbeat/processors/decode_csv_fields"
 	_ "github.com/elastic/beats/v7/libbeat/processors/dissect"
@@ -787,3 +788,37 @@ func generateFields(t require.TestingT, m mapstr.M, count, nesting int) {
 		require.NoError(t, err)
 	}
 }
+
+func TestEmitters(t *testing.T) {
+	yml := []map[string]interface{}{
+		{
+			"add_fields": map[string]interface{}{
+				"fields": map[string]interface{}{"a": "b"},
+			},
+		},
+		{
+			"aggregate": map[string]interface{}{
+				"when": map[string]interface{}{
+					"has_fields": []string{"url.path"},
+				},
+			},
+		},
+		{
+			"if": map[string]interface{}{
+				"has_fields": []string{"error"},
+			},
+			"then": []map[string]interface{}{
+				{"aggregate": map[string]interface{}{"group_by": []string{"error.type"}}},
+			},
+		},
+	}
+	procs := GetProcessors(t, yml)
+
+	emitters := processors.Emitters(procs)
+	require.Len(t, emitters, 2)
+	assert.Contains(t, emitters[0].String(), "aggregate=")
+	assert.Contains(t, emitters[1].String(), "group_by=[error.type]")
+
+	assert.Empty(t, processors.Emitters(GetProcessors(t, yml[:1])))
+	assert.NoError(t, procs.Close())
+}
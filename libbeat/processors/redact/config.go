@@ -0,0 +1,151 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type config struct {
+	// Fields is the list of fields inspected by rules that don't
+	// define their own.
+	Fields []string `config:"fields"`
+
+	// Rules is the list of redaction rules, applied in order.
+	Rules []ruleConfig `config:"rules" validate:"required"`
+
+	Hash hashConfig `config:"hash"`
+}
+
+type hashConfig struct {
+	// Key is the secret used to compute the HMAC of hashed values. It
+	// should be a reference to a keystore entry, like ${REDACT_KEY}.
+	Key string `config:"key"`
+}
+
+type ruleConfig struct {
+	// Name identifies the rule in the metrics. It defaults to the
+	// detector name.
+	Name string `config:"name"`
+
+	// Pattern is a regular expression matching the values to redact.
+	// When it has a capture group, only the first group is redacted.
+	Pattern string `config:"pattern"`
+
+	// Detector is the name of a built-in detector. It is an
+	// alternative to Pattern. When neither is set the whole value of
+	// the fields is redacted.
+	Detector string `config:"detector"`
+
+	// Fields overrides the list of fields inspected by the rule.
+	Fields []string `config:"fields"`
+
+	// Action is how matched values are redacted.
+	Action string `config:"action"`
+
+	Mask     maskConfig     `config:"mask"`
+	Truncate truncateConfig `config:"truncate"`
+}
+
+type maskConfig struct {
+	// Char is the character replacing each masked character.
+	Char string `config:"char"`
+
+	// KeepStart and KeepEnd are the number of leading and trailing
+	// characters left unmasked.
+	KeepStart int `config:"keep_start" validate:"min=0"`
+	KeepEnd   int `config:"keep_end" validate:"min=0"`
+}
+
+type truncateConfig struct {
+	// Length is the number of leading characters kept.
+	Length int `config:"length" validate:"min=0"`
+}
+
+const (
+	actionMask     = "mask"
+	actionHash     = "hash"
+	actionTruncate = "truncate"
+)
+
+func defaultConfig() config {
+	return config{
+		Fields: []string{"message"},
+	}
+}
+
+func (cfg *config) Validate() error {
+	names := make(map[string]bool, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		if names[r.Name] {
+			return fmt.Errorf("duplicate rule name %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Action == actionHash && cfg.Hash.Key == "" {
+			return fmt.Errorf("hash.key is required by rule %q", r.Name)
+		}
+		if r.Pattern == "" && r.Detector == "" && len(r.Fields) == 0 {
+			return fmt.Errorf("rule %d must specify fields when it has no pattern or detector", i)
+		}
+	}
+	return nil
+}
+
+func (cfg *ruleConfig) Validate() error {
+	if cfg.Pattern != "" && cfg.Detector != "" {
+		return errors.New("must specify only one of pattern or detector")
+	}
+	if cfg.Detector != "" {
+		if _, ok := detectors[cfg.Detector]; !ok {
+			return fmt.Errorf("unknown detector %q, must be one of %s", cfg.Detector, detectorNames())
+		}
+		if cfg.Name == "" {
+			cfg.Name = cfg.Detector
+		}
+	}
+	switch {
+	case cfg.Name == "":
+		return errors.New("name is required for rules without a detector")
+	case strings.Contains(cfg.Name, "."):
+		return fmt.Errorf("invalid rule name %q, must not contain dots", cfg.Name)
+	}
+
+	switch cfg.Action {
+	case "":
+		cfg.Action = actionMask
+	case actionMask, actionHash, actionTruncate:
+	default:
+		return fmt.Errorf("invalid action %q, must be one of %q, %q or %q", cfg.Action, actionMask, actionHash, actionTruncate)
+	}
+	if cfg.Mask.Char == "" {
+		cfg.Mask.Char = "*"
+	}
+	return nil
+}
+
+func detectorNames() string {
+	names := make([]string, 0, len(detectors))
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"net/netip"
+	"regexp"
+)
+
+// detector is a built-in pattern for a kind of sensitive value.
+type detector struct {
+	re *regexp.Regexp
+	// find returns the parts of the candidate s[start:end] that are
+	// instances of the detected kind. It is nil when every regexp match is.
+	find func(s string, start, end int) []span
+}
+
+// span is the range s[start:end] of a value to redact.
+type span struct {
+	start, end int
+}
+
+// detectors are the built-in detectors, keyed by their configuration name.
+// When a detector regexp has a capture group, only the group is redacted.
+var detectors = map[string]detector{
+	"credit_card": {
+		// Sequences of digit groups, the card numbers are searched in
+		// them, as card numbers are often followed by other numbers like
+		// the expiry date or CVV.
+		re:   regexp.MustCompile(`\b\d+(?:[ -]\d+)*\b`),
+		find: findCreditCards,
+	},
+	"email": {
+		re: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}\b`),
+	},
+	"ipv4": {
+		re:   regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+		find: whole(validIPv4),
+	},
+	"ipv6": {
+		re:   regexp.MustCompile(`(?i)[0-9a-f]*:[0-9a-f:]*:[0-9a-f]*(?:\.\d+){0,3}`),
+		find: whole(validIPv6),
+	},
+	"bearer_token": {
+		re: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	},
+	"aws_access_key": {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}\b`),
+	},
+	"aws_secret_key": {
+		re: regexp.MustCompile(`(?i)\baws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+	},
+}
+
+// whole returns a find function that accepts the whole candidate if valid
+// returns true for it.
+func whole(valid func(s string, start, end int) bool) func(s string, start, end int) []span {
+	return func(s string, start, end int) []span {
+		if !valid(s, start, end) {
+			return nil
+		}
+		return []span{{start, end}}
+	}
+}
+
+// findCreditCards returns the payment card numbers in the sequence of digit
+// groups s[start:end]. A card number consists of whole groups, has 13 to 19
+// digits and is valid according to the Luhn algorithm. For every group the
+// longest card number starting with it is used.
+func findCreditCards(s string, start, end int) []span {
+	type group struct {
+		start, end int
+	}
+	var groups []group
+	for i := start; i < end; {
+		j := i
+		for j < end && isDigit(s[j]) {
+			j++
+		}
+		groups = append(groups, group{i, j})
+		i = j + 1
+	}
+
+	var cards []span
+	for i := 0; i < len(groups); {
+		last, digits := -1, 0
+		for j := i; j < len(groups); j++ {
+			digits += groups[j].end - groups[j].start
+			if digits > 19 {
+				break
+			}
+			if digits >= 13 && validCreditCard(s[groups[i].start:groups[j].end]) {
+				last = j
+			}
+		}
+		if last < 0 {
+			i++
+			continue
+		}
+		cards = append(cards, span{groups[i].start, groups[last].end})
+		i = last + 1
+	}
+	return cards
+}
+
+// validCreditCard reports whether the digits of s are a valid payment card
+// number according to the Luhn algorithm.
+func validCreditCard(s string) bool {
+	var digits []int
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIPv4 rejects matches that are part of a longer dotted sequence, like
+// a version number.
+func validIPv4(s string, start, end int) bool {
+	return (start == 0 || s[start-1] != '.') && (end == len(s) || s[end] != '.' || end+1 == len(s) || !isDigit(s[end+1]))
+}
+
+// validIPv6 reports whether s[start:end] is an IPv6 address that is not
+// embedded in a word, like std::string.
+func validIPv6(s string, start, end int) bool {
+	if start > 0 && isWord(s[start-1]) || end < len(s) && isWord(s[end]) {
+		return false
+	}
+	addr, err := netip.ParseAddr(s[start:end])
+	return err == nil && addr.Is6()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWord(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	processorName = "redact"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type processor struct {
+	rules []*rule
+}
+
+// rule is a compiled redaction rule.
+type rule struct {
+	name   string
+	fields []string
+
+	// re matches the values to redact. When it is nil the whole value of
+	// the fields is redacted.
+	re   *regexp.Regexp
+	find func(s string, start, end int) []span
+
+	redact func(string) string
+	count  *monitoring.Int
+}
+
+// New constructs a new redact processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	var (
+		id  = int(instanceID.Add(1))
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+		p   = &processor{}
+	)
+	for _, rc := range c.Rules {
+		r := &rule{
+			name:   rc.Name,
+			fields: rc.Fields,
+			redact: newAction(rc, []byte(c.Hash.Key)),
+			count:  monitoring.NewInt(reg, "redactions."+rc.Name),
+		}
+		if len(r.fields) == 0 {
+			r.fields = c.Fields
+		}
+		switch {
+		case rc.Detector != "":
+			d := detectors[rc.Detector]
+			r.re, r.find = d.re, d.find
+		case rc.Pattern != "":
+			re, err := regexp.Compile(rc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of rule %q: %w", rc.Name, err)
+			}
+			r.re = re
+		}
+		p.rules = append(p.rules, r)
+	}
+	return p, nil
+}
+
+// newAction returns the function redacting a value according to the
+// action of the rule.
+func newAction(rc ruleConfig, key []byte) func(string) string {
+	switch rc.Action {
+	case actionHash:
+		return func(s string) string {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(s))
+			return hex.EncodeToString(mac.Sum(nil))
+		}
+	case actionTruncate:
+		return func(s string) string {
+			r := []rune(s)
+			return string(r[:min(rc.Truncate.Length, len(r))])
+		}
+	default:
+		return func(s string) string {
+			r := []rune(s)
+			// Values too short to keep anything are masked entirely.
+			start, end := rc.Mask.KeepStart, len(r)-rc.Mask.KeepEnd
+			if start >= end {
+				start, end = 0, len(r)
+			}
+			var b strings.Builder
+			b.WriteString(string(r[:start]))
+			b.WriteString(strings.Repeat(rc.Mask.Char, end-start))
+			b.WriteString(string(r[end:]))
+			return b.String()
+		}
+	}
+}
+
+// Run redacts the values matched by each rule in the fields it inspects.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	for _, r := range p.rules {
+		for _, field := range r.fields {
+			v, err := event.GetValue(field)
+			if err != nil {
+				// Fields are not expected to be present in all events.
+				continue
+			}
+			redacted, n := r.apply(v)
+			if n == 0 {
+				continue
+			}
+			if _, err := event.PutValue(field, redacted); err != nil {
+				return event, fmt.Errorf("failed to put redacted value of field %s: %w", field, err)
+			}
+			r.count.Add(int64(n))
+		}
+	}
+	return event, nil
+}
+
+// apply redacts the string values of v and returns the number of
+// redactions. Rules without a pattern also redact numbers and booleans,
+// which are replaced by the redacted string of their value. Arrays are
+// copied rather than modified in place as they may be shared with other
+// events.
+func (r *rule) apply(v interface{}) (interface{}, int) {
+	switch v := v.(type) {
+	case string:
+		return r.redactString(v)
+	case []string:
+		var total int
+		a := make([]string, len(v))
+		for i, s := range v {
+			var n int
+			a[i], n = r.redactString(s)
+			total += n
+		}
+		return a, total
+	case []interface{}:
+		var total int
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			s, ok := r.stringValue(e)
+			if !ok {
+				a[i] = e
+				continue
+			}
+			var n int
+			a[i], n = r.redactString(s)
+			total += n
+		}
+		return a, total
+	default:
+		s, ok := r.stringValue(v)
+		if !ok {
+			return v, 0
+		}
+		return r.redactString(s)
+	}
+}
+
+// stringValue returns the string to redact for a value, and whether the
+// rule redacts it. Numbers and booleans are only redacted by rules without
+// a pattern, as patterns match the text of strings.
+func (r *rule) stringValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		if r.re != nil {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func (r *rule) redactString(s string) (string, int) {
+	if s == "" {
+		return s, 0
+	}
+	if r.re == nil {
+		return r.redact(s), 1
+	}
+
+	var (
+		b    strings.Builder
+		last int
+		n    int
+	)
+	for _, m := range r.re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start == end {
+			continue
+		}
+		spans := []span{{start, end}}
+		if r.find != nil {
+			spans = r.find(s, start, end)
+		}
+		for _, sp := range spans {
+			b.WriteString(s[last:sp.start])
+			b.WriteString(r.redact(s[sp.start:sp.end]))
+			last = sp.end
+			n++
+		}
+	}
+	if n == 0 {
+		return s, 0
+	}
+	b.WriteString(s[last:])
+	return b.String(), n
+}
+
+func (p *processor) String() string {
+	names := make([]string, len(p.rules))
+	for i, r := range p.rules {
+		names[i] = r.name
+	}
+	return fmt.Sprintf("%v=[rules=[%v]]", processorName, strings.Join(names, ", "))
+}
@@ -0,0 +1,159 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestRedact(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"fields": []string{"message", "tags"},
+		"hash":   mapstr.M{"key": "secret"},
+		"rules": []mapstr.M{
+			{"detector": "credit_card", "mask": mapstr.M{"keep_end": 4}},
+			{"detector": "email", "action": "hash"},
+			{"name": "password", "pattern": `password=(\S+)`, "mask": mapstr.M{"char": "#"}},
+			{"name": "ip", "detector": "ipv4", "action": "truncate", "truncate": mapstr.M{"length": 3}, "fields": []string{"source.address"}},
+			{"name": "token", "fields": []string{"http.request.headers.authorization"}},
+		},
+	}))
+	require.NoError(t, err)
+
+	tags := []interface{}{"a@example.com", 1}
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"message": "paid with 4111-1111-1111-1111 by a@example.com password=hunter2 from 10.0.0.1",
+		"tags":    tags,
+		"source":  mapstr.M{"address": "10.0.0.1"},
+		"http":    mapstr.M{"request": mapstr.M{"headers": mapstr.M{"authorization": "Basic Zm9v"}}},
+	}})
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("a@example.com"))
+	hash := hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, mapstr.M{
+		"message": "paid with ***************1111 by " + hash + " password=####### from 10.0.0.1",
+		"tags":    []interface{}{hash, 1},
+		"source":  mapstr.M{"address": "10."},
+		"http":    mapstr.M{"request": mapstr.M{"headers": mapstr.M{"authorization": "**********"}}},
+	}, event.Fields)
+	assert.Equal(t, []interface{}{"a@example.com", 1}, tags, "arrays must not be modified in place")
+
+	// Events without the fields are left unchanged.
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"event": mapstr.M{"kind": "event"}}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"event": mapstr.M{"kind": "event"}}, event.Fields)
+
+	counts := map[string]int64{}
+	for _, r := range p.(*processor).rules {
+		counts[r.name] = r.count.Get()
+	}
+	assert.Equal(t, map[string]int64{"credit_card": 1, "email": 2, "password": 1, "ip": 1, "token": 1}, counts)
+}
+
+func TestRedactScalars(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"rules": []mapstr.M{
+			{"name": "account", "fields": []string{"account.id", "account.active", "account.codes"}},
+			{"name": "amount", "pattern": `\d+`, "fields": []string{"amount"}},
+		},
+	}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{
+		"account": mapstr.M{"id": int64(12345), "active": true, "codes": []interface{}{42, "ab"}},
+		"amount":  150,
+	}})
+	require.NoError(t, err)
+
+	// Rules without a pattern redact the string of numbers and booleans,
+	// patterns only match strings.
+	assert.Equal(t, mapstr.M{
+		"account": mapstr.M{"id": "*****", "active": "****", "codes": []interface{}{"**", "**"}},
+		"amount":  150,
+	}, event.Fields)
+	assert.Equal(t, int64(4), p.(*processor).rules[0].count.Get())
+}
+
+func TestMask(t *testing.T) {
+	mask := newAction(ruleConfig{Action: actionMask, Mask: maskConfig{Char: "*", KeepStart: 2, KeepEnd: 2}}, nil)
+	assert.Equal(t, "ab*dé", mask("abcdé"))
+	assert.Equal(t, "****", mask("abcd"), "values too short are masked entirely")
+}
+
+func TestConfig(t *testing.T) {
+	tests := map[string]struct {
+		config mapstr.M
+		err    string
+	}{
+		"no rules": {
+			config: mapstr.M{},
+			err:    "missing required field accessing 'rules'",
+		},
+		"pattern and detector": {
+			config: mapstr.M{"rules": []mapstr.M{{"name": "x", "pattern": "x", "detector": "email"}}},
+			err:    "must specify only one of pattern or detector",
+		},
+		"unknown detector": {
+			config: mapstr.M{"rules": []mapstr.M{{"detector": "ssn"}}},
+			err:    `unknown detector "ssn"`,
+		},
+		"missing name": {
+			config: mapstr.M{"rules": []mapstr.M{{"pattern": "x"}}},
+			err:    "name is required for rules without a detector",
+		},
+		"duplicate name": {
+			config: mapstr.M{"rules": []mapstr.M{{"detector": "email"}, {"detector": "email"}}},
+			err:    `duplicate rule name "email"`,
+		},
+		"invalid action": {
+			config: mapstr.M{"rules": []mapstr.M{{"detector": "email", "action": "drop"}}},
+			err:    `invalid action "drop"`,
+		},
+		"hash without key": {
+			config: mapstr.M{"rules": []mapstr.M{{"detector": "email", "action": "hash"}}},
+			err:    `hash.key is required by rule "email"`,
+		},
+		"whole value without fields": {
+			config: mapstr.M{"rules": []mapstr.M{{"name": "x"}}},
+			err:    "rule 0 must specify fields when it has no pattern or detector",
+		},
+		"invalid pattern": {
+			config: mapstr.M{"rules": []mapstr.M{{"name": "x", "pattern": "(?<=x)"}}},
+			err:    `invalid pattern of rule "x"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(test.config))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
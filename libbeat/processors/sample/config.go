@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type config struct {
+	// Mode selects how events are sampled.
+	Mode string `config:"mode"`
+
+	// Percentage is the percentage of events kept in head and hash mode.
+	Percentage float64 `config:"percentage"`
+
+	// Fields is the list of fields forming the sampling key. All events
+	// with the same key are kept or dropped together in hash mode, and
+	// share a reservoir in reservoir mode.
+	Fields []string `config:"fields"`
+
+	// RateField is the field set to the sampling rate of kept events, an
+	// estimate in reservoir mode. An empty value disables it.
+	RateField string `config:"rate_field"`
+
+	Reservoir reservoirConfig `config:"reservoir"`
+}
+
+type reservoirConfig struct {
+	// Size is the maximum number of events kept per key in an interval.
+	Size int `config:"size" validate:"positive,nonzero"`
+
+	// Interval is the duration of the sampling intervals.
+	Interval time.Duration `config:"interval" validate:"positive,nonzero"`
+
+	// MaxKeys is the maximum number of keys tracked. The least recently
+	// used key is forgotten when it is reached.
+	MaxKeys int `config:"max_keys" validate:"positive,nonzero"`
+}
+
+const (
+	modeHead      = "head"
+	modeHash      = "hash"
+	modeReservoir = "reservoir"
+)
+
+func defaultConfig() config {
+	return config{
+		Mode:      modeHead,
+		RateField: "sample.rate",
+		Reservoir: reservoirConfig{
+			Size:     100,
+			Interval: time.Minute,
+			MaxKeys:  10000,
+		},
+	}
+}
+
+func (cfg *config) Validate() error {
+	switch cfg.Mode {
+	case modeHead, modeHash:
+		if cfg.Percentage <= 0 || cfg.Percentage > 100 {
+			return fmt.Errorf("percentage must be in the range (0, 100] in %s mode", cfg.Mode)
+		}
+		if cfg.Mode == modeHash && len(cfg.Fields) == 0 {
+			return errors.New("fields are required in hash mode")
+		}
+	case modeReservoir:
+		if cfg.Percentage != 0 {
+			return errors.New("percentage is not supported in reservoir mode")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q, must be one of %q, %q or %q", cfg.Mode, modeHead, modeHash, modeReservoir)
+	}
+	return nil
+}
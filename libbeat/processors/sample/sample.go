@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+const (
+	processorName = "sample"
+	logName       = "processor." + processorName
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+}
+
+type metrics struct {
+	Kept    *monitoring.Int
+	Dropped *monitoring.Int
+}
+
+type processor struct {
+	config
+	rate float64 // rate is the configured percentage as a fraction.
+
+	random func() float64
+	clock  clockwork.Clock
+
+	// mu protects the reservoirs, it is only used in reservoir mode.
+	mu         sync.Mutex
+	reservoirs *lru.Cache[string, *reservoir]
+
+	metrics metrics
+}
+
+// reservoir is the sampling state of a key in reservoir mode.
+type reservoir struct {
+	start time.Time // start of the current interval.
+	seen  int       // seen is the number of events in the current interval.
+	kept  int       // kept is the number of events kept in the current interval.
+	rate  float64   // rate is the probability to keep an event in the current interval.
+}
+
+// New constructs a new sample processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	var (
+		id  = int(instanceID.Add(1))
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+	p := &processor{
+		config: c,
+		rate:   c.Percentage / 100,
+		random: rand.Float64,
+		clock:  clockwork.NewRealClock(),
+		metrics: metrics{
+			Kept:    monitoring.NewInt(reg, "kept"),
+			Dropped: monitoring.NewInt(reg, "dropped"),
+		},
+	}
+	if c.Mode == modeReservoir {
+		reservoirs, err := lru.New[string, *reservoir](c.Reservoir.MaxKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %v reservoirs: %w", processorName, err)
+		}
+		p.reservoirs = reservoirs
+	}
+	return p, nil
+}
+
+// Run returns the event if it is part of the sample, or nil if it is
+// dropped.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	var (
+		keep bool
+		rate float64
+	)
+	switch p.Mode {
+	case modeHead:
+		keep, rate = p.random() < p.rate, p.rate
+	case modeHash:
+		keep, rate = p.sampleHash(event), p.rate
+	case modeReservoir:
+		keep, rate = p.sampleReservoir(event)
+	}
+	if !keep {
+		p.metrics.Dropped.Inc()
+		return nil, nil
+	}
+	p.metrics.Kept.Inc()
+
+	if p.RateField != "" {
+		// Combine the rate with the one of a previous sampling, so that
+		// the weight of the event stays accurate.
+		if v, err := event.GetValue(p.RateField); err == nil {
+			if prev, ok := v.(float64); ok {
+				rate *= prev
+			}
+		}
+		if _, err := event.PutValue(p.RateField, rate); err != nil {
+			return event, fmt.Errorf("failed to set %s: %w", p.RateField, err)
+		}
+	}
+	return event, nil
+}
+
+// sampleHash keeps the event if the hash of its key is in the sampled
+// part of the hash space. Events without any of the key fields are sampled
+// randomly.
+func (p *processor) sampleHash(event *beat.Event) bool {
+	if p.rate >= 1 {
+		return true
+	}
+	key, ok := p.key(event)
+	if !ok {
+		return p.random() < p.rate
+	}
+	return float64(xxhash.Sum64String(key)) < p.rate*math.MaxUint64
+}
+
+// sampleReservoir keeps at most Reservoir.Size events per key in each
+// interval. The events are kept with a probability estimated from the
+// number of events of the key in the previous interval, so that they are
+// spread over the interval. The returned rate is that probability, it is
+// only an estimate of the rate of the whole interval, which depends on the
+// number of events of the key that are still to come.
+func (p *processor) sampleReservoir(event *beat.Event) (bool, float64) {
+	key, _ := p.key(event)
+	now := p.clock.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r, ok := p.reservoirs.Get(key)
+	switch {
+	case !ok:
+		r = &reservoir{start: now, rate: 1}
+		p.reservoirs.Add(key, r)
+	case now.Sub(r.start) >= p.Reservoir.Interval:
+		elapsed := now.Sub(r.start) / p.Reservoir.Interval
+		r.rate = 1
+		if elapsed == 1 && r.seen > p.Reservoir.Size {
+			r.rate = float64(p.Reservoir.Size) / float64(r.seen)
+		}
+		r.start = r.start.Add(elapsed * p.Reservoir.Interval)
+		r.seen, r.kept = 0, 0
+	}
+
+	r.seen++
+	if r.kept >= p.Reservoir.Size || p.random() >= r.rate {
+		return false, 0
+	}
+	r.kept++
+	return true, r.rate
+}
+
+// key returns the sampling key of the event, and whether any of the key
+// fields is present.
+func (p *processor) key(event *beat.Event) (string, bool) {
+	var (
+		b     strings.Builder
+		found bool
+	)
+	for i, field := range p.Fields {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		v, err := event.GetValue(field)
+		if err != nil {
+			continue
+		}
+		found = true
+		fmt.Fprint(&b, v)
+	}
+	return b.String(), found
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("%v=[mode=%v, percentage=%v, fields=[%v]]",
+		processorName, p.Mode, p.Percentage, strings.Join(p.Fields, ", "))
+}
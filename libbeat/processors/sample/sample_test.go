@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newProcessor(t *testing.T, config mapstr.M) *processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(config))
+	require.NoError(t, err)
+	return p.(*processor)
+}
+
+func TestHead(t *testing.T) {
+	p := newProcessor(t, mapstr.M{"percentage": 25})
+	random := []float64{0.1, 0.3, 0.24, 0.9}
+	p.random = func() float64 {
+		r := random[0]
+		random = random[1:]
+		return r
+	}
+
+	var kept []beat.Event
+	for range 4 {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "x"}})
+		require.NoError(t, err)
+		if event != nil {
+			kept = append(kept, *event)
+		}
+	}
+	require.Len(t, kept, 2)
+	assert.Equal(t, mapstr.M{"message": "x", "sample": mapstr.M{"rate": 0.25}}, kept[0].Fields)
+	assert.Equal(t, int64(2), p.metrics.Kept.Get())
+	assert.Equal(t, int64(2), p.metrics.Dropped.Get())
+}
+
+func TestHash(t *testing.T) {
+	config := mapstr.M{"mode": "hash", "percentage": 10, "fields": []string{"trace.id"}, "rate_field": ""}
+	p1, p2 := newProcessor(t, config), newProcessor(t, config)
+
+	const n = 10000
+	kept := 0
+	for i := range n {
+		id := strconv.Itoa(i)
+		e1, err := p1.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": id}}})
+		require.NoError(t, err)
+		e2, err := p2.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": id}, "message": "other"}})
+		require.NoError(t, err)
+
+		// All events of a trace are kept or dropped together, by any instance.
+		require.Equal(t, e1 != nil, e2 != nil, "trace %s", id)
+		if e1 != nil {
+			kept++
+			assert.Equal(t, mapstr.M{"trace": mapstr.M{"id": id}}, e1.Fields)
+		}
+	}
+	assert.InDelta(t, n/10, kept, n/100)
+
+	// Events without the key are sampled randomly.
+	p1.random = func() float64 { return 0.05 }
+	event, err := p1.Run(&beat.Event{Fields: mapstr.M{"message": "x"}})
+	require.NoError(t, err)
+	assert.NotNil(t, event)
+}
+
+func TestReservoir(t *testing.T) {
+	p := newProcessor(t, mapstr.M{"mode": "reservoir", "fields": []string{"service.name"}, "reservoir": mapstr.M{"size": 2, "interval": "1m"}})
+	clock := clockwork.NewFakeClock()
+	p.clock = clock
+	p.random = func() float64 { return 0.3 }
+
+	run := func(service string, n int) []float64 {
+		var rates []float64
+		for range n {
+			event, err := p.Run(&beat.Event{Fields: mapstr.M{"service": mapstr.M{"name": service}}})
+			require.NoError(t, err)
+			if event != nil {
+				rate, err := event.GetValue("sample.rate")
+				require.NoError(t, err)
+				rates = append(rates, rate.(float64))
+			}
+		}
+		return rates
+	}
+
+	assert.Equal(t, []float64{1, 1}, run("a", 5))
+	assert.Equal(t, []float64{1}, run("b", 1))
+
+	// The probability to keep an event, and its rate, are estimated from
+	// the previous interval.
+	clock.Advance(time.Minute)
+	assert.Equal(t, []float64{0.4, 0.4}, run("a", 5))
+	assert.Equal(t, []float64{1}, run("b", 1))
+	p.random = func() float64 { return 0.5 }
+	assert.Empty(t, run("a", 5))
+
+	// Keys idle for more than an interval start over.
+	clock.Advance(3 * time.Minute)
+	assert.Equal(t, []float64{1, 1}, run("a", 3))
+}
+
+func TestRateWeights(t *testing.T) {
+	// The sum of the inverse of the rates of the kept events estimates
+	// the number of events.
+	for _, config := range []mapstr.M{
+		{"mode": "head", "percentage": 10},
+		{"mode": "hash", "percentage": 10, "fields": []string{"trace.id"}},
+	} {
+		t.Run(config["mode"].(string), func(t *testing.T) {
+			p := newProcessor(t, config)
+
+			const n = 10000
+			var sum float64
+			for i := range n {
+				event, err := p.Run(&beat.Event{Fields: mapstr.M{"trace": mapstr.M{"id": strconv.Itoa(i)}}})
+				require.NoError(t, err)
+				if event != nil {
+					rate, err := event.GetValue("sample.rate")
+					require.NoError(t, err)
+					sum += 1 / rate.(float64)
+				}
+			}
+			assert.InEpsilon(t, n, sum, 0.1)
+		})
+	}
+}
+
+func TestRateField(t *testing.T) {
+	p := newProcessor(t, mapstr.M{"percentage": 50, "rate_field": "weight.rate"})
+	p.random = func() float64 { return 0 }
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"weight": mapstr.M{"rate": 0.5}}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"weight": mapstr.M{"rate": 0.25}}, event.Fields)
+}
+
+func TestConfig(t *testing.T) {
+	tests := map[string]struct {
+		config mapstr.M
+		err    string
+	}{
+		"missing percentage": {
+			config: mapstr.M{},
+			err:    "percentage must be in the range (0, 100] in head mode",
+		},
+		"percentage too high": {
+			config: mapstr.M{"mode": "hash", "percentage": 101, "fields": []string{"trace.id"}},
+			err:    "percentage must be in the range (0, 100] in hash mode",
+		},
+		"hash without fields": {
+			config: mapstr.M{"mode": "hash", "percentage": 10},
+			err:    "fields are required in hash mode",
+		},
+		"reservoir with percentage": {
+			config: mapstr.M{"mode": "reservoir", "percentage": 10},
+			err:    "percentage is not supported in reservoir mode",
+		},
+		"invalid reservoir size": {
+			config: mapstr.M{"mode": "reservoir", "reservoir": mapstr.M{"size": 0}},
+			err:    "zero value accessing 'reservoir.size'",
+		},
+		"invalid mode": {
+			config: mapstr.M{"mode": "tail", "percentage": 10},
+			err:    `invalid mode "tail"`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(test.config))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
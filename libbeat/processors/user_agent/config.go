@@ -0,0 +1,42 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+type config struct {
+	Field         string      `config:"field"`
+	TargetField   string      `config:"target_field"`
+	RegexesFile   string      `config:"regexes_file"`
+	IgnoreMissing bool        `config:"ignore_missing"`
+	Cache         cacheConfig `config:"cache"`
+}
+
+type cacheConfig struct {
+	// Size is the maximum number of parsed user-agent strings kept.
+	// When it is reached, the least recently used result is evicted.
+	Size int `config:"size" validate:"min=1"`
+}
+
+func defaultConfig() config {
+	return config{
+		Field:       "user_agent.original",
+		TargetField: "user_agent",
+		Cache: cacheConfig{
+			Size: 1000,
+		},
+	}
+}
@@ -0,0 +1,200 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed regexes.yaml
+var defaultRegexes []byte
+
+// regexesFile is a regexes file in the format of the ua-parser project.
+type regexesFile struct {
+	UserAgentParsers []regexDef `yaml:"user_agent_parsers"`
+	OSParsers        []regexDef `yaml:"os_parsers"`
+	DeviceParsers    []regexDef `yaml:"device_parsers"`
+}
+
+type regexDef struct {
+	Regex string `yaml:"regex"`
+	Flag  string `yaml:"regex_flag"`
+
+	FamilyReplacement string `yaml:"family_replacement"`
+	V1Replacement     string `yaml:"v1_replacement"`
+	V2Replacement     string `yaml:"v2_replacement"`
+	V3Replacement     string `yaml:"v3_replacement"`
+
+	OSReplacement   string `yaml:"os_replacement"`
+	OSV1Replacement string `yaml:"os_v1_replacement"`
+	OSV2Replacement string `yaml:"os_v2_replacement"`
+	OSV3Replacement string `yaml:"os_v3_replacement"`
+	OSV4Replacement string `yaml:"os_v4_replacement"`
+
+	DeviceReplacement string `yaml:"device_replacement"`
+}
+
+// matcher is a compiled regex with the replacements of its fields.
+// A field is taken from the match group of the same index when its
+// replacement is empty and the index is not zero.
+type matcher struct {
+	re           *regexp.Regexp
+	replacements []string
+}
+
+// parser parses user-agent strings.
+type parser struct {
+	agents  []matcher
+	os      []matcher
+	devices []matcher
+}
+
+// userAgent is the result of parsing a user-agent string.
+type userAgent struct {
+	name, major, minor, patch                   string
+	os, osMajor, osMinor, osPatch, osPatchMinor string
+	device                                      string
+}
+
+// loadParser returns a parser for the regexes in the file at path, or for
+// the embedded regexes if path is empty.
+func loadParser(path string) (*parser, error) {
+	data := defaultRegexes
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read regexes file: %w", err)
+		}
+	}
+	var f regexesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse regexes file: %w", err)
+	}
+
+	var (
+		p   parser
+		err error
+	)
+	p.agents, err = compile("user_agent_parsers", f.UserAgentParsers, func(d regexDef) []string {
+		return []string{d.FamilyReplacement, d.V1Replacement, d.V2Replacement, d.V3Replacement}
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.os, err = compile("os_parsers", f.OSParsers, func(d regexDef) []string {
+		return []string{d.OSReplacement, d.OSV1Replacement, d.OSV2Replacement, d.OSV3Replacement, d.OSV4Replacement}
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.devices, err = compile("device_parsers", f.DeviceParsers, func(d regexDef) []string {
+		return []string{or(d.DeviceReplacement, "$1")}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func compile(section string, defs []regexDef, replacements func(regexDef) []string) ([]matcher, error) {
+	matchers := make([]matcher, 0, len(defs))
+	for i, d := range defs {
+		expr := d.Regex
+		if strings.Contains(d.Flag, "i") {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %d of %s: %w", i, section, err)
+		}
+		matchers = append(matchers, matcher{re: re, replacements: replacements(d)})
+	}
+	return matchers, nil
+}
+
+// match returns the fields of the first matcher matching s, or nil.
+func match(matchers []matcher, s string) []string {
+	for _, m := range matchers {
+		groups := m.re.FindStringSubmatch(s)
+		if groups == nil {
+			continue
+		}
+		fields := make([]string, len(m.replacements))
+		for i, r := range m.replacements {
+			switch {
+			case r != "":
+				fields[i] = strings.TrimSpace(expand(r, groups))
+			case i+1 < len(groups):
+				// The name is in group 1 and the version parts follow.
+				fields[i] = groups[i+1]
+			}
+		}
+		return fields
+	}
+	return nil
+}
+
+// expand replaces $1 to $9 in r with the match groups.
+func expand(r string, groups []string) string {
+	if !strings.Contains(r, "$") {
+		return r
+	}
+	var b strings.Builder
+	for i := 0; i < len(r); i++ {
+		if r[i] == '$' && i+1 < len(r) && r[i+1] >= '1' && r[i+1] <= '9' {
+			n, _ := strconv.Atoi(r[i+1 : i+2])
+			if n < len(groups) {
+				b.WriteString(groups[n])
+			}
+			i++
+			continue
+		}
+		b.WriteByte(r[i])
+	}
+	return b.String()
+}
+
+// parse parses a user-agent string.
+func (p *parser) parse(s string) userAgent {
+	var ua userAgent
+	if f := match(p.agents, s); f != nil {
+		ua.name, ua.major, ua.minor, ua.patch = f[0], f[1], f[2], f[3]
+	}
+	if f := match(p.os, s); f != nil {
+		ua.os, ua.osMajor, ua.osMinor, ua.osPatch, ua.osPatchMinor = f[0], f[1], f[2], f[3], f[4]
+	}
+	if f := match(p.devices, s); f != nil {
+		ua.device = f[0]
+	}
+	return ua
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestParse(t *testing.T) {
+	p, err := loadParser("")
+	require.NoError(t, err)
+
+	cases := map[string]mapstr.M{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.130 Safari/537.36": {
+			"name": "Chrome", "version": "120.0.6099",
+			"os":     mapstr.M{"name": "Windows", "version": "10", "full": "Windows 10"},
+			"device": mapstr.M{"name": "Other"},
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91": {
+			"name": "Edge", "version": "120.0.2210",
+			"os":     mapstr.M{"name": "Windows", "version": "10", "full": "Windows 10"},
+			"device": mapstr.M{"name": "Other"},
+		},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15": {
+			"name": "Safari", "version": "17.2",
+			"os":     mapstr.M{"name": "Mac OS X", "version": "10.15.7", "full": "Mac OS X 10.15.7"},
+			"device": mapstr.M{"name": "Mac"},
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1": {
+			"name": "Mobile Safari", "version": "17.2",
+			"os":     mapstr.M{"name": "iOS", "version": "17.2", "full": "iOS 17.2"},
+			"device": mapstr.M{"name": "iPhone"},
+		},
+		"Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36": {
+			"name": "Chrome Mobile", "version": "120.0.6099",
+			"os":     mapstr.M{"name": "Android", "version": "14", "full": "Android 14"},
+			"device": mapstr.M{"name": "Samsung SM-S918B"},
+		},
+		"Mozilla/5.0 (Linux; Android 13; Pixel 7 Build/TQ3A.230901.001) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/118.0.0.0 Mobile Safari/537.36": {
+			"name": "Chrome Mobile", "version": "118.0.0",
+			"os":     mapstr.M{"name": "Android", "version": "13", "full": "Android 13"},
+			"device": mapstr.M{"name": "Pixel 7"},
+		},
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0": {
+			"name": "Firefox", "version": "121.0",
+			"os":     mapstr.M{"name": "Ubuntu", "full": "Ubuntu"},
+			"device": mapstr.M{"name": "Other"},
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			"name": "Googlebot", "version": "2.1",
+			"device": mapstr.M{"name": "Spider"},
+		},
+		"curl/8.4.0": {
+			"name": "curl", "version": "8.4.0",
+			"device": mapstr.M{"name": "Other"},
+		},
+		"Elastic-Heartbeat/8.17.0 (linux; amd64; abc; 2025-01-01 00:00:00 +0000 UTC)": {
+			"name": "Elastic-Heartbeat", "version": "8.17.0",
+			"device": mapstr.M{"name": "Other"},
+		},
+		"something unknown": {
+			"name":   "Other",
+			"device": mapstr.M{"name": "Other"},
+		},
+	}
+	for ua, want := range cases {
+		assert.Equal(t, want, toFields(p.parse(ua)), ua)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	groups := []string{"all", "a", "b"}
+	// Missing groups are replaced with an empty string.
+	assert.Equal(t, "x a-b  $", expand("x $1-$2 $3 $", groups))
+	assert.Equal(t, "plain", expand("plain", groups))
+}
@@ -0,0 +1,131 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const processorName = "user_agent"
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("UserAgent", New)
+}
+
+type processor struct {
+	config config
+	parser *parser
+	cache  *lru.Cache[string, mapstr.M]
+}
+
+// New constructs a new user_agent processor.
+func New(cfg *conf.C) (beat.Processor, error) {
+	c := defaultConfig()
+	if err := cfg.Unpack(&c); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	p, err := loadParser(c.RegexesFile)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := lru.New[string, mapstr.M](c.Cache.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %v cache: %w", processorName, err)
+	}
+	return &processor{config: c, parser: p, cache: cache}, nil
+}
+
+// Run parses the user-agent string of the configured field and adds the
+// ECS user_agent fields to the event.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, err
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field)
+	}
+
+	fields, ok := p.cache.Get(s)
+	if !ok {
+		fields = toFields(p.parser.parse(s))
+		p.cache.Add(s, fields)
+	}
+	var target mapstr.M
+	if p.config.TargetField != "" {
+		target = mapstr.M{p.config.TargetField: fields.Clone()}
+	} else {
+		target = fields.Clone()
+	}
+	event.Fields.DeepUpdate(target)
+	return event, nil
+}
+
+// toFields maps a parsed user-agent to ECS user_agent fields. Like the
+// Elasticsearch user_agent processor, unknown names are reported as Other.
+func toFields(ua userAgent) mapstr.M {
+	fields := mapstr.M{
+		"name":   or(ua.name, "Other"),
+		"device": mapstr.M{"name": or(ua.device, "Other")},
+	}
+	if version := joinVersion(ua.major, ua.minor, ua.patch); version != "" {
+		fields["version"] = version
+	}
+	if ua.os != "" {
+		os := mapstr.M{"name": ua.os, "full": ua.os}
+		if version := joinVersion(ua.osMajor, ua.osMinor, ua.osPatch, ua.osPatchMinor); version != "" {
+			os["version"] = version
+			os["full"] = ua.os + " " + version
+		}
+		fields["os"] = os
+	}
+	return fields
+}
+
+// joinVersion joins the leading non-empty version parts with dots.
+func joinVersion(parts ...string) string {
+	for i, p := range parts {
+		if p == "" {
+			parts = parts[:i]
+			break
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (p *processor) String() string {
+	return fmt.Sprintf("%v=[field=%v, target_field=%v, regexes_file=%v]",
+		processorName, p.config.Field, p.config.TargetField, p.config.RegexesFile)
+}
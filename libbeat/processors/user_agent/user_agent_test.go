@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+func TestProcessor(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{}))
+	require.NoError(t, err)
+
+	for range 2 {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": firefox}}})
+		require.NoError(t, err)
+		assert.Equal(t, mapstr.M{"user_agent": mapstr.M{
+			"original": firefox,
+			"name":     "Firefox",
+			"version":  "121.0",
+			"os":       mapstr.M{"name": "Linux", "full": "Linux"},
+			"device":   mapstr.M{"name": "Other"},
+		}}, event.Fields)
+
+		// Cached results are not shared between events.
+		event.Fields.Put("user_agent.os.name", "changed")
+	}
+	assert.Equal(t, 1, p.(*processor).cache.Len())
+}
+
+func TestProcessorConfig(t *testing.T) {
+	regexes := filepath.Join(t.TempDir(), "regexes.yaml")
+	err := os.WriteFile(regexes, []byte(`
+user_agent_parsers:
+  - regex: '(MyApp)/(\d+)'
+    family_replacement: 'My $1'
+os_parsers: []
+device_parsers:
+  - regex: 'kiosk'
+    regex_flag: 'i'
+    device_replacement: 'Kiosk'
+`), 0o600)
+	require.NoError(t, err)
+
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{
+		"field":          "http.request.headers.user_agent",
+		"target_field":   "ua",
+		"regexes_file":   regexes,
+		"ignore_missing": true,
+	}))
+	require.NoError(t, err)
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"http": mapstr.M{"request": mapstr.M{"headers": mapstr.M{"user_agent": "MyApp/3 (KIOSK)"}}}}})
+	require.NoError(t, err)
+	ua, err := event.GetValue("ua")
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"name": "My MyApp", "version": "3", "device": mapstr.M{"name": "Kiosk"}}, ua)
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "x"}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"message": "x"}, event.Fields)
+
+	_, err = New(conf.MustNewConfigFrom(mapstr.M{"regexes_file": filepath.Join(t.TempDir(), "missing.yaml")}))
+	assert.ErrorContains(t, err, "failed to read regexes file")
+
+	require.NoError(t, os.WriteFile(regexes, []byte("user_agent_parsers:\n  - regex: '(?<!x)'\n"), 0o600))
+	_, err = New(conf.MustNewConfigFrom(mapstr.M{"regexes_file": regexes}))
+	assert.ErrorContains(t, err, "invalid regex 0 of user_agent_parsers")
+}
+
+func TestProcessorMissing(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{}))
+	require.NoError(t, err)
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "x"}})
+	assert.ErrorContains(t, err, "key not found")
+}
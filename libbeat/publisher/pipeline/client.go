@@ -26,6 +26,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
 
@@ -37,6 +38,11 @@ type client struct {
 	mutex      sync.Mutex
 	waiter     *clientCloseWaiter
 
+	// emitters are the client processors publishing events of their own,
+	// emitted are the processors applied to these events.
+	emitters []processors.Emitter
+	emitted  beat.Processor
+
 	eventFlags publisher.EventFlags
 	canDrop    bool
 
@@ -46,6 +52,9 @@ type client struct {
 	observer       observer
 	eventListener  beat.EventListener
 	clientListener beat.ClientListener
+
+	tap     *tap.Hub
+	inputID string
 }
 
 type clientCloseWaiter struct {
@@ -74,11 +83,6 @@ func (c *client) Publish(e beat.Event) {
 }
 
 func (c *client) publish(e beat.Event) {
-	var (
-		event   = &e
-		publish = true
-	)
-
 	c.onNewEvent()
 
 	if !c.isOpen.Load() {
@@ -87,10 +91,34 @@ func (c *client) publish(e beat.Event) {
 		return
 	}
 
-	if c.processors != nil {
+	c.process(e, c.processors)
+}
+
+// publishEmitted publishes an event emitted by one of the client processors.
+// Emitted events are accepted while the client is closing, as processors
+// publish their pending events when they are closed.
+func (c *client) publishEmitted(e beat.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.onNewEvent()
+	c.process(e, c.emitted)
+}
+
+func (c *client) process(e beat.Event, procs beat.Processor) {
+	var (
+		event   = &e
+		publish = true
+	)
+
+	if c.tap.Active(tap.BeforeProcessors) {
+		c.tap.Publish(tap.BeforeProcessors, c.inputID, event)
+	}
+
+	if procs != nil {
 		var err error
 
-		event, err = c.processors.Run(event)
+		event, err = procs.Run(event)
 		publish = event != nil
 		if err != nil {
 			// If we introduce a dead-letter queue, this is where we should
@@ -110,6 +138,9 @@ func (c *client) publish(e beat.Event) {
 	}
 
 	e = *event
+	if c.tap.Active(tap.AfterProcessors) {
+		c.tap.Publish(tap.AfterProcessors, c.inputID, event)
+	}
 	pubEvent := publisher.Event{
 		Content: e,
 		Flags:   c.eventFlags,
@@ -134,6 +165,12 @@ func (c *client) Close() error {
 		// Only do shutdown handling the first time Close is called
 		c.onClosing()
 
+		// Processors emitting events publish their pending events when
+		// closed, so they are closed while the producer is still open.
+		if len(c.emitters) > 0 {
+			c.closeProcessors()
+		}
+
 		c.logger.Debug("client: closing acker")
 		c.waiter.signalClose()
 		c.waiter.wait()
@@ -146,18 +183,24 @@ func (c *client) Close() error {
 		c.onClosed()
 		c.logger.Debug("client: done producer close")
 
-		if c.processors != nil {
-			c.logger.Debug("client: closing processors")
-			err := processors.Close(c.processors)
-			if err != nil {
-				c.logger.Errorf("client: error closing processors: %v", err)
-			}
-			c.logger.Debug("client: done closing processors")
+		if len(c.emitters) == 0 {
+			c.closeProcessors()
 		}
 	}
 	return nil
 }
 
+func (c *client) closeProcessors() {
+	if c.processors != nil {
+		c.logger.Debug("client: closing processors")
+		err := processors.Close(c.processors)
+		if err != nil {
+			c.logger.Errorf("client: error closing processors: %v", err)
+		}
+		c.logger.Debug("client: done closing processors")
+	}
+}
+
 func (c *client) onClosing() {
 	c.clientListener.Closing()
 }
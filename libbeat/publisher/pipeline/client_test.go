@@ -35,6 +35,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 	"github.com/elastic/beats/v7/libbeat/tests/resources"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
@@ -191,6 +192,109 @@ func TestClient(t *testing.T) {
 	})
 }
 
+func TestClientTap(t *testing.T) {
+	hub := tap.NewHub()
+	before, err := hub.Subscribe(tap.Filter{Stage: tap.BeforeProcessors, InputID: "my-input"})
+	require.NoError(t, err)
+	defer before.Close()
+	after, err := hub.Subscribe(tap.Filter{Stage: tap.AfterProcessors})
+	require.NoError(t, err)
+	defer after.Close()
+	otherInput, err := hub.Subscribe(tap.Filter{Stage: tap.BeforeProcessors, InputID: "other-input"})
+	require.NoError(t, err)
+	defer otherInput.Close()
+
+	logger := logptest.NewTestingLogger(t, "")
+	q := memqueue.NewQueue(logger, nil, memqueue.Settings{
+		Events:        5,
+		MaxGetRequest: 1,
+		FlushTimeout:  time.Millisecond,
+	}, 5, nil)
+	processor := &testProcessor{processorFn: func(in *beat.Event) (*beat.Event, error) {
+		_, err := in.Fields.Put("processed", true)
+		return in, err
+	}}
+	p, err := New(beat.Info{Logger: logger},
+		Monitors{Tap: hub},
+		conf.Namespace{},
+		outputs.Group{},
+		Settings{Processors: testProcessorSupporter{Processor: processor}},
+	)
+	require.NoError(t, err)
+	p.outputController.queue = q
+	defer p.Close()
+
+	client, err := p.ConnectWith(beat.ClientConfig{InputID: "my-input"})
+	require.NoError(t, err)
+	defer client.Close()
+	client.Publish(beat.Event{
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Fields:    mapstr.M{"message": "hello"},
+	})
+
+	record := <-before.Records()
+	assert.Equal(t, "before_processors", record.Stage)
+	assert.Equal(t, "my-input", record.InputID)
+	assert.JSONEq(t, `{"@timestamp":"2024-01-01T00:00:00Z","message":"hello"}`, string(record.Event))
+
+	record = <-after.Records()
+	assert.Equal(t, "after_processors", record.Stage)
+	assert.JSONEq(t, `{"@timestamp":"2024-01-01T00:00:00Z","message":"hello","processed":true}`, string(record.Event))
+
+	assert.Empty(t, otherInput.Records())
+}
+
+func TestClientEmitter(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	q := memqueue.NewQueue(logger, nil, memqueue.Settings{
+		Events:        5,
+		MaxGetRequest: 1,
+		FlushTimeout:  time.Millisecond,
+	}, 5, nil)
+	var seen []mapstr.M
+	global := &testProcessor{processorFn: func(in *beat.Event) (*beat.Event, error) {
+		seen = append(seen, in.Fields.Clone())
+		return in, nil
+	}}
+	p, err := New(beat.Info{Logger: logger},
+		Monitors{},
+		conf.Namespace{},
+		outputs.Group{},
+		Settings{Processors: emitterProcessorSupporter{global: global}},
+	)
+	require.NoError(t, err)
+	p.outputController.queue = q
+	defer p.Close()
+
+	emitter, second := &testEmitter{}, &testEmitter{}
+	listener := &mockClientListener{}
+	procs := processors.NewList(logger)
+	procs.AddProcessor(emitter)
+	procs.AddProcessor(second)
+	client, err := p.ConnectWith(beat.ClientConfig{
+		ClientListener: listener,
+		Processing:     beat.ProcessingConfig{Processor: procs},
+		InputID:        "my-input",
+	})
+	require.NoError(t, err)
+	require.NotNil(t, emitter.emit)
+	assert.Equal(t, "my-input", emitter.inputID)
+	assert.Equal(t, 0, emitter.index)
+	assert.Equal(t, 1, second.index, "emitters should get their position in the client processors")
+
+	client.Publish(beat.Event{Fields: mapstr.M{"message": "hello"}})
+
+	// The emitters publish their summary when closed, the summaries skip
+	// the client processors.
+	client.Close()
+	assert.Equal(t, []mapstr.M{
+		{"message": "hello", "emitter": "seen"},
+		{"count": 1},
+		{"count": 1},
+	}, seen)
+	assert.Equal(t, 3, listener.eventsPublished)
+}
+
 func TestClientWaitClose(t *testing.T) {
 	logger := logptest.NewTestingLogger(t, "")
 	makePipeline := func(settings Settings, qu queue.Queue) *Pipeline {
@@ -487,6 +591,57 @@ func (p testProcessorSupporter) Close() error {
 	return processors.Close(p.Processor)
 }
 
+// testEmitter counts the events it sees and emits their count when closed.
+type testEmitter struct {
+	inputID string
+	index   int
+	emit    func(beat.Event)
+	count   int
+}
+
+func (p *testEmitter) String() string {
+	return "testEmitter"
+}
+
+func (p *testEmitter) Run(in *beat.Event) (*beat.Event, error) {
+	p.count++
+	_, err := in.Fields.Put("emitter", "seen")
+	return in, err
+}
+
+func (p *testEmitter) SetEmitter(inputID string, index int, emit func(beat.Event)) {
+	p.inputID, p.index, p.emit = inputID, index, emit
+}
+
+func (p *testEmitter) Close() error {
+	p.emit(beat.Event{Fields: mapstr.M{"count": p.count}})
+	return nil
+}
+
+// emitterProcessorSupporter runs the client processors followed by a
+// global processor.
+type emitterProcessorSupporter struct {
+	global beat.Processor
+}
+
+func (p emitterProcessorSupporter) Create(cfg beat.ProcessingConfig, drop bool) (beat.Processor, error) {
+	if cfg.Processor == nil {
+		return p.global, nil
+	}
+	procs := processors.NewList(nil)
+	procs.AddProcessor(cfg.Processor)
+	procs.AddProcessor(p.global)
+	return procs, nil
+}
+
+func (p emitterProcessorSupporter) Processors() []string {
+	return []string{p.global.String()}
+}
+
+func (p emitterProcessorSupporter) Close() error {
+	return nil
+}
+
 type mockClientListener struct {
 	eventsTotal            int
 	eventsFiltered         int
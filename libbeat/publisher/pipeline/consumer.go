@@ -22,6 +22,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
 
@@ -74,11 +75,12 @@ type retryRequest struct {
 func newEventConsumer(
 	log *logp.Logger,
 	observer retryObserver,
+	tap *tap.Hub,
 ) *eventConsumer {
 	c := &eventConsumer{
 		logger:        log,
 		retryObserver: observer,
-		queueReader:   makeQueueReader(),
+		queueReader:   makeQueueReader(tap),
 
 		targetChan: make(chan consumerTarget),
 		retryChan:  make(chan retryRequest),
@@ -18,6 +18,8 @@
 package pipeline
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/periodic"
 )
 
 // outputController manages the pipelines output capabilities, like:
@@ -53,6 +56,22 @@ type outputController struct {
 	// is called.
 	queueFactory queue.QueueFactory
 
+	// routeQueueFactory, if set, returns the factory used to create the
+	// queue of an output route that doesn't configure its own queue.
+	// Otherwise queueFactory is used.
+	routeQueueFactory func(route string) queue.QueueFactory
+
+	// router is set instead of queue if the output group has routes. Each
+	// route is handled by its own outputController.
+	router *outputRouter
+
+	// The retryObserver is passed on to the outputControllers of routes.
+	retryObserver retryObserver
+
+	// queueMetrics overrides the registry the queue metrics are reported
+	// under, it is set for the outputControllers of routes.
+	queueMetrics *monitoring.Registry
+
 	// consumer is a helper goroutine that reads event batches from the queue
 	// and sends them to workerChan for an output worker to process.
 	consumer *eventConsumer
@@ -93,8 +112,9 @@ func newOutputController(
 		beat:           beat,
 		monitors:       monitors,
 		queueFactory:   queueFactory,
+		retryObserver:  retryObserver,
 		workerChan:     make(chan publisher.Batch),
-		consumer:       newEventConsumer(monitors.Logger, retryObserver),
+		consumer:       newEventConsumer(monitors.Logger, retryObserver, monitors.Tap),
 		inputQueueSize: inputQueueSize,
 	}
 
@@ -121,6 +141,27 @@ func (c *outputController) WaitClose(timeout time.Duration) error {
 }
 
 func (c *outputController) Set(outGrp outputs.Group) {
+	if err := c.set(outGrp); err != nil {
+		c.monitors.Logger.Errorf("outputController failed to set the output: %v", err)
+	}
+}
+
+// set sets the output group. It returns an error if the change can't be
+// applied while the beat is running, the previous output then keeps
+// running.
+func (c *outputController) set(outGrp outputs.Group) error {
+	if len(outGrp.Routes) > 0 {
+		return c.setRoutes(outGrp.Routes)
+	}
+	if router := c.activeRouter(); router != nil {
+		if len(outGrp.Clients) > 0 {
+			return errors.New("an output with routes can't be replaced by an output " +
+				"without routes while the beat is running, restart the beat to apply the change")
+		}
+		router.pause()
+		return nil
+	}
+
 	c.createQueueIfNeeded(outGrp)
 
 	// Set consumer to empty target to pause it while we reload
@@ -159,6 +200,7 @@ func (c *outputController) Set(outGrp outputs.Group) {
 			batchSize:  outGrp.BatchSize,
 			timeToLive: outGrp.Retry + 1,
 		})
+	return nil
 }
 
 // Reload the output
@@ -182,16 +224,32 @@ func (c *outputController) Reload(
 		return err
 	}
 
-	c.Set(output)
+	if err := c.set(output); err != nil {
+		closeGroup(output)
+		return err
+	}
 
 	return nil
 }
 
+// closeGroup closes the clients of an output group that was not set.
+func closeGroup(outGrp outputs.Group) {
+	for _, client := range outGrp.Clients {
+		client.Close()
+	}
+	for _, route := range outGrp.Routes {
+		closeGroup(route.Group)
+	}
+}
+
 // Close the queue, waiting up to the specified timeout for pending events
 // to complete.
 func (c *outputController) closeQueue(timeout time.Duration) {
 	c.queueLock.Lock()
 	defer c.queueLock.Unlock()
+	if c.router != nil {
+		c.router.waitClose(timeout)
+	}
 	if c.queue != nil {
 		c.queue.Close()
 		select {
@@ -220,6 +278,10 @@ func (c *outputController) queueProducer(config queue.ProducerConfig) queue.Prod
 		return emptyProducer{}
 	}
 	c.queueLock.Lock()
+	if c.router != nil {
+		defer c.queueLock.Unlock()
+		return c.router.producer(config)
+	}
 	if c.queue != nil {
 		// We defer the unlock only after the nil check because if the
 		// queue doesn't exist we'll need to block until it does, and
@@ -261,15 +323,7 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	if factory == nil {
 		factory = c.queueFactory
 	}
-	// Queue metrics are reported under the pipeline namespace
-	var pipelineMetrics *monitoring.Registry
-	if c.monitors.Metrics != nil {
-		pipelineMetrics = c.monitors.Metrics.GetRegistry("pipeline")
-		if pipelineMetrics == nil {
-			pipelineMetrics = c.monitors.Metrics.NewRegistry("pipeline")
-		}
-	}
-	queueObserver := queue.NewQueueObserver(pipelineMetrics)
+	queueObserver := queue.NewQueueObserver(c.queueMetricsRegistry())
 
 	queue, err := factory(logger, queueObserver, c.inputQueueSize, outGrp.EncoderFactory)
 	if err != nil {
@@ -292,6 +346,97 @@ func (c *outputController) createQueueIfNeeded(outGrp outputs.Group) {
 	c.pendingRequests = nil
 }
 
+// Queue metrics are reported under the pipeline namespace, unless
+// queueMetrics is set.
+func (c *outputController) queueMetricsRegistry() *monitoring.Registry {
+	if c.queueMetrics != nil {
+		return c.queueMetrics
+	}
+	if c.monitors.Metrics == nil {
+		return nil
+	}
+	return getOrCreateRegistry(c.monitors.Metrics, "pipeline")
+}
+
+func (c *outputController) activeRouter() *outputRouter {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+	return c.router
+}
+
+// setRoutes creates an outputController for each route and unblocks the
+// callers waiting for a producer. If routes are already active, the
+// outputControllers of the routes are updated instead, keeping their
+// queues. The set of route names can't change then, and an output without
+// routes can't be replaced by routes once its queue was created.
+func (c *outputController) setRoutes(routes []outputs.Route) error {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+
+	for _, route := range routes {
+		if len(route.Group.Clients) == 0 {
+			return fmt.Errorf("output route '%v' has no clients", route.Name)
+		}
+	}
+	if c.router != nil {
+		return c.router.update(routes)
+	}
+	if c.queue != nil {
+		return errors.New("an output without routes can't be replaced by an output " +
+			"with routes while the beat is running, restart the beat to apply the change")
+	}
+
+	router := &outputRouter{unrouted: &monitoring.Uint{}}
+	if pipelineMetrics := c.queueMetricsRegistry(); pipelineMetrics != nil {
+		router.unrouted = monitoring.NewUint(pipelineMetrics, "events.unrouted")
+	}
+	logger := c.monitors.Logger
+	router.pLogUnrouted = periodic.NewDoer(10*time.Second, func(count uint64, d time.Duration) {
+		logger.Debugf("Dropped %d events in last %s that match no output route", count, d)
+	})
+	router.pLogUnrouted.Start()
+	for _, route := range routes {
+		factory := c.queueFactory
+		if c.routeQueueFactory != nil {
+			factory = c.routeQueueFactory(route.Name)
+		}
+		monitors := c.monitors
+		monitors.Telemetry = nil
+		controller, _ := newOutputController(c.beat, monitors, c.retryObserver, factory, c.inputQueueSize)
+		if pipelineMetrics := c.queueMetricsRegistry(); pipelineMetrics != nil {
+			// Route queue metrics are reported under pipeline.routes.<name>
+			controller.queueMetrics = getOrCreateRegistry(
+				getOrCreateRegistry(pipelineMetrics, "routes"), route.Name)
+		}
+		controller.Set(route.Group)
+
+		router.routes = append(router.routes, outputRoute{
+			name:       route.Name,
+			condition:  route.Condition,
+			controller: controller,
+		})
+	}
+	c.router = router
+
+	if c.monitors.Telemetry != nil {
+		queueReg := c.monitors.Telemetry.NewRegistry("queue")
+		monitoring.NewString(queueReg, "name").Set("routes")
+	}
+
+	for _, req := range c.pendingRequests {
+		req.responseChan <- c.router.producer(req.config)
+	}
+	c.pendingRequests = nil
+	return nil
+}
+
+func getOrCreateRegistry(parent *monitoring.Registry, name string) *monitoring.Registry {
+	if reg := parent.GetRegistry(name); reg != nil {
+		return reg
+	}
+	return parent.NewRegistry(name)
+}
+
 // emptyProducer is a placeholder queue producer that is used only when
 // publishDisabled is set, so beats don't block forever waiting for
 // a producer for a nonexistent queue.
@@ -25,6 +25,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/monitoring"
 )
@@ -43,6 +44,9 @@ type Monitors struct {
 	Telemetry *monitoring.Registry
 	Logger    *logp.Logger
 	Tracer    *apm.Tracer
+	// Tap receives samples of the events at the different pipeline
+	// stages for debugging. It is optional.
+	Tap *tap.Hub
 }
 
 // OutputFactory is used by the publisher pipeline to create an output instance.
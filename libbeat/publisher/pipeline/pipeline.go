@@ -28,6 +28,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/common/acker"
 	"github.com/elastic/beats/v7/libbeat/common/reload"
 	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
@@ -150,6 +151,8 @@ func New(
 	if err != nil {
 		return nil, err
 	}
+	output.routeQueueFactory = routeQueueFactoryForUserConfig(
+		queueType, userQueueConfig.Config(), queueFactory)
 	p.outputController = output
 	p.outputController.Set(out)
 
@@ -203,6 +206,19 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 
 	waitClose := cfg.WaitClose
 
+	// Events emitted by the client processors skip them and only go
+	// through the pipeline processors.
+	var emittedProcessors beat.Processor
+	emitters := processors.Emitters(cfg.Processing.Processor)
+	if len(emitters) > 0 {
+		emittedCfg := cfg.Processing
+		emittedCfg.Processor = nil
+		emittedProcessors, err = p.createEventProcessing(emittedCfg, publishDisabled)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	processors, err := p.createEventProcessing(cfg.Processing, publishDisabled)
 	if err != nil {
 		return nil, err
@@ -217,9 +233,13 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		logger:         p.monitors.Logger,
 		clientListener: clientListener,
 		processors:     processors,
+		emitters:       emitters,
+		emitted:        emittedProcessors,
 		eventFlags:     eventFlags,
 		canDrop:        canDrop,
 		observer:       p.observer,
+		tap:            p.monitors.Tap,
+		inputID:        cfg.InputID,
 	}
 
 	client.isOpen.Store(true)
@@ -243,6 +263,7 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 				ackHandler.ACKEvents(count)
 			}
 		},
+		Priority: cfg.Priority,
 	}
 
 	if ackHandler == nil {
@@ -258,6 +279,10 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		return nil, fmt.Errorf("client failed to connect because the pipeline is shutting down")
 	}
 
+	for i, e := range emitters {
+		e.SetEmitter(cfg.InputID, i, client.publishEmitted)
+	}
+
 	p.observer.clientConnected()
 	return client, nil
 }
@@ -305,3 +330,21 @@ func (n noopClientListener) NewEvent()                   {}
 func (n noopClientListener) Filtered()                   {}
 func (n noopClientListener) Published()                  {}
 func (n noopClientListener) DroppedOnPublish(beat.Event) {}
+
+// routeQueueFactoryForUserConfig returns the function that creates the
+// queue factory for an output route. Routes can't share a disk queue
+// directory, so each route gets its own subdirectory.
+func routeQueueFactoryForUserConfig(
+	queueType string,
+	userConfig *conf.C,
+	queueFactory queue.QueueFactory,
+) func(route string) queue.QueueFactory {
+	return func(route string) queue.QueueFactory {
+		if queueType != diskqueue.QueueType {
+			return queueFactory
+		}
+		// The config was validated by queueFactoryForUserConfig already.
+		settings, _ := diskqueue.SettingsForUserConfig(userConfig)
+		return diskqueue.FactoryForSettings(settings.ForRoute(route))
+	}
+}
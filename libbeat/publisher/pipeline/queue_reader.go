@@ -21,6 +21,7 @@ import (
 	"github.com/elastic/elastic-agent-libs/logp"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/tap"
 )
 
 // queueReader is a standalone stateless helper goroutine to dispatch
@@ -28,6 +29,10 @@ import (
 type queueReader struct {
 	req  chan queueReaderRequest // "give me a batch for this target"
 	resp chan *ttlBatch          // "here is your batch, or nil"
+
+	// tap receives the events of new batches, before they are sent to the
+	// output for the first time.
+	tap *tap.Hub
 }
 
 type queueReaderRequest struct {
@@ -37,10 +42,11 @@ type queueReaderRequest struct {
 	timeToLive int
 }
 
-func makeQueueReader() queueReader {
+func makeQueueReader(tap *tap.Hub) queueReader {
 	qr := queueReader{
 		req:  make(chan queueReaderRequest, 1),
 		resp: make(chan *ttlBatch),
+		tap:  tap,
 	}
 	return qr
 }
@@ -58,6 +64,11 @@ func (qr *queueReader) run(logger *logp.Logger) {
 		var batch *ttlBatch
 		if queueBatch != nil {
 			batch = newBatch(req.retryer, queueBatch, req.timeToLive)
+			if qr.tap.Active(tap.Output) {
+				for i := range batch.events {
+					qr.tap.Publish(tap.Output, "", &batch.events[i].Content)
+				}
+			}
 		}
 		select {
 		case qr.resp <- batch:
@@ -0,0 +1,316 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/periodic"
+)
+
+// outputRouter distributes events to the routes of an output group. Each
+// route is handled by its own outputController, with its own queue, event
+// consumer and output workers.
+type outputRouter struct {
+	// routes never changes once the router is created, as the producers of
+	// connected clients publish to a fixed set of routes. The conditions and
+	// output groups of the routes are replaced when the output is reloaded.
+	routes []outputRoute
+
+	// conditionsMutex protects the conditions of the routes.
+	conditionsMutex sync.RWMutex
+
+	// unrouted counts the events that match no route, pLogUnrouted logs
+	// them periodically.
+	unrouted     *monitoring.Uint
+	pLogUnrouted *periodic.Doer
+}
+
+type outputRoute struct {
+	name       string
+	condition  conditions.Condition
+	controller *outputController
+}
+
+// producer creates a producer that publishes to the queues of all routes.
+func (r *outputRouter) producer(config queue.ProducerConfig) queue.Producer {
+	p := &routerProducer{
+		router:      r,
+		producers:   make([]queue.Producer, len(r.routes)),
+		routeEvents: make([][]uint64, len(r.routes)),
+		ack:         config.ACK,
+	}
+	for i, route := range r.routes {
+		routeConfig := queue.ProducerConfig{Priority: config.Priority}
+		if config.ACK != nil {
+			routeConfig.ACK = func(count int) { p.routeACK(i, count) }
+		}
+		p.producers[i] = route.controller.queueProducer(routeConfig)
+	}
+	return p
+}
+
+// update replaces the conditions and output groups of the routes with the
+// ones of a reloaded output. The reloaded output must have routes with the
+// same names, routes can't be added or removed while clients are connected.
+func (r *outputRouter) update(routes []outputs.Route) error {
+	byName := make(map[string]outputs.Route, len(routes))
+	for _, route := range routes {
+		byName[route.Name] = route
+	}
+	matches := len(byName) == len(r.routes)
+	for _, route := range r.routes {
+		if _, ok := byName[route.name]; !ok {
+			matches = false
+		}
+	}
+	if !matches {
+		return fmt.Errorf("output routes can't be changed from %v to %v while the beat is running, "+
+			"restart the beat to apply the change", r.names(), routeNames(routes))
+	}
+
+	r.conditionsMutex.Lock()
+	for i := range r.routes {
+		r.routes[i].condition = byName[r.routes[i].name].Condition
+	}
+	r.conditionsMutex.Unlock()
+
+	for _, route := range r.routes {
+		route.controller.Set(byName[route.name].Group)
+	}
+	return nil
+}
+
+// pause stops all routes from sending events until a new output is set.
+func (r *outputRouter) pause() {
+	for _, route := range r.routes {
+		route.controller.Set(outputs.Group{})
+	}
+}
+
+func (r *outputRouter) names() []string {
+	names := make([]string, len(r.routes))
+	for i, route := range r.routes {
+		names[i] = route.name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func routeNames(routes []outputs.Route) []string {
+	names := make([]string, len(routes))
+	for i, route := range routes {
+		names[i] = route.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitClose closes the outputControllers of all routes in parallel, so the
+// timeout applies to the routes as a whole.
+func (r *outputRouter) waitClose(timeout time.Duration) {
+	r.pLogUnrouted.Stop()
+
+	var wg sync.WaitGroup
+	for _, route := range r.routes {
+		wg.Add(1)
+		go func(controller *outputController) {
+			defer wg.Done()
+			controller.WaitClose(timeout)
+		}(route.controller)
+	}
+	wg.Wait()
+}
+
+// routerProducer publishes each event to the producers of all routes whose
+// condition matches the event. Events that match no route are dropped and
+// counted. An event is ACKed once all routes it was published to have ACKed
+// it, and events are ACKed in the order they were published in.
+type routerProducer struct {
+	router    *outputRouter
+	producers []queue.Producer
+	ack       func(count int)
+
+	// publishMutex serializes publishing, so the events published to a
+	// route are in the same order as in routeEvents. Publishing blocks
+	// while the queue of a matching route is full, which also holds back
+	// the next events of the producer for the other routes. Like its
+	// client, a producer publishes one event at a time, the producers of
+	// other clients are not affected.
+	publishMutex sync.Mutex
+	matched      []int
+
+	// ackMutex serializes the calls to ack.
+	ackMutex sync.Mutex
+
+	// mutex protects the ACK accounting below.
+	mutex sync.Mutex
+	// pending has an entry for every event that has not been ACKed yet, in
+	// publishing order. The entry of the event with sequence number seq is
+	// pending[seq-firstSeq].
+	pending  []pendingEvent
+	firstSeq uint64
+	// routeEvents holds for each route the sequence numbers of the events
+	// that were published to it and not ACKed yet.
+	routeEvents [][]uint64
+}
+
+type pendingEvent struct {
+	// remaining is the number of routes that still have to ACK the event,
+	// plus one while the event is being published.
+	remaining int
+	// published is false if no route accepted the event. The event is then
+	// removed without being ACKed.
+	published bool
+}
+
+func (p *routerProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, queue.Producer.Publish)
+}
+
+func (p *routerProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, queue.Producer.TryPublish)
+}
+
+func (p *routerProducer) publish(
+	entry queue.Entry,
+	publishFn func(queue.Producer, queue.Entry) (queue.EntryID, bool),
+) (queue.EntryID, bool) {
+	p.publishMutex.Lock()
+	defer p.publishMutex.Unlock()
+
+	routes := p.matchRoutes(entry)
+
+	p.mutex.Lock()
+	seq := p.firstSeq + uint64(len(p.pending))
+	if p.ack != nil {
+		p.pending = append(p.pending, pendingEvent{remaining: len(routes) + 1})
+		for _, i := range routes {
+			p.routeEvents[i] = append(p.routeEvents[i], seq)
+		}
+	}
+	p.mutex.Unlock()
+
+	// Events that match no route count as published, they are ACKed
+	// right away.
+	published := len(routes) == 0
+	if published {
+		p.router.unrouted.Inc()
+		p.router.pLogUnrouted.Add()
+	}
+	for n, i := range routes {
+		// Every route gets its own copy of the event, as outputs may
+		// modify the events they publish.
+		if _, ok := publishFn(p.producers[i], routeEntry(entry, n < len(routes)-1)); ok {
+			published = true
+			continue
+		}
+		if p.ack != nil {
+			// The route didn't accept the event, so it won't ACK it either.
+			// Publishing is serialized, the event is the last one of the
+			// route.
+			p.mutex.Lock()
+			p.routeEvents[i] = p.routeEvents[i][:len(p.routeEvents[i])-1]
+			p.pending[seq-p.firstSeq].remaining--
+			p.mutex.Unlock()
+		}
+	}
+
+	if p.ack != nil {
+		p.mutex.Lock()
+		event := &p.pending[seq-p.firstSeq]
+		event.remaining--
+		event.published = published
+		p.mutex.Unlock()
+		p.acknowledge()
+	}
+	return queue.EntryID(seq), published
+}
+
+func (p *routerProducer) matchRoutes(entry queue.Entry) []int {
+	p.router.conditionsMutex.RLock()
+	defer p.router.conditionsMutex.RUnlock()
+
+	p.matched = p.matched[:0]
+	event, ok := entry.(publisher.Event)
+	for i, route := range p.router.routes {
+		if route.condition == nil || (ok && route.condition.Check(&event.Content)) {
+			p.matched = append(p.matched, i)
+		}
+	}
+	return p.matched
+}
+
+func routeEntry(entry queue.Entry, clone bool) queue.Entry {
+	event, ok := entry.(publisher.Event)
+	if !clone || !ok {
+		return entry
+	}
+	event.Content = *event.Content.Clone()
+	return event
+}
+
+// routeACK is called by the producer of route i when count of its events
+// have been ACKed.
+func (p *routerProducer) routeACK(i int, count int) {
+	p.mutex.Lock()
+	for _, seq := range p.routeEvents[i][:count] {
+		p.pending[seq-p.firstSeq].remaining--
+	}
+	p.routeEvents[i] = p.routeEvents[i][count:]
+	p.mutex.Unlock()
+
+	p.acknowledge()
+}
+
+// acknowledge removes the events at the front of pending that have been
+// ACKed by all their routes and passes their number on to ack.
+func (p *routerProducer) acknowledge() {
+	p.ackMutex.Lock()
+	defer p.ackMutex.Unlock()
+
+	p.mutex.Lock()
+	done, count := 0, 0
+	for done < len(p.pending) && p.pending[done].remaining == 0 {
+		if p.pending[done].published {
+			count++
+		}
+		done++
+	}
+	p.pending = p.pending[done:]
+	p.firstSeq += uint64(done)
+	p.mutex.Unlock()
+
+	if count > 0 {
+		p.ack(count)
+	}
+}
+
+func (p *routerProducer) Close() {
+	for _, producer := range p.producers {
+		producer.Close()
+	}
+}
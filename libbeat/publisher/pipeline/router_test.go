@@ -0,0 +1,274 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestRoutedEventsAreACKedOnceAllRoutesACK(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	reg := monitoring.NewRegistry()
+
+	queueConfig := conf.Namespace{}
+	cfg, err := conf.NewConfigFrom("mem.events: 32\nmem.flush.min_events: 1")
+	require.NoError(t, err)
+	require.NoError(t, queueConfig.Unpack(cfg))
+
+	// Route a ACKs its batches right away, route b holds them until the
+	// test ACKs them.
+	var publishedA atomic.Int64
+	clientA := newMockClient(func(batch publisher.Batch) error {
+		publishedA.Add(int64(len(batch.Events())))
+		batch.ACK()
+		return nil
+	})
+	batchesB := make(chan publisher.Batch, 10)
+	clientB := newMockClient(func(batch publisher.Batch) error {
+		batchesB <- batch
+		return nil
+	})
+
+	pipeline, err := New(
+		beat.Info{Logger: logger},
+		// The queue readers of the routes may still log after the
+		// pipeline is closed, which the testing logger doesn't allow.
+		Monitors{Logger: logp.NewLogger("test"), Metrics: reg},
+		queueConfig,
+		outputs.Group{Routes: []outputs.Route{
+			{
+				Name:      "a",
+				Condition: equalsCondition(t, "to_a", true),
+				Group:     outputs.Group{Clients: []outputs.Client{clientA}},
+			},
+			{
+				Name:      "b",
+				Condition: equalsCondition(t, "to_b", true),
+				Group:     outputs.Group{Clients: []outputs.Client{clientB}},
+			},
+		}},
+		Settings{},
+	)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	var acked atomic.Int64
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		EventListener: acker.RawCounting(func(n int) { acked.Add(int64(n)) }),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, fields := range []mapstr.M{
+		{"to_a": true},
+		{"to_a": true, "to_b": true},
+		{"to_b": true},
+		{},
+	} {
+		client.Publish(beat.Event{Timestamp: time.Now(), Fields: fields})
+	}
+
+	require.Eventually(t, func() bool { return publishedA.Load() == 2 },
+		time.Second, time.Millisecond, "route a should receive 2 events")
+	// The second event is still pending in route b, so only the first
+	// event can be ACKed.
+	assert.Never(t, func() bool { return acked.Load() != 1 },
+		100*time.Millisecond, time.Millisecond, "only the first event should be ACKed")
+
+	received := 0
+	for received < 2 {
+		select {
+		case batch := <-batchesB:
+			for _, event := range batch.Events() {
+				assert.Equal(t, true, event.Content.Fields["to_b"], "route b should only receive matching events")
+			}
+			received += len(batch.Events())
+			batch.ACK()
+		case <-time.After(time.Second):
+			require.FailNow(t, "route b should receive 2 events")
+		}
+	}
+	assert.Equal(t, 2, received)
+	require.Eventually(t, func() bool { return acked.Load() == 4 },
+		time.Second, time.Millisecond, "all events should be ACKed once route b ACKs")
+
+	assert.NotNil(t, reg.Get("pipeline.routes.a.queue.max_events"), "route a should have queue metrics")
+	assert.NotNil(t, reg.Get("pipeline.routes.b.queue.max_events"), "route b should have queue metrics")
+	unrouted, ok := reg.Get("pipeline.events.unrouted").(*monitoring.Uint)
+	require.True(t, ok, "events that match no route should be counted")
+	assert.Equal(t, uint64(1), unrouted.Get())
+}
+
+func TestRoutesReload(t *testing.T) {
+	queueConfig := conf.Namespace{}
+	cfg, err := conf.NewConfigFrom("mem.events: 32\nmem.flush.min_events: 1")
+	require.NoError(t, err)
+	require.NoError(t, queueConfig.Unpack(cfg))
+
+	// Each client reports its name for every event it receives.
+	received := make(chan string, 10)
+	newClient := func(name string) outputs.Client {
+		return newMockClient(func(batch publisher.Batch) error {
+			for range batch.Events() {
+				received <- name
+			}
+			batch.ACK()
+			return nil
+		})
+	}
+	route := func(name, field, client string) outputs.Route {
+		return outputs.Route{
+			Name:      name,
+			Condition: equalsCondition(t, field, true),
+			Group:     outputs.Group{Clients: []outputs.Client{newClient(client)}},
+		}
+	}
+
+	pipeline, err := New(
+		beat.Info{Logger: logptest.NewTestingLogger(t, "")},
+		Monitors{Logger: logp.NewLogger("test")},
+		queueConfig,
+		outputs.Group{Routes: []outputs.Route{
+			route("a", "to_a", "a1"),
+			route("b", "to_b", "b1"),
+		}},
+		Settings{},
+	)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	client, err := pipeline.Connect()
+	require.NoError(t, err)
+	defer client.Close()
+
+	publish := func(field string, expected string) {
+		t.Helper()
+		client.Publish(beat.Event{Timestamp: time.Now(), Fields: mapstr.M{field: true}})
+		select {
+		case name := <-received:
+			assert.Equal(t, expected, name)
+		case <-time.After(time.Second):
+			require.FailNow(t, "event was not published", "expected client %s", expected)
+		}
+	}
+	reload := func(out outputs.Group) error {
+		return pipeline.outputController.Reload(nil, func(outputs.Observer, conf.Namespace) (outputs.Group, error) {
+			return out, nil
+		})
+	}
+
+	publish("to_a", "a1")
+
+	// Reloading routes with the same names replaces their clients and
+	// conditions.
+	require.NoError(t, reload(outputs.Group{Routes: []outputs.Route{
+		route("b", "to_a", "b2"),
+		route("a", "to_b", "a2"),
+	}}))
+	publish("to_a", "b2")
+	publish("to_b", "a2")
+
+	// Changes that can't be applied return an error and keep the routes
+	// running.
+	assert.Error(t, reload(outputs.Group{Routes: []outputs.Route{
+		route("a", "to_a", "a3"),
+		route("c", "to_b", "c3"),
+	}}), "routes can't be added or removed")
+	assert.Error(t, reload(outputs.Group{Clients: []outputs.Client{newClient("single")}}),
+		"routes can't be replaced by an output without routes")
+	publish("to_a", "b2")
+
+	// An empty output pauses the routes until a new output is set.
+	require.NoError(t, reload(outputs.Group{}))
+	client.Publish(beat.Event{Timestamp: time.Now(), Fields: mapstr.M{"to_b": true}})
+	assert.Never(t, func() bool { return len(received) > 0 },
+		100*time.Millisecond, time.Millisecond, "paused routes should not publish events")
+	require.NoError(t, reload(outputs.Group{Routes: []outputs.Route{
+		route("a", "to_b", "a4"),
+		route("b", "to_a", "b4"),
+	}}))
+	select {
+	case name := <-received:
+		assert.Equal(t, "a4", name)
+	case <-time.After(time.Second):
+		require.FailNow(t, "event was not published after the routes were resumed")
+	}
+}
+
+func TestSingleOutputCantBeReloadedWithRoutes(t *testing.T) {
+	controller, err := newOutputController(
+		beat.Info{Logger: logptest.NewTestingLogger(t, "")},
+		Monitors{Logger: logptest.NewTestingLogger(t, "")},
+		nilObserver,
+		memqueue.FactoryForSettings(memqueue.Settings{Events: 32}),
+		0,
+	)
+	require.NoError(t, err)
+	controller.Set(outputs.Group{Clients: []outputs.Client{newMockClient(nil)}})
+	defer controller.WaitClose(time.Second)
+
+	err = controller.Reload(nil, func(outputs.Observer, conf.Namespace) (outputs.Group, error) {
+		return outputs.Group{Routes: []outputs.Route{{
+			Name:  "a",
+			Group: outputs.Group{Clients: []outputs.Client{newMockClient(nil)}},
+		}}}, nil
+	})
+	assert.Error(t, err)
+	assert.Nil(t, controller.activeRouter())
+}
+
+func TestRoutedEventsAreCopied(t *testing.T) {
+	// Each route must receive its own copy of an event, so outputs can
+	// modify the events they publish.
+	event := publisher.Event{Content: beat.Event{Fields: mapstr.M{"a": 1}}}
+	routed, ok := routeEntry(event, true).(publisher.Event)
+	require.True(t, ok)
+	routed.Content.Fields["a"] = 2
+	assert.Equal(t, 1, event.Content.Fields["a"])
+
+	assert.Equal(t, event, routeEntry(event, false), "the last route should get the original event")
+}
+
+func equalsCondition(t *testing.T, field string, value interface{}) conditions.Condition {
+	cfg, err := conf.NewConfigFrom(map[string]interface{}{
+		"equals": map[string]interface{}{field: value},
+	})
+	require.NoError(t, err)
+	condConfig := conditions.Config{}
+	require.NoError(t, cfg.Unpack(&condConfig))
+	condition, err := conditions.NewCondition(&condConfig)
+	require.NoError(t, err)
+	return condition
+}
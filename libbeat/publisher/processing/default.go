@@ -125,12 +125,18 @@ func MakeDefaultSupport(
 			rawProcessors = cfg.Processors
 		}
 
-		processors, err := processors.New(rawProcessors)
+		procs, err := processors.New(rawProcessors)
 		if err != nil {
 			return nil, fmt.Errorf("error initializing processors: %w", err)
 		}
+		// Global processors are shared by all clients, so there is no
+		// client to publish the events of emitting processors.
+		if emitters := processors.Emitters(procs); len(emitters) > 0 {
+			_ = procs.Close()
+			return nil, fmt.Errorf("processor %v is only supported in the processors of inputs and modules", emitters[0])
+		}
 
-		return newBuilder(info, log, processors, cfg.EventMetadata, modifiers, !normalize, cfg.TimeSeries)
+		return newBuilder(info, log, procs, cfg.EventMetadata, modifiers, !normalize, cfg.TimeSeries)
 	}
 }
 
@@ -38,6 +38,7 @@ import (
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_docker_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_host_metadata"
 	_ "github.com/elastic/beats/v7/libbeat/processors/add_kubernetes_metadata"
+	_ "github.com/elastic/beats/v7/libbeat/processors/aggregate"
 )
 
 func TestGenerateProcessorList(t *testing.T) {
@@ -414,6 +415,16 @@ func TestAlwaysDrop(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestGlobalEmitters(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"processors": []map[string]interface{}{
+			{"aggregate": map[string]interface{}{"group_by": []string{"url.path"}}},
+		},
+	})
+	_, err := MakeDefaultSupport(true, nil)(beat.Info{}, logp.L(), cfg)
+	assert.ErrorContains(t, err, "is only supported in the processors of inputs and modules")
+}
+
 func TestDynamicFields(t *testing.T) {
 	factory, err := MakeDefaultSupport(true, nil)(beat.Info{}, logp.L(), config.NewConfig())
 	require.NoError(t, err)
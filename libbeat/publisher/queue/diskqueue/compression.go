@@ -18,15 +18,80 @@
 package diskqueue
 
 import (
+	"fmt"
 	"io"
+	"strings"
 
+	"github.com/klauspost/compress/zstd"
 	lz4V4 "github.com/pierrec/lz4/v4"
 )
 
-// CompressionReader allows reading a stream compressed with LZ4
+// CompressionCodec selects the algorithm used to compress new segments.
+// The codec of existing segments is read from their header options.
+type CompressionCodec uint8
+
+const (
+	CompressionLZ4 CompressionCodec = iota
+	CompressionZstd
+)
+
+// Valid compression levels per codec. Level 0 selects the codec's
+// default.
+const (
+	maxLZ4CompressionLevel  = 9
+	maxZstdCompressionLevel = 22
+)
+
+func (c CompressionCodec) String() string {
+	switch c {
+	case CompressionLZ4:
+		return "lz4"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// Unpack implements config.StringUnpacker.
+func (c *CompressionCodec) Unpack(s string) error {
+	switch strings.ToLower(s) {
+	case "lz4":
+		*c = CompressionLZ4
+	case "zstd":
+		*c = CompressionZstd
+	default:
+		return fmt.Errorf("unknown compression codec '%s', must be lz4 or zstd", s)
+	}
+	return nil
+}
+
+// option returns the segment header option that marks the codec.
+func (c CompressionCodec) option() uint32 {
+	if c == CompressionZstd {
+		return ENABLE_ZSTD_COMPRESSION
+	}
+	return ENABLE_COMPRESSION
+}
+
+func (c CompressionCodec) validateLevel(level int) error {
+	maxLevel := maxLZ4CompressionLevel
+	if c == CompressionZstd {
+		maxLevel = maxZstdCompressionLevel
+	}
+	if level < 0 || level > maxLevel {
+		return fmt.Errorf(
+			"%v compression level %d is out of range 0-%d", c, level, maxLevel)
+	}
+	return nil
+}
+
+// CompressionReader allows reading a stream compressed with LZ4 or
+// Zstandard
 type CompressionReader struct {
-	src        io.ReadCloser
-	pLZ4Reader *lz4V4.Reader
+	src         io.ReadCloser
+	pLZ4Reader  *lz4V4.Reader
+	zstdDecoder *zstd.Decoder
 }
 
 // NewCompressionReader returns a new LZ4 frame decoder
@@ -38,25 +103,49 @@ func NewCompressionReader(r io.ReadCloser) *CompressionReader {
 	}
 }
 
+// NewZstdCompressionReader returns a new Zstandard frame decoder
+func NewZstdCompressionReader(r io.ReadCloser) (*CompressionReader, error) {
+	// A single goroutine decodes synchronously, so reads never go past
+	// the data that was requested.
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("could not create zstd decoder: %w", err)
+	}
+	return &CompressionReader{
+		src:         r,
+		zstdDecoder: zr,
+	}, nil
+}
+
 func (r *CompressionReader) Read(buf []byte) (int, error) {
+	if r.zstdDecoder != nil {
+		return r.zstdDecoder.Read(buf)
+	}
 	return r.pLZ4Reader.Read(buf)
 }
 
 func (r *CompressionReader) Close() error {
+	if r.zstdDecoder != nil {
+		r.zstdDecoder.Close()
+	}
 	return r.src.Close()
 }
 
 // Reset Sets up compression again, assumes that caller has already set
 // the src to the correct position
 func (r *CompressionReader) Reset() error {
+	if r.zstdDecoder != nil {
+		return r.zstdDecoder.Reset(r.src)
+	}
 	r.pLZ4Reader.Reset(r.src)
 	return nil
 }
 
-// CompressionWriter allows writing an LZ4 stream
+// CompressionWriter allows writing an LZ4 or Zstandard stream
 type CompressionWriter struct {
-	dst        WriteCloseSyncer
-	pLZ4Writer *lz4V4.Writer
+	dst         WriteCloseSyncer
+	pLZ4Writer  *lz4V4.Writer
+	zstdEncoder *zstd.Encoder
 }
 
 // NewCompressionWriter returns a new LZ4 frame encoder
@@ -68,12 +157,59 @@ func NewCompressionWriter(w WriteCloseSyncer) *CompressionWriter {
 	}
 }
 
+// NewCompressionWriterForCodec returns a new frame encoder for the given
+// codec and level, level 0 selects the codec's default.
+func NewCompressionWriterForCodec(
+	w WriteCloseSyncer, codec CompressionCodec, level int,
+) (*CompressionWriter, error) {
+	if err := codec.validateLevel(level); err != nil {
+		return nil, err
+	}
+	switch codec {
+	case CompressionLZ4:
+		cw := NewCompressionWriter(w)
+		if level > 0 {
+			// lz4 levels are powers of two starting at 1<<9 for Level1.
+			err := cw.pLZ4Writer.Apply(
+				lz4V4.CompressionLevelOption(lz4V4.CompressionLevel(1 << (8 + level))))
+			if err != nil {
+				return nil, fmt.Errorf("could not set lz4 compression level: %w", err)
+			}
+		}
+		return cw, nil
+	case CompressionZstd:
+		options := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level > 0 {
+			options = append(options,
+				zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		zw, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, fmt.Errorf("could not create zstd encoder: %w", err)
+		}
+		return &CompressionWriter{
+			dst:         w,
+			zstdEncoder: zw,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression codec %v", codec)
+	}
+}
+
 func (w *CompressionWriter) Write(p []byte) (int, error) {
+	if w.zstdEncoder != nil {
+		return w.zstdEncoder.Write(p)
+	}
 	return w.pLZ4Writer.Write(p)
 }
 
 func (w *CompressionWriter) Close() error {
-	err := w.pLZ4Writer.Close()
+	var err error
+	if w.zstdEncoder != nil {
+		err = w.zstdEncoder.Close()
+	} else {
+		err = w.pLZ4Writer.Close()
+	}
 	if err != nil {
 		return err
 	}
@@ -81,6 +217,12 @@ func (w *CompressionWriter) Close() error {
 }
 
 func (w *CompressionWriter) Sync() error {
-	w.pLZ4Writer.Flush()
+	if w.zstdEncoder != nil {
+		if err := w.zstdEncoder.Flush(); err != nil {
+			return err
+		}
+	} else {
+		w.pLZ4Writer.Flush()
+	}
 	return w.dst.Sync()
 }
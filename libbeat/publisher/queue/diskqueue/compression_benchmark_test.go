@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Usage:
+//
+// go test -bench=BenchmarkCodec -benchmem -run=^$ ./libbeat/publisher/queue/diskqueue/
+//
+// The "ratio" metric is the compressed size divided by the input size,
+// lower is better.
+
+package diskqueue
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+)
+
+// codecBenchmarkInputSize is roughly the amount of event data written
+// between two syncs of a busy segment.
+const codecBenchmarkInputSize = 1 << 20
+
+var codecBenchmarks = []struct {
+	codec CompressionCodec
+	level int
+}{
+	{CompressionLZ4, 0},
+	{CompressionLZ4, 9},
+	{CompressionZstd, 1},
+	{CompressionZstd, 3},
+	{CompressionZstd, 9},
+	{CompressionZstd, 19},
+}
+
+// codecBenchmarkInput returns serialized sample events, picked like the
+// queue benchmarks pick them.
+func codecBenchmarkInput() []byte {
+	r := rand.New(rand.NewPCG(1, 2))
+	var buf bytes.Buffer
+	for buf.Len() < codecBenchmarkInputSize {
+		buf.WriteString(msgs[r.IntN(len(msgs))])
+	}
+	return buf.Bytes()
+}
+
+func compressForBenchmark(
+	b *testing.B, codec CompressionCodec, level int, input []byte,
+) []byte {
+	var dst bytes.Buffer
+	cw, err := NewCompressionWriterForCodec(
+		NopWriteCloseSyncer(NopWriteCloser(&dst)), codec, level)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := cw.Write(input); err != nil {
+		b.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return dst.Bytes()
+}
+
+func newReaderForBenchmark(
+	b *testing.B, codec CompressionCodec, compressed []byte,
+) *CompressionReader {
+	src := io.NopCloser(bytes.NewReader(compressed))
+	if codec == CompressionZstd {
+		cr, err := NewZstdCompressionReader(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return cr
+	}
+	return NewCompressionReader(src)
+}
+
+func BenchmarkCodecCompress(b *testing.B) {
+	input := codecBenchmarkInput()
+	for _, bc := range codecBenchmarks {
+		b.Run(fmt.Sprintf("%v-%d", bc.codec, bc.level), func(b *testing.B) {
+			var compressed []byte
+			b.SetBytes(int64(len(input)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				compressed = compressForBenchmark(b, bc.codec, bc.level, input)
+			}
+			b.ReportMetric(float64(len(compressed))/float64(len(input)), "ratio")
+		})
+	}
+}
+
+func BenchmarkCodecDecompress(b *testing.B) {
+	input := codecBenchmarkInput()
+	for _, bc := range codecBenchmarks {
+		b.Run(fmt.Sprintf("%v-%d", bc.codec, bc.level), func(b *testing.B) {
+			compressed := compressForBenchmark(b, bc.codec, bc.level, input)
+			b.SetBytes(int64(len(input)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				cr := newReaderForBenchmark(b, bc.codec, compressed)
+				if _, err := io.Copy(io.Discard, cr); err != nil {
+					b.Fatal(err)
+				}
+				cr.Close()
+			}
+		})
+	}
+}
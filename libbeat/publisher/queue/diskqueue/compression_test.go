@@ -23,6 +23,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
 )
 
 type nopWriteCloser struct {
@@ -171,3 +174,93 @@ func TestCompressionSync(t *testing.T) {
 		assert.Equal(t, tc.plaintext, dst.Bytes()[len(tc.plaintext):], name)
 	}
 }
+
+func TestZstdCompressionSync(t *testing.T) {
+	plaintext := []byte("abcdefghijklmnopqrstuvwxzy01234567890ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	for _, level := range []int{0, 1, 3, 19} {
+		pr, pw := io.Pipe()
+		var dst bytes.Buffer
+		go func() {
+			cw, err := NewCompressionWriterForCodec(
+				NopWriteCloseSyncer(pw), CompressionZstd, level)
+			assert.Nil(t, err, level)
+			_, err = cw.Write(plaintext)
+			assert.Nil(t, err, level)
+			// Sync must produce a decodable block so readers can catch
+			// up with a segment that is still being written.
+			err = cw.Sync()
+			assert.Nil(t, err, level)
+			_, err = cw.Write(plaintext)
+			assert.Nil(t, err, level)
+			cw.Close()
+		}()
+		cr, err := NewZstdCompressionReader(pr)
+		assert.Nil(t, err, level)
+		_, err = io.Copy(&dst, cr)
+		assert.Nil(t, err, level)
+		assert.Equal(t, append(append([]byte{}, plaintext...), plaintext...), dst.Bytes(), level)
+	}
+}
+
+func TestCompressionLevels(t *testing.T) {
+	tests := map[string]struct {
+		codec CompressionCodec
+		level int
+		valid bool
+	}{
+		"lz4 default":   {codec: CompressionLZ4, level: 0, valid: true},
+		"lz4 max":       {codec: CompressionLZ4, level: 9, valid: true},
+		"lz4 too high":  {codec: CompressionLZ4, level: 10},
+		"zstd default":  {codec: CompressionZstd, level: 0, valid: true},
+		"zstd max":      {codec: CompressionZstd, level: 22, valid: true},
+		"zstd too high": {codec: CompressionZstd, level: 23},
+		"negative":      {codec: CompressionZstd, level: -1},
+	}
+	for name, tc := range tests {
+		var dst bytes.Buffer
+		_, err := NewCompressionWriterForCodec(
+			NopWriteCloseSyncer(NopWriteCloser(&dst)), tc.codec, tc.level)
+		if tc.valid {
+			assert.Nil(t, err, name)
+		} else {
+			assert.NotNil(t, err, name)
+		}
+	}
+}
+
+func TestCompressionSettingsForUserConfig(t *testing.T) {
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"max_size": "1GB",
+		"compression": map[string]interface{}{
+			"codec": "zstd",
+			"level": 9,
+		},
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.True(t, settings.UseCompression)
+	assert.Equal(t, CompressionZstd, settings.CompressionCodec)
+	assert.Equal(t, 9, settings.CompressionLevel)
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":    "1GB",
+		"compression": map[string]interface{}{"enabled": false, "codec": "zstd"},
+	})
+	settings, err = SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.False(t, settings.UseCompression)
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":    "1GB",
+		"compression": map[string]interface{}{"codec": "gzip"},
+	})
+	_, err = SettingsForUserConfig(cfg)
+	assert.Error(t, err, "unknown codecs must be rejected")
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":    "1GB",
+		"compression": map[string]interface{}{"codec": "lz4", "level": 12},
+	})
+	_, err = SettingsForUserConfig(cfg)
+	assert.Error(t, err, "out of range levels must be rejected")
+}
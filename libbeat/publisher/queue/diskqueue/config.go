@@ -64,8 +64,22 @@ type Settings struct {
 	RetryInterval    time.Duration
 	MaxRetryInterval time.Duration
 
-	// UseCompression enables or disables LZ4 compression
+	// UseCompression enables or disables compression of new segments
 	UseCompression bool
+
+	// CompressionCodec selects the algorithm used when UseCompression is
+	// set, CompressionLevel its level. Level 0 selects the codec's default.
+	CompressionCodec CompressionCodec
+	CompressionLevel int
+
+	// EncryptionKey enables AES-256-GCM encryption of new segments when
+	// set. It must be KeySize bytes long.
+	EncryptionKey []byte
+
+	// DecryptionKeys holds previous encryption keys. Segments that were
+	// written under one of these keys can still be read, so a queue can
+	// be drained after the key has been rotated.
+	DecryptionKeys [][]byte
 }
 
 // userConfig holds the parameters for a disk queue that are configurable
@@ -80,6 +94,91 @@ type userConfig struct {
 
 	RetryInterval    *time.Duration `config:"retry_interval" validate:"positive"`
 	MaxRetryInterval *time.Duration `config:"max_retry_interval" validate:"positive"`
+
+	Compression *compressionConfig `config:"compression"`
+	Encryption  *encryptionConfig  `config:"encryption"`
+}
+
+// compressionConfig holds the user settings for segment compression.
+type compressionConfig struct {
+	Enabled *bool            `config:"enabled"`
+	Codec   CompressionCodec `config:"codec"`
+	Level   int              `config:"level"`
+}
+
+func (c *compressionConfig) enabled() bool {
+	return c != nil && (c.Enabled == nil || *c.Enabled)
+}
+
+func (c *compressionConfig) Validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if err := c.Codec.validateLevel(c.Level); err != nil {
+		return fmt.Errorf("invalid disk queue compression: %w", err)
+	}
+	return nil
+}
+
+// encryptionConfig holds the user settings for segment encryption. Keys
+// are base64 encoded and can be referenced from the keystore, e.g.
+// `key: ${DISKQUEUE_KEY}`.
+type encryptionConfig struct {
+	Enabled *bool  `config:"enabled"`
+	Key     string `config:"key"`
+	KeyFile string `config:"key_file"`
+
+	// Previous keys are only used to read existing segments.
+	PreviousKeys     []string `config:"previous_keys"`
+	PreviousKeyFiles []string `config:"previous_key_files"`
+}
+
+func (c *encryptionConfig) enabled() bool {
+	return c != nil && (c.Enabled == nil || *c.Enabled)
+}
+
+func (c *encryptionConfig) Validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if (c.Key == "") == (c.KeyFile == "") {
+		return errors.New(
+			"disk queue encryption requires exactly one of key or key_file")
+	}
+	return nil
+}
+
+// keys loads the current key and any previous keys.
+func (c *encryptionConfig) keys() ([]byte, [][]byte, error) {
+	var current []byte
+	var err error
+	if c.KeyFile != "" {
+		current, err = ReadEncryptionKeyFile(c.KeyFile)
+	} else {
+		current, err = ParseEncryptionKey(c.Key)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid disk queue encryption key: %w", err)
+	}
+
+	var previous [][]byte
+	for i, encoded := range c.PreviousKeys {
+		key, err := ParseEncryptionKey(encoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"invalid disk queue encryption previous_keys[%d]: %w", i, err)
+		}
+		previous = append(previous, key)
+	}
+	for _, path := range c.PreviousKeyFiles {
+		key, err := ReadEncryptionKeyFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf(
+				"invalid disk queue encryption previous key: %w", err)
+		}
+		previous = append(previous, key)
+	}
+	return current, previous, nil
 }
 
 func (c *userConfig) Validate() error {
@@ -134,7 +233,8 @@ func DefaultSettings() Settings {
 // end-user-configurable settings in the given config tree.
 func SettingsForUserConfig(config *config.C) (Settings, error) {
 	userConfig := userConfig{}
-	if err := config.Unpack(&userConfig); err != nil {
+	err := config.Unpack(&userConfig)
+	if err != nil {
 		return Settings{}, fmt.Errorf("couldn't unpack disk queue config: %w", err)
 	}
 	settings := DefaultSettings()
@@ -163,6 +263,20 @@ func SettingsForUserConfig(config *config.C) (Settings, error) {
 		settings.MaxRetryInterval = *userConfig.MaxRetryInterval
 	}
 
+	if userConfig.Compression.enabled() {
+		settings.UseCompression = true
+		settings.CompressionCodec = userConfig.Compression.Codec
+		settings.CompressionLevel = userConfig.Compression.Level
+	}
+
+	if userConfig.Encryption.enabled() {
+		settings.EncryptionKey, settings.DecryptionKeys, err =
+			userConfig.Encryption.keys()
+		if err != nil {
+			return Settings{}, err
+		}
+	}
+
 	return settings, nil
 }
 
@@ -177,10 +291,27 @@ func (settings Settings) directoryPath() string {
 	return settings.Path
 }
 
+// ForRoute returns a copy of the settings for the queue of the named
+// output route, which is stored in its own subdirectory of the queue
+// directory.
+func (settings Settings) ForRoute(route string) Settings {
+	settings.Path = filepath.Join(settings.directoryPath(), "routes", route)
+	return settings
+}
+
 func (settings Settings) stateFilePath() string {
 	return filepath.Join(settings.directoryPath(), "state.dat")
 }
 
+// decryptionKeys returns all keys that may be used to read segments.
+func (settings Settings) decryptionKeys() [][]byte {
+	keys := make([][]byte, 0, len(settings.DecryptionKeys)+1)
+	if settings.EncryptionKey != nil {
+		keys = append(keys, settings.EncryptionKey)
+	}
+	return append(keys, settings.DecryptionKeys...)
+}
+
 func (settings Settings) segmentPath(segmentID segmentID) string {
 	return filepath.Join(
 		settings.directoryPath(),
@@ -0,0 +1,356 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// KeySize is the required size in bytes of a disk queue encryption
+	// key. Keys are used for AES-256-GCM.
+	KeySize = 32
+
+	// keyIDSize is the size of the key identifier that is stored in the
+	// encryption header of every encrypted segment.
+	keyIDSize = 8
+
+	// noncePrefixSize is the size of the random per-segment nonce prefix.
+	// The remaining 4 bytes of the 12-byte GCM nonce hold the chunk counter.
+	noncePrefixSize = 8
+
+	// encryptionHeaderSize is the size of the header that immediately
+	// follows the segment header when encryption is enabled: the key ID
+	// followed by the nonce prefix.
+	encryptionHeaderSize = keyIDSize + noncePrefixSize
+
+	// encryptionChunkSize is the maximum amount of plaintext sealed into
+	// a single chunk. Smaller chunks are written whenever the segment is
+	// synced.
+	encryptionChunkSize = 64 * 1024
+
+	// chunkLengthSize is the size of the little-endian ciphertext length
+	// that precedes every chunk.
+	chunkLengthSize = 4
+)
+
+// keyIDContext is mixed into the key ID derivation so the stored ID can
+// not be used to learn anything about the key itself.
+var keyIDContext = []byte("beats diskqueue segment key id")
+
+// ParseEncryptionKey decodes a base64 (standard or URL encoding) encoded
+// AES-256 key, as produced by e.g. `openssl rand -base64 32`.
+func ParseEncryptionKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, errors.New("encryption key is empty")
+	}
+	var key []byte
+	var err error
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding,
+		base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		key, err = enc.DecodeString(encoded)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf(
+			"encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// ReadEncryptionKeyFile reads a base64 encoded key from the given file.
+func ReadEncryptionKeyFile(path string) ([]byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read encryption key file '%s': %w", path, err)
+	}
+	key, err := ParseEncryptionKey(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key file '%s': %w", path, err)
+	}
+	return key, nil
+}
+
+// encryptionKeyID returns the identifier stored in the header of
+// segments encrypted with the given key.
+func encryptionKeyID(key []byte) [keyIDSize]byte {
+	var id [keyIDSize]byte
+	mac := hmac.New(sha256.New, key)
+	mac.Write(keyIDContext)
+	copy(id[:], mac.Sum(nil))
+	return id
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("could not create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// chunkNonce builds the GCM nonce for the given chunk from the segment's
+// random nonce prefix and the chunk's sequence number. Chunks can
+// therefore be neither reordered nor replayed within a segment.
+func chunkNonce(prefix [noncePrefixSize]byte, counter uint32) []byte {
+	nonce := make([]byte, noncePrefixSize+4)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	return nonce
+}
+
+// EncryptionReader allows reading a stream encrypted with
+// EncryptionWriter. Every chunk is authenticated before any of its
+// plaintext is returned.
+type EncryptionReader struct {
+	src io.ReadCloser
+	// keys holds the candidate keys indexed by key ID.
+	keys map[[keyIDSize]byte][]byte
+
+	gcm         cipher.AEAD
+	noncePrefix [noncePrefixSize]byte
+	counter     uint32
+
+	chunk     []byte
+	plaintext []byte
+}
+
+// NewEncryptionReader reads the encryption header from r and returns a
+// reader that decrypts the rest of the stream. The key used to write the
+// segment must be among the given keys.
+func NewEncryptionReader(r io.ReadCloser, keys [][]byte) (*EncryptionReader, error) {
+	er := &EncryptionReader{
+		src:  r,
+		keys: make(map[[keyIDSize]byte][]byte, len(keys)),
+	}
+	for _, key := range keys {
+		er.keys[encryptionKeyID(key)] = key
+	}
+	if err := er.Reset(); err != nil {
+		return nil, err
+	}
+	return er, nil
+}
+
+func (r *EncryptionReader) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	if len(r.plaintext) == 0 {
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(buf, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+// readChunk reads, authenticates and decrypts the next chunk.
+func (r *EncryptionReader) readChunk() error {
+	var lengthBuf [chunkLengthSize]byte
+	if _, err := io.ReadFull(r.src, lengthBuf[:]); err != nil {
+		// A clean EOF on a chunk boundary is the end of the data,
+		// anything else is a truncated chunk.
+		return err
+	}
+	length := binary.LittleEndian.Uint32(lengthBuf[:])
+	if length < uint32(r.gcm.Overhead()) ||
+		length > uint32(encryptionChunkSize+r.gcm.Overhead()) {
+		return fmt.Errorf("invalid encrypted chunk length %d", length)
+	}
+	if cap(r.chunk) < int(length) {
+		r.chunk = make([]byte, length)
+	}
+	r.chunk = r.chunk[:length]
+	if _, err := io.ReadFull(r.src, r.chunk); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	plaintext, err := r.gcm.Open(
+		r.chunk[:0], chunkNonce(r.noncePrefix, r.counter), r.chunk, lengthBuf[:])
+	if err != nil {
+		return fmt.Errorf("encrypted chunk %d failed authentication: %w", r.counter, err)
+	}
+	r.counter++
+	r.plaintext = plaintext
+	return nil
+}
+
+func (r *EncryptionReader) Close() error {
+	return r.src.Close()
+}
+
+// Reset reads the encryption header again and restarts decryption,
+// assumes that caller has already set the src to the correct position
+func (r *EncryptionReader) Reset() error {
+	var header [encryptionHeaderSize]byte
+	if _, err := io.ReadFull(r.src, header[:]); err != nil {
+		return fmt.Errorf("could not read encryption header: %w", err)
+	}
+	var keyID [keyIDSize]byte
+	copy(keyID[:], header[:keyIDSize])
+	key, ok := r.keys[keyID]
+	if !ok {
+		return fmt.Errorf("no configured key matches segment key ID %x", keyID)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	r.gcm = gcm
+	copy(r.noncePrefix[:], header[keyIDSize:])
+	r.counter = 0
+	r.plaintext = nil
+	return nil
+}
+
+// EncryptionWriter allows writing an AES-256-GCM encrypted stream. Data
+// is sealed in chunks of up to encryptionChunkSize bytes, a chunk is
+// written whenever the buffer fills up or the writer is synced.
+type EncryptionWriter struct {
+	dst         WriteCloseSyncer
+	gcm         cipher.AEAD
+	noncePrefix [noncePrefixSize]byte
+	counter     uint32
+
+	// plaintext holds data that has not been sealed yet.
+	plaintext []byte
+	// pending holds sealed data that could not be written to dst yet.
+	pending bytes.Buffer
+}
+
+// NewEncryptionWriter writes the encryption header to w and returns a
+// writer that encrypts everything written to it with the given key.
+func NewEncryptionWriter(w WriteCloseSyncer, key []byte) (*EncryptionWriter, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	ew := &EncryptionWriter{
+		dst:       w,
+		gcm:       gcm,
+		plaintext: make([]byte, 0, encryptionChunkSize),
+	}
+	if _, err := io.ReadFull(rand.Reader, ew.noncePrefix[:]); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+	keyID := encryptionKeyID(key)
+	if _, err := w.Write(keyID[:]); err != nil {
+		return nil, fmt.Errorf("could not write encryption header: %w", err)
+	}
+	if _, err := w.Write(ew.noncePrefix[:]); err != nil {
+		return nil, fmt.Errorf("could not write encryption header: %w", err)
+	}
+	return ew, nil
+}
+
+func (w *EncryptionWriter) Write(p []byte) (int, error) {
+	// Don't accept new data while previously sealed data is stuck, so
+	// the caller's retry logic applies to the blocked write.
+	if err := w.writePending(); err != nil {
+		return 0, err
+	}
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(w.plaintext[len(w.plaintext):cap(w.plaintext)], p)
+		w.plaintext = w.plaintext[:len(w.plaintext)+n]
+		p = p[n:]
+		if len(w.plaintext) == cap(w.plaintext) {
+			w.seal()
+		}
+	}
+	// The data has been accepted at this point. If writing the sealed
+	// chunks fails, they are retried by the next call to Write, Sync or
+	// Close, which also report the error.
+	_ = w.writePending()
+	return written, nil
+}
+
+// seal encrypts the buffered plaintext into a new chunk.
+func (w *EncryptionWriter) seal() {
+	if len(w.plaintext) == 0 {
+		return
+	}
+	var lengthBuf [chunkLengthSize]byte
+	binary.LittleEndian.PutUint32(
+		lengthBuf[:], uint32(len(w.plaintext)+w.gcm.Overhead()))
+	sealed := w.gcm.Seal(
+		nil, chunkNonce(w.noncePrefix, w.counter), w.plaintext, lengthBuf[:])
+	w.counter++
+	w.pending.Write(lengthBuf[:])
+	w.pending.Write(sealed)
+	w.plaintext = w.plaintext[:0]
+}
+
+func (w *EncryptionWriter) writePending() error {
+	for w.pending.Len() > 0 {
+		n, err := w.dst.Write(w.pending.Bytes())
+		w.pending.Next(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush seals any buffered plaintext and writes it to dst.
+func (w *EncryptionWriter) flush() error {
+	w.seal()
+	return w.writePending()
+}
+
+func (w *EncryptionWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Close()
+}
+
+func (w *EncryptionWriter) Sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Sync()
+}
@@ -0,0 +1,175 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+var (
+	testEncryptionKey = bytes.Repeat([]byte{0x42}, KeySize)
+	testRotatedKey    = bytes.Repeat([]byte{0x17}, KeySize)
+)
+
+// bufferWriteCloseSyncer is an in-memory WriteCloseSyncer.
+type bufferWriteCloseSyncer struct {
+	bytes.Buffer
+}
+
+func (*bufferWriteCloseSyncer) Close() error { return nil }
+func (*bufferWriteCloseSyncer) Sync() error  { return nil }
+
+func encryptForTest(t *testing.T, key []byte, chunks ...[]byte) []byte {
+	t.Helper()
+	dst := &bufferWriteCloseSyncer{}
+	ew, err := NewEncryptionWriter(dst, key)
+	require.NoError(t, err)
+	for _, chunk := range chunks {
+		_, err = ew.Write(chunk)
+		require.NoError(t, err)
+		require.NoError(t, ew.Sync())
+	}
+	require.NoError(t, ew.Close())
+	return dst.Bytes()
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	tests := map[string][][]byte{
+		"empty":         {},
+		"single write":  {[]byte("abc")},
+		"several syncs": {[]byte("abc"), []byte("defg"), []byte("hijkl")},
+		"multiple chunks": {
+			bytes.Repeat([]byte("x"), encryptionChunkSize*2+17),
+		},
+	}
+	for name, writes := range tests {
+		t.Run(name, func(t *testing.T) {
+			encrypted := encryptForTest(t, testEncryptionKey, writes...)
+			plaintext := bytes.Join(writes, nil)
+			if len(plaintext) > 0 {
+				assert.NotContains(t, string(encrypted), string(plaintext))
+			}
+
+			er, err := NewEncryptionReader(
+				io.NopCloser(bytes.NewReader(encrypted)), [][]byte{testEncryptionKey})
+			require.NoError(t, err)
+			decrypted, err := io.ReadAll(er)
+			require.NoError(t, err)
+			assert.Equal(t, len(plaintext), len(decrypted))
+			assert.Equal(t, plaintext, decrypted)
+		})
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	encrypted := encryptForTest(t, testRotatedKey, []byte("written under the old key"))
+
+	// The current key alone can't read the segment.
+	_, err := NewEncryptionReader(
+		io.NopCloser(bytes.NewReader(encrypted)), [][]byte{testEncryptionKey})
+	assert.Error(t, err)
+
+	// With the previous key available the segment can be drained.
+	er, err := NewEncryptionReader(
+		io.NopCloser(bytes.NewReader(encrypted)),
+		[][]byte{testEncryptionKey, testRotatedKey})
+	require.NoError(t, err)
+	decrypted, err := io.ReadAll(er)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("written under the old key"), decrypted)
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	encrypted := encryptForTest(t, testEncryptionKey, []byte("abc"), []byte("defg"))
+
+	tests := map[string]func([]byte) []byte{
+		"flipped ciphertext bit": func(b []byte) []byte {
+			b[encryptionHeaderSize+chunkLengthSize] ^= 0x01
+			return b
+		},
+		"flipped nonce bit": func(b []byte) []byte {
+			b[keyIDSize] ^= 0x01
+			return b
+		},
+		"truncated chunk": func(b []byte) []byte {
+			return b[:len(b)-1]
+		},
+		"swapped chunks": func(b []byte) []byte {
+			// Both chunks have 3 and 4 bytes of plaintext respectively, so
+			// splice the second chunk in place of the first.
+			first := encryptionHeaderSize
+			second := first + chunkLengthSize + 3 + 16
+			out := append([]byte{}, b[:first]...)
+			out = append(out, b[second:]...)
+			return append(out, b[first:second]...)
+		},
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			modified := tamper(append([]byte{}, encrypted...))
+			er, err := NewEncryptionReader(
+				io.NopCloser(bytes.NewReader(modified)), [][]byte{testEncryptionKey})
+			require.NoError(t, err)
+			_, err = io.ReadAll(er)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncryptionSettingsForUserConfig(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testEncryptionKey)
+	keyFile := filepath.Join(t.TempDir(), "old.key")
+	require.NoError(t, os.WriteFile(keyFile,
+		[]byte(base64.StdEncoding.EncodeToString(testRotatedKey)+"\n"), 0600))
+
+	cfg := config.MustNewConfigFrom(map[string]interface{}{
+		"max_size": "1GB",
+		"encryption": map[string]interface{}{
+			"key":                encoded,
+			"previous_key_files": []string{keyFile},
+		},
+	})
+	settings, err := SettingsForUserConfig(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, testEncryptionKey, settings.EncryptionKey)
+	assert.Equal(t, [][]byte{testRotatedKey}, settings.DecryptionKeys)
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":   "1GB",
+		"encryption": map[string]interface{}{"enabled": true},
+	})
+	_, err = SettingsForUserConfig(cfg)
+	assert.Error(t, err, "encryption without a key must be rejected")
+
+	cfg = config.MustNewConfigFrom(map[string]interface{}{
+		"max_size":   "1GB",
+		"encryption": map[string]interface{}{"key": "dG9vIHNob3J0"},
+	})
+	_, err = SettingsForUserConfig(cfg)
+	assert.Error(t, err, "short keys must be rejected")
+}
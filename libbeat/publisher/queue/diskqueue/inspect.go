@@ -0,0 +1,343 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+)
+
+// This file contains helpers to inspect and repair a queue directory while
+// the queue itself is not running, e.g. from the `queue` subcommand. None
+// of these functions may be used on a directory that is owned by an open
+// queue.
+
+// QuarantineDirectory is the name of the directory inside the queue
+// directory that quarantined segments are moved to. The queue ignores
+// its contents.
+const QuarantineDirectory = "quarantine"
+
+// SegmentInfo describes a segment file on disk.
+type SegmentInfo struct {
+	ID   uint64
+	Path string
+	// Size is the size of the segment file in bytes.
+	Size int64
+
+	// The fields below are read from the segment header. FrameCount is
+	// zero if the segment was not closed cleanly.
+	Version    uint32
+	FrameCount uint32
+	Options    uint32
+}
+
+// OptionNames returns the names of the options enabled in the segment
+// header.
+func (info SegmentInfo) OptionNames() []string {
+	var names []string
+	if info.Options&ENABLE_COMPRESSION != 0 {
+		names = append(names, "compression")
+	}
+	if info.Options&ENABLE_ZSTD_COMPRESSION != 0 {
+		names = append(names, "zstd")
+	}
+	if info.Options&ENABLE_PROTOBUF != 0 {
+		names = append(names, "protobuf")
+	}
+	if info.Options&ENABLE_ENCRYPTION != 0 {
+		names = append(names, "encryption")
+	}
+	return names
+}
+
+func (info SegmentInfo) queueSegment() *queueSegment {
+	version := info.Version
+	return &queueSegment{
+		id:            segmentID(info.ID),
+		schemaVersion: &version,
+		byteCount:     uint64(info.Size),
+		frameCount:    info.FrameCount,
+	}
+}
+
+// Position is the position of the oldest unacknowledged frame, as
+// recorded in the queue's state file.
+type Position struct {
+	SegmentID uint64
+	// ByteIndex is the offset of the frame in the segment. Zero means the
+	// first frame of the segment.
+	ByteIndex uint64
+	// FrameIndex is the 0-based index of the frame in the segment.
+	FrameIndex uint64
+}
+
+// Acked returns true if the given frame of the given segment precedes
+// the position and has therefore already been acknowledged.
+func (p Position) Acked(segmentID uint64, frameIndex uint64) bool {
+	return segmentID < p.SegmentID ||
+		(segmentID == p.SegmentID && frameIndex < p.FrameIndex)
+}
+
+// ReadPosition reads the ACK position from the queue's state file. If the
+// state file does not exist the returned error matches os.ErrNotExist.
+func ReadPosition(settings Settings) (Position, error) {
+	position, err := queuePositionFromPath(settings.stateFilePath())
+	if err != nil {
+		return Position{}, err
+	}
+	return Position{
+		SegmentID:  uint64(position.segmentID),
+		ByteIndex:  position.byteIndex,
+		FrameIndex: position.frameIndex,
+	}, nil
+}
+
+// ListSegments returns all segment files in the queue directory, sorted
+// by segment ID. Unlike queue startup, segments with unreadable headers
+// are not skipped, they are returned with a zero Version and the error
+// for the first of them is returned alongside the list.
+func ListSegments(settings Settings) ([]SegmentInfo, error) {
+	dir := settings.directoryPath()
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read queue directory '%s': %w", dir, err)
+	}
+
+	var segments []SegmentInfo
+	var firstErr error
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+		name, found := strings.CutSuffix(strings.ToLower(dirEntry.Name()), ".seg")
+		if !found {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info := SegmentInfo{
+			ID:   id,
+			Path: filepath.Join(dir, dirEntry.Name()),
+		}
+		if stat, err := dirEntry.Info(); err == nil {
+			info.Size = stat.Size()
+		}
+		if err := info.readHeader(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("segment %d: %w", id, err)
+		}
+		segments = append(segments, info)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments, firstErr
+}
+
+func (info *SegmentInfo) readHeader() error {
+	file, err := os.Open(info.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	header, err := readSegmentHeader(autoRetryReader{file})
+	if err != nil {
+		return err
+	}
+	info.Version = header.version
+	info.FrameCount = header.frameCount
+	info.Options = header.options
+	return nil
+}
+
+// Frame is a frame read by ScanSegment.
+type Frame struct {
+	// Index is the 0-based index of the frame in its segment.
+	Index uint64
+	// Offset is the logical position of the frame in the segment, the same
+	// value that is used for Position.ByteIndex.
+	Offset uint64
+	// Size is the size of the frame on disk, including header and footer.
+	Size  uint64
+	Event publisher.Event
+}
+
+// ScanResult summarizes a ScanSegment call.
+type ScanResult struct {
+	// Frames is the number of valid frames that were read.
+	Frames uint64
+	// ValidSize is the logical size of the segment up to the end of the
+	// last valid frame.
+	ValidSize uint64
+	// Err is set if the segment is corrupted after ValidSize, e.g. if a
+	// frame checksum does not match or the segment is truncated.
+	Err error
+}
+
+// ScanSegment reads all frames of a segment in order, verifying their
+// checksums and decoding their events, and calls fn for each valid frame.
+// Scanning stops at the first corrupted frame, which is reported in the
+// returned ScanResult. An error is returned if the segment can't be opened
+// or fn returns an error.
+func ScanSegment(
+	settings Settings, info SegmentInfo, fn func(Frame) error,
+) (ScanResult, error) {
+	return scanSegment(settings, info, func(frame Frame, _ []byte) error {
+		if fn == nil {
+			return nil
+		}
+		return fn(frame)
+	})
+}
+
+// scanSegment implements ScanSegment, it additionally passes the raw frame
+// data to fn, which is only valid until fn returns.
+func scanSegment(
+	settings Settings, info SegmentInfo, fn func(Frame, []byte) error,
+) (ScanResult, error) {
+	segment := info.queueSegment()
+	handle, err := segment.getReader(settings)
+	if err != nil {
+		return ScanResult{}, err
+	}
+	defer handle.Close()
+
+	rl := &readerLoop{decoder: newEventDecoder()}
+	rl.decoder.serializationFormat = handle.serializationFormat
+
+	result := ScanResult{ValidSize: segment.headerSize()}
+	for {
+		frame, err := rl.nextFrame(handle, math.MaxUint64)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				result.Err = err
+			}
+			return result, nil
+		}
+		event, ok := frame.event.(publisher.Event)
+		if !ok {
+			result.Err = fmt.Errorf("unexpected frame content %T", frame.event)
+			return result, nil
+		}
+		err = fn(Frame{
+			Index:  result.Frames,
+			Offset: result.ValidSize,
+			Size:   frame.bytesOnDisk,
+			Event:  event,
+		}, rl.decoder.buf)
+		if err != nil {
+			return result, err
+		}
+		result.Frames++
+		result.ValidSize += frame.bytesOnDisk
+	}
+}
+
+// QuarantineSegment moves a segment file into the QuarantineDirectory of
+// the queue and returns its new path.
+func QuarantineSegment(settings Settings, info SegmentInfo) (string, error) {
+	dir := filepath.Join(settings.directoryPath(), QuarantineDirectory)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("could not create quarantine directory: %w", err)
+	}
+	target := filepath.Join(dir, filepath.Base(info.Path))
+	if err := os.Rename(info.Path, target); err != nil {
+		return "", fmt.Errorf("could not quarantine segment %d: %w", info.ID, err)
+	}
+	return target, nil
+}
+
+// TruncateSegment rewrites a corrupted segment so that it only contains
+// the valid frames that precede the corruption, it does nothing if the
+// segment is not corrupted. The original file is
+// moved to the QuarantineDirectory. Compressed and encrypted segments are
+// written with the same options, encrypted segments are written with the
+// current encryption key. If the segment has no valid frames it is only
+// quarantined.
+func TruncateSegment(settings Settings, info SegmentInfo) (ScanResult, error) {
+	if info.Version < 1 {
+		// Rewritten segments always use the current schema, which can't
+		// hold the JSON frames of schema version 0.
+		return ScanResult{}, fmt.Errorf(
+			"can't truncate segment with schema version %d", info.Version)
+	}
+	if info.Options&ENABLE_ENCRYPTION != 0 && settings.EncryptionKey == nil {
+		return ScanResult{}, errors.New(
+			"truncating an encrypted segment requires an encryption key")
+	}
+
+	// The configured level only applies if the segment uses the
+	// configured codec, otherwise the codec's default is used.
+	compressionLevel := 0
+	if info.Options&compressionOptions == settings.CompressionCodec.option() {
+		compressionLevel = settings.CompressionLevel
+	}
+	tmpPath := info.Path + ".truncate"
+	writer, err := newSegmentWriter(
+		tmpPath, info.Options, settings.EncryptionKey, compressionLevel)
+	if err != nil {
+		return ScanResult{}, fmt.Errorf("could not create truncated segment: %w", err)
+	}
+	buf := make([]byte, 0, 4096)
+	result, err := scanSegment(settings, info, func(frame Frame, data []byte) error {
+		buf = binary.LittleEndian.AppendUint32(buf[:0], uint32(frame.Size))
+		buf = append(buf, data...)
+		buf = binary.LittleEndian.AppendUint32(buf, computeChecksum(data))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(frame.Size))
+		_, err := writer.Write(buf)
+		return err
+	})
+	if err == nil {
+		err = writer.UpdateCount(uint32(result.Frames))
+	}
+	if err == nil {
+		err = writer.Sync()
+	}
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || result.Err == nil || result.Frames == 0 {
+		os.Remove(tmpPath)
+		if err != nil {
+			return result, fmt.Errorf("could not truncate segment %d: %w", info.ID, err)
+		}
+		if result.Err != nil {
+			// Nothing to keep, quarantine the whole segment.
+			_, err = QuarantineSegment(settings, info)
+		}
+		return result, err
+	}
+
+	if _, err := QuarantineSegment(settings, info); err != nil {
+		os.Remove(tmpPath)
+		return result, err
+	}
+	if err := os.Rename(tmpPath, info.Path); err != nil {
+		return result, fmt.Errorf("could not replace segment %d: %w", info.ID, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// writeTestSegment writes a segment containing one event per message and
+// returns its info.
+func writeTestSegment(
+	t *testing.T, settings Settings, id segmentID, messages ...string,
+) SegmentInfo {
+	t.Helper()
+	writer, err := (&queueSegment{id: id}).getWriter(settings)
+	require.NoError(t, err)
+	encoder := newEventEncoder(SerializationCBOR)
+	for _, message := range messages {
+		data, err := encoder.encode(publisher.Event{Content: beat.Event{
+			Timestamp: time.Unix(1700000000, 0),
+			Fields:    mapstr.M{"message": message},
+		}})
+		require.NoError(t, err)
+		size := uint32(len(data) + frameMetadataSize)
+		frame := binary.LittleEndian.AppendUint32(nil, size)
+		frame = append(frame, data...)
+		frame = binary.LittleEndian.AppendUint32(frame, computeChecksum(data))
+		frame = binary.LittleEndian.AppendUint32(frame, size)
+		_, err = writer.Write(frame)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.UpdateCount(uint32(len(messages))))
+	require.NoError(t, writer.Close())
+
+	segments, err := ListSegments(settings)
+	require.NoError(t, err)
+	for _, info := range segments {
+		if info.ID == uint64(id) {
+			return info
+		}
+	}
+	t.Fatalf("segment %d not found", id)
+	return SegmentInfo{}
+}
+
+func scanMessages(t *testing.T, settings Settings, info SegmentInfo) ([]string, ScanResult) {
+	t.Helper()
+	var messages []string
+	result, err := ScanSegment(settings, info, func(frame Frame) error {
+		message, _ := frame.Event.Content.Fields.GetValue("message")
+		messages = append(messages, message.(string))
+		return nil
+	})
+	require.NoError(t, err)
+	return messages, result
+}
+
+func TestListSegmentsAndPosition(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.UseCompression = true
+
+	writeTestSegment(t, settings, 3, "a", "b")
+	writeTestSegment(t, settings, 1, "c")
+	require.NoError(t, os.Mkdir(filepath.Join(settings.Path, QuarantineDirectory), 0700))
+
+	segments, err := ListSegments(settings)
+	require.NoError(t, err)
+	require.Len(t, segments, 2)
+	assert.Equal(t, uint64(1), segments[0].ID)
+	assert.Equal(t, uint64(3), segments[1].ID)
+	assert.Equal(t, uint32(currentSegmentVersion), segments[1].Version)
+	assert.Equal(t, uint32(2), segments[1].FrameCount)
+	assert.Equal(t, []string{"compression"}, segments[1].OptionNames())
+
+	_, err = ReadPosition(settings)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	stateFile, err := os.Create(settings.stateFilePath())
+	require.NoError(t, err)
+	require.NoError(t, writeQueuePositionToHandle(stateFile,
+		queuePosition{segmentID: 3, byteIndex: 100, frameIndex: 1}))
+	require.NoError(t, stateFile.Close())
+
+	position, err := ReadPosition(settings)
+	require.NoError(t, err)
+	assert.Equal(t, Position{SegmentID: 3, ByteIndex: 100, FrameIndex: 1}, position)
+	assert.True(t, position.Acked(1, 0))
+	assert.True(t, position.Acked(3, 0))
+	assert.False(t, position.Acked(3, 1))
+}
+
+func TestScanSegment(t *testing.T) {
+	tests := map[string]struct {
+		compress bool
+		encrypt  bool
+	}{
+		"plain":      {},
+		"compressed": {compress: true},
+		"encrypted":  {encrypt: true},
+		"both":       {compress: true, encrypt: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			settings.UseCompression = tc.compress
+			if tc.encrypt {
+				settings.EncryptionKey = testEncryptionKey
+			}
+			info := writeTestSegment(t, settings, 0, "a", "b", "c")
+
+			messages, result := scanMessages(t, settings, info)
+			assert.NoError(t, result.Err)
+			assert.Equal(t, []string{"a", "b", "c"}, messages)
+			assert.Equal(t, uint64(3), result.Frames)
+		})
+	}
+}
+
+func TestTruncateSegment(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	info := writeTestSegment(t, settings, 0, "a", "b", "c")
+
+	// Corrupt the last byte of the second frame's data.
+	_, result := scanMessages(t, settings, info)
+	contents, err := os.ReadFile(info.Path)
+	require.NoError(t, err)
+	frameSize := (result.ValidSize - segmentHeaderSize) / 3
+	contents[segmentHeaderSize+2*frameSize-frameFooterSize-1] ^= 0xff
+	require.NoError(t, os.WriteFile(info.Path, contents, 0600))
+
+	messages, result := scanMessages(t, settings, info)
+	assert.Error(t, result.Err)
+	assert.Equal(t, []string{"a"}, messages)
+
+	result, err = TruncateSegment(settings, info)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), result.Frames)
+
+	// The original segment is kept in the quarantine directory.
+	_, err = os.Stat(filepath.Join(settings.Path, QuarantineDirectory, "0.seg"))
+	assert.NoError(t, err)
+
+	segments, err := ListSegments(settings)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, uint32(1), segments[0].FrameCount)
+	messages, result = scanMessages(t, settings, segments[0])
+	assert.NoError(t, result.Err)
+	assert.Equal(t, []string{"a"}, messages)
+}
+
+func TestQuarantineSegment(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	info := writeTestSegment(t, settings, 7, "a")
+
+	path, err := QuarantineSegment(settings, info)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(settings.Path, QuarantineDirectory, "7.seg"), path)
+
+	segments, err := ListSegments(settings)
+	require.NoError(t, err)
+	assert.Empty(t, segments)
+}
@@ -70,13 +70,26 @@ func TestProduceConsumer(t *testing.T) {
 	}
 
 	t.Run("direct", testWith(makeTestQueue()))
+	t.Run("zstd", testWith(makeTestQueueWith(func(settings *Settings) {
+		settings.UseCompression = true
+		settings.CompressionCodec = CompressionZstd
+	})))
 }
 
 func makeTestQueue() queuetest.QueueFactory {
+	return makeTestQueueWith(nil)
+}
+
+// makeTestQueueWith returns a factory for queues with default settings
+// adjusted by the given function.
+func makeTestQueueWith(adjust func(*Settings)) queuetest.QueueFactory {
 	return func(t *testing.T) queue.Queue {
 		dir := t.TempDir()
 		settings := DefaultSettings()
 		settings.Path = dir
+		if adjust != nil {
+			adjust(&settings)
+		}
 		logger := logptest.NewTestingLogger(t, "")
 		queue, _ := NewQueue(logger, nil, settings, nil)
 		return testQueue{
@@ -19,6 +19,7 @@ package diskqueue
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -218,14 +219,14 @@ func (rl *readerLoop) nextFrame(handle *segmentReader, maxLength uint64) (*readF
 	bytes := rl.decoder.Buffer(int(dataLength))
 	_, err = reader.Read(bytes)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read data frame content: %w", err)
+		return nil, fmt.Errorf("couldn't read data frame content: %w", truncatedFrameError(err))
 	}
 
 	// Read the footer (checksum + duplicate length)
 	var checksum uint32
 	err = binary.Read(reader, binary.LittleEndian, &checksum)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read data frame checksum: %w", err)
+		return nil, fmt.Errorf("couldn't read data frame checksum: %w", truncatedFrameError(err))
 	}
 	expected := computeChecksum(bytes)
 	if checksum != expected {
@@ -236,7 +237,7 @@ func (rl *readerLoop) nextFrame(handle *segmentReader, maxLength uint64) (*readF
 	var duplicateLength uint32
 	err = binary.Read(reader, binary.LittleEndian, &duplicateLength)
 	if err != nil {
-		return nil, fmt.Errorf("couldn't read data frame footer: %w", err)
+		return nil, fmt.Errorf("couldn't read data frame footer: %w", truncatedFrameError(err))
 	}
 	if duplicateLength != frameLength {
 		return nil, fmt.Errorf(
@@ -262,3 +263,13 @@ func (rl *readerLoop) nextFrame(handle *segmentReader, maxLength uint64) (*readF
 
 	return frame, nil
 }
+
+// truncatedFrameError converts io.EOF into io.ErrUnexpectedEOF for reads
+// in the middle of a frame, so io.EOF from nextFrame always means that the
+// segment ended cleanly on a frame boundary.
+func truncatedFrameError(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -150,11 +150,17 @@ const currentSegmentVersion = 2
 const segmentHeaderSize = 12
 
 const (
-	_                  uint32 = 1 << iota // 0x1
-	ENABLE_COMPRESSION                    // 0x2
-	ENABLE_PROTOBUF                       // 0x4
+	_                       uint32 = 1 << iota // 0x1
+	ENABLE_COMPRESSION                         // 0x2
+	ENABLE_PROTOBUF                            // 0x4
+	ENABLE_ENCRYPTION                          // 0x8
+	ENABLE_ZSTD_COMPRESSION                    // 0x10
 )
 
+// compressionOptions is the set of options that select a compression
+// codec, at most one of them may be set.
+const compressionOptions = ENABLE_COMPRESSION | ENABLE_ZSTD_COMPRESSION
+
 // Sort order: we store loaded segments in ascending order by their id.
 type bySegmentID []*queueSegment
 
@@ -255,8 +261,32 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 		sr.serializationFormat = SerializationCBOR
 	}
 
-	if (header.options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sr.cr = NewCompressionReader(sr.src)
+	if (header.options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		sr.er, err = NewEncryptionReader(sr.src, queueSettings.decryptionKeys())
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf(
+				"couldn't set up decryption for segment %d: %w", segment.id, err)
+		}
+	}
+
+	var compressed io.ReadCloser = sr.src
+	if sr.er != nil {
+		compressed = sr.er
+	}
+	switch header.options & compressionOptions {
+	case 0:
+	case ENABLE_COMPRESSION:
+		sr.cr = NewCompressionReader(compressed)
+	case ENABLE_ZSTD_COMPRESSION:
+		sr.cr, err = NewZstdCompressionReader(compressed)
+	default:
+		err = fmt.Errorf("conflicting compression options %#x", header.options)
+	}
+	if err != nil {
+		sr.Close()
+		return nil, fmt.Errorf(
+			"couldn't set up decompression for segment %d: %w", segment.id, err)
 	}
 	return sr, nil
 }
@@ -266,16 +296,31 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 // from the writer loop.
 func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter, error) {
 	var options uint32
-	path := queueSettings.segmentPath(segment.id)
+	if queueSettings.UseCompression {
+		options = options | queueSettings.CompressionCodec.option()
+	}
+
+	if queueSettings.EncryptionKey != nil {
+		options = options | ENABLE_ENCRYPTION
+	}
+
+	return newSegmentWriter(
+		queueSettings.segmentPath(segment.id), options,
+		queueSettings.EncryptionKey, queueSettings.CompressionLevel)
+}
+
+// newSegmentWriter creates the segment file at the given path and writes
+// its header with the given options. The key is only used when the
+// options enable encryption, the compression level only when they enable
+// compression.
+func newSegmentWriter(
+	path string, options uint32, key []byte, compressionLevel int,
+) (*segmentWriter, error) {
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return nil, err
 	}
 
-	if queueSettings.UseCompression {
-		options = options | ENABLE_COMPRESSION
-	}
-
 	sw := &segmentWriter{}
 	sw.dst = file
 
@@ -283,8 +328,30 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 		return nil, err
 	}
 
-	if (options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sw.cw = NewCompressionWriter(sw.dst)
+	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		sw.ew, err = NewEncryptionWriter(sw.dst, key)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	var compressed WriteCloseSyncer = sw.dst
+	if sw.ew != nil {
+		compressed = sw.ew
+	}
+	switch options & compressionOptions {
+	case 0:
+	case ENABLE_COMPRESSION:
+		sw.cw, err = NewCompressionWriterForCodec(compressed, CompressionLZ4, compressionLevel)
+	case ENABLE_ZSTD_COMPRESSION:
+		sw.cw, err = NewCompressionWriterForCodec(compressed, CompressionZstd, compressionLevel)
+	default:
+		err = fmt.Errorf("conflicting compression options %#x", options)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
 	return sw, nil
@@ -443,6 +510,7 @@ func (segments *diskQueueSegments) sizeOnDisk() uint64 {
 // less compressable.
 type segmentReader struct {
 	src                 io.ReadSeekCloser
+	er                  *EncryptionReader
 	cr                  *CompressionReader
 	serializationFormat SerializationFormat
 }
@@ -451,6 +519,9 @@ func (r *segmentReader) Read(p []byte) (int, error) {
 	if r.cr != nil {
 		return r.cr.Read(p)
 	}
+	if r.er != nil {
+		return r.er.Read(p)
+	}
 	return r.src.Read(p)
 }
 
@@ -458,11 +529,17 @@ func (r *segmentReader) Close() error {
 	if r.cr != nil {
 		return r.cr.Close()
 	}
+	if r.er != nil {
+		return r.er.Close()
+	}
 	return r.src.Close()
 }
 
+// Seek positions the reader at the given logical offset. Compressed and
+// encrypted streams can't seek directly, so they are restarted from the
+// beginning of the data region and read up to the requested offset.
 func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
-	if r.cr != nil {
+	if r.cr != nil || r.er != nil {
 		//can't seek before segment header
 		if (offset + int64(whence)) < segmentHeaderSize {
 			return 0, fmt.Errorf("illegal seek offset %d, whence %d", offset, whence)
@@ -470,10 +547,20 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 		if _, err := r.src.Seek(segmentHeaderSize, io.SeekStart); err != nil {
 			return 0, fmt.Errorf("could not seek past segment header: %w", err)
 		}
-		if err := r.cr.Reset(); err != nil {
-			return 0, fmt.Errorf("could not reset compression: %w", err)
+		var reader io.Reader = r.src
+		if r.er != nil {
+			if err := r.er.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset encryption: %w", err)
+			}
+			reader = r.er
 		}
-		written, err := io.CopyN(io.Discard, r.cr, (offset+int64(whence))-segmentHeaderSize)
+		if r.cr != nil {
+			if err := r.cr.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset compression: %w", err)
+			}
+			reader = r.cr
+		}
+		written, err := io.CopyN(io.Discard, reader, (offset+int64(whence))-segmentHeaderSize)
 		return written + segmentHeaderSize, err
 	}
 	return r.src.Seek(offset, whence)
@@ -488,6 +575,7 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 // data less compressable.
 type segmentWriter struct {
 	dst *os.File
+	ew  *EncryptionWriter
 	cw  *CompressionWriter
 }
 
@@ -495,6 +583,9 @@ func (w *segmentWriter) Write(p []byte) (int, error) {
 	if w.cw != nil {
 		return w.cw.Write(p)
 	}
+	if w.ew != nil {
+		return w.ew.Write(p)
+	}
 	return w.dst.Write(p)
 }
 
@@ -502,6 +593,9 @@ func (w *segmentWriter) Close() error {
 	if w.cw != nil {
 		return w.cw.Close()
 	}
+	if w.ew != nil {
+		return w.ew.Close()
+	}
 	return w.dst.Close()
 }
 
@@ -509,6 +603,9 @@ func (w *segmentWriter) Sync() error {
 	if w.cw != nil {
 		return w.cw.Sync()
 	}
+	if w.ew != nil {
+		return w.ew.Sync()
+	}
 	return w.dst.Sync()
 }
 
@@ -22,12 +22,15 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSegmentsRoundTrip(t *testing.T) {
 	tests := map[string]struct {
 		id        segmentID
 		compress  bool
+		codec     CompressionCodec
+		encrypt   bool
 		plaintext []byte
 	}{
 		"No Compression": {
@@ -40,6 +43,30 @@ func TestSegmentsRoundTrip(t *testing.T) {
 			compress:  true,
 			plaintext: []byte("compression only"),
 		},
+		"With Encryption": {
+			id:        3,
+			encrypt:   true,
+			plaintext: []byte("encryption only"),
+		},
+		"With Encryption and Compression": {
+			id:        4,
+			compress:  true,
+			encrypt:   true,
+			plaintext: []byte("encryption and compression"),
+		},
+		"With Zstd Compression": {
+			id:        5,
+			compress:  true,
+			codec:     CompressionZstd,
+			plaintext: []byte("zstd compression only"),
+		},
+		"With Encryption and Zstd Compression": {
+			id:        6,
+			compress:  true,
+			codec:     CompressionZstd,
+			encrypt:   true,
+			plaintext: []byte("encryption and zstd compression"),
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
@@ -47,6 +74,10 @@ func TestSegmentsRoundTrip(t *testing.T) {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.CompressionCodec = tc.codec
+		if tc.encrypt {
+			settings.EncryptionKey = testEncryptionKey
+		}
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -80,10 +111,45 @@ func TestSegmentsRoundTrip(t *testing.T) {
 	}
 }
 
+func TestSegmentsMixedCompression(t *testing.T) {
+	// Segments written before the codec was changed must stay readable,
+	// the reader picks the codec from the segment header.
+	dir := t.TempDir()
+	settings := DefaultSettings()
+	settings.Path = dir
+	settings.UseCompression = true
+	codecs := []CompressionCodec{CompressionLZ4, CompressionZstd}
+	for i, codec := range codecs {
+		settings.CompressionCodec = codec
+		qs := &queueSegment{id: segmentID(i)}
+		sw, err := qs.getWriter(settings)
+		require.NoError(t, err)
+		_, err = sw.Write([]byte(codec.String()))
+		require.NoError(t, err)
+		require.NoError(t, sw.Close())
+	}
+
+	infos, err := ListSegments(settings)
+	require.NoError(t, err)
+	require.Len(t, infos, len(codecs))
+	for i, codec := range codecs {
+		assert.Equal(t, codec.option(), infos[i].Options&compressionOptions)
+		qs := infos[i].queueSegment()
+		sr, err := qs.getReader(settings)
+		require.NoError(t, err)
+		data, err := io.ReadAll(sr)
+		require.NoError(t, err)
+		assert.Equal(t, codec.String(), string(data))
+		require.NoError(t, sr.Close())
+	}
+}
+
 func TestSegmentReaderSeek(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		compress   bool
+		codec      CompressionCodec
+		encrypt    bool
 		plaintexts [][]byte
 	}{
 		"No Compression": {
@@ -96,12 +162,33 @@ func TestSegmentReaderSeek(t *testing.T) {
 			compress:   true,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
+		"With Encryption": {
+			id:         3,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"With Encryption and Compression": {
+			id:         4,
+			compress:   true,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"With Zstd Compression": {
+			id:         5,
+			compress:   true,
+			codec:      CompressionZstd,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.CompressionCodec = tc.codec
+		if tc.encrypt {
+			settings.EncryptionKey = testEncryptionKey
+		}
 
 		qs := &queueSegment{
 			id: tc.id,
@@ -136,6 +223,8 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		compress   bool
+		codec      CompressionCodec
+		encrypt    bool
 		plaintexts [][]byte
 		location   int64
 	}{
@@ -151,12 +240,29 @@ func TestSegmentReaderSeekLocations(t *testing.T) {
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 			location:   2,
 		},
+		"Encryption": {
+			id:         2,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+			location:   2,
+		},
+		"Zstd Compression": {
+			id:         3,
+			compress:   true,
+			codec:      CompressionZstd,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+			location:   2,
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		settings.CompressionCodec = tc.codec
+		if tc.encrypt {
+			settings.EncryptionKey = testEncryptionKey
+		}
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -23,6 +23,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -59,8 +60,9 @@ type broker struct {
 	///////////////////////////
 	// api channels
 
-	// Producers send requests to pushChan to add events to the queue.
-	pushChan chan pushRequest
+	// Producers send requests to the pushChan of their priority lane to add
+	// events to the queue.
+	pushChans [laneCount]chan pushRequest
 
 	// Consumers send requests to getChan to read events from the queue.
 	getChan chan getRequest
@@ -105,6 +107,12 @@ type Settings struct {
 	// If positive, the amount of time the queue will wait to fill up
 	// a batch if a Get request asks for more events than we have.
 	FlushTimeout time.Duration
+
+	// The minimum share of admissions each priority class below the
+	// highest waiting one is guaranteed while the queue is full. If zero,
+	// producers of a lower priority class only get to add events when no
+	// producer of a higher class is waiting.
+	PriorityMinShare float64
 }
 
 type queueEntry struct {
@@ -114,6 +122,8 @@ type queueEntry struct {
 
 	producer   *ackProducer
 	producerID producerID // The order of this entry within its producer
+
+	priority beat.Priority
 }
 
 type batch struct {
@@ -218,7 +228,6 @@ func newQueue(
 		encoderFactory: encoderFactory,
 
 		// broker API channels
-		pushChan:  make(chan pushRequest, chanSize),
 		getChan:   make(chan getRequest),
 		closeChan: make(chan struct{}),
 
@@ -227,6 +236,9 @@ func newQueue(
 		deleteChan:   make(chan int),
 		closingChan:  make(chan struct{}),
 	}
+	for lane := range b.pushChans {
+		b.pushChans[lane] = make(chan pushRequest, chanSize)
+	}
 	b.ctx, b.ctxCancel = context.WithCancel(context.Background())
 
 	b.runLoop = newRunLoop(b, observer)
@@ -264,7 +276,7 @@ func (b *broker) Producer(cfg queue.ProducerConfig) queue.Producer {
 	if b.encoderFactory != nil {
 		encoder = b.encoderFactory()
 	}
-	return newProducer(b, cfg.ACK, encoder)
+	return newProducer(b, cfg.ACK, encoder, cfg.Priority)
 }
 
 func (b *broker) Get(count int) (queue.Batch, error) {
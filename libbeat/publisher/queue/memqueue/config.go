@@ -33,18 +33,27 @@ type config struct {
 	// since it used to control buffer size in the internal buffer chain.
 	MaxGetRequest int           `config:"flush.min_events" validate:"min=0"`
 	FlushTimeout  time.Duration `config:"flush.timeout"`
+
+	PriorityMinShare float64 `config:"priority.min_share" validate:"min=0"`
 }
 
 var defaultConfig = config{
-	Events:        3200,
-	MaxGetRequest: 1600,
-	FlushTimeout:  10 * time.Second,
+	Events:           3200,
+	MaxGetRequest:    1600,
+	FlushTimeout:     10 * time.Second,
+	PriorityMinShare: DefaultPriorityMinShare,
 }
 
 func (c *config) Validate() error {
 	if c.MaxGetRequest > c.Events {
 		return errors.New("flush.min_events must be less events")
 	}
+	// Each of the two lower priority classes can be guaranteed at most
+	// half of the admissions.
+	if c.PriorityMinShare > 0.5 {
+		return fmt.Errorf(
+			"priority.min_share (%v) must be between 0 and 0.5", c.PriorityMinShare)
+	}
 	return nil
 }
 
@@ -59,8 +68,9 @@ func SettingsForUserConfig(cfg *c.C) (Settings, error) {
 	}
 	//nolint:gosimple // Actually want this conversion to be explicit since the types aren't definitionally equal.
 	return Settings{
-		Events:        config.Events,
-		MaxGetRequest: config.MaxGetRequest,
-		FlushTimeout:  config.FlushTimeout,
+		Events:           config.Events,
+		MaxGetRequest:    config.MaxGetRequest,
+		FlushTimeout:     config.FlushTimeout,
+		PriorityMinShare: config.PriorityMinShare,
 	}, nil
 }
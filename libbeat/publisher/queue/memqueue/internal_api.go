@@ -17,7 +17,10 @@
 
 package memqueue
 
-import "github.com/elastic/beats/v7/libbeat/publisher/queue"
+import (
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
 
 // producer -> broker API
 
@@ -36,6 +39,9 @@ type pushRequest struct {
 	// multiple acknowledgments for a producer to a single callback call.
 	producerID producerID
 	resp       chan queue.EntryID
+
+	// The priority class of the producer.
+	priority beat.Priority
 }
 
 // consumer -> broker API
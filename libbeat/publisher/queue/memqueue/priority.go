@@ -0,0 +1,115 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package memqueue
+
+import "github.com/elastic/beats/v7/libbeat/beat"
+
+// Producers are assigned to one of several priority lanes based on their
+// priority class. Every lane has its own push channel. While the queue
+// has free space, requests are admitted in the order they arrive. Once it
+// is full, the oldest request of each lane waits in the run loop and every
+// freed slot is handed to a lane by the laneScheduler.
+//
+// Admitted events share the same FIFO buffer, so priorities only decide
+// the order in which blocked producers enter the queue, not the order in
+// which consumers see events.
+
+// laneCount is the number of priority lanes, one for each beat.Priority.
+const laneCount = 3
+
+// DefaultPriorityMinShare is the default share of admissions that lower
+// priority lanes are guaranteed while the queue is full.
+const DefaultPriorityMinShare = 0.1
+
+// laneForPriority returns the lane for the given priority class. Lane 0
+// has the highest priority. Unknown priorities are clamped to the nearest
+// class.
+func laneForPriority(priority beat.Priority) int {
+	if priority > beat.PriorityHigh {
+		priority = beat.PriorityHigh
+	}
+	if priority < beat.PriorityLow {
+		priority = beat.PriorityLow
+	}
+	return int(beat.PriorityHigh - priority)
+}
+
+// priorityForLane is the inverse of laneForPriority.
+func priorityForLane(lane int) beat.Priority {
+	return beat.PriorityHigh - beat.Priority(lane)
+}
+
+// laneScheduler picks the lane to admit the next event from when several
+// lanes are waiting for space in the queue. Higher priority lanes are
+// preferred, but each lower lane is guaranteed at least minShare of the
+// admissions made while lanes are competing, so it can't be starved.
+type laneScheduler struct {
+	minShare float64
+
+	// admitted counts the contended admissions per lane. The counts are
+	// halved whenever total reaches window, so the shares reflect recent
+	// history rather than the whole lifetime of the queue.
+	admitted [laneCount]int
+	total    int
+	window   int
+}
+
+func newLaneScheduler(minShare float64, window int) laneScheduler {
+	if window < 2 {
+		window = 2
+	}
+	return laneScheduler{minShare: minShare, window: window}
+}
+
+// next returns the lane to admit from, given which lanes have a waiting
+// request, or -1 if no lane is waiting.
+func (s *laneScheduler) next(waiting [laneCount]bool) int {
+	first := -1
+	contenders := 0
+	for lane, ok := range waiting {
+		if ok {
+			if first < 0 {
+				first = lane
+			}
+			contenders++
+		}
+	}
+	if contenders <= 1 {
+		// Without competition there is nothing to account for.
+		return first
+	}
+
+	chosen := first
+	for lane := first + 1; lane < laneCount; lane++ {
+		if waiting[lane] && float64(s.admitted[lane]) < s.minShare*float64(s.total) {
+			chosen = lane
+			break
+		}
+	}
+
+	s.admitted[chosen]++
+	s.total++
+	if s.total >= s.window {
+		s.total = 0
+		for lane := range s.admitted {
+			s.admitted[lane] /= 2
+			s.total += s.admitted[lane]
+		}
+	}
+	return chosen
+}
@@ -18,6 +18,7 @@
 package memqueue
 
 import (
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
@@ -40,6 +41,7 @@ type openState struct {
 	queueClosing <-chan struct{}
 	events       chan pushRequest
 	encoder      queue.Encoder
+	priority     beat.Priority
 }
 
 // producerID stores the order of events within a single producer, so multiple
@@ -55,13 +57,16 @@ type produceState struct {
 
 type ackHandler func(count int)
 
-func newProducer(b *broker, cb ackHandler, encoder queue.Encoder) queue.Producer {
+func newProducer(
+	b *broker, cb ackHandler, encoder queue.Encoder, priority beat.Priority,
+) queue.Producer {
 	openState := openState{
 		log:          b.logger,
 		done:         make(chan struct{}),
 		queueClosing: b.closingChan,
-		events:       b.pushChan,
+		events:       b.pushChans[laneForPriority(priority)],
 		encoder:      encoder,
+		priority:     priority,
 	}
 
 	if cb != nil {
@@ -132,6 +137,7 @@ func (st *openState) publish(req pushRequest) (queue.EntryID, bool) {
 	if st.encoder != nil {
 		req.event, req.eventSize = st.encoder.EncodeEntry(req.event)
 	}
+	req.priority = st.priority
 	select {
 	case st.events <- req:
 		// The events channel is buffered, which means we may successfully
@@ -160,6 +166,7 @@ func (st *openState) tryPublish(req pushRequest) (queue.EntryID, bool) {
 	if st.encoder != nil {
 		req.event, req.eventSize = st.encoder.EncodeEntry(req.event)
 	}
+	req.priority = st.priority
 	select {
 	case st.events <- req:
 		// The events channel is buffered, which means we may successfully
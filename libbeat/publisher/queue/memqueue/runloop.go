@@ -60,6 +60,14 @@ type runLoop struct {
 	// It is active if and only if pendingGetRequest is non-nil.
 	getTimer *time.Timer
 
+	// pendingPush holds the oldest push request of each priority lane that
+	// could not be added yet because the queue is full.
+	pendingPush [laneCount]*pushRequest
+
+	// scheduler picks the lane that gets the next free slot when several
+	// lanes are waiting.
+	scheduler laneScheduler
+
 	// closing is set when a close request is received. Once closing is true,
 	// the queue will not accept any new events, but will continue responding
 	// to Gets and Acks to allow pending events to complete on shutdown.
@@ -86,6 +94,8 @@ func newRunLoop(broker *broker, observer queue.Observer) *runLoop {
 		broker:   broker,
 		observer: observer,
 		getTimer: timer,
+		scheduler: newLaneScheduler(
+			broker.settings.PriorityMinShare, len(broker.buf)),
 	}
 }
 
@@ -98,10 +108,16 @@ func (l *runLoop) run() {
 // Perform one iteration of the queue's main run loop. Broken out into a
 // standalone helper function to allow testing of loop invariants.
 func (l *runLoop) runIteration() {
-	var pushChan chan pushRequest
-	// Push requests are enabled if the queue isn't full or closing.
-	if l.eventCount < len(l.broker.buf) && !l.closing {
-		pushChan = l.broker.pushChan
+	var pushChans [laneCount]chan pushRequest
+	// Push requests are enabled if the queue isn't closing. While the queue
+	// is full we still read the oldest request of each lane, so the next
+	// free slot can be given to the lane with the highest priority.
+	if !l.closing {
+		for lane, req := range l.pendingPush {
+			if req == nil {
+				pushChans[lane] = l.broker.pushChans[lane]
+			}
+		}
 	}
 
 	var getChan chan getRequest
@@ -128,6 +144,8 @@ func (l *runLoop) runIteration() {
 	case <-l.broker.closeChan:
 		l.closing = true
 		close(l.broker.closingChan)
+		// Producers waiting for a slot give up once closingChan is closed.
+		l.pendingPush = [laneCount]*pushRequest{}
 		// Get requests are handled immediately during shutdown
 		l.maybeUnblockGetRequest()
 
@@ -135,8 +153,13 @@ func (l *runLoop) runIteration() {
 		// The queue is fully shut down, do nothing
 		return
 
-	case req := <-pushChan: // producer pushing new event
-		l.handleInsert(&req)
+	// producers pushing new events, one case per priority lane
+	case req := <-pushChans[0]:
+		l.handlePush(0, &req)
+	case req := <-pushChans[1]:
+		l.handlePush(1, &req)
+	case req := <-pushChans[2]:
+		l.handlePush(2, &req)
 
 	case req := <-getChan: // consumer asking for next batch
 		l.handleGetRequest(&req)
@@ -210,9 +233,11 @@ func (l *runLoop) handleGetReply(req *getRequest) {
 
 func (l *runLoop) handleDelete(count int) {
 	byteCount := 0
+	var laneCounts [laneCount]int
 	for i := 0; i < count; i++ {
 		entry := l.broker.buf[(l.bufPos+i)%len(l.broker.buf)]
 		byteCount += entry.eventSize
+		laneCounts[laneForPriority(entry.priority)]++
 	}
 	// Advance position and counters. Event data was already cleared in
 	// batch.FreeEntries when the events were vended.
@@ -220,6 +245,39 @@ func (l *runLoop) handleDelete(count int) {
 	l.eventCount -= count
 	l.consumedCount -= count
 	l.observer.RemoveEvents(count, byteCount)
+	for lane, laneCount := range laneCounts {
+		if laneCount > 0 {
+			l.observer.RemovePriorityEvents(priorityForLane(lane), laneCount)
+		}
+	}
+
+	// The deleted events made room for waiting producers
+	l.admitPending()
+}
+
+// handlePush queues a push request received on the given lane and adds
+// it to the queue if there is space.
+func (l *runLoop) handlePush(lane int, req *pushRequest) {
+	l.pendingPush[lane] = req
+	l.admitPending()
+}
+
+// admitPending adds pending push requests to the queue while there is
+// space, letting the scheduler pick between the waiting lanes.
+func (l *runLoop) admitPending() {
+	for l.eventCount < len(l.broker.buf) && !l.closing {
+		var waiting [laneCount]bool
+		for lane, req := range l.pendingPush {
+			waiting[lane] = req != nil
+		}
+		lane := l.scheduler.next(waiting)
+		if lane < 0 {
+			return
+		}
+		req := l.pendingPush[lane]
+		l.pendingPush[lane] = nil
+		l.handleInsert(req)
+	}
 }
 
 func (l *runLoop) handleInsert(req *pushRequest) {
@@ -257,6 +315,8 @@ func (l *runLoop) insert(req *pushRequest, id queue.EntryID) {
 		id:         id,
 		producer:   req.producer,
 		producerID: req.producerID,
+		priority:   req.priority,
 	}
 	l.observer.AddEvent(req.eventSize)
+	l.observer.AddPriorityEvent(req.priority)
 }
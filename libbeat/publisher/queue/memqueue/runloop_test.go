@@ -26,6 +26,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/publisher"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -51,7 +52,7 @@ func TestFlushSettingsDoNotBlockFullBatches(t *testing.T) {
 		},
 		10, nil)
 
-	producer := newProducer(broker, nil, nil)
+	producer := newProducer(broker, nil, nil, beat.PriorityNormal)
 	rl := broker.runLoop
 	for i := 0; i < 100; i++ {
 		// Pair each publish call with an iteration of the run loop so we
@@ -90,7 +91,7 @@ func TestFlushSettingsBlockPartialBatches(t *testing.T) {
 		},
 		10, nil)
 
-	producer := newProducer(broker, nil, nil)
+	producer := newProducer(broker, nil, nil, beat.PriorityNormal)
 	rl := broker.runLoop
 	for i := 0; i < 100; i++ {
 		// Pair each publish call with an iteration of the run loop so we
@@ -221,6 +222,99 @@ func TestObserverRemoveEvents(t *testing.T) {
 	assertRegistryUint(t, reg, "queue.removed.bytes", deleteCount*123, "Deleting from the queue should report the removed bytes")
 }
 
+func TestPriorityLanesAdmitHigherPriorityFirst(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+	broker := newQueue(
+		logger.Named("testing"),
+		nil,
+		Settings{
+			Events:        2,
+			MaxGetRequest: 2,
+		},
+		10, nil)
+	rl := broker.runLoop
+
+	// Fill the queue with normal priority events. The run loop is driven
+	// from the test goroutine, so it never runs concurrently with the
+	// assertions below.
+	normal := newProducer(broker, nil, nil, beat.PriorityNormal)
+	for i := 0; i < 2; i++ {
+		go normal.Publish(i)
+		rl.runIteration()
+	}
+
+	// A low and then a high priority producer block on the full queue.
+	published := make(chan beat.Priority, 2)
+	for _, priority := range []beat.Priority{beat.PriorityLow, beat.PriorityHigh} {
+		producer := newProducer(broker, nil, nil, priority)
+		go func() {
+			if _, ok := producer.Publish(priority); ok {
+				published <- priority
+			}
+		}()
+		rl.runIteration()
+	}
+	require.NotNil(t, rl.pendingPush[laneForPriority(beat.PriorityHigh)])
+	require.NotNil(t, rl.pendingPush[laneForPriority(beat.PriorityLow)])
+	assert.Equal(t, 2, rl.eventCount, "Blocked requests must not be added to a full queue")
+
+	// Freeing one slot admits the high priority event even though the low
+	// priority one was waiting longer.
+	rl.handleDelete(1)
+	assert.Equal(t, beat.PriorityHigh, <-published)
+	assert.Nil(t, rl.pendingPush[laneForPriority(beat.PriorityHigh)])
+	assert.NotNil(t, rl.pendingPush[laneForPriority(beat.PriorityLow)])
+
+	rl.handleDelete(1)
+	assert.Equal(t, beat.PriorityLow, <-published)
+}
+
+func TestLaneSchedulerMinShare(t *testing.T) {
+	allWaiting := [laneCount]bool{true, true, true}
+
+	strict := newLaneScheduler(0, 100)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, 0, strict.next(allWaiting), "Without a minimum share the highest lane always wins")
+	}
+
+	const admissions = 1000
+	shared := newLaneScheduler(0.1, 100)
+	var counts [laneCount]int
+	for i := 0; i < admissions; i++ {
+		counts[shared.next(allWaiting)]++
+	}
+	assert.GreaterOrEqual(t, counts[1], admissions/10-1, "Normal lane must get its minimum share")
+	assert.GreaterOrEqual(t, counts[2], admissions/10-1, "Low lane must get its minimum share")
+	assert.Greater(t, counts[0], counts[1]+counts[2], "High lane must get the remaining admissions")
+
+	// A single waiting lane is always picked, whatever its share.
+	assert.Equal(t, 2, shared.next([laneCount]bool{false, false, true}))
+	assert.Equal(t, -1, shared.next([laneCount]bool{}))
+}
+
+func TestObserverPriorityEvents(t *testing.T) {
+	reg := monitoring.NewRegistry()
+	rl := &runLoop{
+		observer: queue.NewQueueObserver(reg),
+		broker: &broker{
+			buf: make([]queueEntry, 100),
+		},
+	}
+	rl.observer.MaxEvents(len(rl.broker.buf))
+	rl.insert(&pushRequest{priority: beat.PriorityHigh}, 0)
+	rl.eventCount++
+	rl.insert(&pushRequest{priority: beat.PriorityLow}, 1)
+	rl.eventCount++
+	assertRegistryUint(t, reg, "queue.priority.high.filled.events", 1, "Queue insert should report the filled events of the priority class")
+	assertRegistryUint(t, reg, "queue.priority.low.added.events", 1, "Queue insert should report the added events of the priority class")
+
+	rl.consumedCount = 2
+	rl.handleDelete(1)
+	assertRegistryUint(t, reg, "queue.priority.high.filled.events", 0, "Deleting from the queue should update the filled events of the priority class")
+	assertRegistryUint(t, reg, "queue.priority.high.removed.events", 1, "Deleting from the queue should report the removed events of the priority class")
+	assertRegistryUint(t, reg, "queue.priority.low.filled.events", 1, "Deleting other events should not change the priority class")
+}
+
 func assertRegistryUint(t *testing.T, reg *monitoring.Registry, key string, expected uint64, message string) {
 	t.Helper()
 
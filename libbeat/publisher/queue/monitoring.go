@@ -18,6 +18,7 @@
 package queue
 
 import (
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/elastic-agent-libs/monitoring"
 )
 
@@ -36,6 +37,11 @@ type Observer interface {
 	AddEvent(byteCount int)
 	ConsumeEvents(eventCount int, byteCount int)
 	RemoveEvents(eventCount int, byteCount int)
+
+	// Per priority class counts, only updated by queues that support
+	// priority classes. They are reported in addition to the totals above.
+	AddPriorityEvent(priority beat.Priority)
+	RemovePriorityEvents(priority beat.Priority, eventCount int)
 }
 
 type queueObserver struct {
@@ -59,6 +65,22 @@ type queueObserver struct {
 	// extra variable and make sure to always change removedEvents and
 	// acked at the same time.
 	acked *monitoring.Uint
+
+	// Metrics for each priority class, indexed by priorityIndex. Queues
+	// without priority classes leave them at zero.
+	priorityClasses [priorityClassCount]*priorityObserver
+}
+
+// priorityClassCount is the number of classes in beat.Priorities.
+const priorityClassCount = 3
+
+// priorityObserver holds the metrics of a single priority class under
+// "pipeline.queue.priority.<class>".
+type priorityObserver struct {
+	addedEvents   *monitoring.Uint
+	removedEvents *monitoring.Uint
+	filledEvents  *monitoring.Uint  // gauge
+	filledPct     *monitoring.Float // gauge
 }
 
 type nilObserver struct{}
@@ -96,6 +118,15 @@ func NewQueueObserver(metrics *monitoring.Registry) Observer {
 		// backwards compatibility: "acked" is an alias for "removed.events".
 		acked: monitoring.NewUint(queueMetrics, "acked"),
 	}
+	for _, priority := range beat.Priorities {
+		prefix := "priority." + priority.String() + "."
+		ob.priorityClasses[priorityIndex(priority)] = &priorityObserver{
+			addedEvents:   monitoring.NewUint(queueMetrics, prefix+"added.events"),
+			removedEvents: monitoring.NewUint(queueMetrics, prefix+"removed.events"),
+			filledEvents:  monitoring.NewUint(queueMetrics, prefix+"filled.events"), // gauge
+			filledPct:     monitoring.NewFloat(queueMetrics, prefix+"filled.pct"),   // gauge
+		}
+	}
 	return ob
 }
 
@@ -137,6 +168,42 @@ func (ob *queueObserver) RemoveEvents(eventCount int, byteCount int) {
 	ob.updateFilledPct()
 }
 
+func (ob *queueObserver) AddPriorityEvent(priority beat.Priority) {
+	po := ob.priorityClasses[priorityIndex(priority)]
+	po.addedEvents.Inc()
+	po.filledEvents.Inc()
+	po.filledPct.Set(ob.eventsPct(po.filledEvents.Get()))
+}
+
+func (ob *queueObserver) RemovePriorityEvents(priority beat.Priority, eventCount int) {
+	po := ob.priorityClasses[priorityIndex(priority)]
+	po.removedEvents.Add(uint64(eventCount))
+	po.filledEvents.Sub(uint64(eventCount))
+	po.filledPct.Set(ob.eventsPct(po.filledEvents.Get()))
+}
+
+// priorityIndex returns the index of a priority class in priorityClasses.
+// Like the lanes of the memory queue, index 0 is the highest class and
+// unknown priorities are clamped to the nearest class.
+func priorityIndex(priority beat.Priority) int {
+	if priority > beat.PriorityHigh {
+		priority = beat.PriorityHigh
+	}
+	if priority < beat.PriorityLow {
+		priority = beat.PriorityLow
+	}
+	return int(beat.PriorityHigh - priority)
+}
+
+// eventsPct returns the given event count as a fraction of the queue's
+// maximum event count.
+func (ob *queueObserver) eventsPct(eventCount uint64) float64 {
+	if maxEvents := ob.maxEvents.Get(); maxEvents > 0 {
+		return float64(eventCount) / float64(maxEvents)
+	}
+	return 0
+}
+
 func (ob *queueObserver) updateFilledPct() {
 	if maxBytes := ob.maxBytes.Get(); maxBytes > 0 {
 		ob.filledPct.Set(float64(ob.filledBytes.Get()) / float64(maxBytes))
@@ -145,9 +212,11 @@ func (ob *queueObserver) updateFilledPct() {
 	}
 }
 
-func (nilObserver) MaxEvents(_ int)            {}
-func (nilObserver) MaxBytes(_ int)             {}
-func (nilObserver) Restore(_ int, _ int)       {}
-func (nilObserver) AddEvent(_ int)             {}
-func (nilObserver) ConsumeEvents(_ int, _ int) {}
-func (nilObserver) RemoveEvents(_ int, _ int)  {}
+func (nilObserver) MaxEvents(_ int)                             {}
+func (nilObserver) MaxBytes(_ int)                              {}
+func (nilObserver) Restore(_ int, _ int)                        {}
+func (nilObserver) AddEvent(_ int)                              {}
+func (nilObserver) ConsumeEvents(_ int, _ int)                  {}
+func (nilObserver) RemoveEvents(_ int, _ int)                   {}
+func (nilObserver) AddPriorityEvent(_ beat.Priority)            {}
+func (nilObserver) RemovePriorityEvents(_ beat.Priority, _ int) {}
@@ -18,6 +18,7 @@
 package queue
 
 import (
+	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/elastic-agent-libs/logp"
 )
 
@@ -81,6 +82,10 @@ type ProducerConfig struct {
 	// if ACK is set, the callback will be called with number of events produced
 	// by the producer instance and being ACKed by the queue.
 	ACK func(count int)
+
+	// Priority is the priority class of the producer's events. Queues that
+	// don't support priority classes ignore it.
+	Priority beat.Priority
 }
 
 type EntryID uint64
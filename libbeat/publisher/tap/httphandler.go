@@ -0,0 +1,128 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Handler returns an HTTP handler that streams the tapped events of hub.
+// The request selects the events with the query parameters stage, input_id
+// and rate. Events are streamed as NDJSON, or as server-sent events if
+// format=sse is set or the client accepts text/event-stream, until the
+// client disconnects.
+func Handler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		filter, sse, err := parseRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		subscription, err := hub.Subscribe(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+		defer subscription.Close()
+
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case record := <-subscription.Records():
+				data, err := json.Marshal(record)
+				if err != nil {
+					continue
+				}
+				if sse {
+					_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+				} else {
+					_, err = fmt.Fprintf(w, "%s\n", data)
+				}
+				if err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func parseRequest(r *http.Request) (filter Filter, sse bool, err error) {
+	query := r.URL.Query()
+	for param := range query {
+		switch param {
+		case "stage", "input_id", "rate", "format":
+		default:
+			return Filter{}, false, fmt.Errorf("unknown query param %s", param)
+		}
+	}
+
+	filter.Stage = AfterProcessors
+	if name := query.Get("stage"); name != "" {
+		if filter.Stage, err = ParseStage(name); err != nil {
+			return Filter{}, false, err
+		}
+	}
+	filter.InputID = query.Get("input_id")
+	if filter.InputID != "" && filter.Stage == Output {
+		return Filter{}, false, fmt.Errorf("input_id is not supported at the %s stage", Output)
+	}
+
+	filter.Rate = 1
+	if value := query.Get("rate"); value != "" {
+		filter.Rate, err = strconv.ParseFloat(value, 64)
+		if err != nil || filter.Rate <= 0 || filter.Rate > MaxRate {
+			return Filter{}, false, fmt.Errorf("rate must be a number of events per second between 0 and %d", MaxRate)
+		}
+	}
+
+	switch format := query.Get("format"); format {
+	case "":
+		sse = strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	case "ndjson":
+	case "sse":
+		sse = true
+	default:
+		return Filter{}, false, fmt.Errorf("unknown format %q", format)
+	}
+	return filter, sse, nil
+}
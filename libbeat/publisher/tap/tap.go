@@ -0,0 +1,220 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package tap streams samples of the events that pass through the
+// publisher pipeline to debugging clients, e.g. the /tap endpoint of the
+// HTTP API.
+package tap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Stage is a point of the pipeline events can be tapped at.
+type Stage int
+
+const (
+	// BeforeProcessors taps events as they are published by an input,
+	// before the processors run.
+	BeforeProcessors Stage = iota
+	// AfterProcessors taps events after the processors ran, when they are
+	// added to the queue.
+	AfterProcessors
+	// Output taps events when they are read from the queue by the output.
+	Output
+
+	stageCount
+)
+
+var stageNames = [stageCount]string{
+	BeforeProcessors: "before_processors",
+	AfterProcessors:  "after_processors",
+	Output:           "output",
+}
+
+func (s Stage) String() string {
+	if s < 0 || s >= stageCount {
+		return fmt.Sprintf("Stage(%d)", int(s))
+	}
+	return stageNames[s]
+}
+
+// ParseStage returns the stage with the given name.
+func ParseStage(name string) (Stage, error) {
+	for stage, stageName := range stageNames {
+		if name == stageName {
+			return Stage(stage), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stage %q", name)
+}
+
+const (
+	// MaxRate is the maximum number of events per second a subscription
+	// can receive.
+	MaxRate = 100
+	// MaxSubscriptions is the maximum number of concurrent subscriptions
+	// of a Hub.
+	MaxSubscriptions = 8
+
+	subscriptionBuffer = 64
+)
+
+// Filter selects the events of a subscription.
+type Filter struct {
+	Stage Stage
+	// InputID selects the events of an input, all inputs if empty.
+	InputID string
+	// Rate is the maximum number of events per second, events above this
+	// rate are skipped. It is capped at MaxRate.
+	Rate float64
+}
+
+// Record is a tapped event.
+type Record struct {
+	Stage   string          `json:"stage"`
+	InputID string          `json:"input_id,omitempty"`
+	Event   json.RawMessage `json:"event"`
+}
+
+// Hub distributes tapped events to the subscriptions. A nil Hub is valid
+// and never has subscriptions.
+type Hub struct {
+	// active counts the subscriptions per stage, so the pipeline can skip
+	// the tap without locking when nobody is subscribed.
+	active [stageCount]atomic.Int32
+
+	mutex         sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+// Subscription receives the tapped events that match its filter.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	limiter *rate.Limiter
+	records chan Record
+	once    sync.Once
+}
+
+// NewHub creates a Hub without subscriptions.
+func NewHub() *Hub {
+	return &Hub{subscriptions: map[*Subscription]struct{}{}}
+}
+
+// Active returns true if there is a subscription for the stage. The
+// pipeline must check it before calling Publish.
+func (h *Hub) Active(stage Stage) bool {
+	return h != nil && h.active[stage].Load() > 0
+}
+
+// Publish sends the event to the matching subscriptions that are below
+// their rate. Subscriptions that don't keep up miss events, Publish never
+// blocks.
+func (h *Hub) Publish(stage Stage, inputID string, event *beat.Event) {
+	if !h.Active(stage) {
+		return
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	var encoded json.RawMessage
+	for s := range h.subscriptions {
+		if s.filter.Stage != stage || (s.filter.InputID != "" && s.filter.InputID != inputID) {
+			continue
+		}
+		if !s.limiter.Allow() {
+			continue
+		}
+		if encoded == nil {
+			var err error
+			encoded, err = encodeEvent(event)
+			if err != nil {
+				return
+			}
+		}
+		select {
+		case s.records <- Record{Stage: stage.String(), InputID: inputID, Event: encoded}:
+		default:
+		}
+	}
+}
+
+// Subscribe creates a subscription for the events matching filter. It
+// fails if the hub already has MaxSubscriptions subscriptions. The
+// subscription must be closed when it is no longer used.
+func (h *Hub) Subscribe(filter Filter) (*Subscription, error) {
+	if filter.Stage < 0 || filter.Stage >= stageCount {
+		return nil, fmt.Errorf("invalid stage %v", filter.Stage)
+	}
+	if filter.Rate <= 0 || filter.Rate > MaxRate {
+		filter.Rate = MaxRate
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.subscriptions) >= MaxSubscriptions {
+		return nil, fmt.Errorf("too many subscriptions, at most %d are allowed", MaxSubscriptions)
+	}
+	s := &Subscription{
+		hub:     h,
+		filter:  filter,
+		limiter: rate.NewLimiter(rate.Limit(filter.Rate), 1),
+		records: make(chan Record, subscriptionBuffer),
+	}
+	h.subscriptions[s] = struct{}{}
+	h.active[filter.Stage].Add(1)
+	return s, nil
+}
+
+// Records returns the channel the tapped events are sent to.
+func (s *Subscription) Records() <-chan Record {
+	return s.records
+}
+
+// Close removes the subscription from its hub.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mutex.Lock()
+		defer s.hub.mutex.Unlock()
+		delete(s.hub.subscriptions, s)
+		s.hub.active[s.filter.Stage].Add(-1)
+	})
+}
+
+// encodeEvent encodes the event in the same layout as the console output.
+func encodeEvent(event *beat.Event) (json.RawMessage, error) {
+	doc := make(mapstr.M, len(event.Fields)+2)
+	for k, v := range event.Fields {
+		doc[k] = v
+	}
+	doc["@timestamp"] = event.Timestamp.UTC().Format(time.RFC3339Nano)
+	if len(event.Meta) > 0 {
+		doc["@metadata"] = event.Meta
+	}
+	return json.Marshal(doc)
+}
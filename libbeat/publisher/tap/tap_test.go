@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package tap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestHubActive(t *testing.T) {
+	var nilHub *Hub
+	assert.False(t, nilHub.Active(AfterProcessors))
+	nilHub.Publish(AfterProcessors, "", &beat.Event{})
+
+	hub := NewHub()
+	assert.False(t, hub.Active(Output))
+
+	s, err := hub.Subscribe(Filter{Stage: Output})
+	require.NoError(t, err)
+	assert.True(t, hub.Active(Output))
+	assert.False(t, hub.Active(BeforeProcessors))
+
+	s.Close()
+	s.Close()
+	assert.False(t, hub.Active(Output))
+}
+
+func TestHubPublish(t *testing.T) {
+	hub := NewHub()
+	s, err := hub.Subscribe(Filter{Stage: AfterProcessors, InputID: "a", Rate: 1})
+	require.NoError(t, err)
+	defer s.Close()
+
+	event := &beat.Event{
+		Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Meta:      mapstr.M{"pipeline": "p"},
+		Fields:    mapstr.M{"message": "hello"},
+	}
+	hub.Publish(BeforeProcessors, "a", event)
+	hub.Publish(AfterProcessors, "b", event)
+	hub.Publish(AfterProcessors, "a", event)
+	// Above the rate of the subscription.
+	hub.Publish(AfterProcessors, "a", event)
+
+	require.Len(t, s.Records(), 1)
+	record := <-s.Records()
+	assert.Equal(t, "after_processors", record.Stage)
+	assert.Equal(t, "a", record.InputID)
+	assert.JSONEq(t,
+		`{"@timestamp":"2024-01-01T00:00:00Z","@metadata":{"pipeline":"p"},"message":"hello"}`,
+		string(record.Event))
+}
+
+func TestHubDoesNotBlock(t *testing.T) {
+	hub := NewHub()
+	s, err := hub.Subscribe(Filter{Stage: Output})
+	require.NoError(t, err)
+	defer s.Close()
+	s.limiter.SetLimit(1e9)
+	s.limiter.SetBurst(1e9)
+
+	for i := 0; i < 2*subscriptionBuffer; i++ {
+		hub.Publish(Output, "", &beat.Event{Fields: mapstr.M{}})
+	}
+	assert.Len(t, s.Records(), subscriptionBuffer)
+}
+
+func TestHubMaxSubscriptions(t *testing.T) {
+	hub := NewHub()
+	for i := 0; i < MaxSubscriptions; i++ {
+		s, err := hub.Subscribe(Filter{Stage: Output})
+		require.NoError(t, err)
+		defer s.Close()
+	}
+	_, err := hub.Subscribe(Filter{Stage: Output})
+	assert.Error(t, err)
+}
+
+func TestHandler(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(Handler(hub))
+	defer server.Close()
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, query := range []string{
+			"stage=somewhere",
+			"rate=1000",
+			"rate=0",
+			"format=xml",
+			"stage=output&input_id=a",
+			"unknown=1",
+		} {
+			resp, err := http.Get(server.URL + "?" + query) //nolint:noctx // Safe to not use ctx in test
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+	})
+
+	for format, prefix := range map[string]string{"ndjson": "", "sse": "data: "} {
+		t.Run(format, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+				server.URL+"?stage=before_processors&input_id=a&rate=10&format="+format, nil)
+			require.NoError(t, err)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			require.Eventually(t, func() bool { return hub.Active(BeforeProcessors) }, time.Second, time.Millisecond)
+			hub.Publish(BeforeProcessors, "a", &beat.Event{Fields: mapstr.M{"message": "hello"}})
+
+			line, err := bufio.NewReader(resp.Body).ReadString('\n')
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(line, prefix), line)
+
+			var record Record
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, prefix)), &record))
+			assert.Equal(t, "before_processors", record.Stage)
+			assert.Equal(t, "a", record.InputID)
+
+			cancel()
+			assert.Eventually(t, func() bool { return !hub.Active(BeforeProcessors) }, time.Second, time.Millisecond)
+		})
+	}
+}
@@ -13,9 +13,14 @@ func XPackConfigFileParams() devtools.ConfigFileParams {
 	p := devtools.DefaultConfigFileParams()
 	p.Templates = append(p.Templates, "_meta/config/*.tmpl")
 	p.ExtraVars = map[string]interface{}{
+		"ExcludeAMQP":                true,
 		"ExcludeConsole":             false,
+		"ExcludeFanout":              true,
 		"ExcludeFileOutput":          true,
+		"ExcludeHTTPOutput":          true,
 		"ExcludeKafka":               true,
+		"ExcludeOTLP":                true,
+		"ExcludeMQTT":                true,
 		"ExcludeRedis":               true,
 		"UseDockerMetadataProcessor": false,
 	}